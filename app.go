@@ -0,0 +1,184 @@
+package goka
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lovoo/goka/kafka"
+	"github.com/lovoo/goka/multierr"
+)
+
+// App runs several processors and views of a service as one unit. The
+// processors and views share the brokers and the options given to the app.
+// When run, the app first starts the views and, once they are recovered, the
+// processors. On shutdown, the processors are stopped before the views.
+type App struct {
+	brokers    []string
+	popts      []ProcessorOption
+	vopts      []ViewOption
+	processors []*Processor
+	views      []*View
+}
+
+// AppOption defines a configuration option to be used when creating an app.
+type AppOption func(*App)
+
+// WithAppProcessorOptions defines options applied to every processor of the
+// app before the options passed to App.Processor.
+func WithAppProcessorOptions(opts ...ProcessorOption) AppOption {
+	return func(a *App) {
+		a.popts = append(a.popts, opts...)
+	}
+}
+
+// WithAppViewOptions defines options applied to every view of the app before
+// the options passed to App.View.
+func WithAppViewOptions(opts ...ViewOption) AppOption {
+	return func(a *App) {
+		a.vopts = append(a.vopts, opts...)
+	}
+}
+
+// WithAppSharedProducer lets all processors of the app share a single
+// producer created with builder instead of creating one producer each. The
+// output stats are still reported per processor.
+func WithAppSharedProducer(builder kafka.ProducerBuilder) AppOption {
+	return func(a *App) {
+		a.popts = append(a.popts, WithProducerBuilder(kafka.SharedProducerBuilder(builder)))
+	}
+}
+
+// NewApp creates an app whose processors and views connect to brokers.
+func NewApp(brokers []string, opts ...AppOption) *App {
+	a := &App{brokers: brokers}
+	for _, o := range opts {
+		o(a)
+	}
+	return a
+}
+
+// Processor creates a processor for the group graph and adds it to the app.
+// The processor must not be run directly, it is run by App.Run.
+func (a *App) Processor(gg *GroupGraph, opts ...ProcessorOption) (*Processor, error) {
+	p, err := NewProcessor(a.brokers, gg, append(append([]ProcessorOption{}, a.popts...), opts...)...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating processor %s: %v", gg.Group(), err)
+	}
+	a.processors = append(a.processors, p)
+	return p, nil
+}
+
+// View creates a view of the table and adds it to the app. The view must not
+// be run directly, it is run by App.Run.
+func (a *App) View(table Table, c Codec, opts ...ViewOption) (*View, error) {
+	v, err := NewView(a.brokers, table, c, append(append([]ViewOption{}, a.vopts...), opts...)...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating view %s: %v", table, err)
+	}
+	a.views = append(a.views, v)
+	return v, nil
+}
+
+// Run starts the views and, once they are recovered, the processors of the
+// app. Run returns when ctx is done or any processor or view fails, after all
+// processors and views have stopped.
+func (a *App) Run(ctx context.Context) error {
+	vctx, vcancel := viewContext(ctx)
+	defer vcancel()
+	verrg, vctx := multierr.NewErrGroup(vctx)
+	for _, v := range a.views {
+		v := v
+		verrg.Go(func() error {
+			if err := v.Run(vctx); err != nil {
+				return fmt.Errorf("error running view %s: %v", v.Topic(), err)
+			}
+			return nil
+		})
+	}
+
+	pctx, pcancel := context.WithCancel(ctx)
+	defer pcancel()
+	perrg, pctx := multierr.NewErrGroup(pctx)
+	perrg.Go(func() error {
+		if !a.waitViewsRecovered(pctx) {
+			return nil
+		}
+		for _, p := range a.processors {
+			p := p
+			perrg.Go(func() error {
+				if err := p.Run(pctx); err != nil {
+					return fmt.Errorf("error running processor %s: %v", p.Graph().Group(), err)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+
+	// a failing view stops the processors
+	go func() {
+		select {
+		case <-vctx.Done():
+			pcancel()
+		case <-pctx.Done():
+		}
+	}()
+
+	errs := perrg.Wait()
+	vcancel()
+	return errs.Merge(verrg.Wait()).NilOrError()
+}
+
+// viewContext derives the context of the views of an app from the context of
+// the app. It carries the values of ctx but is not canceled with ctx, so that
+// the views are only stopped after the processors.
+func viewContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithCancel(context.WithoutCancel(ctx))
+}
+
+func (a *App) waitViewsRecovered(ctx context.Context) bool {
+	for _, v := range a.views {
+		if err := v.WaitRecovered(ctx); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Recovered returns true if all processors and views of the app have
+// recovered their tables.
+func (a *App) Recovered() bool {
+	for _, v := range a.views {
+		if !v.Recovered() {
+			return false
+		}
+	}
+	for _, p := range a.processors {
+		if !p.Recovered() {
+			return false
+		}
+	}
+	return true
+}
+
+// AppStats contains the stats of the processors of an app by group and of its
+// views by table.
+type AppStats struct {
+	Processors map[Group]*ProcessorStats
+	Views      map[string]*ViewStats
+}
+
+// Stats returns a summary of the stats of all processors and views of the app.
+func (a *App) Stats() *AppStats {
+	stats := &AppStats{
+		Processors: make(map[Group]*ProcessorStats),
+		Views:      make(map[string]*ViewStats),
+	}
+	for _, p := range a.processors {
+		stats.Processors[p.Graph().Group()] = p.Stats()
+	}
+	for _, v := range a.views {
+		stats.Views[v.Topic()] = v.Stats()
+	}
+	return stats
+}
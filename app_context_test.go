@@ -0,0 +1,25 @@
+package goka
+
+import (
+	"context"
+	"testing"
+
+	"github.com/facebookgo/ensure"
+)
+
+type appTestKey struct{}
+
+func TestApp_viewContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), appTestKey{}, "value"))
+	vctx, vcancel := viewContext(ctx)
+	defer vcancel()
+
+	// the views see the values of the app context
+	ensure.DeepEqual(t, vctx.Value(appTestKey{}), "value")
+
+	// but keep running until the processors are stopped
+	cancel()
+	ensure.Nil(t, vctx.Err())
+	vcancel()
+	ensure.NotNil(t, vctx.Err())
+}
@@ -0,0 +1,47 @@
+package goka_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/facebookgo/ensure"
+	"github.com/lovoo/goka"
+	"github.com/lovoo/goka/codec"
+	"github.com/lovoo/goka/tester"
+)
+
+func TestApp_Run(t *testing.T) {
+	gkt := tester.New(t)
+	app := goka.NewApp(nil, goka.WithAppProcessorOptions(goka.WithTester(gkt)))
+
+	for _, group := range []goka.Group{"group1", "group2"} {
+		_, err := app.Processor(goka.DefineGroup(group,
+			goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {
+				ctx.SetValue(msg)
+			}),
+			goka.Persist(new(codec.String)),
+		))
+		ensure.Nil(t, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- app.Run(ctx)
+	}()
+
+	gkt.Consume("input", "key", "value")
+	ensure.DeepEqual(t, gkt.TableValue("group1-table", "key"), "value")
+	ensure.DeepEqual(t, gkt.TableValue("group2-table", "key"), "value")
+	ensure.True(t, app.Recovered())
+
+	stats := app.Stats()
+	ensure.DeepEqual(t, len(stats.Processors), 2)
+	ensure.NotNil(t, stats.Processors["group1"])
+
+	cancel()
+	err := doTimed(t, func() {
+		ensure.Nil(t, <-done)
+	})
+	ensure.Nil(t, err)
+}
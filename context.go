@@ -59,7 +59,10 @@ type Context interface {
 	// Loop subscription.
 	Loopback(key string, value interface{})
 
-	// Fail stops execution and shuts down the processor
+	// Fail stops execution and shuts down the processor. The behavior can be
+	// changed by wrapping err in a RetryableError (the callback is called
+	// again for the same message) or in a SkipMessageError (the message is
+	// committed and processing continues).
 	Fail(err error)
 
 	// Context returns the underlying context used to start the processor or a
@@ -67,7 +70,29 @@ type Context interface {
 	Context() context.Context
 }
 
-type emitter func(topic string, key string, value []byte) *kafka.Promise
+// TombstoneContext is implemented by contexts that know whether their input
+// message is a tombstone. It is not part of Context, so that existing
+// implementations of Context, eg, in tests, keep working.
+type TombstoneContext interface {
+	// IsTombstone returns whether the input message is a tombstone, ie, has a
+	// nil value or the value defined by WithTombstonePolicy, which marks the
+	// deletion of the key in CDC-style streams.
+	IsTombstone() bool
+}
+
+// IsTombstone returns whether the input message of ctx is a tombstone.
+// Tombstones are only passed to the callback if the processor is created with
+// WithNilHandling(NilProcess) or WithNilHandling(NilDecode). Messages of
+// visits (see Processor.VisitAll) and contexts not implementing
+// TombstoneContext are never tombstones.
+func IsTombstone(ctx Context) bool {
+	if tc, ok := ctx.(TombstoneContext); ok {
+		return tc.IsTombstone()
+	}
+	return false
+}
+
+type emitter func(topic string, key string, value []byte, headers kafka.Headers) *kafka.Promise
 
 type cbContext struct {
 	ctx   context.Context
@@ -76,6 +101,11 @@ type cbContext struct {
 	commit  func()
 	emitter emitter
 	failer  func(err error)
+	// reserve, if set, reserves a slot in the producer queue for a message
+	// before the message is passed to the emitter and returns the time it
+	// blocked. release frees a reserved slot of a message that is not sent.
+	reserve func() (time.Duration, error)
+	release func()
 
 	storage storage.Storage
 	pviews  map[string]*partition
@@ -85,6 +115,29 @@ type cbContext struct {
 
 	msg      *message
 	done     bool
+	released bool
+	// tombstones defines which input messages are tombstones
+	tombstones storage.TombstonePolicy
+	// failed is set if the callback called Fail, distinguishing it from
+	// other panics
+	failed bool
+	// abandoned is set if the callback exceeded its timeout. Its later table
+	// updates and emits are dropped.
+	abandoned bool
+	// om serializes the table updates and emits of the callback with its
+	// abandonment
+	om sync.Mutex
+	// buffering is set while the callback is invoked. The table updates and
+	// emits of an attempt are buffered and only applied in order once the
+	// attempt succeeded, so that retried or skipped messages neither update
+	// the table nor emit more than once. pending holds the buffered table
+	// updates, so that the attempt reads its own writes.
+	buffering bool
+	buffered  []bufferedOp
+	pending   map[string]bufferedOp
+	// acked is closed once all emits are done and the message is committed
+	// or failed, if set
+	acked    chan struct{}
 	counters struct {
 		emits  int
 		dones  int
@@ -138,9 +191,70 @@ func (ctx *cbContext) Loopback(key string, value interface{}) {
 	ctx.emit(l.Topic(), key, data)
 }
 
+// bufferedOp is a table update or an emit of an attempt to process a message.
+// Table updates have no topic.
+type bufferedOp struct {
+	topic   string
+	key     string
+	value   []byte
+	deleted bool
+}
+
+// buffer buffers op if an attempt is running and returns whether it did.
+func (ctx *cbContext) buffer(op bufferedOp) bool {
+	ctx.lockOps()
+	defer ctx.om.Unlock()
+	if !ctx.buffering {
+		return false
+	}
+	ctx.buffered = append(ctx.buffered, op)
+	if op.topic == "" {
+		if ctx.pending == nil {
+			ctx.pending = make(map[string]bufferedOp)
+		}
+		ctx.pending[op.key] = op
+	}
+	return true
+}
+
+// bufferedValue returns the value of key set or deleted by the running
+// attempt, if any.
+func (ctx *cbContext) bufferedValue(key string) ([]byte, bool) {
+	ctx.om.Lock()
+	defer ctx.om.Unlock()
+	op, ok := ctx.pending[key]
+	return op.value, ok
+}
+
 func (ctx *cbContext) emit(topic string, key string, value []byte) {
+	if ctx.buffer(bufferedOp{topic: topic, key: key, value: value}) {
+		return
+	}
+
+	reserveErr := ctx.lockEmit(topic)
+	defer ctx.om.Unlock()
+	ctx.send(topic, key, value, reserveErr)
+}
+
+// deadLetter emits the input message of a failed callback with its headers to
+// topic, even if the callback was abandoned.
+func (ctx *cbContext) deadLetter(topic string) {
+	blocked, reserveErr := ctx.reserveEmit()
+	ctx.om.Lock()
+	defer ctx.om.Unlock()
+	ctx.countBlocked(topic, blocked)
+	ctx.counters.emits++
+	ctx.produce(topic, ctx.msg.Key, ctx.msg.Data, ctx.msg.Headers, reserveErr).Then(func(err error) {
+		if err != nil {
+			err = fmt.Errorf("error emitting to %s: %v", topic, err)
+		}
+		ctx.emitDone(err)
+	})
+}
+
+func (ctx *cbContext) send(topic string, key string, value []byte, reserveErr error) {
 	ctx.counters.emits++
-	ctx.emitter(topic, key, value).Then(func(err error) {
+	ctx.produce(topic, key, value, nil, reserveErr).Then(func(err error) {
 		if err != nil {
 			err = fmt.Errorf("error emitting to %s: %v", topic, err)
 		}
@@ -196,6 +310,11 @@ func (ctx *cbContext) Partition() int32 {
 	return ctx.msg.Partition
 }
 
+func (ctx *cbContext) IsTombstone() bool {
+	// visits have no input message
+	return ctx.msg.Offset >= 0 && ctx.tombstones.IsTombstone(ctx.msg.Data)
+}
+
 func (ctx *cbContext) Join(topic Table) interface{} {
 	if ctx.pviews == nil {
 		ctx.Fail(fmt.Errorf("table %s not subscribed", topic))
@@ -239,10 +358,14 @@ func (ctx *cbContext) valueForKey(key string) (interface{}, error) {
 		return nil, fmt.Errorf("Cannot access state in stateless processor")
 	}
 
-	data, err := ctx.storage.Get(key)
-	if err != nil {
-		return nil, fmt.Errorf("error reading value: %v", err)
-	} else if data == nil {
+	data, ok := ctx.bufferedValue(key)
+	if !ok {
+		var err error
+		if data, err = ctx.storage.Get(key); err != nil {
+			return nil, fmt.Errorf("error reading value: %v", err)
+		}
+	}
+	if data == nil {
 		return nil, nil
 	}
 
@@ -257,14 +380,26 @@ func (ctx *cbContext) deleteKey(key string) error {
 	if ctx.graph.GroupTable() == nil {
 		return fmt.Errorf("Cannot access state in stateless processor")
 	}
+	if ctx.buffer(bufferedOp{key: key, deleted: true}) {
+		return nil
+	}
+	return ctx.writeDelete(key)
+}
+
+// writeDelete deletes key from the storage and the table topic.
+func (ctx *cbContext) writeDelete(key string) error {
+	table := ctx.graph.GroupTable().Topic()
+	reserveErr := ctx.lockEmit(table)
+	defer ctx.om.Unlock()
 
 	ctx.counters.stores++
 	if err := ctx.storage.Delete(key); err != nil {
+		ctx.unreserve(reserveErr)
 		return fmt.Errorf("error deleting key (%s) from storage: %v", key, err)
 	}
 
 	ctx.counters.emits++
-	ctx.emitter(ctx.graph.GroupTable().Topic(), key, nil).Then(func(err error) {
+	ctx.produce(table, key, nil, nil, reserveErr).Then(func(err error) {
 		ctx.emitDone(err)
 	})
 
@@ -285,15 +420,27 @@ func (ctx *cbContext) setValueForKey(key string, value interface{}) error {
 	if err != nil {
 		return fmt.Errorf("error encoding value: %v", err)
 	}
+	if ctx.buffer(bufferedOp{key: key, value: encodedValue}) {
+		return nil
+	}
+	return ctx.writeValue(key, encodedValue)
+}
+
+// writeValue writes the encoded value of key to the storage and the table
+// topic.
+func (ctx *cbContext) writeValue(key string, encodedValue []byte) error {
+	table := ctx.graph.GroupTable().Topic()
+	reserveErr := ctx.lockEmit(table)
+	defer ctx.om.Unlock()
 
 	ctx.counters.stores++
-	if err = ctx.storage.Set(key, encodedValue); err != nil {
+	if err := ctx.storage.Set(key, encodedValue); err != nil {
+		ctx.unreserve(reserveErr)
 		return fmt.Errorf("error storing value: %v", err)
 	}
 
-	table := ctx.graph.GroupTable().Topic()
 	ctx.counters.emits++
-	ctx.emitter(table, key, encodedValue).Then(func(err error) {
+	ctx.produce(table, key, encodedValue, nil, reserveErr).Then(func(err error) {
 		ctx.emitDone(err)
 	})
 
@@ -332,6 +479,12 @@ func (ctx *cbContext) tryCommit(err error) {
 		_ = ctx.errors.Collect(err)
 	}
 
+	// context already committed or failed, eg, a timed out callback that is
+	// still emitting in the background.
+	if ctx.released {
+		return
+	}
+
 	// not all calls are done yet, do not send the ack upstream.
 	if !ctx.done || ctx.counters.emits > ctx.counters.dones {
 		return
@@ -345,11 +498,136 @@ func (ctx *cbContext) tryCommit(err error) {
 	}
 
 	// no further callback will be called from this context
+	ctx.released = true
+	if ctx.acked != nil {
+		close(ctx.acked)
+	}
 	ctx.wg.Done()
 }
 
+// lockOps locks the context for a table update or emit. If the callback was
+// abandoned, it is stopped instead.
+func (ctx *cbContext) lockOps() {
+	ctx.om.Lock()
+	if ctx.abandoned {
+		ctx.om.Unlock()
+		panic(errAbandoned)
+	}
+}
+
+// lockEmit reserves a slot in the producer queue for a message to topic and
+// locks the context like lockOps. The slot is reserved before locking, so that
+// a callback blocked on a full producer queue does not delay its abandonment.
+// The error of the reservation is returned to fail the message in produce.
+func (ctx *cbContext) lockEmit(topic string) error {
+	blocked, reserveErr := ctx.reserveEmit()
+	ctx.om.Lock()
+	if ctx.abandoned {
+		ctx.om.Unlock()
+		ctx.unreserve(reserveErr)
+		panic(errAbandoned)
+	}
+	ctx.countBlocked(topic, blocked)
+	return reserveErr
+}
+
+func (ctx *cbContext) reserveEmit() (time.Duration, error) {
+	if ctx.reserve == nil {
+		return 0, nil
+	}
+	return ctx.reserve()
+}
+
+// countBlocked counts an emit to topic that blocked on the producer queue.
+// The context must be locked, so that the stats of abandoned callbacks are
+// not written while the partition reads them.
+func (ctx *cbContext) countBlocked(topic string, blocked time.Duration) {
+	if blocked <= 0 {
+		return
+	}
+	s := ctx.pstats.Output[topic]
+	s.Blocked++
+	s.BlockedTime += blocked
+	ctx.pstats.Output[topic] = s
+}
+
+// unreserve frees the slot reserved for a message that is not sent.
+func (ctx *cbContext) unreserve(reserveErr error) {
+	if reserveErr == nil && ctx.release != nil {
+		ctx.release()
+	}
+}
+
+// produce passes a message to the emitter or fails it with the error of its
+// reservation.
+func (ctx *cbContext) produce(topic string, key string, value []byte, headers kafka.Headers, reserveErr error) *kafka.Promise {
+	if reserveErr != nil {
+		return kafka.NewPromise().Finish(reserveErr)
+	}
+	return ctx.emitter(topic, key, value, headers)
+}
+
+// abandon drops all further table updates and emits of a timed out callback.
+// It waits for an update or emit in progress to finish.
+func (ctx *cbContext) abandon() {
+	ctx.om.Lock()
+	defer ctx.om.Unlock()
+	ctx.abandoned = true
+}
+
+// resetAttempt resets the state of a previous attempt to process the message
+// and drops its buffered table updates and emits.
+func (ctx *cbContext) resetAttempt() {
+	ctx.om.Lock()
+	defer ctx.om.Unlock()
+	ctx.failed = false
+	ctx.buffering = true
+	ctx.buffered = nil
+	ctx.pending = nil
+}
+
+// flushAttempt stops buffering and applies the table updates and emits of the
+// last attempt in order if it succeeded or drops them otherwise.
+func (ctx *cbContext) flushAttempt(succeeded bool) error {
+	ctx.om.Lock()
+	buffered := ctx.buffered
+	ctx.buffering = false
+	ctx.buffered = nil
+	ctx.pending = nil
+	ctx.om.Unlock()
+
+	if !succeeded {
+		return nil
+	}
+	for _, op := range buffered {
+		var err error
+		switch {
+		case op.topic != "":
+			ctx.emit(op.topic, op.key, op.value)
+		case op.deleted:
+			err = ctx.writeDelete(op.key)
+		default:
+			err = ctx.writeValue(op.key, op.value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasFailed returns whether the callback called Fail.
+func (ctx *cbContext) hasFailed() bool {
+	ctx.om.Lock()
+	defer ctx.om.Unlock()
+	return ctx.failed
+}
+
 // Fail stops execution and shuts down the processor
 func (ctx *cbContext) Fail(err error) {
+	ctx.lockOps()
+	ctx.failed = true
+	ctx.om.Unlock()
 	panic(err)
 }
 
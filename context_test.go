@@ -13,13 +13,14 @@ import (
 	"github.com/lovoo/goka/kafka"
 	"github.com/lovoo/goka/logger"
 	"github.com/lovoo/goka/mock"
+	"github.com/lovoo/goka/storage"
 
 	"github.com/facebookgo/ensure"
 	"github.com/golang/mock/gomock"
 )
 
 func newEmitter(err error, done func(err error)) emitter {
-	return func(topic string, key string, value []byte) *kafka.Promise {
+	return func(topic string, key string, value []byte, headers kafka.Headers) *kafka.Promise {
 		p := kafka.NewPromise()
 		if done != nil {
 			p.Then(done)
@@ -29,7 +30,7 @@ func newEmitter(err error, done func(err error)) emitter {
 }
 
 func newEmitterW(wg *sync.WaitGroup, err error, done func(err error)) emitter {
-	return func(topic string, key string, value []byte) *kafka.Promise {
+	return func(topic string, key string, value []byte, headers kafka.Headers) *kafka.Promise {
 		wg.Add(1)
 		p := kafka.NewPromise()
 		if done != nil {
@@ -81,6 +82,43 @@ func TestContext_Timestamp(t *testing.T) {
 	ensure.DeepEqual(t, ctx.Timestamp(), ts)
 }
 
+func TestContext_Position(t *testing.T) {
+	ctx := &cbContext{
+		msg: &message{
+			Topic:     "some-topic",
+			Key:       "key",
+			Partition: 3,
+			Offset:    42,
+		},
+	}
+
+	ensure.DeepEqual(t, ctx.Topic(), Stream("some-topic"))
+	ensure.DeepEqual(t, ctx.Key(), "key")
+	ensure.DeepEqual(t, ctx.Partition(), int32(3))
+	ensure.DeepEqual(t, ctx.Offset(), int64(42))
+}
+
+func TestContext_IsTombstone(t *testing.T) {
+	ctx := &cbContext{msg: &message{Data: []byte("value")}}
+	ensure.False(t, IsTombstone(ctx))
+
+	ctx = &cbContext{msg: &message{Data: nil}}
+	ensure.True(t, IsTombstone(ctx))
+
+	// visits are no tombstones
+	ctx = &cbContext{msg: &message{Data: nil, Offset: -1}}
+	ensure.False(t, IsTombstone(ctx))
+
+	// the tombstones are defined by the policy of the processor
+	ctx = &cbContext{msg: &message{Data: []byte{}}, tombstones: storage.TombstoneEmpty}
+	ensure.True(t, IsTombstone(ctx))
+	ctx = &cbContext{msg: &message{Data: nil}, tombstones: storage.TombstoneNever}
+	ensure.False(t, IsTombstone(ctx))
+
+	// other contexts are no tombstones
+	ensure.False(t, IsTombstone(nil))
+}
+
 func TestContext_EmitError(t *testing.T) {
 	ack := 0
 	emitted := 0
@@ -293,7 +331,7 @@ func TestContext_GetSetStateful(t *testing.T) {
 		graph:   graph,
 		msg:     &message{Key: key, Offset: offset},
 		storage: storage,
-		emitter: func(tp string, k string, v []byte) *kafka.Promise {
+		emitter: func(tp string, k string, v []byte, h kafka.Headers) *kafka.Promise {
 			wg.Add(1)
 			ensure.DeepEqual(t, tp, graph.GroupTable().Topic())
 			ensure.DeepEqual(t, string(k), key)
@@ -385,7 +423,7 @@ func TestContext_Loopback(t *testing.T) {
 		graph:  graph,
 		msg:    new(message),
 		pstats: newPartitionStats(),
-		emitter: func(tp string, k string, v []byte) *kafka.Promise {
+		emitter: func(tp string, k string, v []byte, h kafka.Headers) *kafka.Promise {
 			cnt++
 			ensure.DeepEqual(t, tp, graph.LoopStream().Topic())
 			ensure.DeepEqual(t, string(k), key)
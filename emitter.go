@@ -1,12 +1,34 @@
 package goka
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"sync"
+	"time"
 
+	"github.com/Shopify/sarama"
 	"github.com/lovoo/goka/kafka"
+	"github.com/lovoo/goka/multierr"
 )
 
+// KeyValue is a message of a batch emitted by EmitSyncBatch.
+type KeyValue struct {
+	Key   string
+	Value interface{}
+}
+
+// DeliveryReport describes the outcome of a message sent by an emitter.
+// Partition and Offset are -1 if the message was not written to Kafka or the
+// producer does not report them.
+type DeliveryReport struct {
+	Topic     string
+	Key       string
+	Partition int32
+	Offset    int64
+	Err       error
+}
+
 // Emitter emits messages into a specific Kafka topic, first encoding the message with the given codec.
 type Emitter struct {
 	codec    Codec
@@ -14,6 +36,14 @@ type Emitter struct {
 
 	topic string
 
+	limiter      *rateLimiter
+	delivered    func(report *DeliveryReport)
+	retries      int
+	retryBackoff time.Duration
+
+	m     sync.Mutex
+	stats EmitterStats
+
 	wg sync.WaitGroup
 }
 
@@ -39,40 +69,233 @@ func NewEmitter(brokers []string, topic Stream, codec Codec, options ...EmitterO
 		return nil, fmt.Errorf(errBuildProducer, err)
 	}
 
-	return &Emitter{
-		codec:    codec,
-		producer: prod,
-		topic:    string(topic),
-	}, nil
+	return newEmitterWithProducer(topic, codec, guardTransactional(prod), opts), nil
+}
+
+// newEmitterWithProducer creates an emitter sending messages with prod.
+func newEmitterWithProducer(topic Stream, codec Codec, prod kafka.Producer, opts *eoptions) *Emitter {
+	e := &Emitter{
+		codec:        codec,
+		producer:     prod,
+		topic:        string(topic),
+		delivered:    opts.delivered,
+		retries:      opts.retries,
+		retryBackoff: opts.retryBackoff,
+	}
+	if opts.rate > 0 {
+		e.limiter = newBurstRateLimiter(opts.rate, opts.burst)
+	}
+	return e
+}
+
+// limit blocks until the rate limit of the emitter allows to send a message.
+// It returns the error of ctx if ctx is done before that.
+func (e *Emitter) limit(ctx context.Context) error {
+	if e.limiter != nil && !e.limiter.wait(ctx) {
+		return ctx.Err()
+	}
+	return nil
 }
 
 // Emit sends a message for passed key using the emitter's codec.
 func (e *Emitter) Emit(key string, msg interface{}) (*kafka.Promise, error) {
-	var (
-		err  error
-		data []byte
-	)
+	data, err := e.encode(key, msg)
+	if err != nil {
+		return nil, err
+	}
+	return e.send(&kafka.ProducerMessage{Topic: e.topic, Key: key, Value: data}), nil
+}
 
-	if msg != nil {
-		data, err = e.codec.Encode(msg)
-		if err != nil {
-			return nil, fmt.Errorf("Error encoding value for key %s in topic %s: %v", key, e.topic, err)
-		}
+// encode encodes msg with the emitter's codec.
+func (e *Emitter) encode(key string, msg interface{}) ([]byte, error) {
+	if msg == nil {
+		return nil, nil
+	}
+	data, err := e.codec.Encode(msg)
+	if err != nil {
+		return nil, fmt.Errorf("Error encoding value for key %s in topic %s: %v", key, e.topic, err)
+	}
+	return data, nil
+}
+
+// EmitWithHeaders sends a message with headers for passed key using the
+// emitter's codec. Headers require Kafka 0.11 or newer, so the producer has to
+// be configured with a matching version (see WithEmitterProducerBuilder).
+func (e *Emitter) EmitWithHeaders(key string, msg interface{}, headers kafka.Headers) (*kafka.Promise, error) {
+	return e.emitMessage(&kafka.ProducerMessage{Key: key, Headers: headers}, msg)
+}
+
+// EmitWithTimestamp sends a message for passed key with the given timestamp
+// instead of the time of producing, eg, to keep the original event time when
+// replaying events.
+func (e *Emitter) EmitWithTimestamp(key string, msg interface{}, timestamp time.Time) (*kafka.Promise, error) {
+	return e.emitMessage(&kafka.ProducerMessage{Key: key, Timestamp: timestamp}, msg)
+}
+
+// EmitToPartition sends a message for passed key to the given partition,
+// bypassing the hasher of the emitter. Use it only if the caller has computed
+// the placement of the key itself, since processors expect the keys in the
+// partitions assigned by the hasher.
+func (e *Emitter) EmitToPartition(partition int32, key string, msg interface{}) (*kafka.Promise, error) {
+	return e.emitMessage(&kafka.ProducerMessage{Key: key, Partition: &partition}, msg)
+}
+
+// EmitWithoutKey sends a message without key. Messages without key are
+// distributed over the partitions round-robin, so they cannot be processed as
+// table updates of a key.
+func (e *Emitter) EmitWithoutKey(msg interface{}) (*kafka.Promise, error) {
+	return e.emitMessage(&kafka.ProducerMessage{NoKey: true}, msg)
+}
+
+// emitMessage encodes msg and sends it with the attributes of pm.
+func (e *Emitter) emitMessage(pm *kafka.ProducerMessage, msg interface{}) (*kafka.Promise, error) {
+	data, err := e.encode(pm.Key, msg)
+	if err != nil {
+		return nil, err
+	}
+	pm.Topic = e.topic
+	pm.Value = data
+	return e.send(pm), nil
+}
+
+// send sends the message, retrying failed attempts according to the retry
+// policy of the emitter.
+func (e *Emitter) send(pm *kafka.ProducerMessage) *kafka.Promise {
+	// the background context is never done
+	promise, _ := e.sendContext(context.Background(), pm)
+	return promise
+}
+
+// sendContext sends the message like send, but stops waiting for the rate
+// limit when ctx is done.
+func (e *Emitter) sendContext(ctx context.Context, pm *kafka.ProducerMessage) (*kafka.Promise, error) {
+	if err := e.limit(ctx); err != nil {
+		return nil, err
 	}
 	e.wg.Add(1)
-	return e.producer.Emit(e.topic, key, data).Then(func(err error) {
+	e.m.Lock()
+	e.stats.InFlight++
+	e.m.Unlock()
+	promise := kafka.NewPromise()
+	e.attempt(pm, promise, time.Now(), 0)
+	return promise, nil
+}
+
+// attempt sends the message and finishes the promise once the message is
+// acknowledged or no retries are left.
+func (e *Emitter) attempt(pm *kafka.ProducerMessage, promise *kafka.Promise, start time.Time, retry int) {
+	e.producer.EmitMessage(pm).ThenWithMessage(func(msg *sarama.ProducerMessage, err error) {
+		if err != nil && retry < e.retries && !isPermanent(err) {
+			// do not block the producer while backing off
+			time.AfterFunc(e.retryBackoff, func() {
+				e.attempt(pm, promise, start, retry+1)
+			})
+			return
+		}
+		if err != nil && retry > 0 {
+			err = fmt.Errorf("giving up after %d retries: %v", retry, err)
+		}
+		e.updateStats(len(pm.Value), time.Since(start), err)
+
+		if e.delivered != nil {
+			report := &DeliveryReport{Topic: pm.Topic, Key: pm.Key, Partition: -1, Offset: -1, Err: err}
+			if msg != nil && err == nil {
+				report.Partition = msg.Partition
+				report.Offset = msg.Offset
+			}
+			e.delivered(report)
+		}
+		promise.FinishWithMessage(msg, err)
 		e.wg.Done()
-	}), nil
+	})
 }
 
-// EmitSync sends a message to passed topic and key.
-func (e *Emitter) EmitSync(key string, msg interface{}) error {
+// isPermanent returns true for produce errors that resending the message
+// cannot fix, eg, messages exceeding the maximum message size.
+func isPermanent(err error) bool {
 	var (
-		err     error
-		promise *kafka.Promise
+		encodingErr sarama.PacketEncodingError
+		configErr   sarama.ConfigurationError
 	)
-	promise, err = e.Emit(key, msg)
+	switch {
+	case errors.Is(err, errNoTransaction),
+		errors.Is(err, sarama.ErrMessageSizeTooLarge),
+		errors.Is(err, sarama.ErrInvalidMessage),
+		errors.Is(err, sarama.ErrInvalidMessageSize),
+		errors.Is(err, sarama.ErrTopicAuthorizationFailed),
+		errors.As(err, &encodingErr),
+		errors.As(err, &configErr):
+		return true
+	}
+	return false
+}
 
+func (e *Emitter) updateStats(bytes int, latency time.Duration, err error) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	e.stats.InFlight--
+	if err != nil {
+		e.stats.Failed++
+		return
+	}
+	e.stats.Emitted++
+	e.stats.Bytes += bytes
+	e.stats.AckLatency += latency
+	if latency > e.stats.MaxAckLatency {
+		e.stats.MaxAckLatency = latency
+	}
+}
+
+// Stats returns a set of performance metrics of the emitter.
+func (e *Emitter) Stats() *EmitterStats {
+	e.m.Lock()
+	defer e.m.Unlock()
+	stats := e.stats
+	return &stats
+}
+
+// EmitSync sends a message to passed topic and key.
+func (e *Emitter) EmitSync(key string, msg interface{}) error {
+	return waitPromise(e.Emit(key, msg))
+}
+
+// EmitSyncContext sends a message like EmitSync, but stops waiting for the
+// rate limit or the acknowledgement when ctx is done and returns the error of
+// ctx. If ctx is done before the message is sent, the message is not sent at
+// all. Note that a message may still be written to Kafka after ctx is done.
+func (e *Emitter) EmitSyncContext(ctx context.Context, key string, msg interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	data, err := e.encode(key, msg)
+	if err != nil {
+		return err
+	}
+	promise, err := e.sendContext(ctx, &kafka.ProducerMessage{Topic: e.topic, Key: key, Value: data})
+	if err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	promise.Then(func(err error) {
+		done <- err
+	})
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// EmitSyncWithHeaders sends a message with headers to passed topic and key and
+// waits until it is acknowledged.
+func (e *Emitter) EmitSyncWithHeaders(key string, msg interface{}, headers kafka.Headers) error {
+	return waitPromise(e.EmitWithHeaders(key, msg, headers))
+}
+
+// waitPromise waits for the promise of an emit to finish.
+func waitPromise(promise *kafka.Promise, err error) error {
 	if err != nil {
 		return err
 	}
@@ -86,6 +309,92 @@ func (e *Emitter) EmitSync(key string, msg interface{}) error {
 	return err
 }
 
+// EmitSyncBatch sends all messages of the batch and waits until all of them
+// are acknowledged. The messages are sent without waiting for each other, so
+// the batch takes about one round-trip to the brokers. If some messages fail,
+// the returned error contains the errors of all failed messages. If a value
+// cannot be encoded, no message is sent.
+func (e *Emitter) EmitSyncBatch(batch []KeyValue) error {
+	data, err := e.encodeBatch(batch)
+	if err != nil {
+		return err
+	}
+
+	var (
+		errs multierr.Errors
+		wg   sync.WaitGroup
+	)
+	wg.Add(len(batch))
+	e.emitBatch(batch, data, func(key string, err error) {
+		if err != nil {
+			_ = errs.Collect(fmt.Errorf("error emitting key %s: %v", key, err))
+		}
+		wg.Done()
+	})
+	wg.Wait()
+	return errs.NilOrError()
+}
+
+// EmitBatch sends all messages of the batch. The returned promise finishes
+// once all messages are acknowledged or with the error of the first message
+// that fails. If a value cannot be encoded, no message is sent.
+func (e *Emitter) EmitBatch(batch []KeyValue) (*kafka.Promise, error) {
+	data, err := e.encodeBatch(batch)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		promise = kafka.NewPromise()
+		once    sync.Once
+		m       sync.Mutex
+		pending = len(batch)
+	)
+	if pending == 0 {
+		return promise.Finish(nil), nil
+	}
+	e.emitBatch(batch, data, func(key string, err error) {
+		m.Lock()
+		pending--
+		done := pending == 0
+		m.Unlock()
+
+		if err != nil {
+			once.Do(func() { promise.Finish(fmt.Errorf("error emitting key %s: %v", key, err)) })
+		} else if done {
+			once.Do(func() { promise.Finish(nil) })
+		}
+	})
+	return promise, nil
+}
+
+// encodeBatch encodes the values of a batch.
+func (e *Emitter) encodeBatch(batch []KeyValue) ([][]byte, error) {
+	data := make([][]byte, len(batch))
+	for i, kv := range batch {
+		if kv.Value == nil {
+			continue
+		}
+		var err error
+		data[i], err = e.codec.Encode(kv.Value)
+		if err != nil {
+			return nil, fmt.Errorf("Error encoding value for key %s in topic %s: %v", kv.Key, e.topic, err)
+		}
+	}
+	return data, nil
+}
+
+// emitBatch sends the encoded messages of a batch and calls done with the
+// result of every message.
+func (e *Emitter) emitBatch(batch []KeyValue, data [][]byte, done func(key string, err error)) {
+	for i, kv := range batch {
+		key := kv.Key
+		e.send(&kafka.ProducerMessage{Topic: e.topic, Key: key, Value: data[i]}).Then(func(err error) {
+			done(key, err)
+		})
+	}
+}
+
 // Finish waits until the emitter is finished producing all pending messages.
 func (e *Emitter) Finish() error {
 	e.wg.Wait()
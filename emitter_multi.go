@@ -0,0 +1,192 @@
+package goka
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/lovoo/goka/kafka"
+)
+
+// MultiEmitter emits messages into several topics with a single producer. The
+// messages of every topic are encoded with the codec of the topic.
+type MultiEmitter struct {
+	producer kafka.Producer
+	emitters map[string]*Emitter
+}
+
+// NewMultiEmitter creates an emitter for the topics in codecs, which maps every
+// topic to the codec of its messages. The options apply to all topics, eg, the
+// rate limit is shared by the messages of all topics.
+func NewMultiEmitter(brokers []string, codecs map[Stream]Codec, options ...EmitterOption) (*MultiEmitter, error) {
+	if len(codecs) == 0 {
+		return nil, fmt.Errorf("multi-emitter requires at least one topic")
+	}
+
+	// apply the options in a stable order of the topics
+	topics := make([]string, 0, len(codecs))
+	for topic := range codecs {
+		topics = append(topics, string(topic))
+	}
+	sort.Strings(topics)
+
+	allOpts := make([]*eoptions, len(topics))
+	for i, topic := range topics {
+		allOpts[i] = new(eoptions)
+		if err := allOpts[i].applyOptions(Stream(topic), codecs[Stream(topic)], options...); err != nil {
+			return nil, fmt.Errorf(errApplyOptions, err)
+		}
+	}
+
+	opts := allOpts[0]
+	prod, err := opts.builders.producer(brokers, opts.clientID, opts.hasher)
+	if err != nil {
+		return nil, fmt.Errorf(errBuildProducer, err)
+	}
+	// the emitters share the transactions of the producer
+	prod = guardTransactional(prod)
+
+	me := &MultiEmitter{
+		producer: prod,
+		emitters: make(map[string]*Emitter),
+	}
+	var limiter *rateLimiter
+	for i, topic := range topics {
+		e := newEmitterWithProducer(Stream(topic), codecs[Stream(topic)], prod, allOpts[i])
+		if limiter == nil {
+			limiter = e.limiter
+		}
+		e.limiter = limiter
+		me.emitters[topic] = e
+	}
+	return me, nil
+}
+
+func (me *MultiEmitter) emitter(topic Stream) (*Emitter, error) {
+	e, ok := me.emitters[string(topic)]
+	if !ok {
+		return nil, fmt.Errorf("topic %s is not part of the multi-emitter", topic)
+	}
+	return e, nil
+}
+
+// Emit sends a message for passed key to topic using the codec of the topic.
+func (me *MultiEmitter) Emit(topic Stream, key string, msg interface{}) (*kafka.Promise, error) {
+	e, err := me.emitter(topic)
+	if err != nil {
+		return nil, err
+	}
+	return e.Emit(key, msg)
+}
+
+// EmitSync sends a message for passed key to topic and waits until it is
+// acknowledged.
+func (me *MultiEmitter) EmitSync(topic Stream, key string, msg interface{}) error {
+	return waitPromise(me.Emit(topic, key, msg))
+}
+
+// EmitWithHeaders sends a message with headers for passed key to topic (see
+// Emitter.EmitWithHeaders).
+func (me *MultiEmitter) EmitWithHeaders(topic Stream, key string, msg interface{}, headers kafka.Headers) (*kafka.Promise, error) {
+	e, err := me.emitter(topic)
+	if err != nil {
+		return nil, err
+	}
+	return e.EmitWithHeaders(key, msg, headers)
+}
+
+// EmitSyncWithHeaders sends a message with headers for passed key to topic and
+// waits until it is acknowledged.
+func (me *MultiEmitter) EmitSyncWithHeaders(topic Stream, key string, msg interface{}, headers kafka.Headers) error {
+	return waitPromise(me.EmitWithHeaders(topic, key, msg, headers))
+}
+
+// EmitToPartition sends a message for passed key to the given partition of
+// topic, bypassing the hasher (see Emitter.EmitToPartition).
+func (me *MultiEmitter) EmitToPartition(topic Stream, partition int32, key string, msg interface{}) (*kafka.Promise, error) {
+	e, err := me.emitter(topic)
+	if err != nil {
+		return nil, err
+	}
+	return e.EmitToPartition(partition, key, msg)
+}
+
+// EmitBatch sends all messages of the batch to topic (see Emitter.EmitBatch).
+func (me *MultiEmitter) EmitBatch(topic Stream, batch []KeyValue) (*kafka.Promise, error) {
+	e, err := me.emitter(topic)
+	if err != nil {
+		return nil, err
+	}
+	return e.EmitBatch(batch)
+}
+
+// EmitSyncBatch sends all messages of the batch to topic and waits until all
+// of them are acknowledged (see Emitter.EmitSyncBatch).
+func (me *MultiEmitter) EmitSyncBatch(topic Stream, batch []KeyValue) error {
+	e, err := me.emitter(topic)
+	if err != nil {
+		return err
+	}
+	return e.EmitSyncBatch(batch)
+}
+
+// Stats returns the metrics of the emitters of all topics.
+func (me *MultiEmitter) Stats() map[string]*EmitterStats {
+	stats := make(map[string]*EmitterStats)
+	for topic, e := range me.emitters {
+		stats[topic] = e.Stats()
+	}
+	return stats
+}
+
+// transactional returns the transactional producer of the multi-emitter.
+func (me *MultiEmitter) transactional() (*txnProducer, error) {
+	tp, ok := me.producer.(*txnProducer)
+	if !ok {
+		return nil, fmt.Errorf("producer %T does not support transactions", me.producer)
+	}
+	return tp, nil
+}
+
+// BeginTransaction begins a transaction spanning all topics of the
+// multi-emitter, so that the messages emitted into the topics until the
+// transaction is committed become visible atomically (see
+// Emitter.BeginTransaction).
+func (me *MultiEmitter) BeginTransaction() error {
+	tp, err := me.transactional()
+	if err != nil {
+		return err
+	}
+	return tp.begin()
+}
+
+// CommitTransaction waits until all pending messages are acknowledged and
+// commits the transaction.
+func (me *MultiEmitter) CommitTransaction() error {
+	tp, err := me.transactional()
+	if err != nil {
+		return err
+	}
+	return tp.commit(func() {
+		for _, e := range me.emitters {
+			e.wg.Wait()
+		}
+	})
+}
+
+// AbortTransaction aborts the transaction.
+func (me *MultiEmitter) AbortTransaction() error {
+	tp, err := me.transactional()
+	if err != nil {
+		return err
+	}
+	return tp.abort()
+}
+
+// Finish waits until all pending messages are produced and closes the
+// producer.
+func (me *MultiEmitter) Finish() error {
+	for _, e := range me.emitters {
+		e.wg.Wait()
+	}
+	return me.producer.Close()
+}
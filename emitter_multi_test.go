@@ -0,0 +1,114 @@
+package goka
+
+import (
+	"hash"
+	"testing"
+
+	"github.com/facebookgo/ensure"
+	"github.com/golang/mock/gomock"
+	"github.com/lovoo/goka/codec"
+	"github.com/lovoo/goka/kafka"
+	"github.com/lovoo/goka/mock"
+)
+
+func newMultiEmitterWithMock(t *testing.T, prod kafka.Producer) *MultiEmitter {
+	me, err := NewMultiEmitter(nil, map[Stream]Codec{"a": new(codec.String), "b": new(codec.Int64)},
+		WithEmitterProducerBuilder(func([]string, string, func() hash.Hash32) (kafka.Producer, error) {
+			return prod, nil
+		}),
+	)
+	ensure.Nil(t, err)
+	return me
+}
+
+func TestMultiEmitter_Emit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	producer := mock.NewMockProducer(ctrl)
+	me := newMultiEmitterWithMock(t, producer)
+
+	producer.EXPECT().EmitMessage(&kafka.ProducerMessage{Topic: "a", Key: "key", Value: []byte("value")}).Return(kafka.NewPromise().Finish(nil))
+	producer.EXPECT().EmitMessage(&kafka.ProducerMessage{Topic: "b", Key: "key", Value: []byte("42")}).Return(kafka.NewPromise().Finish(nil))
+	ensure.Nil(t, me.EmitSync("a", "key", "value"))
+	ensure.Nil(t, me.EmitSync("b", "key", int64(42)))
+
+	// topics are encoded with their codecs and must be part of the emitter
+	_, err := me.Emit("b", "key", "value")
+	ensure.NotNil(t, err)
+	_, err = me.Emit("c", "key", "value")
+	ensure.StringContains(t, err.Error(), "not part of the multi-emitter")
+
+	producer.EXPECT().Close().Return(nil)
+	ensure.Nil(t, me.Finish())
+}
+
+func TestMultiEmitter_variants(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	producer := mock.NewMockProducer(ctrl)
+	me := newMultiEmitterWithMock(t, producer)
+
+	headers := kafka.Headers{"header": []byte("value")}
+	producer.EXPECT().EmitMessage(&kafka.ProducerMessage{Topic: "a", Key: "key", Value: []byte("value"), Headers: headers}).Return(kafka.NewPromise().Finish(nil))
+	producer.EXPECT().EmitMessage(&kafka.ProducerMessage{Topic: "b", Key: "key", Value: []byte("42"), Headers: headers}).Return(kafka.NewPromise().Finish(nil))
+	ensure.Nil(t, me.EmitSyncWithHeaders("a", "key", "value", headers))
+	ensure.Nil(t, me.EmitSyncWithHeaders("b", "key", int64(42), headers))
+
+	partition := int32(3)
+	producer.EXPECT().EmitMessage(&kafka.ProducerMessage{Topic: "b", Key: "key", Value: []byte("42"), Partition: &partition}).Return(kafka.NewPromise().Finish(nil))
+	promise, err := me.EmitToPartition("b", 3, "key", int64(42))
+	ensure.Nil(t, err)
+	ensure.Nil(t, waitPromise(promise, nil))
+
+	producer.EXPECT().EmitMessage(&kafka.ProducerMessage{Topic: "a", Key: "x", Value: []byte("1")}).Return(kafka.NewPromise().Finish(nil))
+	producer.EXPECT().EmitMessage(&kafka.ProducerMessage{Topic: "a", Key: "y", Value: []byte("2")}).Return(kafka.NewPromise().Finish(nil))
+	ensure.Nil(t, me.EmitSyncBatch("a", []KeyValue{{Key: "x", Value: "1"}, {Key: "y", Value: "2"}}))
+
+	producer.EXPECT().EmitMessage(&kafka.ProducerMessage{Topic: "b", Key: "x", Value: []byte("1")}).Return(kafka.NewPromise().Finish(nil))
+	promise, err = me.EmitBatch("b", []KeyValue{{Key: "x", Value: int64(1)}})
+	ensure.Nil(t, err)
+	ensure.Nil(t, waitPromise(promise, nil))
+
+	// values are encoded with the codec of the topic
+	ensure.NotNil(t, me.EmitSyncBatch("b", []KeyValue{{Key: "x", Value: "1"}}))
+
+	// all variants reject unknown topics
+	_, err = me.EmitWithHeaders("c", "key", "value", headers)
+	ensure.NotNil(t, err)
+	_, err = me.EmitToPartition("c", 0, "key", "value")
+	ensure.NotNil(t, err)
+	_, err = me.EmitBatch("c", nil)
+	ensure.NotNil(t, err)
+	ensure.NotNil(t, me.EmitSyncBatch("c", nil))
+}
+
+func TestMultiEmitter_transaction(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	producer := mock.NewMockTransactionalProducer(ctrl)
+	me := newMultiEmitterWithMock(t, producer)
+
+	// one transaction spans all topics
+	gomock.InOrder(
+		producer.EXPECT().BeginTxn().Return(nil),
+		producer.EXPECT().EmitMessage(&kafka.ProducerMessage{Topic: "a", Key: "key", Value: []byte("value")}).Return(kafka.NewPromise().Finish(nil)),
+		producer.EXPECT().EmitMessage(&kafka.ProducerMessage{Topic: "b", Key: "key", Value: []byte("42")}).Return(kafka.NewPromise().Finish(nil)),
+		producer.EXPECT().CommitTxn().Return(nil),
+	)
+	ensure.Nil(t, me.BeginTransaction())
+	ensure.Nil(t, me.EmitSync("a", "key", "value"))
+	ensure.Nil(t, me.EmitSync("b", "key", int64(42)))
+	ensure.Nil(t, me.CommitTransaction())
+
+	// no topic emits outside of a transaction
+	ensure.DeepEqual(t, me.EmitSync("a", "key", "value"), errNoTransaction)
+	ensure.DeepEqual(t, me.EmitSync("b", "key", int64(42)), errNoTransaction)
+
+	gomock.InOrder(
+		producer.EXPECT().BeginTxn().Return(nil),
+		producer.EXPECT().AbortTxn().Return(nil),
+	)
+	ensure.Nil(t, me.BeginTransaction())
+	ensure.Nil(t, me.AbortTransaction())
+	ensure.DeepEqual(t, me.CommitTransaction(), errNoTransaction)
+}
@@ -0,0 +1,281 @@
+package goka
+
+import (
+	"context"
+	"errors"
+	"hash"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/facebookgo/ensure"
+	"github.com/golang/mock/gomock"
+	"github.com/lovoo/goka/codec"
+	"github.com/lovoo/goka/kafka"
+	"github.com/lovoo/goka/mock"
+)
+
+func newEmitterWithMock(t *testing.T, prod kafka.Producer, opts ...EmitterOption) *Emitter {
+	e, err := NewEmitter(nil, "topic", new(codec.String),
+		append([]EmitterOption{WithEmitterProducerBuilder(func([]string, string, func() hash.Hash32) (kafka.Producer, error) {
+			return prod, nil
+		})}, opts...)...,
+	)
+	ensure.Nil(t, err)
+	return e
+}
+
+func TestEmitter_transactionCommit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	producer := mock.NewMockTransactionalProducer(ctrl)
+	e := newEmitterWithMock(t, producer)
+
+	promise := kafka.NewPromise()
+	gomock.InOrder(
+		producer.EXPECT().BeginTxn().Return(nil),
+		producer.EXPECT().EmitMessage(&kafka.ProducerMessage{Topic: "topic", Key: "key", Value: []byte("value")}).Return(promise),
+		producer.EXPECT().CommitTxn().Return(nil),
+	)
+
+	ensure.Nil(t, e.BeginTransaction())
+	_, err := e.Emit("key", "value")
+	ensure.Nil(t, err)
+
+	// the commit waits for the pending message
+	done := make(chan error)
+	go func() {
+		done <- e.CommitTransaction()
+	}()
+	promise.Finish(nil)
+	ensure.Nil(t, <-done)
+
+	// only one transaction can be open at a time
+	producer.EXPECT().BeginTxn().Return(nil)
+	ensure.Nil(t, e.BeginTransaction())
+	ensure.NotNil(t, e.BeginTransaction())
+}
+
+func TestEmitter_transactionAbort(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	producer := mock.NewMockTransactionalProducer(ctrl)
+	e := newEmitterWithMock(t, producer)
+
+	gomock.InOrder(
+		producer.EXPECT().BeginTxn().Return(nil),
+		producer.EXPECT().EmitMessage(&kafka.ProducerMessage{Topic: "topic", Key: "key", Value: []byte("value")}).Return(kafka.NewPromise().Finish(nil)),
+		producer.EXPECT().AbortTxn().Return(nil),
+	)
+
+	ensure.Nil(t, e.BeginTransaction())
+	ensure.Nil(t, e.EmitSync("key", "value"))
+	ensure.Nil(t, e.AbortTransaction())
+
+	// the transaction is finished
+	ensure.DeepEqual(t, e.CommitTransaction(), errNoTransaction)
+	ensure.DeepEqual(t, e.AbortTransaction(), errNoTransaction)
+}
+
+func TestEmitter_emitAfterAbort(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	producer := mock.NewMockTransactionalProducer(ctrl)
+	e := newEmitterWithMock(t, producer)
+
+	gomock.InOrder(
+		producer.EXPECT().BeginTxn().Return(nil),
+		producer.EXPECT().AbortTxn().Return(nil),
+	)
+	ensure.Nil(t, e.BeginTransaction())
+	ensure.Nil(t, e.AbortTransaction())
+
+	// messages emitted outside of a transaction fail without reaching the
+	// producer
+	ensure.DeepEqual(t, e.EmitSync("key", "value"), errNoTransaction)
+	ensure.DeepEqual(t, e.EmitSyncWithHeaders("key", "value", nil), errNoTransaction)
+
+	// the next transaction emits again
+	gomock.InOrder(
+		producer.EXPECT().BeginTxn().Return(nil),
+		producer.EXPECT().EmitMessage(&kafka.ProducerMessage{Topic: "topic", Key: "key", Value: []byte("value")}).Return(kafka.NewPromise().Finish(nil)),
+		producer.EXPECT().CommitTxn().Return(nil),
+	)
+	ensure.Nil(t, e.BeginTransaction())
+	ensure.Nil(t, e.EmitSync("key", "value"))
+	ensure.Nil(t, e.CommitTransaction())
+}
+
+func TestEmitter_transactionNotSupported(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	e := newEmitterWithMock(t, mock.NewMockProducer(ctrl))
+
+	ensure.StringContains(t, e.BeginTransaction().Error(), "does not support transactions")
+	ensure.StringContains(t, e.CommitTransaction().Error(), "does not support transactions")
+	ensure.StringContains(t, e.AbortTransaction().Error(), "does not support transactions")
+}
+
+func TestEmitter_EmitSyncBatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	producer := mock.NewMockProducer(ctrl)
+	e := newEmitterWithMock(t, producer)
+
+	batch := []KeyValue{{Key: "a", Value: "1"}, {Key: "b", Value: "2"}, {Key: "c", Value: "3"}}
+
+	// all messages are sent
+	for _, kv := range batch {
+		producer.EXPECT().EmitMessage(&kafka.ProducerMessage{Topic: "topic", Key: kv.Key, Value: []byte(kv.Value.(string))}).Return(kafka.NewPromise().Finish(nil))
+	}
+	ensure.Nil(t, e.EmitSyncBatch(batch))
+
+	// failing messages do not stop the others
+	producer.EXPECT().EmitMessage(&kafka.ProducerMessage{Topic: "topic", Key: "a", Value: []byte("1")}).Return(kafka.NewPromise().Finish(nil))
+	producer.EXPECT().EmitMessage(&kafka.ProducerMessage{Topic: "topic", Key: "b", Value: []byte("2")}).Return(kafka.NewPromise().Finish(errors.New("some error")))
+	producer.EXPECT().EmitMessage(&kafka.ProducerMessage{Topic: "topic", Key: "c", Value: []byte("3")}).Return(kafka.NewPromise().Finish(nil))
+	err := e.EmitSyncBatch(batch)
+	ensure.StringContains(t, err.Error(), "error emitting key b: some error")
+	ensure.DeepEqual(t, e.Stats().Emitted, uint(5))
+	ensure.DeepEqual(t, e.Stats().Failed, uint(1))
+
+	// no message is sent if a value cannot be encoded
+	err = e.EmitSyncBatch([]KeyValue{{Key: "a", Value: "1"}, {Key: "b", Value: 2}})
+	ensure.StringContains(t, err.Error(), "Error encoding value for key b")
+
+	ensure.Nil(t, e.EmitSyncBatch(nil))
+}
+
+func TestEmitter_EmitWithTimestamp(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	producer := mock.NewMockProducer(ctrl)
+	e := newEmitterWithMock(t, producer)
+
+	ts := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	producer.EXPECT().EmitMessage(&kafka.ProducerMessage{Topic: "topic", Key: "key", Value: []byte("value"), Timestamp: ts}).Return(kafka.NewPromise().Finish(nil))
+	promise, err := e.EmitWithTimestamp("key", "value", ts)
+	ensure.Nil(t, err)
+	ensure.Nil(t, waitPromise(promise, nil))
+}
+
+func TestEmitter_EmitBatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	producer := mock.NewMockProducer(ctrl)
+	e := newEmitterWithMock(t, producer)
+
+	// the promise finishes once all messages are acknowledged
+	var (
+		batch    = []KeyValue{{Key: "a", Value: "1"}, {Key: "b", Value: "2"}}
+		promises = []*kafka.Promise{kafka.NewPromise(), kafka.NewPromise()}
+	)
+	for i, kv := range batch {
+		producer.EXPECT().EmitMessage(&kafka.ProducerMessage{Topic: "topic", Key: kv.Key, Value: []byte(kv.Value.(string))}).Return(promises[i])
+	}
+	promise, err := e.EmitBatch(batch)
+	ensure.Nil(t, err)
+	done := make(chan error, 1)
+	promise.Then(func(err error) { done <- err })
+	promises[1].Finish(nil)
+	select {
+	case <-done:
+		t.Fatalf("batch finished before all messages were acknowledged")
+	default:
+	}
+	promises[0].Finish(nil)
+	ensure.Nil(t, <-done)
+
+	// the promise fails with the first failing message
+	producer.EXPECT().EmitMessage(&kafka.ProducerMessage{Topic: "topic", Key: "a", Value: []byte("1")}).Return(kafka.NewPromise().Finish(errors.New("some error")))
+	producer.EXPECT().EmitMessage(&kafka.ProducerMessage{Topic: "topic", Key: "b", Value: []byte("2")}).Return(kafka.NewPromise().Finish(nil))
+	promise, err = e.EmitBatch(batch)
+	ensure.Nil(t, err)
+	err = waitPromise(promise, nil)
+	ensure.StringContains(t, err.Error(), "error emitting key a: some error")
+
+	// no message is sent if a value cannot be encoded
+	_, err = e.EmitBatch([]KeyValue{{Key: "a", Value: 1}})
+	ensure.NotNil(t, err)
+
+	promise, err = e.EmitBatch(nil)
+	ensure.Nil(t, err)
+	ensure.Nil(t, waitPromise(promise, nil))
+}
+
+func TestEmitter_rateLimit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	producer := mock.NewMockProducer(ctrl)
+	e := newEmitterWithMock(t, producer, WithEmitRateLimit(100, 2))
+
+	producer.EXPECT().EmitMessage(gomock.Any()).Return(kafka.NewPromise().Finish(nil)).Times(7)
+
+	// the burst is sent right away
+	start := time.Now()
+	ensure.Nil(t, e.EmitSync("key", "value"))
+	ensure.Nil(t, e.EmitSync("key", "value"))
+	ensure.True(t, time.Since(start) < 30*time.Millisecond, time.Since(start))
+
+	// further messages are sent every 10ms
+	start = time.Now()
+	for i := 0; i < 5; i++ {
+		ensure.Nil(t, e.EmitSync("key", "value"))
+	}
+	ensure.True(t, time.Since(start) >= 40*time.Millisecond, time.Since(start))
+}
+
+func TestEmitter_retry(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	producer := mock.NewMockProducer(ctrl)
+	e := newEmitterWithMock(t, producer, WithEmitterRetry(2, time.Millisecond))
+
+	msg := &kafka.ProducerMessage{Topic: "topic", Key: "key", Value: []byte("value")}
+
+	// transient errors are retried
+	gomock.InOrder(
+		producer.EXPECT().EmitMessage(msg).Return(kafka.NewPromise().Finish(sarama.ErrNotLeaderForPartition)),
+		producer.EXPECT().EmitMessage(msg).Return(kafka.NewPromise().Finish(nil)),
+	)
+	ensure.Nil(t, e.EmitSync("key", "value"))
+
+	// until no retries are left
+	producer.EXPECT().EmitMessage(msg).Return(kafka.NewPromise().Finish(sarama.ErrNotLeaderForPartition)).Times(3)
+	err := e.EmitSync("key", "value")
+	ensure.StringContains(t, err.Error(), "giving up after 2 retries")
+
+	// permanent errors are not retried
+	for _, perm := range []error{
+		sarama.ErrMessageSizeTooLarge,
+		sarama.PacketEncodingError{Info: "some error"},
+		errNoTransaction,
+	} {
+		producer.EXPECT().EmitMessage(msg).Return(kafka.NewPromise().Finish(perm))
+		ensure.DeepEqual(t, e.EmitSync("key", "value"), perm)
+	}
+}
+
+func TestEmitter_EmitSyncContext(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	producer := mock.NewMockProducer(ctrl)
+	e := newEmitterWithMock(t, producer, WithEmitRateLimit(1, 1))
+
+	producer.EXPECT().EmitMessage(&kafka.ProducerMessage{Topic: "topic", Key: "key", Value: []byte("value")}).Return(kafka.NewPromise().Finish(nil))
+	ensure.Nil(t, e.EmitSyncContext(context.Background(), "key", "value"))
+
+	// waiting for the rate limit stops once the context is done, the message
+	// is not sent
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	ensure.DeepEqual(t, e.EmitSyncContext(ctx, "key", "value"), context.DeadlineExceeded)
+	ensure.True(t, time.Since(start) < 500*time.Millisecond, time.Since(start))
+
+	// cancelled contexts do not send at all
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	ensure.DeepEqual(t, e.EmitSyncContext(ctx, "key", "value"), context.Canceled)
+	ensure.DeepEqual(t, e.Stats().InFlight, 0)
+}
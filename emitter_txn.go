@@ -0,0 +1,147 @@
+package goka
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/lovoo/goka/kafka"
+)
+
+// errNoTransaction is returned by transactional emitters when emitting or
+// finishing a transaction while no transaction is open.
+var errNoTransaction = errors.New("no open transaction")
+
+// txnProducer guards a transactional producer, so that messages are only sent
+// while a transaction is open. Messages emitted outside of transactions would
+// otherwise fail in the producer or, worse, become part of the next
+// transaction.
+type txnProducer struct {
+	kafka.TransactionalProducer
+
+	m    sync.RWMutex
+	open bool
+}
+
+// guardTransactional wraps prod in a txnProducer if it supports transactions.
+func guardTransactional(prod kafka.Producer) kafka.Producer {
+	if tp, ok := prod.(kafka.TransactionalProducer); ok {
+		return &txnProducer{TransactionalProducer: tp}
+	}
+	return prod
+}
+
+func (p *txnProducer) Emit(topic string, key string, value []byte) *kafka.Promise {
+	p.m.RLock()
+	defer p.m.RUnlock()
+	if !p.open {
+		return kafka.NewPromise().Finish(errNoTransaction)
+	}
+	return p.TransactionalProducer.Emit(topic, key, value)
+}
+
+func (p *txnProducer) EmitMessage(msg *kafka.ProducerMessage) *kafka.Promise {
+	p.m.RLock()
+	defer p.m.RUnlock()
+	if !p.open {
+		return kafka.NewPromise().Finish(errNoTransaction)
+	}
+	return p.TransactionalProducer.EmitMessage(msg)
+}
+
+func (p *txnProducer) begin() error {
+	p.m.Lock()
+	defer p.m.Unlock()
+	if p.open {
+		return fmt.Errorf("transaction already open")
+	}
+	if err := p.BeginTxn(); err != nil {
+		return err
+	}
+	p.open = true
+	return nil
+}
+
+// commit calls wait to wait for the pending messages of the transaction and
+// commits it. If the commit fails, the transaction stays open to be aborted.
+func (p *txnProducer) commit(wait func()) error {
+	p.m.RLock()
+	open := p.open
+	p.m.RUnlock()
+	if !open {
+		return errNoTransaction
+	}
+
+	// do not hold the lock while waiting, so that pending messages can be
+	// resent
+	wait()
+
+	p.m.Lock()
+	defer p.m.Unlock()
+	if !p.open {
+		return errNoTransaction
+	}
+	if err := p.CommitTxn(); err != nil {
+		return err
+	}
+	p.open = false
+	return nil
+}
+
+func (p *txnProducer) abort() error {
+	p.m.Lock()
+	defer p.m.Unlock()
+	if !p.open {
+		return errNoTransaction
+	}
+	if err := p.AbortTxn(); err != nil {
+		return err
+	}
+	p.open = false
+	return nil
+}
+
+// transactional returns the transactional producer of the emitter.
+func (e *Emitter) transactional() (*txnProducer, error) {
+	tp, ok := e.producer.(*txnProducer)
+	if !ok {
+		return nil, fmt.Errorf("producer %T does not support transactions", e.producer)
+	}
+	return tp, nil
+}
+
+// BeginTransaction begins a transaction. The messages emitted until the
+// transaction is committed become visible to consumers reading committed
+// messages only all at once, or never if the transaction is aborted. The
+// emitter must be created with a transactional producer, eg, with
+// WithEmitterTransactionalID. Transactional emitters only emit within
+// transactions and only one transaction can be open at a time.
+func (e *Emitter) BeginTransaction() error {
+	tp, err := e.transactional()
+	if err != nil {
+		return err
+	}
+	return tp.begin()
+}
+
+// CommitTransaction waits until all pending messages of the emitter are
+// acknowledged and commits the transaction begun by BeginTransaction.
+func (e *Emitter) CommitTransaction() error {
+	tp, err := e.transactional()
+	if err != nil {
+		return err
+	}
+	return tp.commit(e.wg.Wait)
+}
+
+// AbortTransaction aborts the transaction begun by BeginTransaction, so the
+// messages emitted in it are discarded by consumers reading committed
+// messages only. Messages emitted after the abort fail until the next
+// transaction begins.
+func (e *Emitter) AbortTransaction() error {
+	tp, err := e.transactional()
+	if err != nil {
+		return err
+	}
+	return tp.abort()
+}
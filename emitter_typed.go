@@ -0,0 +1,71 @@
+package goka
+
+import (
+	"context"
+	"time"
+
+	"github.com/lovoo/goka/kafka"
+)
+
+// TypedEmitter is an emitter whose messages have type T. Passing values of
+// another type to Emit fails at compile time instead of in the codec.
+type TypedEmitter[T any] struct {
+	emitter *Emitter
+}
+
+// NewTypedEmitter creates an emitter of messages of type T into topic. The
+// codec has to encode values of type T.
+func NewTypedEmitter[T any](brokers []string, topic Stream, codec Codec, options ...EmitterOption) (*TypedEmitter[T], error) {
+	e, err := NewEmitter(brokers, topic, codec, options...)
+	if err != nil {
+		return nil, err
+	}
+	return &TypedEmitter[T]{emitter: e}, nil
+}
+
+// Emit sends a message for passed key using the emitter's codec.
+func (e *TypedEmitter[T]) Emit(key string, msg T) (*kafka.Promise, error) {
+	return e.emitter.Emit(key, msg)
+}
+
+// EmitSync sends a message for passed key and waits until it is acknowledged.
+func (e *TypedEmitter[T]) EmitSync(key string, msg T) error {
+	return e.emitter.EmitSync(key, msg)
+}
+
+// EmitSyncContext sends a message like EmitSync, but stops waiting when ctx is
+// done (see Emitter.EmitSyncContext).
+func (e *TypedEmitter[T]) EmitSyncContext(ctx context.Context, key string, msg T) error {
+	return e.emitter.EmitSyncContext(ctx, key, msg)
+}
+
+// EmitWithHeaders sends a message with headers for passed key.
+func (e *TypedEmitter[T]) EmitWithHeaders(key string, msg T, headers kafka.Headers) (*kafka.Promise, error) {
+	return e.emitter.EmitWithHeaders(key, msg, headers)
+}
+
+// EmitWithTimestamp sends a message for passed key with the given timestamp.
+func (e *TypedEmitter[T]) EmitWithTimestamp(key string, msg T, timestamp time.Time) (*kafka.Promise, error) {
+	return e.emitter.EmitWithTimestamp(key, msg, timestamp)
+}
+
+// EmitToPartition sends a message for passed key to the given partition (see
+// Emitter.EmitToPartition).
+func (e *TypedEmitter[T]) EmitToPartition(partition int32, key string, msg T) (*kafka.Promise, error) {
+	return e.emitter.EmitToPartition(partition, key, msg)
+}
+
+// Delete sends a nil value for passed key, which deletes the key from tables.
+func (e *TypedEmitter[T]) Delete(key string) (*kafka.Promise, error) {
+	return e.emitter.Emit(key, nil)
+}
+
+// Stats returns a set of performance metrics of the emitter.
+func (e *TypedEmitter[T]) Stats() *EmitterStats {
+	return e.emitter.Stats()
+}
+
+// Finish waits until the emitter is finished producing all pending messages.
+func (e *TypedEmitter[T]) Finish() error {
+	return e.emitter.Finish()
+}
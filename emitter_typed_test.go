@@ -0,0 +1,42 @@
+package goka
+
+import (
+	"hash"
+	"testing"
+
+	"github.com/facebookgo/ensure"
+	"github.com/golang/mock/gomock"
+	"github.com/lovoo/goka/codec"
+	"github.com/lovoo/goka/kafka"
+	"github.com/lovoo/goka/mock"
+)
+
+func TestTypedEmitter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	producer := mock.NewMockProducer(ctrl)
+
+	e, err := NewTypedEmitter[int64](nil, "topic", new(codec.Int64),
+		WithEmitterProducerBuilder(func([]string, string, func() hash.Hash32) (kafka.Producer, error) {
+			return producer, nil
+		}),
+	)
+	ensure.Nil(t, err)
+
+	producer.EXPECT().EmitMessage(&kafka.ProducerMessage{Topic: "topic", Key: "key", Value: []byte("42")}).Return(kafka.NewPromise().Finish(nil))
+	ensure.Nil(t, e.EmitSync("key", 42))
+
+	headers := kafka.Headers{"header": []byte("value")}
+	producer.EXPECT().EmitMessage(&kafka.ProducerMessage{Topic: "topic", Key: "key", Value: []byte("43"), Headers: headers}).Return(kafka.NewPromise().Finish(nil))
+	promise, err := e.EmitWithHeaders("key", 43, headers)
+	ensure.Nil(t, err)
+	ensure.Nil(t, waitPromise(promise, nil))
+
+	// deleting emits a nil value
+	producer.EXPECT().EmitMessage(&kafka.ProducerMessage{Topic: "topic", Key: "key"}).Return(kafka.NewPromise().Finish(nil))
+	ensure.Nil(t, waitPromise(e.Delete("key")))
+
+	ensure.DeepEqual(t, e.Stats().Emitted, uint(3))
+	producer.EXPECT().Close().Return(nil)
+	ensure.Nil(t, e.Finish())
+}
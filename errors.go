@@ -1,7 +1,100 @@
 package goka
 
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
 var (
 	errBuildConsumer = "error creating Kafka consumer: %v"
 	errBuildProducer = "error creating Kafka producer: %v"
 	errApplyOptions  = "error applying options: %v"
+
+	// errAbandoned stops a callback that exceeded its timeout
+	errAbandoned = errors.New("callback abandoned after timeout")
 )
+
+// RetryableError marks an error passed to Context.Fail as transient. The
+// processor invokes the callback again for the same message until it succeeds
+// or the maximum number of retries is exhausted (see WithCallbackRetries).
+// The table updates and emits of an attempt are only applied, in the order
+// they were made, once the attempt succeeds. Those of failed attempts are
+// dropped, so a retried callback sees the table as it was before the message.
+type RetryableError struct {
+	Err error
+}
+
+func (e *RetryableError) Error() string {
+	return fmt.Sprintf("retryable: %v", e.Err)
+}
+
+// Unwrap returns the classified error.
+func (e *RetryableError) Unwrap() error {
+	return e.Err
+}
+
+// FatalError marks an error passed to Context.Fail as fatal. The processor
+// stops and returns the error. This is also the behavior for unclassified
+// errors.
+type FatalError struct {
+	Err error
+}
+
+func (e *FatalError) Error() string {
+	return fmt.Sprintf("fatal: %v", e.Err)
+}
+
+// Unwrap returns the classified error.
+func (e *FatalError) Unwrap() error {
+	return e.Err
+}
+
+// PanicError is the error of a panic in a callback. It contains the message
+// whose processing caused the panic. The stack of the panic is kept in Stack
+// and is not part of the error message.
+type PanicError struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	Key       string
+	Value     interface{}
+	Stack     []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic processing message for key %s from %s/%d at offset %d: %v",
+		e.Key, e.Topic, e.Partition, e.Offset, e.Value)
+}
+
+// TimeoutError is the error of a callback that exceeded the callback timeout
+// (see WithCallbackTimeout). It contains the message whose processing timed
+// out.
+type TimeoutError struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	Key       string
+	Timeout   time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("callback for key %s from %s/%d at offset %d exceeded timeout of %v",
+		e.Key, e.Topic, e.Partition, e.Offset, e.Timeout)
+}
+
+// SkipMessageError marks an error passed to Context.Fail as specific to the
+// message being processed. The processor logs the error, commits the message
+// and continues with the next one.
+type SkipMessageError struct {
+	Err error
+}
+
+func (e *SkipMessageError) Error() string {
+	return fmt.Sprintf("skipping message: %v", e.Err)
+}
+
+// Unwrap returns the classified error.
+func (e *SkipMessageError) Unwrap() error {
+	return e.Err
+}
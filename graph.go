@@ -3,12 +3,16 @@ package goka
 import (
 	"errors"
 	"fmt"
+	"reflect"
 	"strings"
+
+	"github.com/lovoo/goka/kafka"
 )
 
 var (
 	tableSuffix = "-table"
 	loopSuffix  = "-loop"
+	rekeySuffix = "-rekey"
 )
 
 // Stream is the name of an event stream topic in Kafka, ie, a topic with
@@ -38,7 +42,10 @@ type GroupGraph struct {
 	inputStreams  []Edge
 	outputStreams []Edge
 	loopStream    []Edge
+	rekeyStreams  []Edge
 	groupTable    []Edge
+	visitors      []Edge
+	branches      []Edge
 
 	codecs    map[string]Codec
 	callbacks map[string]ProcessCallback
@@ -75,6 +82,12 @@ func (gg *GroupGraph) LoopStream() Edge {
 	return nil
 }
 
+// RekeyStreams returns the intermediate stream edges of the ReKey edges of
+// the group.
+func (gg *GroupGraph) RekeyStreams() Edges {
+	return gg.rekeyStreams
+}
+
 // GroupTable returns the group table edge of the group.
 func (gg *GroupGraph) GroupTable() Edge {
 	// only 1 group table is valid
@@ -89,6 +102,17 @@ func (gg *GroupGraph) OutputStreams() Edges {
 	return gg.outputStreams
 }
 
+// partitioners returns the custom partitioners of the output streams.
+func (gg *GroupGraph) partitioners() map[string]kafka.Partitioner {
+	partitioners := make(map[string]kafka.Partitioner)
+	for _, e := range gg.outputStreams {
+		if o, ok := e.(*outputStream); ok && o.partitioner != nil {
+			partitioners[o.Topic()] = o.partitioner
+		}
+	}
+	return partitioners
+}
+
 // inputs returns all input topics (tables and streams)
 func (gg *GroupGraph) inputs() Edges {
 	return append(append(gg.inputStreams, gg.inputTables...), gg.crossTables...)
@@ -107,6 +131,15 @@ func (gg *GroupGraph) callback(topic string) ProcessCallback {
 	return gg.callbacks[topic]
 }
 
+func (gg *GroupGraph) visitor(name string) ProcessCallback {
+	for _, v := range gg.visitors {
+		if v.Topic() == name {
+			return v.(*visitor).cb
+		}
+	}
+	return nil
+}
+
 func (gg *GroupGraph) joint(topic string) bool {
 	return gg.joinCheck[topic]
 }
@@ -140,6 +173,25 @@ func DefineGroup(group Group, edges ...Edge) *GroupGraph {
 			gg.codecs[e.Topic()] = e.Codec()
 			gg.callbacks[e.Topic()] = e.cb
 			gg.loopStream = append(gg.loopStream, e)
+		case *rekeyStream:
+			e.setGroup(group)
+			gg.validateInputTopic(e.input.Topic())
+			gg.codecs[e.input.Topic()] = e.input.Codec()
+			gg.callbacks[e.input.Topic()] = e.input.cb
+			gg.inputStreams = append(gg.inputStreams, e.input)
+			gg.codecs[e.Topic()] = e.Codec()
+			gg.callbacks[e.Topic()] = e.cb
+			gg.rekeyStreams = append(gg.rekeyStreams, e)
+		case *branchStream:
+			gg.validateInputTopic(e.Topic())
+			gg.codecs[e.Topic()] = e.Codec()
+			gg.callbacks[e.Topic()] = e.cb
+			gg.inputStreams = append(gg.inputStreams, e.inputStream)
+			gg.branches = append(gg.branches, e)
+			for _, o := range e.outputs {
+				gg.codecs[o.Topic()] = o.Codec()
+				gg.outputStreams = append(gg.outputStreams, o)
+			}
 		case *outputStream:
 			gg.codecs[e.Topic()] = e.Codec()
 			gg.outputStreams = append(gg.outputStreams, e)
@@ -150,6 +202,8 @@ func DefineGroup(group Group, edges ...Edge) *GroupGraph {
 		case *crossTable:
 			gg.codecs[e.Topic()] = e.Codec()
 			gg.crossTables = append(gg.crossTables, e)
+		case *visitor:
+			gg.visitors = append(gg.visitors, e)
 		case *groupTable:
 			e.setGroup(group)
 			gg.codecs[e.Topic()] = e.Codec()
@@ -175,6 +229,8 @@ func (gg *GroupGraph) validateInputTopic(topic string) {
 // - at most one group table edge is allowed
 // - at least one input stream is required
 // - table and loopback topics cannot be used in any other edge.
+// - branches cannot route into their input and the edges of their outputs
+// must use the same codec as any other edge of the same topic.
 func (gg *GroupGraph) Validate() error {
 	if len(gg.loopStream) > 1 {
 		return errors.New("more than one loop stream in group graph")
@@ -185,6 +241,9 @@ func (gg *GroupGraph) Validate() error {
 	if len(gg.inputStreams) == 0 {
 		return errors.New("no input stream in group graph")
 	}
+	if len(gg.visitors) > 0 && len(gg.groupTable) == 0 {
+		return errors.New("visitors require a group table")
+	}
 	for _, t := range append(gg.outputStreams,
 		append(gg.inputStreams, append(gg.inputTables, gg.crossTables...)...)...) {
 		if t.Topic() == loopName(gg.Group()) {
@@ -194,6 +253,33 @@ func (gg *GroupGraph) Validate() error {
 			return errors.New("should not directly use group table")
 		}
 	}
+	return gg.validateBranches()
+}
+
+// validateBranches checks the outputs of the branches against the other edges
+// of the group graph.
+func (gg *GroupGraph) validateBranches() error {
+	var edges Edges
+	edges = append(edges, gg.outputStreams...)
+	edges = append(edges, gg.inputs()...)
+	edges = append(edges, gg.loopStream...)
+	for _, b := range gg.branches {
+		b := b.(*branchStream)
+		for topic, o := range b.outputs {
+			if string(topic) == b.Topic() {
+				return fmt.Errorf("branch %s routes into its own input", b.Topic())
+			}
+			for _, e := range edges {
+				if e.Topic() != string(topic) || e == o {
+					continue
+				}
+				if reflect.TypeOf(e.Codec()) != reflect.TypeOf(o.Codec()) {
+					return fmt.Errorf("branch %s: output %s has codec %T, but edge %v uses the same topic",
+						b.Topic(), topic, o.Codec(), e)
+				}
+			}
+		}
+	}
 	return nil
 }
 
@@ -290,6 +376,57 @@ func Inputs(topics Streams, c Codec, cb ProcessCallback) Edge {
 	return inputStreams(edges)
 }
 
+// BranchCallback is called for every message of a branch input. It returns
+// the output stream the message is emitted into. Returning an empty stream
+// drops the message.
+type BranchCallback func(ctx Context, msg interface{}) Stream
+
+type branchStream struct {
+	*inputStream
+	outputs map[Stream]Edge
+}
+
+// Branch represents an edge of an input stream whose messages are routed into
+// one of the given output edges. For every message, cb decides the output
+// stream and the message is emitted with the same key into that stream. The
+// message decoded by c is encoded again by the codec of the output edge, so
+// the outputs must be distinct Output edges with a codec of the same type as
+// c, otherwise Branch panics. The outputs are validated against the other
+// edges of the group graph by GroupGraph.Validate.
+func Branch(topic Stream, c Codec, cb BranchCallback, outputs ...Edge) Edge {
+	if len(outputs) == 0 {
+		panic(fmt.Errorf("Branch %s has no outputs", topic))
+	}
+	b := &branchStream{outputs: make(map[Stream]Edge)}
+	for _, o := range outputs {
+		if _, ok := o.(*outputStream); !ok {
+			panic(fmt.Errorf("Branch %s: %v is not an output edge", topic, o))
+		}
+		if o.Codec() == nil {
+			panic(fmt.Errorf("Branch %s: output %s has no codec", topic, o.Topic()))
+		}
+		if reflect.TypeOf(o.Codec()) != reflect.TypeOf(c) {
+			panic(fmt.Errorf("Branch %s: output %s has codec %T, but the input is decoded with %T",
+				topic, o.Topic(), o.Codec(), c))
+		}
+		if _, ok := b.outputs[Stream(o.Topic())]; ok {
+			panic(fmt.Errorf("Branch %s: output %s is declared twice", topic, o.Topic()))
+		}
+		b.outputs[Stream(o.Topic())] = o
+	}
+	b.inputStream = &inputStream{&topicDef{string(topic), c}, func(ctx Context, msg interface{}) {
+		out := cb(ctx, msg)
+		if out == "" {
+			return
+		}
+		if _, ok := b.outputs[out]; !ok {
+			ctx.Fail(fmt.Errorf("%s is not an output of branch %s", out, topic))
+		}
+		ctx.Emit(out, ctx.Key(), msg)
+	}}
+	return b
+}
+
 type loopStream inputStream
 
 // Loop represents the edge of the loopback topic of the group. The edge
@@ -304,6 +441,47 @@ func (s *loopStream) setGroup(group Group) {
 	s.topicDef.name = loopName(group)
 }
 
+type visitor struct {
+	*topicDef
+	cb ProcessCallback
+}
+
+// Visitor represents a callback that is called for every key of the group
+// table when Processor.VisitAll is called with name. The callback receives the
+// meta value passed to VisitAll as message and may use the Context as for
+// any input message, eg, to update or delete the value of the key.
+func Visitor(name string, cb ProcessCallback) Edge {
+	return &visitor{&topicDef{name: name}, cb}
+}
+
+// KeyFunc returns the new key of a message.
+type KeyFunc func(ctx Context, msg interface{}) string
+
+type rekeyStream struct {
+	*topicDef
+	input *inputStream
+	cb    ProcessCallback
+}
+
+// ReKey represents an edge that repartitions an input stream topic by another
+// key. For every message of topic, keyFn returns the new key and the message
+// is forwarded with it into the intermediate stream <group>-<topic>-rekey.
+// The messages of the intermediate stream are processed by cb, where
+// Context.Key() returns the new key. Like the loopback stream, the
+// intermediate stream is created by the processor and is copartitioned with
+// the group table.
+func ReKey(topic Stream, c Codec, keyFn KeyFunc, cb ProcessCallback) Edge {
+	r := &rekeyStream{topicDef: &topicDef{codec: c}, cb: cb}
+	r.input = &inputStream{&topicDef{string(topic), c}, func(ctx Context, msg interface{}) {
+		ctx.Emit(Stream(r.Topic()), keyFn(ctx, msg), msg)
+	}}
+	return r
+}
+
+func (s *rekeyStream) setGroup(group Group) {
+	s.topicDef.name = rekeyName(group, Stream(s.input.Topic()))
+}
+
 type inputTable struct {
 	*topicDef
 }
@@ -349,6 +527,7 @@ func (t *groupTable) setGroup(group Group) {
 
 type outputStream struct {
 	*topicDef
+	partitioner kafka.Partitioner
 }
 
 // Output represents an edge of an output stream topic. The edge
@@ -357,7 +536,17 @@ type outputStream struct {
 // graph.
 // The topic does not have to be copartitioned with the input streams.
 func Output(topic Stream, c Codec) Edge {
-	return &outputStream{&topicDef{string(topic), c}}
+	return &outputStream{topicDef: &topicDef{string(topic), c}}
+}
+
+// OutputWithPartitioner represents an edge of an output stream topic whose
+// messages are assigned to partitions by p instead of hashing their keys,
+// eg, to partition messages by region. The partitioner is only used if the
+// processor is created with the default producer builder. Producers built by
+// a builder passed with WithProducerBuilder or WithTester ignore it and
+// partition all messages alike.
+func OutputWithPartitioner(topic Stream, c Codec, p kafka.Partitioner) Edge {
+	return &outputStream{topicDef: &topicDef{string(topic), c}, partitioner: p}
 }
 
 // GroupTable returns the name of the group table of group.
@@ -369,6 +558,12 @@ func tableName(group Group) string {
 	return string(group) + tableSuffix
 }
 
+// rekeyName returns the name of the intermediate topic of group to rekey
+// topic.
+func rekeyName(group Group, topic Stream) string {
+	return string(group) + "-" + string(topic) + rekeySuffix
+}
+
 // loopName returns the name of the loop topic of group.
 func loopName(group Group) string {
 	return string(group) + loopSuffix
@@ -154,3 +154,115 @@ func TestGroupGraph_Inputs(t *testing.T) {
 	ensure.DeepEqual(t, topics.Topic(), "a,b,c")
 	ensure.True(t, strings.Contains(topics.String(), "a,b,c/*codec.String"))
 }
+
+func TestGroupGraph_Branch(t *testing.T) {
+	route := func(ctx Context, msg interface{}) Stream { return "t2" }
+	g := DefineGroup("group",
+		Branch("t1", c, route,
+			Output("t2", c),
+			Output("t3", new(codec.String)),
+		),
+	)
+	ensure.Nil(t, g.Validate())
+	ensure.DeepEqual(t, g.InputStreams().Topics(), []string{"t1"})
+	ensure.True(t, len(g.OutputStreams()) == 2)
+	ensure.DeepEqual(t, g.codec("t1"), c)
+	ensure.DeepEqual(t, g.codec("t3"), new(codec.String))
+	ensure.NotNil(t, g.callback("t1"))
+
+	// invalid outputs
+	for _, outputs := range [][]Edge{
+		nil,
+		{Input("t2", c, cb)},
+		{Output("t2", nil)},
+		{Output("t2", c), Output("t2", c)},
+		// the decoded input cannot be encoded by a codec of another type
+		{Output("t2", c), Output("t3", new(codec.Int64))},
+	} {
+		func() {
+			defer func() {
+				ensure.NotNil(t, recover())
+			}()
+			Branch("t1", c, route, outputs...)
+		}()
+	}
+
+	// branch into its own input
+	g = DefineGroup("group",
+		Branch("t1", c, route, Output("t1", c)),
+	)
+	ensure.StringContains(t, g.Validate().Error(), "routes into its own input")
+
+	// output codec differs from another edge of the same topic
+	g = DefineGroup("group",
+		Branch("t1", c, route, Output("t2", c)),
+		Output("t2", new(codec.Int64)),
+	)
+	ensure.StringContains(t, g.Validate().Error(), "output t2 has codec")
+
+	g = DefineGroup("group",
+		Branch("t1", c, route, Output("t2", c)),
+		Input("t2", new(codec.Int64), cb),
+	)
+	ensure.NotNil(t, g.Validate())
+
+	// same codec type on the same topic is fine
+	g = DefineGroup("group",
+		Branch("t1", c, route, Output("t2", c)),
+		Output("t2", c),
+	)
+	ensure.Nil(t, g.Validate())
+
+	// branch outputs must not be the group table
+	g = DefineGroup("group",
+		Branch("t1", c, route, Output(Stream(tableName("group")), c)),
+		Persist(c),
+	)
+	ensure.StringContains(t, g.Validate().Error(), "group table")
+}
+
+func TestGroupGraph_OutputWithPartitioner(t *testing.T) {
+	byRegion := func(key string, numPartitions int32) (int32, error) { return 0, nil }
+	g := DefineGroup("group",
+		Input("input", c, cb),
+		Output("output", c),
+		OutputWithPartitioner("regions", c, byRegion),
+	)
+	ensure.Nil(t, g.Validate())
+	ensure.True(t, len(g.OutputStreams()) == 2)
+
+	partitioners := g.partitioners()
+	ensure.True(t, len(partitioners) == 1)
+	ensure.NotNil(t, partitioners["regions"])
+}
+
+func TestGroupGraph_ReKey(t *testing.T) {
+	byUser := func(ctx Context, msg interface{}) string { return msg.(string) }
+	g := DefineGroup("group",
+		ReKey("clicks", c, byUser, cb),
+		Persist(c),
+	)
+	ensure.Nil(t, g.Validate())
+	ensure.DeepEqual(t, g.InputStreams().Topics(), []string{"clicks"})
+	ensure.DeepEqual(t, g.RekeyStreams().Topics(), []string{"group-clicks-rekey"})
+	ensure.DeepEqual(t, g.codec("group-clicks-rekey"), c)
+	ensure.NotNil(t, g.callback("clicks"))
+	ensure.NotNil(t, g.callback("group-clicks-rekey"))
+}
+
+func TestGroupGraph_Visitor(t *testing.T) {
+	g := DefineGroup("group",
+		Input("input", c, cb),
+		Visitor("reset", cb),
+		Persist(c),
+	)
+	ensure.Nil(t, g.Validate())
+	ensure.NotNil(t, g.visitor("reset"))
+	ensure.True(t, g.visitor("unknown") == nil)
+
+	g = DefineGroup("group",
+		Input("input", c, cb),
+		Visitor("reset", cb),
+	)
+	ensure.StringContains(t, g.Validate().Error(), "visitors require a group table")
+}
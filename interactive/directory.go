@@ -0,0 +1,114 @@
+package interactive
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	cluster "github.com/bsm/sarama-cluster"
+	"github.com/lovoo/goka"
+	"github.com/lovoo/goka/kafka"
+)
+
+// directoryMaxAge is the time after which a GroupDirectory describes the group
+// again.
+const directoryMaxAge = 10 * time.Second
+
+// WithAdvertisedAddress adds the address of the server of the instance to the
+// metadata of its consumer group members, so that GroupDirectories resolve the
+// partitions of the instance to addr. Use it with the consumer builder of the
+// processor, eg, kafka.ConsumerBuilderWithOptions.
+func WithAdvertisedAddress(addr string) kafka.ConfigOption {
+	return func(config *cluster.Config) {
+		config.Group.Member.UserData = []byte(addr)
+	}
+}
+
+// GroupDescriber describes consumer groups, eg, sarama.ClusterAdmin.
+type GroupDescriber interface {
+	DescribeConsumerGroups(groups []string) ([]*sarama.GroupDescription, error)
+}
+
+// GroupDirectory resolves the partitions of a processor group from the
+// metadata of the consumer group. The members of the group advertise the
+// addresses of their servers with WithAdvertisedAddress.
+type GroupDirectory struct {
+	admin GroupDescriber
+	group goka.Group
+	topic goka.Stream
+
+	m       sync.Mutex
+	addrs   map[int32]string
+	updated time.Time
+}
+
+// NewGroupDirectory creates a directory for the processors of group, which
+// resolves partitions by the assignment of topic, an input topic of the group.
+func NewGroupDirectory(admin GroupDescriber, group goka.Group, topic goka.Stream) *GroupDirectory {
+	return &GroupDirectory{
+		admin: admin,
+		group: group,
+		topic: topic,
+	}
+}
+
+// Lookup returns the address advertised by the member assigned to partition.
+// The group is described again if the assignment is outdated or the partition
+// is not assigned.
+func (d *GroupDirectory) Lookup(partition int32) (string, error) {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	addr, ok := d.addrs[partition]
+	if ok && time.Since(d.updated) < directoryMaxAge {
+		return addr, nil
+	}
+	if err := d.refresh(); err != nil {
+		return "", err
+	}
+	addr, ok = d.addrs[partition]
+	if !ok {
+		return "", fmt.Errorf("no instance found for partition %d", partition)
+	}
+	return addr, nil
+}
+
+// refresh describes the group and updates the addresses of the partitions.
+func (d *GroupDirectory) refresh() error {
+	groups, err := d.admin.DescribeConsumerGroups([]string{string(d.group)})
+	if err != nil {
+		return fmt.Errorf("error describing group %s: %v", d.group, err)
+	}
+	if len(groups) != 1 {
+		return fmt.Errorf("group %s not found", d.group)
+	}
+	if groups[0].Err != sarama.ErrNoError {
+		return fmt.Errorf("error describing group %s: %v", d.group, groups[0].Err)
+	}
+
+	addrs := make(map[int32]string)
+	for id, member := range groups[0].Members {
+		meta, err := member.GetMemberMetadata()
+		if err != nil {
+			return fmt.Errorf("error decoding metadata of member %s: %v", id, err)
+		}
+		if meta == nil || len(meta.UserData) == 0 {
+			// member does not serve lookups
+			continue
+		}
+		assignment, err := member.GetMemberAssignment()
+		if err != nil {
+			return fmt.Errorf("error decoding assignment of member %s: %v", id, err)
+		}
+		if assignment == nil {
+			continue
+		}
+		for _, p := range assignment.Topics[string(d.topic)] {
+			addrs[p] = string(meta.UserData)
+		}
+	}
+	d.addrs = addrs
+	d.updated = time.Now()
+	return nil
+}
@@ -0,0 +1,87 @@
+package interactive
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/facebookgo/ensure"
+
+	"github.com/lovoo/goka/kafka"
+)
+
+type describer struct {
+	groups []*sarama.GroupDescription
+	err    error
+	calls  int
+}
+
+func (d *describer) DescribeConsumerGroups(groups []string) ([]*sarama.GroupDescription, error) {
+	d.calls++
+	return d.groups, d.err
+}
+
+// encodeMember encodes the metadata and the assignment of a group member in
+// the consumer protocol.
+func encodeMember(addr string, topic string, partitions ...int32) *sarama.GroupMemberDescription {
+	putString := func(b []byte, s string) []byte {
+		b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+		return append(b, s...)
+	}
+
+	// version, topics, user data
+	meta := binary.BigEndian.AppendUint16(nil, 0)
+	meta = binary.BigEndian.AppendUint32(meta, 1)
+	meta = putString(meta, topic)
+	meta = binary.BigEndian.AppendUint32(meta, uint32(len(addr)))
+	meta = append(meta, addr...)
+
+	// version, topic partitions, user data
+	assignment := binary.BigEndian.AppendUint16(nil, 0)
+	assignment = binary.BigEndian.AppendUint32(assignment, 1)
+	assignment = putString(assignment, topic)
+	assignment = binary.BigEndian.AppendUint32(assignment, uint32(len(partitions)))
+	for _, p := range partitions {
+		assignment = binary.BigEndian.AppendUint32(assignment, uint32(p))
+	}
+	assignment = binary.BigEndian.AppendUint32(assignment, 0)
+
+	return &sarama.GroupMemberDescription{MemberMetadata: meta, MemberAssignment: assignment}
+}
+
+func TestGroupDirectory_Lookup(t *testing.T) {
+	admin := &describer{groups: []*sarama.GroupDescription{{
+		GroupId: "group",
+		Members: map[string]*sarama.GroupMemberDescription{
+			"member-0": encodeMember("host-0:8080", "input", 0, 2),
+			"member-1": encodeMember("host-1:8080", "input", 1),
+			// members without address do not serve lookups
+			"member-2": encodeMember("", "input", 3),
+		},
+	}}}
+	dir := NewGroupDirectory(admin, "group", "input")
+
+	for partition, addr := range map[int32]string{0: "host-0:8080", 1: "host-1:8080", 2: "host-0:8080"} {
+		found, err := dir.Lookup(partition)
+		ensure.Nil(t, err)
+		ensure.DeepEqual(t, found, addr)
+	}
+	// the group is described once for all assigned partitions
+	ensure.DeepEqual(t, admin.calls, 1)
+
+	// unassigned partitions describe the group again
+	_, err := dir.Lookup(3)
+	ensure.StringContains(t, err.Error(), "no instance found")
+	ensure.DeepEqual(t, admin.calls, 2)
+
+	admin.err = errors.New("some error")
+	_, err = dir.Lookup(3)
+	ensure.NotNil(t, err)
+}
+
+func TestWithAdvertisedAddress(t *testing.T) {
+	config := kafka.NewConfig()
+	WithAdvertisedAddress("host:8080")(config)
+	ensure.DeepEqual(t, config.Group.Member.UserData, []byte("host:8080"))
+}
@@ -0,0 +1,259 @@
+// Package interactive provides distributed lookups over the tables of several
+// service instances, so that a key can be queried from any instance, no matter
+// which instance holds the partition of the key.
+//
+// Every instance runs a Server exposing its local views and processors. A
+// Client computes the partition of a key with the hasher used by goka and
+// sends the lookup to the instance owning the partition as resolved by a
+// Directory:
+//
+//	srv := interactive.NewServer()
+//	srv.Register("users", view.Get, new(codec.String))
+//	go srv.Serve(listener)
+//
+//	client := interactive.NewClient(directory, numPartitions)
+//	value, found, err := client.Get(ctx, "users", "user-1", new(codec.String))
+//
+// The servers and clients communicate over gRPC with the Query service defined
+// in querypb/query.proto. With a GroupDirectory, the partitions are resolved
+// from the metadata of the consumer group of the processors, which advertise
+// the addresses of their servers with WithAdvertisedAddress.
+package interactive
+
+//go:generate protoc -I querypb --go_out=querypb --go_opt=paths=source_relative --go-grpc_out=querypb --go-grpc_opt=paths=source_relative querypb/query.proto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash"
+	"net"
+	"sync"
+
+	"github.com/lovoo/goka"
+	"github.com/lovoo/goka/interactive/querypb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+type source struct {
+	get   goka.Getter
+	codec goka.Codec
+}
+
+// Server serves lookups of the local sources of an instance.
+type Server struct {
+	m       sync.RWMutex
+	sources map[string]*source
+	grpc    *grpc.Server
+}
+
+// service implements the Query service. It is not exported to keep the methods
+// of the service out of the API of Server.
+type service struct {
+	querypb.UnimplementedQueryServer
+	srv *Server
+}
+
+// NewServer creates a server without sources. The options configure the gRPC
+// server, eg, its transport credentials.
+func NewServer(opts ...grpc.ServerOption) *Server {
+	s := &Server{
+		sources: make(map[string]*source),
+		grpc:    grpc.NewServer(opts...),
+	}
+	querypb.RegisterQueryServer(s.grpc, &service{srv: s})
+	return s
+}
+
+// Register adds a source called name to the server. get returns the values of
+// the local partitions, eg, View.Get or Processor.Get, and codec encodes them
+// for the client.
+func (s *Server) Register(name string, get goka.Getter, codec goka.Codec) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if _, exists := s.sources[name]; exists {
+		return fmt.Errorf("source with name '%s' is already registered", name)
+	}
+	s.sources[name] = &source{get: get, codec: codec}
+	return nil
+}
+
+// Serve accepts connections on the listener and serves lookups until Stop is
+// called.
+func (s *Server) Serve(l net.Listener) error {
+	return s.grpc.Serve(l)
+}
+
+// Stop stops the server after the pending lookups are served.
+func (s *Server) Stop() {
+	s.grpc.GracefulStop()
+}
+
+// Get looks up a key of a local source.
+func (s *service) Get(ctx context.Context, req *querypb.GetRequest) (*querypb.GetResponse, error) {
+	s.srv.m.RLock()
+	src, ok := s.srv.sources[req.Source]
+	s.srv.m.RUnlock()
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "source '%s' not found", req.Source)
+	}
+
+	value, err := src.get(req.Key)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "error getting key %s from %s: %v", req.Key, req.Source, err)
+	} else if value == nil {
+		return &querypb.GetResponse{}, nil
+	}
+
+	data, err := src.codec.Encode(value)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "error encoding value of key %s: %v", req.Key, err)
+	}
+	return &querypb.GetResponse{Found: true, Value: data}, nil
+}
+
+// Directory resolves the address of the server of the instance owning a
+// partition.
+type Directory interface {
+	Lookup(partition int32) (string, error)
+}
+
+// StaticDirectory is a directory with a fixed assignment of partitions to
+// server addresses.
+type StaticDirectory map[int32]string
+
+// Lookup returns the address of the partition.
+func (d StaticDirectory) Lookup(partition int32) (string, error) {
+	addr, ok := d[partition]
+	if !ok {
+		return "", fmt.Errorf("no instance found for partition %d", partition)
+	}
+	return addr, nil
+}
+
+// ClientOption defines a configuration option of a client.
+type ClientOption func(*Client)
+
+// WithClientHasher sets the hash function that assigns keys to partitions. It
+// has to match the hasher of the processors and views.
+func WithClientHasher(hasher func() hash.Hash32) ClientOption {
+	return func(c *Client) {
+		c.hasher = hasher
+	}
+}
+
+// WithClientDialOptions sets the options of the connections to the servers.
+// By default, the connections are not encrypted.
+func WithClientDialOptions(opts ...grpc.DialOption) ClientOption {
+	return func(c *Client) {
+		c.dialOpts = opts
+	}
+}
+
+// Client routes lookups to the servers of the instances owning the partitions
+// of the keys.
+type Client struct {
+	dir           Directory
+	numPartitions int32
+	hasher        func() hash.Hash32
+	dialOpts      []grpc.DialOption
+
+	m     sync.Mutex
+	conns map[string]*grpc.ClientConn
+}
+
+// NewClient creates a client for tables with numPartitions partitions.
+func NewClient(dir Directory, numPartitions int32, opts ...ClientOption) *Client {
+	c := &Client{
+		dir:           dir,
+		numPartitions: numPartitions,
+		hasher:        goka.DefaultHasher(),
+		dialOpts:      []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())},
+		conns:         make(map[string]*grpc.ClientConn),
+	}
+	for _, o := range opts {
+		o(c)
+	}
+	return c
+}
+
+// Partition returns the partition of key.
+func (c *Client) Partition(key string) (int32, error) {
+	if c.numPartitions <= 0 {
+		return -1, errors.New("no partitions found")
+	}
+	hasher := c.hasher()
+	if _, err := hasher.Write([]byte(key)); err != nil {
+		return -1, err
+	}
+	hash := int32(hasher.Sum32())
+	if hash < 0 {
+		hash = -hash
+	}
+	return hash % c.numPartitions, nil
+}
+
+// Get returns the value of key in the source of the instance owning the
+// partition of the key, decoded with codec. found is false if the key does not
+// exist.
+func (c *Client) Get(ctx context.Context, src, key string, codec goka.Codec) (value interface{}, found bool, err error) {
+	partition, err := c.Partition(key)
+	if err != nil {
+		return nil, false, err
+	}
+	addr, err := c.dir.Lookup(partition)
+	if err != nil {
+		return nil, false, err
+	}
+	conn, err := c.conn(addr)
+	if err != nil {
+		return nil, false, err
+	}
+
+	resp, err := querypb.NewQueryClient(conn).Get(ctx, &querypb.GetRequest{Source: src, Key: key})
+	if err != nil {
+		return nil, false, fmt.Errorf("error querying %s at %s: %v", key, addr, err)
+	}
+	if !resp.Found {
+		return nil, false, nil
+	}
+	value, err = codec.Decode(resp.Value)
+	if err != nil {
+		return nil, false, fmt.Errorf("error decoding value of key %s: %v", key, err)
+	}
+	return value, true, nil
+}
+
+// conn returns the connection to addr. Connections reconnect by themselves if
+// they break.
+func (c *Client) conn(addr string) (*grpc.ClientConn, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if conn, ok := c.conns[addr]; ok {
+		return conn, nil
+	}
+	conn, err := grpc.NewClient(addr, c.dialOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to %s: %v", addr, err)
+	}
+	c.conns[addr] = conn
+	return conn, nil
+}
+
+// Close closes the connections of the client.
+func (c *Client) Close() error {
+	c.m.Lock()
+	defer c.m.Unlock()
+	var err error
+	for addr, conn := range c.conns {
+		if e := conn.Close(); e != nil && err == nil {
+			err = fmt.Errorf("error closing connection to %s: %v", addr, e)
+		}
+		delete(c.conns, addr)
+	}
+	return err
+}
@@ -0,0 +1,83 @@
+package interactive
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/lovoo/goka"
+	"github.com/lovoo/goka/codec"
+
+	"github.com/facebookgo/ensure"
+)
+
+func startServer(t *testing.T, values map[string]string) (string, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	ensure.Nil(t, err)
+
+	srv := NewServer()
+	err = srv.Register("table", func(key string) (interface{}, error) {
+		if key == "failing" {
+			return nil, errors.New("some error")
+		}
+		if v, ok := values[key]; ok {
+			return v, nil
+		}
+		return nil, nil
+	}, new(codec.String))
+	ensure.Nil(t, err)
+	ensure.NotNil(t, srv.Register("table", nil, nil))
+
+	go srv.Serve(l)
+	return l.Addr().String(), srv.Stop
+}
+
+func TestClient_Get(t *testing.T) {
+	addr0, stop0 := startServer(t, map[string]string{"a": "a0", "b": "b0"})
+	defer stop0()
+	addr1, stop1 := startServer(t, map[string]string{"a": "a1", "b": "b1"})
+	defer stop1()
+
+	client := NewClient(StaticDirectory{0: addr0, 1: addr1}, 2)
+	defer client.Close()
+	ctx := context.Background()
+
+	for _, key := range []string{"a", "b"} {
+		partition, err := client.Partition(key)
+		ensure.Nil(t, err)
+
+		value, found, err := client.Get(ctx, "table", key, new(codec.String))
+		ensure.Nil(t, err)
+		ensure.True(t, found)
+		// the value is served by the instance of the partition
+		ensure.DeepEqual(t, value, key+string('0'+rune(partition)))
+	}
+
+	value, found, err := client.Get(ctx, "table", "missing", new(codec.String))
+	ensure.Nil(t, err)
+	ensure.False(t, found)
+	ensure.Nil(t, value)
+
+	_, _, err = client.Get(ctx, "table", "failing", new(codec.String))
+	ensure.NotNil(t, err)
+
+	_, _, err = client.Get(ctx, "unknown", "a", new(codec.String))
+	ensure.StringContains(t, err.Error(), "not found")
+}
+
+func TestClient_Partition(t *testing.T) {
+	client := NewClient(StaticDirectory{}, 10, WithClientHasher(goka.DefaultHasher()))
+	p1, err := client.Partition("key")
+	ensure.Nil(t, err)
+	p2, err := client.Partition("key")
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, p1, p2)
+	ensure.True(t, p1 >= 0 && p1 < 10)
+
+	_, _, err = client.Get(context.Background(), "table", "key", new(codec.String))
+	ensure.NotNil(t, err)
+
+	_, err = NewClient(StaticDirectory{}, 0).Partition("key")
+	ensure.NotNil(t, err)
+}
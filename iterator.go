@@ -16,13 +16,30 @@ type Iterator interface {
 type iterator struct {
 	iter  storage.Iterator
 	codec Codec
+
+	// value is the decoded value of the current key if decoded is true
+	value   interface{}
+	err     error
+	decoded bool
+}
+
+// NewIterator returns an Iterator over the keys of iter, whose values are
+// decoded with codec when they are accessed. Each value is decoded at most
+// once, so it is only decoded for the keys whose values are used.
+func NewIterator(iter storage.Iterator, codec Codec) Iterator {
+	return &iterator{iter: iter, codec: codec}
 }
 
 // Next advances the iterator to the next key.
 func (i *iterator) Next() bool {
+	i.reset()
 	return i.iter.Next()
 }
 
+func (i *iterator) reset() {
+	i.value, i.err, i.decoded = nil, nil, false
+}
+
 // Key returns the current key.
 func (i *iterator) Key() string {
 	return string(i.iter.Key())
@@ -30,6 +47,14 @@ func (i *iterator) Key() string {
 
 // Value returns the current value decoded by the codec of the storage.
 func (i *iterator) Value() (interface{}, error) {
+	if !i.decoded {
+		i.value, i.err = i.decode()
+		i.decoded = true
+	}
+	return i.value, i.err
+}
+
+func (i *iterator) decode() (interface{}, error) {
 	data, err := i.iter.Value()
 	if err != nil {
 		return nil, err
@@ -45,5 +70,27 @@ func (i *iterator) Release() {
 }
 
 func (i *iterator) Seek(key string) bool {
+	i.reset()
 	return i.iter.Seek([]byte(key))
 }
+
+// fromIterator skips the keys of a sorted iterator that are less than start.
+type fromIterator struct {
+	Iterator
+	start   string
+	started bool
+}
+
+// Next advances the iterator to the next key not less than start.
+func (i *fromIterator) Next() bool {
+	if i.started {
+		return i.Iterator.Next()
+	}
+	i.started = true
+	for i.Iterator.Next() {
+		if i.Iterator.Key() >= i.start {
+			return true
+		}
+	}
+	return false
+}
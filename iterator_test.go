@@ -61,3 +61,41 @@ func TestIterator(t *testing.T) {
 	}
 	ensure.DeepEqual(t, count, len(kv))
 }
+
+type countingCodec struct {
+	codec.String
+	decoded int
+}
+
+func (c *countingCodec) Decode(data []byte) (interface{}, error) {
+	c.decoded++
+	return c.String.Decode(data)
+}
+
+func TestIterator_lazyDecode(t *testing.T) {
+	st := storage.NewMemory()
+	for _, k := range []string{"key-1", "key-2", "key-3"} {
+		ensure.Nil(t, st.Set(k, []byte("val")))
+	}
+	iter, err := st.Iterator()
+	ensure.Nil(t, err)
+
+	c := new(countingCodec)
+	it := NewIterator(iter, c)
+	defer it.Release()
+
+	// values are decoded once and only when accessed
+	ensure.True(t, it.Next())
+	ensure.True(t, it.Next())
+	for i := 0; i < 2; i++ {
+		val, err := it.Value()
+		ensure.Nil(t, err)
+		ensure.DeepEqual(t, val, "val")
+	}
+	ensure.DeepEqual(t, c.decoded, 1)
+
+	ensure.True(t, it.Next())
+	_, err = it.Value()
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, c.decoded, 2)
+}
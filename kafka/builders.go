@@ -25,6 +25,12 @@ func ConsumerBuilderWithConfig(config *cluster.Config) ConsumerBuilder {
 	}
 }
 
+// ConsumerBuilderWithOptions creates a Kafka consumer using the Sarama library
+// with the default configuration modified by opts, eg, WithFetch.
+func ConsumerBuilderWithOptions(opts ...ConfigOption) ConsumerBuilder {
+	return ConsumerBuilderWithConfig(NewConfigWithOptions(opts...))
+}
+
 // ProducerBuilder create a Kafka producer.
 type ProducerBuilder func(brokers []string, clientID string, hasher func() hash.Hash32) (Producer, error)
 
@@ -45,6 +51,17 @@ func ProducerBuilderWithConfig(config *cluster.Config) ProducerBuilder {
 	}
 }
 
+// ProducerBuilderWithPartitioners creates a Kafka producer using the Sarama
+// library. Messages of the topics in partitioners are assigned to partitions
+// with the respective Partitioner, all other messages by hashing their keys.
+func ProducerBuilderWithPartitioners(config *cluster.Config, partitioners map[string]Partitioner) ProducerBuilder {
+	return func(brokers []string, clientID string, hasher func() hash.Hash32) (Producer, error) {
+		config.ClientID = clientID
+		config.Producer.Partitioner = NewPartitionerConstructor(hasher, partitioners)
+		return NewProducer(brokers, &config.Config)
+	}
+}
+
 // TopicManagerBuilder creates a TopicManager to check partition counts and
 // create tables.
 type TopicManagerBuilder func(brokers []string) (TopicManager, error)
@@ -63,6 +80,26 @@ func TopicManagerBuilderWithConfig(config *cluster.Config) TopicManagerBuilder {
 	}
 }
 
+// AdminTopicManagerBuilder creates a TopicManager using the admin API of the
+// brokers, which creates tables and streams as configured in tmConfig.
+func AdminTopicManagerBuilder(tmConfig *TopicManagerConfig) TopicManagerBuilder {
+	return func(brokers []string) (TopicManager, error) {
+		config := NewConfig()
+		if !config.Version.IsAtLeast(sarama.V0_11_0_0) {
+			config.Version = sarama.V0_11_0_0
+		}
+		return NewAdminTopicManager(brokers, &config.Config, tmConfig)
+	}
+}
+
+// AdminTopicManagerBuilderWithConfig creates a TopicManager using the admin
+// API of the brokers. config.Version has to be at least V0_11_0_0.
+func AdminTopicManagerBuilderWithConfig(config *cluster.Config, tmConfig *TopicManagerConfig) TopicManagerBuilder {
+	return func(brokers []string) (TopicManager, error) {
+		return NewAdminTopicManager(brokers, &config.Config, tmConfig)
+	}
+}
+
 // ZKTopicManagerBuilder creates a TopicManager that connects with ZooKeeper to
 // check partition counts and create tables.
 func ZKTopicManagerBuilder(servers []string) TopicManagerBuilder {
@@ -1,6 +1,8 @@
 package kafka
 
 import (
+	"time"
+
 	"github.com/Shopify/sarama"
 	cluster "github.com/bsm/sarama-cluster"
 )
@@ -31,3 +33,79 @@ func NewConfig() *cluster.Config {
 
 	return config
 }
+
+// FetchOptions tune the fetch requests of the consumers. Larger fetches
+// increase the throughput of recovering tables at the cost of memory. Zero
+// values keep the defaults of sarama.
+type FetchOptions struct {
+	// MinBytes is the minimum number of bytes a broker returns per fetch
+	// (fetch.min.bytes).
+	MinBytes int32
+	// MaxWait is the time a broker waits for MinBytes (fetch.max.wait.ms).
+	MaxWait time.Duration
+	// MaxPartitionBytes is the number of bytes fetched per partition and
+	// request (max.partition.fetch.bytes).
+	MaxPartitionBytes int32
+	// ChannelBufferSize is the number of messages buffered per partition by
+	// the consumers and producers.
+	ChannelBufferSize int
+}
+
+// WithFetch configures the fetch requests of the consumers.
+func WithFetch(fetch FetchOptions) ConfigOption {
+	return func(config *cluster.Config) {
+		if fetch.MinBytes > 0 {
+			config.Consumer.Fetch.Min = fetch.MinBytes
+		}
+		if fetch.MaxWait > 0 {
+			config.Consumer.MaxWaitTime = fetch.MaxWait
+		}
+		if fetch.MaxPartitionBytes > 0 {
+			config.Consumer.Fetch.Default = fetch.MaxPartitionBytes
+		}
+		if fetch.ChannelBufferSize > 0 {
+			config.ChannelBufferSize = fetch.ChannelBufferSize
+		}
+	}
+}
+
+// WithIdempotentProducer makes the producers idempotent, so that retries of
+// the producer do not write duplicates. Idempotence requires Kafka 0.11 and
+// acknowledgements of all in-sync replicas, and sarama supports it with a
+// single request in flight per broker only.
+func WithIdempotentProducer() ConfigOption {
+	return func(config *cluster.Config) {
+		config.Producer.Idempotent = true
+		config.Producer.RequiredAcks = sarama.WaitForAll
+		config.Net.MaxOpenRequests = 1
+		if config.Producer.Retry.Max == 0 {
+			config.Producer.Retry.Max = defaultProducerMaxRetries
+		}
+		if !config.Version.IsAtLeast(sarama.V0_11_0_0) {
+			config.Version = sarama.V0_11_0_0
+		}
+	}
+}
+
+// WithCompression makes the producers compress messages with codec, eg,
+// sarama.CompressionLZ4. By default, messages are compressed with snappy.
+// Compressing with zstd requires Kafka 2.1 or later.
+func WithCompression(codec sarama.CompressionCodec) ConfigOption {
+	return func(config *cluster.Config) {
+		config.Producer.Compression = codec
+		if codec == sarama.CompressionZSTD && !config.Version.IsAtLeast(sarama.V2_1_0_0) {
+			config.Version = sarama.V2_1_0_0
+		}
+	}
+}
+
+// WithTransactionalID makes the producers transactional with the given
+// transactional ID (see NewTransactionalProducer). Producers with the same ID
+// fence each other, so each producer instance needs its own ID, eg, derived
+// from the group and partition.
+func WithTransactionalID(id string) ConfigOption {
+	return func(config *cluster.Config) {
+		WithIdempotentProducer()(config)
+		config.Producer.Transaction.ID = id
+	}
+}
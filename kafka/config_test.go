@@ -0,0 +1,49 @@
+package kafka
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/facebookgo/ensure"
+)
+
+func TestConfigOptions_fetch(t *testing.T) {
+	defaults := NewConfig()
+	config := NewConfigWithOptions(WithFetch(FetchOptions{
+		MinBytes:          1 << 20,
+		MaxWait:           time.Second,
+		ChannelBufferSize: 1024,
+	}))
+	ensure.DeepEqual(t, config.Consumer.Fetch.Min, int32(1<<20))
+	ensure.DeepEqual(t, config.Consumer.MaxWaitTime, time.Second)
+	ensure.DeepEqual(t, config.Consumer.Fetch.Default, defaults.Consumer.Fetch.Default)
+	ensure.DeepEqual(t, config.ChannelBufferSize, 1024)
+}
+
+func TestConfigOptions_idempotent(t *testing.T) {
+	config := NewConfigWithOptions(WithIdempotentProducer())
+	ensure.True(t, config.Producer.Idempotent)
+	ensure.DeepEqual(t, config.Producer.RequiredAcks, sarama.WaitForAll)
+	ensure.DeepEqual(t, config.Net.MaxOpenRequests, 1)
+	ensure.True(t, config.Producer.Retry.Max > 0)
+}
+
+func TestConfigOptions_transactional(t *testing.T) {
+	config := NewConfigWithOptions(WithTransactionalID("group-0"))
+	ensure.DeepEqual(t, config.Producer.Transaction.ID, "group-0")
+	ensure.True(t, config.Producer.Idempotent)
+
+	_, err := NewTransactionalProducer(nil, &NewConfig().Config)
+	ensure.StringContains(t, err.Error(), "requires a transactional ID")
+}
+
+func TestConfigOptions_compression(t *testing.T) {
+	config := NewConfigWithOptions(WithCompression(sarama.CompressionLZ4))
+	ensure.DeepEqual(t, config.Producer.Compression, sarama.CompressionLZ4)
+	ensure.DeepEqual(t, config.Version, NewConfig().Version)
+
+	// zstd requires Kafka 2.1
+	config = NewConfigWithOptions(WithCompression(sarama.CompressionZSTD))
+	ensure.True(t, config.Version.IsAtLeast(sarama.V2_1_0_0))
+}
@@ -1,3 +1,4 @@
+//go:build confluent
 // +build confluent
 
 package confluent
@@ -8,7 +9,6 @@ import (
 	"strings"
 
 	rdkafka "github.com/confluentinc/confluent-kafka-go/kafka"
-	"github.com/lovoo/goka"
 	"github.com/lovoo/goka/kafka"
 )
 
@@ -23,12 +23,13 @@ type confluent struct {
 	streamPartitions map[int32][]rdkafka.TopicPartition
 	partitionMap     map[int32]bool
 
-	consumer    confluentConsumer
-	events      chan kafka.Event
-	groupTopics map[string]int64
-	cmds        chan interface{}
-	stop        chan bool
-	done        chan bool
+	consumer     confluentConsumer
+	refreshToken func(config string) (rdkafka.OAuthBearerToken, error)
+	events       chan kafka.Event
+	groupTopics  map[string]int64
+	cmds         chan interface{}
+	stop         chan bool
+	done         chan bool
 }
 
 type addPartition struct {
@@ -46,26 +47,50 @@ type addGroupPartition struct {
 	partition int32
 }
 
+// Config configures the confluent consumers.
+type Config struct {
+	// ChannelSize is the size of the events channel of librdkafka.
+	ChannelSize int
+	// ConfigMap is merged into the configuration of the consumers, eg, to
+	// set "client.rack" or the security settings of librdkafka.
+	ConfigMap rdkafka.ConfigMap
+	// RefreshToken returns a new token if librdkafka requests one for
+	// SASL/OAUTHBEARER with the "sasl.oauthbearer.config" of the ConfigMap.
+	RefreshToken func(config string) (rdkafka.OAuthBearerToken, error)
+}
+
+// NewConsumer creates a confluent consumer with channel size bufsize.
 func NewConsumer(brokers []string, group string, bufsize int) (kafka.Consumer, error) {
-	consumer, err := rdkafka.NewConsumer(
-		&rdkafka.ConfigMap{
-			"bootstrap.servers":  strings.Join(brokers, ","),
-			"group.id":           group,
-			"session.timeout.ms": 6000,
-			// TODO(diogo): implement Commit()
-			//"enable.auto.commit":              false,
-			"go.events.channel.size":          bufsize,
-			"go.events.channel.enable":        true,
-			"go.application.rebalance.enable": true,
-			"default.topic.config":            rdkafka.ConfigMap{"auto.offset.reset": "earliest"},
-		},
-	)
+	return NewConsumerWithConfig(brokers, group, "", Config{ChannelSize: bufsize})
+}
+
+// NewConsumerWithConfig creates a confluent consumer configured by config.
+func NewConsumerWithConfig(brokers []string, group, clientID string, config Config) (kafka.Consumer, error) {
+	cm := rdkafka.ConfigMap{
+		"bootstrap.servers":  strings.Join(brokers, ","),
+		"group.id":           group,
+		"session.timeout.ms": 6000,
+		// TODO(diogo): implement Commit()
+		//"enable.auto.commit":              false,
+		"go.events.channel.size":          config.ChannelSize,
+		"go.events.channel.enable":        true,
+		"go.application.rebalance.enable": true,
+		"default.topic.config":            rdkafka.ConfigMap{"auto.offset.reset": "earliest"},
+	}
+	if clientID != "" {
+		cm["client.id"] = clientID
+	}
+	for k, v := range config.ConfigMap {
+		cm[k] = v
+	}
+	consumer, err := rdkafka.NewConsumer(&cm)
 	if err != nil {
 		return nil, err
 	}
 
 	c := &confluent{
 		consumer:         consumer,
+		refreshToken:     config.RefreshToken,
 		tablePartitions:  make(map[string]map[int32]topicPartitionInfo),
 		streamPartitions: make(map[int32][]rdkafka.TopicPartition),
 		partitionMap:     make(map[int32]bool),
@@ -81,11 +106,18 @@ func NewConsumer(brokers []string, group string, bufsize int) (kafka.Consumer, e
 }
 
 // NewConsumerBuilder builds confluent-based consumers with channel size.
-func NewConsumerBuilder(size int) goka.ConsumerBuilder {
+func NewConsumerBuilder(size int) kafka.ConsumerBuilder {
+	return NewConsumerBuilderWithConfig(Config{ChannelSize: size})
+}
+
+// NewConsumerBuilderWithConfig builds confluent-based consumers configured by
+// config, eg, to use features of librdkafka like rack awareness or the
+// refresh of OAUTHBEARER tokens.
+func NewConsumerBuilderWithConfig(config Config) kafka.ConsumerBuilder {
 	return func(brokers []string, group, clientID string) (kafka.Consumer, error) {
-		consumer, err := NewConsumer(brokers, group, size)
+		consumer, err := NewConsumerWithConfig(brokers, group, clientID, config)
 		if err != nil {
-			log.Fatalf("cannot create confluent consumer: %v", err)
+			return nil, fmt.Errorf("cannot create confluent consumer: %v", err)
 		}
 		return consumer, nil
 	}
@@ -120,18 +152,20 @@ func (c *confluent) AddGroupPartition(partition int32) {
 	}
 }
 
-func (c *confluent) AddPartition(topic string, partition int32, initialOffset int64) {
+func (c *confluent) AddPartition(topic string, partition int32, initialOffset int64) error {
 	select {
 	case c.cmds <- &addPartition{topic, partition, initialOffset}:
 	case <-c.stop:
 	}
+	return nil
 }
 
-func (c *confluent) RemovePartition(topic string, partition int32) {
+func (c *confluent) RemovePartition(topic string, partition int32) error {
 	select {
 	case c.cmds <- &removePartition{topic, partition}:
 	case <-c.stop:
 	}
+	return nil
 }
 
 func (c *confluent) Close() error {
@@ -139,7 +173,7 @@ func (c *confluent) Close() error {
 	close(c.stop)
 	<-c.done
 
-	return nil
+	return c.consumer.Close()
 }
 
 func (c *confluent) run() {
@@ -168,6 +202,8 @@ func (c *confluent) run() {
 					Key:       string(e.Key),
 					Value:     e.Value,
 					Timestamp: e.Timestamp,
+					NilKey:    e.Key == nil,
+					Headers:   headers(e.Headers),
 				}
 
 			case rdkafka.PartitionEOF:
@@ -178,8 +214,11 @@ func (c *confluent) run() {
 					Hwm:       int64(e.Offset),
 				}
 
+			case rdkafka.OAuthBearerTokenRefresh:
+				c.setToken(e.Config)
+
 			case rdkafka.Error:
-				c.events <- &kafka.Error{fmt.Errorf("error from rdkafka: %v", e)}
+				c.events <- &kafka.Error{Err: fmt.Errorf("error from rdkafka: %v", e)}
 
 			default:
 				//log.Printf("HANDLE ME: %v", ev)
@@ -194,7 +233,7 @@ func (c *confluent) run() {
 			case *addGroupPartition:
 				c.addGroupPartition(cmd.partition)
 			default:
-				c.events <- &kafka.Error{fmt.Errorf("invalid command: %T", cmd)}
+				c.events <- &kafka.Error{Err: fmt.Errorf("invalid command: %T", cmd)}
 			}
 
 		case <-c.stop:
@@ -204,6 +243,22 @@ func (c *confluent) run() {
 	}
 }
 
+// setToken sets a new OAUTHBEARER token requested by librdkafka.
+func (c *confluent) setToken(config string) {
+	if c.refreshToken == nil {
+		c.consumer.SetOAuthBearerTokenFailure("no token refresh configured")
+		return
+	}
+	token, err := c.refreshToken(config)
+	if err == nil {
+		err = c.consumer.SetOAuthBearerToken(token)
+	}
+	if err != nil {
+		c.consumer.SetOAuthBearerTokenFailure(err.Error())
+		c.events <- &kafka.Error{Err: fmt.Errorf("error refreshing oauthbearer token: %v", err)}
+	}
+}
+
 func (c *confluent) addGroupPartition(partition int32) {
 	log.Println("%% confluent %%", "adding group partition", partition)
 	c.partitionMap[partition] = true
@@ -228,7 +283,7 @@ func (c *confluent) addPartition(topic string, partition int32, initialOffset in
 	l, h, err := c.consumer.QueryWatermarkOffsets(topic, partition, 500)
 	if err != nil {
 		select {
-		case c.events <- &kafka.Error{fmt.Errorf("error querying watermarks: %v", err)}:
+		case c.events <- &kafka.Error{Err: fmt.Errorf("error querying watermarks: %v", err)}:
 		case <-c.stop:
 			return
 		}
@@ -309,9 +364,23 @@ type confluentConsumer interface {
 	GetMetadata(topic *string, allTopics bool, timeoutMs int) (*rdkafka.Metadata, error)
 	Poll(timeoutMs int) (event rdkafka.Event)
 	QueryWatermarkOffsets(topic string, partition int32, timeoutMs int) (low, high int64, err error)
+	SetOAuthBearerToken(oauthBearerToken rdkafka.OAuthBearerToken) error
+	SetOAuthBearerTokenFailure(errstr string) error
 	String() string
 	Subscribe(topic string, rebalanceCb rdkafka.RebalanceCb) error
 	SubscribeTopics(topics []string, rebalanceCb rdkafka.RebalanceCb) (err error)
 	Unassign() (err error)
 	Unsubscribe() (err error)
 }
+
+// headers converts the headers of a consumed message.
+func headers(hs []rdkafka.Header) kafka.Headers {
+	if len(hs) == 0 {
+		return nil
+	}
+	headers := make(kafka.Headers, len(hs))
+	for _, h := range hs {
+		headers[h.Key] = h.Value
+	}
+	return headers
+}
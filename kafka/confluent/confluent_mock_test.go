@@ -1,3 +1,4 @@
+//go:build confluent
 // +build confluent
 
 // Automatically generated by MockGen. DO NOT EDIT!
@@ -127,6 +128,26 @@ func (_mr *_MockconfluentConsumerRecorder) QueryWatermarkOffsets(arg0, arg1, arg
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "QueryWatermarkOffsets", arg0, arg1, arg2)
 }
 
+func (_m *MockconfluentConsumer) SetOAuthBearerToken(oauthBearerToken kafka.OAuthBearerToken) error {
+	ret := _m.ctrl.Call(_m, "SetOAuthBearerToken", oauthBearerToken)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockconfluentConsumerRecorder) SetOAuthBearerToken(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetOAuthBearerToken", arg0)
+}
+
+func (_m *MockconfluentConsumer) SetOAuthBearerTokenFailure(errstr string) error {
+	ret := _m.ctrl.Call(_m, "SetOAuthBearerTokenFailure", errstr)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockconfluentConsumerRecorder) SetOAuthBearerTokenFailure(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetOAuthBearerTokenFailure", arg0)
+}
+
 func (_m *MockconfluentConsumer) String() string {
 	ret := _m.ctrl.Call(_m, "String")
 	ret0, _ := ret[0].(string)
@@ -1,10 +1,14 @@
+//go:build confluent
 // +build confluent
 
 package confluent
 
 import (
 	"testing"
+	"time"
 
+	rdkafka "github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/facebookgo/ensure"
 	"github.com/golang/mock/gomock"
 	"github.com/lovoo/goka/kafka"
 )
@@ -28,3 +32,145 @@ func TestConfluent1(t *testing.T) {
 	consumer.EXPECT().SubscribeTopics([]string{"t1"}, nil).Return(nil)
 	c.Subscribe(map[string]int64{"t1": -1})
 }
+
+func TestConfluent_refreshToken(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	consumer := NewMockconfluentConsumer(ctrl)
+	c := newMockConfluent(consumer)
+
+	// without refresh function, the refresh fails
+	consumer.EXPECT().SetOAuthBearerTokenFailure("no token refresh configured").Return(nil)
+	c.setToken("config")
+
+	token := rdkafka.OAuthBearerToken{TokenValue: "token"}
+	c.refreshToken = func(config string) (rdkafka.OAuthBearerToken, error) {
+		return token, nil
+	}
+	consumer.EXPECT().SetOAuthBearerToken(token).Return(nil)
+	c.setToken("config")
+}
+
+func TestConfluent_rebalance(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	consumer := NewMockconfluentConsumer(ctrl)
+	c := newMockConfluent(consumer)
+	c.streamPartitions = make(map[int32][]rdkafka.TopicPartition)
+	c.partitionMap = map[int32]bool{1: true}
+	c.groupTopics = map[string]int64{"t1": -2}
+
+	topic := "t1"
+	as := c.rebalance(rdkafka.AssignedPartitions{Partitions: []rdkafka.TopicPartition{
+		{Topic: &topic, Partition: 0, Offset: rdkafka.OffsetInvalid},
+		{Topic: &topic, Partition: 1, Offset: 10},
+	}})
+
+	// partitions without committed offset start at the offset of the topic
+	ensure.DeepEqual(t, *as, kafka.Assignment{0: -2, 1: 10})
+	// partitions already added to the group stay added
+	ensure.DeepEqual(t, c.partitionMap, map[int32]bool{0: false, 1: true})
+	ensure.DeepEqual(t, len(c.streamPartitions[0]), 1)
+}
+
+func TestConfluent_partitions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	consumer := NewMockconfluentConsumer(ctrl)
+	c := newMockConfluent(consumer)
+	c.events = make(chan kafka.Event, 10)
+	c.tablePartitions = make(map[string]map[int32]topicPartitionInfo)
+	c.partitionMap = make(map[int32]bool)
+	stream := "stream"
+	c.streamPartitions = map[int32][]rdkafka.TopicPartition{0: {{Topic: &stream, Partition: 0}}}
+
+	var assigned []rdkafka.TopicPartition
+	assign := func(tps []rdkafka.TopicPartition) { assigned = tps }
+
+	// table partitions are assigned with their offset after sending a BOF
+	consumer.EXPECT().QueryWatermarkOffsets("table", int32(0), 500).Return(int64(3), int64(10), nil)
+	consumer.EXPECT().Assign(gomock.Any()).Do(assign).Return(nil)
+	c.addPartition("table", 0, 5)
+	ensure.DeepEqual(t, <-c.events, kafka.Event(&kafka.BOF{Topic: "table", Partition: 0, Offset: 3, Hwm: 10}))
+	ensure.DeepEqual(t, len(assigned), 1)
+	ensure.DeepEqual(t, *assigned[0].Topic, "table")
+	ensure.DeepEqual(t, assigned[0].Offset, rdkafka.Offset(5))
+
+	// stream partitions are assigned once added to the group
+	consumer.EXPECT().Assign(gomock.Any()).Do(assign).Return(nil)
+	c.addGroupPartition(0)
+	ensure.DeepEqual(t, len(assigned), 2)
+
+	consumer.EXPECT().Assign(gomock.Any()).Do(assign).Return(nil)
+	c.removePartition("table", 0)
+	ensure.DeepEqual(t, len(assigned), 1)
+	ensure.DeepEqual(t, *assigned[0].Topic, "stream")
+	ensure.DeepEqual(t, len(c.tablePartitions), 0)
+
+	// unknown partitions are ignored
+	c.removePartition("table", 0)
+}
+
+func TestConfluent_run(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	consumer := NewMockconfluentConsumer(ctrl)
+	c := newMockConfluent(consumer)
+	events := make(chan rdkafka.Event)
+	consumer.EXPECT().Events().Return(events).AnyTimes()
+	go c.run()
+
+	topic := "topic"
+	ts := time.Unix(100, 0)
+	events <- &rdkafka.Message{
+		TopicPartition: rdkafka.TopicPartition{Topic: &topic, Partition: 1, Offset: 7},
+		Key:            []byte("key"),
+		Value:          []byte("value"),
+		Timestamp:      ts,
+		Headers:        []rdkafka.Header{{Key: "header", Value: []byte("value")}},
+	}
+	ensure.DeepEqual(t, <-c.events, kafka.Event(&kafka.Message{
+		Topic:     "topic",
+		Partition: 1,
+		Offset:    7,
+		Key:       "key",
+		Value:     []byte("value"),
+		Timestamp: ts,
+		Headers:   kafka.Headers{"header": []byte("value")},
+	}))
+
+	// messages without key are marked
+	events <- &rdkafka.Message{TopicPartition: rdkafka.TopicPartition{Topic: &topic, Partition: 1, Offset: 8}}
+	msg := (<-c.events).(*kafka.Message)
+	ensure.True(t, msg.NilKey)
+	ensure.True(t, msg.Headers == nil)
+
+	events <- rdkafka.PartitionEOF{Topic: &topic, Partition: 1, Offset: 9}
+	ensure.DeepEqual(t, <-c.events, kafka.Event(&kafka.EOF{Topic: "topic", Partition: 1, Hwm: 9}))
+
+	events <- rdkafka.NewError(rdkafka.ErrAllBrokersDown, "down", false)
+	ensure.StringContains(t, (<-c.events).(*kafka.Error).Err.Error(), "error from rdkafka")
+
+	// closing stops the loop and closes the consumer
+	consumer.EXPECT().Close().Return(nil)
+	ensure.Nil(t, c.Close())
+}
+
+func TestNewConsumerBuilderWithConfig(t *testing.T) {
+	builder := NewConsumerBuilderWithConfig(Config{
+		ChannelSize: 10,
+		ConfigMap:   rdkafka.ConfigMap{"client.rack": "rack-1"},
+	})
+	consumer, err := builder([]string{"localhost:9092"}, "group", "client")
+	ensure.Nil(t, err)
+	ensure.Nil(t, consumer.Close())
+
+	// invalid settings of librdkafka fail
+	builder = NewConsumerBuilderWithConfig(Config{ConfigMap: rdkafka.ConfigMap{"invalid.setting": true}})
+	_, err = builder([]string{"localhost:9092"}, "group", "client")
+	ensure.NotNil(t, err)
+}
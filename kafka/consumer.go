@@ -26,14 +26,36 @@ const (
 	OffsetNewest = -1
 	// OffsetOldest defines the oldest offset to read from using the consumer
 	OffsetOldest = -2
+
+	// initial offsets below offsetTimeBase encode a timestamp, see OffsetTime
+	offsetTimeBase = -3
 )
 
+// OffsetTime returns an initial offset to pass to Subscribe, so that a
+// consumer group without committed offsets starts consuming the topic at the
+// first message with a timestamp equal to or later than t.
+func OffsetTime(t time.Time) int64 {
+	return offsetTimeBase - t.UnixNano()/int64(time.Millisecond)
+}
+
+// TimeOfOffset returns the timestamp of an initial offset created with
+// OffsetTime. It returns false if offset does not encode a timestamp.
+func TimeOfOffset(offset int64) (time.Time, bool) {
+	if offset > offsetTimeBase {
+		return time.Time{}, false
+	}
+	ms := offsetTimeBase - offset
+	return time.Unix(0, ms*int64(time.Millisecond)), true
+}
+
 // Consumer abstracts a kafka consumer
 type Consumer interface {
 	Events() <-chan Event
 
 	// group consume assumes co-partioned topics
-	// define input topics to consume
+	// define input topics to consume. The values define the initial offset
+	// of each topic if the group has no committed offset yet: OffsetNewest,
+	// OffsetOldest, an absolute offset or a timestamp created with OffsetTime.
 	Subscribe(topics map[string]int64) error
 	// marks the consumer ready to start consuming the messages
 	AddGroupPartition(partition int32)
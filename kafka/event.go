@@ -51,6 +51,10 @@ type Message struct {
 
 	Key   string
 	Value []byte
+	// NilKey is true if the message was produced without key
+	NilKey bool
+	// Headers are the headers of the message, nil if it has none
+	Headers Headers
 }
 
 func (m *Message) string() string {
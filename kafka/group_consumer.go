@@ -55,6 +55,9 @@ func (c *groupConsumer) Subscribe(topics map[string]int64) error {
 	for t := range topics {
 		ts = append(ts, string(t))
 	}
+	if err := c.seedOffsets(topics); err != nil {
+		return err
+	}
 	upConsumer, err := cluster.NewConsumer(c.brokers, c.group, ts, c.config)
 	if err != nil {
 		return err
@@ -66,6 +69,74 @@ func (c *groupConsumer) Subscribe(topics map[string]int64) error {
 	return nil
 }
 
+// seedOffsets commits the initial offsets of topics for all partitions the
+// group has not committed an offset yet. Topics starting at OffsetNewest are
+// left to the consumer configuration.
+func (c *groupConsumer) seedOffsets(topics map[string]int64) error {
+	seed := make(map[string]int64)
+	for t, o := range topics {
+		if o != OffsetNewest {
+			seed[t] = o
+		}
+	}
+	if len(seed) == 0 {
+		return nil
+	}
+
+	client, err := sarama.NewClient(c.brokers, &c.config.Config)
+	if err != nil {
+		return fmt.Errorf("error creating client to seed offsets: %v", err)
+	}
+	defer client.Close()
+	om, err := sarama.NewOffsetManagerFromClient(c.group, client)
+	if err != nil {
+		return fmt.Errorf("error creating offset manager to seed offsets: %v", err)
+	}
+	defer om.Close()
+
+	for topic, offset := range seed {
+		partitions, err := client.Partitions(topic)
+		if err != nil {
+			return fmt.Errorf("error getting partitions of %s: %v", topic, err)
+		}
+		for _, p := range partitions {
+			if err := seedPartitionOffset(client, om, topic, p, offset); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func seedPartitionOffset(client sarama.Client, om sarama.OffsetManager, topic string, partition int32, offset int64) error {
+	pom, err := om.ManagePartition(topic, partition)
+	if err != nil {
+		return fmt.Errorf("error managing offset of %s/%d: %v", topic, partition, err)
+	}
+	defer pom.Close()
+
+	if next, _ := pom.NextOffset(); next >= 0 {
+		// group already committed an offset
+		return nil
+	}
+
+	switch {
+	case offset == OffsetOldest:
+		offset, err = client.GetOffset(topic, partition, sarama.OffsetOldest)
+	case offset <= offsetTimeBase:
+		offset, err = client.GetOffset(topic, partition, offsetTimeBase-offset)
+		if err == nil && offset < 0 {
+			// no message after timestamp
+			offset, err = client.GetOffset(topic, partition, sarama.OffsetNewest)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("error getting initial offset of %s/%d: %v", topic, partition, err)
+	}
+	pom.MarkOffset(offset, "")
+	return nil
+}
+
 func (c *groupConsumer) waitForRebalanceOK() bool {
 	for {
 		select {
@@ -219,6 +290,8 @@ func (c *groupConsumer) waitForMessages() bool {
 				Timestamp: msg.Timestamp,
 				Key:       string(msg.Key),
 				Value:     msg.Value,
+				NilKey:    msg.Key == nil,
+				Headers:   consumedHeaders(msg.Headers),
 			}:
 			case <-c.stop:
 				return false
@@ -613,3 +613,69 @@ func doTimed(t *testing.T, do func()) error {
 
 	return nil
 }
+
+// seedOffsetManager manages the offsets of a single partition for the
+// seeding tests.
+type seedOffsetManager struct {
+	sarama.OffsetManager
+	pom *seedPartitionOffsetManager
+}
+
+func (m *seedOffsetManager) ManagePartition(topic string, partition int32) (sarama.PartitionOffsetManager, error) {
+	return m.pom, nil
+}
+
+type seedPartitionOffsetManager struct {
+	sarama.PartitionOffsetManager
+	next   int64
+	marked int64
+}
+
+func (m *seedPartitionOffsetManager) NextOffset() (int64, string) { return m.next, "" }
+func (m *seedPartitionOffsetManager) MarkOffset(offset int64, metadata string) {
+	m.marked = offset
+}
+func (m *seedPartitionOffsetManager) Close() error { return nil }
+
+func TestGroupConsumer_seedPartitionOffset(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	client := mock.NewMockClient(ctrl)
+
+	seed := func(next, offset int64) int64 {
+		pom := &seedPartitionOffsetManager{next: next, marked: -100}
+		err := seedPartitionOffset(client, &seedOffsetManager{pom: pom}, topic1, 0, offset)
+		ensure.Nil(t, err)
+		return pom.marked
+	}
+
+	// committed offsets are kept
+	ensure.DeepEqual(t, seed(5, OffsetOldest), int64(-100))
+
+	// absolute offsets are committed as they are
+	ensure.DeepEqual(t, seed(-1, 10), int64(10))
+
+	// the oldest offset is looked up
+	client.EXPECT().GetOffset(topic1, int32(0), sarama.OffsetOldest).Return(int64(3), nil)
+	ensure.DeepEqual(t, seed(-1, OffsetOldest), int64(3))
+
+	// timestamps are resolved to the first offset at or after them
+	start := time.Unix(1500000000, 0)
+	ms := start.UnixNano() / int64(time.Millisecond)
+	client.EXPECT().GetOffset(topic1, int32(0), ms).Return(int64(7), nil)
+	ensure.DeepEqual(t, seed(-1, OffsetTime(start)), int64(7))
+
+	// without messages after the timestamp, the partition starts at the newest
+	// offset
+	gomock.InOrder(
+		client.EXPECT().GetOffset(topic1, int32(0), ms).Return(int64(-1), nil),
+		client.EXPECT().GetOffset(topic1, int32(0), sarama.OffsetNewest).Return(int64(42), nil),
+	)
+	ensure.DeepEqual(t, seed(-1, OffsetTime(start)), int64(42))
+
+	// lookup errors are returned
+	client.EXPECT().GetOffset(topic1, int32(0), sarama.OffsetOldest).Return(int64(0), errors.New("some error"))
+	pom := &seedPartitionOffsetManager{next: -1}
+	err := seedPartitionOffset(client, &seedOffsetManager{pom: pom}, topic1, 0, OffsetOldest)
+	ensure.StringContains(t, err.Error(), "some error")
+}
@@ -0,0 +1,371 @@
+//go:build kafkago
+// +build kafkago
+
+package kafkago
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/lovoo/goka/kafka"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+type consumer struct {
+	brokers []string
+	group   string
+	config  *Config
+
+	events chan kafka.Event
+	ctx    context.Context
+	cancel func()
+	wg     sync.WaitGroup
+
+	m sync.Mutex
+	// gen is the current generation of the group
+	gen *kafkago.Generation
+	// added are the group partitions added since the last rebalance
+	added chan int32
+	// partitions are the consumers of individual partitions
+	partitions map[topicPartition]func()
+}
+
+// ConsumerBuilder builds kafka-go consumers.
+func ConsumerBuilder(config *Config) kafka.ConsumerBuilder {
+	return func(brokers []string, group, clientID string) (kafka.Consumer, error) {
+		return NewConsumer(brokers, group, config)
+	}
+}
+
+// NewConsumer creates a kafka-go consumer. The group consumer is started by
+// Subscribe.
+func NewConsumer(brokers []string, group string, config *Config) (kafka.Consumer, error) {
+	if len(brokers) == 0 {
+		return nil, fmt.Errorf("no brokers given")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &consumer{
+		brokers:    brokers,
+		group:      group,
+		config:     config,
+		events:     make(chan kafka.Event, config.channelSize()),
+		ctx:        ctx,
+		cancel:     cancel,
+		added:      make(chan int32, 2048),
+		partitions: make(map[topicPartition]func()),
+	}, nil
+}
+
+func (c *consumer) Events() <-chan kafka.Event {
+	return c.events
+}
+
+// Close stops all consumers and closes the events channel.
+func (c *consumer) Close() error {
+	c.cancel()
+	c.wg.Wait()
+	close(c.events)
+	return nil
+}
+
+// send sends an event unless the consumer is closed.
+func (c *consumer) send(ev kafka.Event) bool {
+	select {
+	case c.events <- ev:
+		return true
+	case <-c.ctx.Done():
+		return false
+	}
+}
+
+func (c *consumer) readerConfig(topic string, partition int) kafkago.ReaderConfig {
+	rc := kafkago.ReaderConfig{
+		Brokers:   c.brokers,
+		Topic:     topic,
+		Partition: partition,
+		Dialer:    c.config.dialer(),
+	}
+	if c.config != nil {
+		rc.MinBytes = c.config.MinBytes
+		rc.MaxBytes = c.config.MaxBytes
+		rc.MaxWait = c.config.MaxWait
+	}
+	return rc
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// group consumer
+///////////////////////////////////////////////////////////////////////////////
+
+// Subscribe joins the group consuming the co-partitioned topics. Partitions
+// without committed offsets start at the initial offset of their topic.
+func (c *consumer) Subscribe(topics map[string]int64) error {
+	var ts []string
+	for t := range topics {
+		ts = append(ts, t)
+	}
+	group, err := kafkago.NewConsumerGroup(kafkago.ConsumerGroupConfig{
+		ID:      c.group,
+		Brokers: c.brokers,
+		Dialer:  c.config.dialer(),
+		Topics:  ts,
+		// partitions without committed offset are resolved with the initial
+		// offsets of the topics when they are started
+		StartOffset: kafkago.LastOffset,
+	})
+	if err != nil {
+		return fmt.Errorf("error creating consumer group: %v", err)
+	}
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		defer group.Close()
+		c.runGroup(group, topics)
+	}()
+	return nil
+}
+
+// runGroup handles the generations of the group until the consumer is closed.
+func (c *consumer) runGroup(group *kafkago.ConsumerGroup, topics map[string]int64) {
+	for {
+		gen, err := group.Next(c.ctx)
+		if err != nil {
+			if c.ctx.Err() == nil {
+				c.send(&kafka.Error{Err: fmt.Errorf("error joining group %s: %v", c.group, err)})
+			}
+			return
+		}
+
+		c.m.Lock()
+		c.gen = gen
+		c.m.Unlock()
+
+		// the topics are co-partitioned, so any topic defines the assignment
+		a := make(kafka.Assignment)
+		for _, pas := range gen.Assignments {
+			for _, pa := range pas {
+				a[int32(pa.ID)] = kafka.OffsetNewest
+			}
+			break
+		}
+		if !c.send(&a) || !c.waitForPartitions(gen, a) {
+			return
+		}
+
+		for topic, pas := range gen.Assignments {
+			initial := topics[topic]
+			for _, pa := range pas {
+				topic, pa := topic, pa
+				gen.Start(func(ctx context.Context) {
+					c.consumeGroupPartition(ctx, topic, pa, initial)
+				})
+			}
+		}
+	}
+}
+
+// groupOffset returns the offset a group partition starts at: the committed
+// offset or, if the group has not committed an offset yet, the initial offset
+// of the topic.
+func groupOffset(committed, initial int64) int64 {
+	if committed == kafkago.LastOffset {
+		return initial
+	}
+	return committed
+}
+
+// waitForPartitions waits until all partitions of the assignment are added.
+func (c *consumer) waitForPartitions(gen *kafkago.Generation, a kafka.Assignment) bool {
+	missing := make(map[int32]bool, len(a))
+	for p := range a {
+		missing[p] = true
+	}
+	for len(missing) > 0 {
+		select {
+		case p := <-c.added:
+			delete(missing, p)
+		case <-c.ctx.Done():
+			return false
+		}
+	}
+	return true
+}
+
+func (c *consumer) consumeGroupPartition(ctx context.Context, topic string, pa kafkago.PartitionAssignment, initial int64) {
+	r := kafkago.NewReader(c.readerConfig(topic, pa.ID))
+	defer r.Close()
+
+	offset := groupOffset(pa.Offset, initial)
+	var err error
+	if ts, ok := kafka.TimeOfOffset(offset); ok {
+		err = r.SetOffsetAt(ctx, ts)
+	} else {
+		err = r.SetOffset(offset)
+	}
+	if err != nil {
+		c.send(&kafka.Error{Err: fmt.Errorf("error setting offset of %s/%d: %v", topic, pa.ID, err)})
+		return
+	}
+	c.read(ctx, r, false)
+}
+
+func (c *consumer) AddGroupPartition(partition int32) {
+	select {
+	case c.added <- partition:
+	case <-c.ctx.Done():
+	}
+}
+
+// Commit commits offset as the last processed offset of the partition.
+func (c *consumer) Commit(topic string, partition int32, offset int64) error {
+	c.m.Lock()
+	gen := c.gen
+	c.m.Unlock()
+	if gen == nil {
+		return fmt.Errorf("cannot commit %s/%d: not subscribed", topic, partition)
+	}
+	// kafka-go commits the next offset to consume
+	return gen.CommitOffsets(map[string]map[int]int64{topic: {int(partition): offset + 1}})
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// partition consumer
+///////////////////////////////////////////////////////////////////////////////
+
+// AddPartition starts consuming a partition of a table at initialOffset,
+// sending BOF first and EOF whenever the high watermark is reached.
+func (c *consumer) AddPartition(topic string, partition int32, initialOffset int64) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+	tp := topicPartition{topic, partition}
+	if _, has := c.partitions[tp]; has {
+		return fmt.Errorf("%s/%d already added", topic, partition)
+	}
+
+	start, hwm, err := c.getOffsets(topic, partition, initialOffset)
+	if err != nil {
+		return fmt.Errorf("error getting offsets %s/%d: %v", topic, partition, err)
+	}
+	r := kafkago.NewReader(c.readerConfig(topic, int(partition)))
+	if err := r.SetOffset(start); err != nil {
+		r.Close()
+		return fmt.Errorf("error creating consumer for %s/%d: %v", topic, partition, err)
+	}
+
+	ctx, cancel := context.WithCancel(c.ctx)
+	c.partitions[tp] = cancel
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		defer r.Close()
+		if !c.send(&kafka.BOF{Topic: topic, Partition: partition, Offset: start, Hwm: hwm}) {
+			return
+		}
+		if start == hwm && !c.send(&kafka.EOF{Topic: topic, Partition: partition, Hwm: hwm}) {
+			return
+		}
+		c.read(ctx, r, true)
+	}()
+	return nil
+}
+
+func (c *consumer) RemovePartition(topic string, partition int32) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+	tp := topicPartition{topic, partition}
+	cancel, has := c.partitions[tp]
+	if !has {
+		return fmt.Errorf("%s/%d was not added", topic, partition)
+	}
+	cancel()
+	delete(c.partitions, tp)
+	return nil
+}
+
+// getOffsets returns the offset to start consuming at and the high watermark
+// of a partition.
+func (c *consumer) getOffsets(topic string, partition int32, offset int64) (start, hwm int64, err error) {
+	var conn *kafkago.Conn
+	for _, broker := range c.brokers {
+		conn, err = c.config.dialer().DialLeader(c.ctx, "tcp", broker, topic, int(partition))
+		if err == nil {
+			break
+		}
+	}
+	if conn == nil {
+		return 0, 0, err
+	}
+	defer conn.Close()
+
+	oldest, hwm, err := conn.ReadOffsets()
+	if err != nil {
+		return 0, 0, err
+	}
+	return startOffset(offset, oldest, hwm), hwm, nil
+}
+
+// startOffset resolves offset to an offset between the oldest offset and the
+// high watermark of a partition.
+func startOffset(offset, oldest, hwm int64) int64 {
+	start := offset
+	switch {
+	case offset == kafka.OffsetOldest:
+		start = oldest
+	case offset == kafka.OffsetNewest:
+		start = hwm
+	}
+	if start > hwm {
+		start = hwm
+	}
+	if start < oldest {
+		start = oldest
+	}
+	return start
+}
+
+// read sends the messages of r until ctx is done. If eof is set, EOF is sent
+// whenever the high watermark is reached.
+func (c *consumer) read(ctx context.Context, r *kafkago.Reader, eof bool) {
+	for {
+		m, err := r.ReadMessage(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				c.send(&kafka.Error{Err: fmt.Errorf("error reading %s/%d: %v", m.Topic, m.Partition, err)})
+			}
+			return
+		}
+
+		msg := &kafka.Message{
+			Topic:     m.Topic,
+			Partition: int32(m.Partition),
+			Offset:    m.Offset,
+			Timestamp: m.Time,
+			Key:       string(m.Key),
+			Value:     m.Value,
+			NilKey:    m.Key == nil,
+		}
+		if len(m.Headers) > 0 {
+			msg.Headers = make(kafka.Headers, len(m.Headers))
+			for _, h := range m.Headers {
+				msg.Headers[h.Key] = h.Value
+			}
+		}
+		if !c.send(msg) {
+			return
+		}
+
+		if eof && m.Offset == m.HighWaterMark-1 {
+			if !c.send(&kafka.EOF{Topic: m.Topic, Partition: int32(m.Partition), Hwm: m.HighWaterMark}) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,66 @@
+//go:build kafkago
+// +build kafkago
+
+package kafkago
+
+import (
+	"testing"
+	"time"
+
+	"github.com/facebookgo/ensure"
+	"github.com/lovoo/goka/kafka"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+func TestGroupOffset(t *testing.T) {
+	// committed offsets are kept
+	ensure.DeepEqual(t, groupOffset(10, kafka.OffsetOldest), int64(10))
+	ensure.DeepEqual(t, groupOffset(0, kafka.OffsetNewest), int64(0))
+
+	// partitions without committed offset start at the initial offset,
+	// which is the newest offset by default like with sarama
+	ensure.DeepEqual(t, groupOffset(kafkago.LastOffset, kafka.OffsetNewest), kafkago.LastOffset)
+	ensure.DeepEqual(t, groupOffset(kafkago.LastOffset, kafka.OffsetOldest), kafkago.FirstOffset)
+	ensure.DeepEqual(t, groupOffset(kafkago.LastOffset, 5), int64(5))
+	ts := kafka.OffsetTime(time.Unix(1000, 0))
+	ensure.DeepEqual(t, groupOffset(kafkago.LastOffset, ts), ts)
+}
+
+func TestStartOffset(t *testing.T) {
+	ensure.DeepEqual(t, startOffset(kafka.OffsetOldest, 3, 10), int64(3))
+	ensure.DeepEqual(t, startOffset(kafka.OffsetNewest, 3, 10), int64(10))
+	ensure.DeepEqual(t, startOffset(5, 3, 10), int64(5))
+
+	// offsets outside of the partition are clamped
+	ensure.DeepEqual(t, startOffset(1, 3, 10), int64(3))
+	ensure.DeepEqual(t, startOffset(20, 3, 10), int64(10))
+}
+
+func TestConsumer(t *testing.T) {
+	_, err := ConsumerBuilder(nil)(nil, "group", "client")
+	ensure.NotNil(t, err)
+
+	c, err := ConsumerBuilder(&Config{ChannelSize: 10})([]string{"localhost:9092"}, "group", "client")
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, cap(c.Events()), 10)
+
+	// offsets are committed with the generation of the group
+	ensure.StringContains(t, c.Commit("topic", 0, 1).Error(), "not subscribed")
+	ensure.StringContains(t, c.RemovePartition("topic", 0).Error(), "was not added")
+
+	// group partitions are started once all assigned partitions are added
+	cons := c.(*consumer)
+	done := make(chan bool)
+	go func() { done <- cons.waitForPartitions(nil, kafka.Assignment{0: -1, 1: -1}) }()
+	c.AddGroupPartition(1)
+	c.AddGroupPartition(0)
+	ensure.True(t, <-done)
+
+	// closing stops waiting and closes the events
+	go func() { done <- cons.waitForPartitions(nil, kafka.Assignment{0: -1}) }()
+	ensure.Nil(t, c.Close())
+	ensure.False(t, <-done)
+	_, ok := <-c.Events()
+	ensure.False(t, ok)
+}
@@ -0,0 +1,76 @@
+//go:build kafkago
+// +build kafkago
+
+// Package kafkago implements the consumer, producer and topic manager of goka
+// with github.com/segmentio/kafka-go, a pure Go client with a context-first
+// API. The package is built with the kafkago build tag:
+//
+//	go build -tags kafkago
+//
+// and plugged into processors, views and emitters via the builders, eg,
+//
+//	goka.NewProcessor(brokers, graph,
+//		goka.WithConsumerBuilder(kafkago.ConsumerBuilder(nil)),
+//		goka.WithProducerBuilder(kafkago.ProducerBuilder(nil)),
+//		goka.WithTopicManagerBuilder(kafkago.TopicManagerBuilder(nil)),
+//	)
+package kafkago
+
+import (
+	"time"
+
+	"github.com/lovoo/goka/kafka"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+// Config configures the kafka-go clients. Zero values use the defaults of
+// kafka-go.
+type Config struct {
+	// Dialer connects the consumers to the brokers, eg, with TLS or SASL.
+	Dialer *kafkago.Dialer
+	// Transport is used by the producers and topic managers, eg, with TLS or
+	// SASL.
+	Transport *kafkago.Transport
+	// MinBytes, MaxBytes and MaxWait tune the fetch requests of the
+	// consumers.
+	MinBytes int
+	MaxBytes int
+	MaxWait  time.Duration
+	// ChannelSize is the number of events buffered by the consumers.
+	ChannelSize int
+	// BatchTimeout is the time the producers wait to fill a batch.
+	BatchTimeout time.Duration
+	// RequiredAcks is the number of acknowledgements the producers wait for.
+	RequiredAcks kafkago.RequiredAcks
+	// Topics configures the tables and streams created by the topic
+	// managers. Configurations of existing topics are verified and updated
+	// if VerifyConfig and FixConfig are set.
+	Topics *kafka.TopicManagerConfig
+}
+
+const (
+	defaultChannelSize  = 1024
+	defaultBatchTimeout = 10 * time.Millisecond
+)
+
+func (c *Config) channelSize() int {
+	if c == nil || c.ChannelSize <= 0 {
+		return defaultChannelSize
+	}
+	return c.ChannelSize
+}
+
+func (c *Config) topics() *kafka.TopicManagerConfig {
+	if c == nil || c.Topics == nil {
+		return &kafka.TopicManagerConfig{}
+	}
+	return c.Topics
+}
+
+func (c *Config) dialer() *kafkago.Dialer {
+	if c == nil || c.Dialer == nil {
+		return kafkago.DefaultDialer
+	}
+	return c.Dialer
+}
@@ -0,0 +1,122 @@
+//go:build kafkago
+// +build kafkago
+
+package kafkago
+
+import (
+	"context"
+	"fmt"
+	"hash"
+	"sync/atomic"
+
+	"github.com/lovoo/goka/kafka"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+// messageMetadata is attached to the messages of the producer.
+type messageMetadata struct {
+	promise    *kafka.Promise
+	partition  *int32
+	roundRobin bool
+}
+
+type producer struct {
+	writer *kafkago.Writer
+}
+
+// ProducerBuilder builds kafka-go producers assigning messages to partitions
+// by hashing their keys with the hasher of goka.
+func ProducerBuilder(config *Config) kafka.ProducerBuilder {
+	return func(brokers []string, clientID string, hasher func() hash.Hash32) (kafka.Producer, error) {
+		return NewProducer(brokers, hasher, config)
+	}
+}
+
+// NewProducer creates a kafka-go producer.
+func NewProducer(brokers []string, hasher func() hash.Hash32, config *Config) (kafka.Producer, error) {
+	if len(brokers) == 0 {
+		return nil, fmt.Errorf("no brokers given")
+	}
+	w := &kafkago.Writer{
+		Addr:         kafkago.TCP(brokers...),
+		Balancer:     &balancer{hasher: hasher},
+		BatchTimeout: defaultBatchTimeout,
+		RequiredAcks: kafkago.RequireOne,
+		Async:        true,
+		Completion: func(messages []kafkago.Message, err error) {
+			for _, m := range messages {
+				m.WriterData.(*messageMetadata).promise.Finish(err)
+			}
+		},
+	}
+	if config != nil {
+		if config.Transport != nil {
+			w.Transport = config.Transport
+		}
+		if config.BatchTimeout > 0 {
+			w.BatchTimeout = config.BatchTimeout
+		}
+		if config.RequiredAcks != 0 {
+			w.RequiredAcks = config.RequiredAcks
+		}
+	}
+	return &producer{writer: w}, nil
+}
+
+func (p *producer) Emit(topic string, key string, value []byte) *kafka.Promise {
+	return p.EmitMessage(&kafka.ProducerMessage{Topic: topic, Key: key, Value: value})
+}
+
+func (p *producer) EmitMessage(msg *kafka.ProducerMessage) *kafka.Promise {
+	promise := kafka.NewPromise()
+	m := kafkago.Message{
+		Topic:      msg.Topic,
+		Value:      msg.Value,
+		Time:       msg.Timestamp,
+		WriterData: &messageMetadata{promise: promise, partition: msg.Partition, roundRobin: msg.NoKey},
+	}
+	if !msg.NoKey {
+		m.Key = []byte(msg.Key)
+	}
+	for k, v := range msg.Headers {
+		m.Headers = append(m.Headers, kafkago.Header{Key: k, Value: v})
+	}
+	// the writer is asynchronous, so errors are reported by the completion
+	// except for invalid messages
+	if err := p.writer.WriteMessages(context.Background(), m); err != nil {
+		promise.Finish(err)
+	}
+	return promise
+}
+
+func (p *producer) Close() error {
+	return p.writer.Close()
+}
+
+// balancer assigns the messages to partitions like the sarama producers:
+// messages with explicit partition to that partition, messages without key
+// round-robin and all other messages by the hash of their keys.
+type balancer struct {
+	hasher  func() hash.Hash32
+	counter uint32
+}
+
+func (b *balancer) Balance(msg kafkago.Message, partitions ...int) int {
+	meta, _ := msg.WriterData.(*messageMetadata)
+	switch {
+	case meta != nil && meta.partition != nil:
+		return int(*meta.partition)
+	case meta != nil && meta.roundRobin:
+		n := atomic.AddUint32(&b.counter, 1)
+		return partitions[int(n)%len(partitions)]
+	}
+
+	h := b.hasher()
+	h.Write(msg.Key)
+	partition := int32(h.Sum32()) % int32(len(partitions))
+	if partition < 0 {
+		partition = -partition
+	}
+	return partitions[partition]
+}
@@ -0,0 +1,176 @@
+//go:build kafkago
+// +build kafkago
+
+package kafkago
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/facebookgo/ensure"
+	"github.com/lovoo/goka/kafka"
+
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/protocol"
+	"github.com/segmentio/kafka-go/protocol/metadata"
+	"github.com/segmentio/kafka-go/protocol/produce"
+)
+
+// record is a message received by fakeTransport.
+type record struct {
+	partition int32
+	key       []byte
+	value     []byte
+	headers   []protocol.Header
+}
+
+// fakeTransport serves the metadata and produce requests of a writer for a
+// broker hosting all topics with the given number of partitions.
+type fakeTransport struct {
+	partitions int
+	// errorCode is returned for all produced records if set
+	errorCode kafkago.Error
+
+	m       sync.Mutex
+	records []record
+}
+
+func (t *fakeTransport) RoundTrip(ctx context.Context, addr net.Addr, req kafkago.Request) (kafkago.Response, error) {
+	switch req := req.(type) {
+	case *metadata.Request:
+		res := &metadata.Response{Brokers: []metadata.ResponseBroker{{NodeID: 1, Host: "localhost", Port: 9092}}}
+		for _, name := range req.TopicNames {
+			topic := metadata.ResponseTopic{Name: name}
+			for i := 0; i < t.partitions; i++ {
+				topic.Partitions = append(topic.Partitions, metadata.ResponsePartition{PartitionIndex: int32(i), LeaderID: 1})
+			}
+			res.Topics = append(res.Topics, topic)
+		}
+		return res, nil
+	case *produce.Request:
+		res := new(produce.Response)
+		for _, rt := range req.Topics {
+			topic := produce.ResponseTopic{Topic: rt.Topic}
+			for _, rp := range rt.Partitions {
+				if err := t.read(rp); err != nil {
+					return nil, err
+				}
+				topic.Partitions = append(topic.Partitions, produce.ResponsePartition{Partition: rp.Partition, ErrorCode: int16(t.errorCode)})
+			}
+			res.Topics = append(res.Topics, topic)
+		}
+		return res, nil
+	}
+	return nil, fmt.Errorf("unexpected request %T", req)
+}
+
+func (t *fakeTransport) read(rp produce.RequestPartition) error {
+	t.m.Lock()
+	defer t.m.Unlock()
+	for {
+		r, err := rp.RecordSet.Records.ReadRecord()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		rec := record{partition: rp.Partition, headers: append([]protocol.Header(nil), r.Headers...)}
+		if r.Key != nil {
+			if rec.key, err = protocol.ReadAll(r.Key); err != nil {
+				return err
+			}
+		}
+		if rec.value, err = protocol.ReadAll(r.Value); err != nil {
+			return err
+		}
+		t.records = append(t.records, rec)
+	}
+}
+
+// wait waits for the promise to finish.
+func wait(p *kafka.Promise) error {
+	done := make(chan error, 1)
+	p.Then(func(err error) { done <- err })
+	return <-done
+}
+
+func newTestProducer(t *testing.T, transport *fakeTransport) kafka.Producer {
+	p, err := NewProducer([]string{"localhost:9092"}, fnv.New32a, &Config{BatchTimeout: time.Millisecond})
+	ensure.Nil(t, err)
+	p.(*producer).writer.Transport = transport
+	return p
+}
+
+func TestProducer_Emit(t *testing.T) {
+	transport := &fakeTransport{partitions: 10}
+	p := newTestProducer(t, transport)
+
+	partition := int32(3)
+	ensure.Nil(t, wait(p.Emit("topic", "key", []byte("value"))))
+	ensure.Nil(t, wait(p.EmitMessage(&kafka.ProducerMessage{
+		Topic:   "topic",
+		Key:     "other",
+		Value:   []byte("value"),
+		Headers: kafka.Headers{"header": []byte("value")},
+	})))
+	ensure.Nil(t, wait(p.EmitMessage(&kafka.ProducerMessage{Topic: "topic", Key: "key", Value: []byte("value"), Partition: &partition})))
+	ensure.Nil(t, wait(p.EmitMessage(&kafka.ProducerMessage{Topic: "topic", Value: []byte("value"), NoKey: true})))
+	ensure.Nil(t, p.Close())
+
+	transport.m.Lock()
+	defer transport.m.Unlock()
+	ensure.DeepEqual(t, len(transport.records), 4)
+
+	// keys are assigned to partitions like by the sarama producers
+	h := fnv.New32a()
+	h.Write([]byte("key"))
+	expected := int32(h.Sum32()) % 10
+	if expected < 0 {
+		expected = -expected
+	}
+	ensure.DeepEqual(t, transport.records[0].partition, expected)
+	ensure.DeepEqual(t, string(transport.records[0].key), "key")
+	ensure.DeepEqual(t, string(transport.records[0].value), "value")
+
+	ensure.DeepEqual(t, transport.records[1].headers, []protocol.Header{{Key: "header", Value: []byte("value")}})
+	ensure.DeepEqual(t, transport.records[2].partition, int32(3))
+	ensure.True(t, transport.records[3].key == nil)
+}
+
+func TestProducer_error(t *testing.T) {
+	transport := &fakeTransport{partitions: 1, errorCode: kafkago.MessageSizeTooLarge}
+	p := newTestProducer(t, transport)
+
+	// the errors of the broker fail the promises
+	err := wait(p.Emit("topic", "key", []byte("value")))
+	ensure.NotNil(t, err)
+	ensure.StringContains(t, err.Error(), "Message Size Too Large")
+	ensure.Nil(t, p.Close())
+
+	_, err = NewProducer(nil, fnv.New32a, nil)
+	ensure.NotNil(t, err)
+}
+
+func TestBalancer(t *testing.T) {
+	b := &balancer{hasher: fnv.New32a}
+	partitions := []int{0, 1, 2}
+
+	// messages without key are distributed round-robin
+	meta := &messageMetadata{roundRobin: true}
+	seen := make(map[int]bool)
+	for i := 0; i < 3; i++ {
+		seen[b.Balance(kafkago.Message{WriterData: meta}, partitions...)] = true
+	}
+	ensure.DeepEqual(t, len(seen), 3)
+
+	// the same key is always assigned to the same partition
+	p := b.Balance(kafkago.Message{Key: []byte("key")}, partitions...)
+	ensure.DeepEqual(t, b.Balance(kafkago.Message{Key: []byte("key")}, partitions...), p)
+}
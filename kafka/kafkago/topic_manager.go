@@ -0,0 +1,268 @@
+//go:build kafkago
+// +build kafkago
+
+package kafkago
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/lovoo/goka/kafka"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+type topicManager struct {
+	client *kafkago.Client
+	config *kafka.TopicManagerConfig
+}
+
+// TopicManagerBuilder builds kafka-go topic managers, which create missing
+// topics via the controller of the cluster.
+func TopicManagerBuilder(config *Config) kafka.TopicManagerBuilder {
+	return func(brokers []string) (kafka.TopicManager, error) {
+		return NewTopicManager(brokers, config)
+	}
+}
+
+// NewTopicManager creates a kafka-go topic manager for the brokers. The
+// configuration of existing topics is verified and updated as set by
+// VerifyConfig and FixConfig of config.Topics.
+func NewTopicManager(brokers []string, config *Config) (kafka.TopicManager, error) {
+	if len(brokers) == 0 {
+		return nil, fmt.Errorf("Error creating topic manager: no brokers")
+	}
+	client := &kafkago.Client{Addr: kafkago.TCP(brokers...)}
+	if config != nil && config.Transport != nil {
+		client.Transport = config.Transport
+	}
+	return &topicManager{client: client, config: config.topics()}, nil
+}
+
+func (m *topicManager) Close() error {
+	return nil
+}
+
+func (m *topicManager) Partitions(topic string) ([]int32, error) {
+	t, exists, err := m.metadata(topic)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("Error fetching partitions for topic %s: %v", topic, kafkago.UnknownTopicOrPartition)
+	}
+	var ids []int32
+	for _, p := range t.Partitions {
+		ids = append(ids, int32(p.ID))
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+func (m *topicManager) EnsureStreamExists(topic string, npar int) error {
+	return m.ensureTopic(topic, npar, replication(m.config.Stream), m.config.Stream.Entries(),
+		m.config.VerifyConfig || m.config.FixConfig, m.config.FixConfig)
+}
+
+func (m *topicManager) EnsureTableExists(topic string, npar int) error {
+	config := m.config.Table.Entries()
+	if config["cleanup.policy"] == "" {
+		config["cleanup.policy"] = "compact"
+	}
+	return m.ensureTopic(topic, npar, replication(m.config.Table), config,
+		m.config.VerifyConfig || m.config.FixConfig, m.config.FixConfig)
+}
+
+// replication returns the replication factor of cfg or -1 for the default of
+// the brokers.
+func replication(cfg kafka.TopicConfig) int {
+	if cfg.Replication <= 0 {
+		return -1
+	}
+	return cfg.Replication
+}
+
+// EnsureTopicExists creates topic if it does not exist. A replication factor
+// of -1 uses the default of the brokers. Existing topics must have npar
+// partitions, rfactor replicas and the given configuration, which is updated
+// if FixConfig is set.
+func (m *topicManager) EnsureTopicExists(topic string, npar, rfactor int, config map[string]string) error {
+	return m.ensureTopic(topic, npar, rfactor, config, true, m.config.FixConfig)
+}
+
+// ensureTopic creates topic if it does not exist. Otherwise it checks the
+// number of partitions and, if verify is set, the replication factor and the
+// configuration entries, which are updated if fix is set.
+func (m *topicManager) ensureTopic(topic string, npar, rfactor int, config map[string]string, verify, fix bool) error {
+	t, exists, err := m.metadata(topic)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return m.createTopic(topic, npar, rfactor, config)
+	}
+
+	if len(t.Partitions) != npar {
+		return fmt.Errorf("topic %s has %d partitions instead of %d", topic, len(t.Partitions), npar)
+	}
+	if !verify {
+		return nil
+	}
+	if rfactor > 0 && len(t.Partitions[0].Replicas) != rfactor {
+		return fmt.Errorf("topic %s has replication factor %d instead of %d", topic, len(t.Partitions[0].Replicas), rfactor)
+	}
+	return m.ensureConfig(topic, config, fix)
+}
+
+func (m *topicManager) createTopic(topic string, npar, rfactor int, config map[string]string) error {
+	tc := kafkago.TopicConfig{
+		Topic:             topic,
+		NumPartitions:     npar,
+		ReplicationFactor: rfactor,
+	}
+	for k, v := range config {
+		tc.ConfigEntries = append(tc.ConfigEntries, kafkago.ConfigEntry{ConfigName: k, ConfigValue: v})
+	}
+	resp, err := m.client.CreateTopics(context.Background(), &kafkago.CreateTopicsRequest{
+		Topics: []kafkago.TopicConfig{tc},
+	})
+	if err == nil {
+		err = resp.Errors[topic]
+	}
+	if err != nil {
+		return fmt.Errorf("error creating topic %s: %v", topic, err)
+	}
+	return nil
+}
+
+// ensureConfig compares the configuration of topic with config and, if fix
+// is set, updates the differing entries.
+func (m *topicManager) ensureConfig(topic string, config map[string]string, fix bool) error {
+	resp, err := m.client.DescribeConfigs(context.Background(), &kafkago.DescribeConfigsRequest{
+		Resources: []kafkago.DescribeConfigRequestResource{{
+			ResourceType: kafkago.ResourceTypeTopic,
+			ResourceName: topic,
+		}},
+	})
+	if err == nil && len(resp.Resources) != 1 {
+		err = fmt.Errorf("got %d resources", len(resp.Resources))
+	}
+	if err == nil {
+		err = resp.Resources[0].Error
+	}
+	if err != nil {
+		return fmt.Errorf("error describing config of topic %s: %v", topic, err)
+	}
+	current := make(map[string]string)
+	for _, e := range resp.Resources[0].ConfigEntries {
+		current[e.ConfigName] = e.ConfigValue
+	}
+
+	var diff []string
+	for k, v := range config {
+		if current[k] != v {
+			diff = append(diff, k)
+		}
+	}
+	if len(diff) == 0 {
+		return nil
+	}
+	sort.Strings(diff)
+	if !fix {
+		k := diff[0]
+		return fmt.Errorf("topic %s: expected %s=%s, but found %s", topic, k, config[k], current[k])
+	}
+
+	// in contrast to AlterConfigs, the other entries of the topic are kept
+	update := kafkago.IncrementalAlterConfigsRequestResource{
+		ResourceType: kafkago.ResourceTypeTopic,
+		ResourceName: topic,
+	}
+	for _, k := range diff {
+		update.Configs = append(update.Configs, kafkago.IncrementalAlterConfigsRequestConfig{
+			Name:            k,
+			Value:           config[k],
+			ConfigOperation: kafkago.ConfigOperationSet,
+		})
+	}
+	alter, err := m.client.IncrementalAlterConfigs(context.Background(), &kafkago.IncrementalAlterConfigsRequest{
+		Resources: []kafkago.IncrementalAlterConfigsRequestResource{update},
+	})
+	if err == nil {
+		for _, r := range alter.Resources {
+			if r.Error != nil {
+				err = r.Error
+			}
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("error updating config of topic %s: %v", topic, err)
+	}
+	return nil
+}
+
+// EnsurePartitions increases the number of partitions of topic to npar.
+func (m *topicManager) EnsurePartitions(topic string, npar int) error {
+	t, exists, err := m.metadata(topic)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("topic %s does not exist", topic)
+	}
+	switch n := len(t.Partitions); {
+	case n == npar:
+		return nil
+	case n > npar:
+		return fmt.Errorf("topic %s has %d partitions, cannot decrease to %d", topic, n, npar)
+	}
+	resp, err := m.client.CreatePartitions(context.Background(), &kafkago.CreatePartitionsRequest{
+		Topics: []kafkago.TopicPartitionsConfig{{Name: topic, Count: int32(npar)}},
+	})
+	if err == nil {
+		err = resp.Errors[topic]
+	}
+	if err != nil {
+		return fmt.Errorf("error increasing partitions of topic %s: %v", topic, err)
+	}
+	return nil
+}
+
+// DeleteTopic deletes topic via the controller of the cluster.
+func (m *topicManager) DeleteTopic(topic string) error {
+	resp, err := m.client.DeleteTopics(context.Background(), &kafkago.DeleteTopicsRequest{
+		Topics: []string{topic},
+	})
+	if err == nil {
+		err = resp.Errors[topic]
+	}
+	if err != nil {
+		return fmt.Errorf("error deleting topic %s: %v", topic, err)
+	}
+	return nil
+}
+
+// metadata returns the metadata of topic and whether it exists.
+func (m *topicManager) metadata(topic string) (kafkago.Topic, bool, error) {
+	resp, err := m.client.Metadata(context.Background(), &kafkago.MetadataRequest{
+		Topics: []string{topic},
+	})
+	if err != nil {
+		return kafkago.Topic{}, false, fmt.Errorf("Error fetching metadata for topic %s: %v", topic, err)
+	}
+	for _, t := range resp.Topics {
+		if t.Name != topic {
+			continue
+		}
+		if errors.Is(t.Error, kafkago.UnknownTopicOrPartition) {
+			return t, false, nil
+		}
+		if t.Error != nil {
+			return t, false, fmt.Errorf("Error fetching metadata for topic %s: %v", topic, t.Error)
+		}
+		return t, len(t.Partitions) > 0, nil
+	}
+	return kafkago.Topic{}, false, nil
+}
@@ -0,0 +1,230 @@
+//go:build kafkago
+// +build kafkago
+
+package kafkago
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/facebookgo/ensure"
+	"github.com/lovoo/goka/kafka"
+
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/protocol/createpartitions"
+	"github.com/segmentio/kafka-go/protocol/createtopics"
+	"github.com/segmentio/kafka-go/protocol/deletetopics"
+	"github.com/segmentio/kafka-go/protocol/describeconfigs"
+	"github.com/segmentio/kafka-go/protocol/incrementalalterconfigs"
+	"github.com/segmentio/kafka-go/protocol/metadata"
+)
+
+type fakeTopic struct {
+	partitions int
+	replicas   int
+	config     map[string]string
+}
+
+// fakeCluster serves the admin requests of a topic manager for a single
+// broker storing the topics in memory.
+type fakeCluster struct {
+	m      sync.Mutex
+	topics map[string]*fakeTopic
+}
+
+func newFakeCluster() *fakeCluster {
+	return &fakeCluster{topics: make(map[string]*fakeTopic)}
+}
+
+func (c *fakeCluster) RoundTrip(ctx context.Context, addr net.Addr, req kafkago.Request) (kafkago.Response, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	switch req := req.(type) {
+	case *metadata.Request:
+		res := &metadata.Response{Brokers: []metadata.ResponseBroker{{NodeID: 1, Host: "localhost", Port: 9092}}}
+		for _, name := range req.TopicNames {
+			topic := metadata.ResponseTopic{Name: name}
+			t, ok := c.topics[name]
+			if !ok {
+				topic.ErrorCode = int16(kafkago.UnknownTopicOrPartition)
+			}
+			for i := 0; ok && i < t.partitions; i++ {
+				p := metadata.ResponsePartition{PartitionIndex: int32(i), LeaderID: 1}
+				for r := 0; r < t.replicas; r++ {
+					p.ReplicaNodes = append(p.ReplicaNodes, int32(r+1))
+				}
+				topic.Partitions = append(topic.Partitions, p)
+			}
+			res.Topics = append(res.Topics, topic)
+		}
+		return res, nil
+	case *createtopics.Request:
+		res := new(createtopics.Response)
+		for _, rt := range req.Topics {
+			topic := createtopics.ResponseTopic{Name: rt.Name}
+			if _, ok := c.topics[rt.Name]; ok {
+				topic.ErrorCode = int16(kafkago.TopicAlreadyExists)
+			} else {
+				t := &fakeTopic{partitions: int(rt.NumPartitions), replicas: int(rt.ReplicationFactor), config: make(map[string]string)}
+				if t.replicas < 0 {
+					t.replicas = 1
+				}
+				for _, cfg := range rt.Configs {
+					t.config[cfg.Name] = cfg.Value
+				}
+				c.topics[rt.Name] = t
+			}
+			res.Topics = append(res.Topics, topic)
+		}
+		return res, nil
+	case *describeconfigs.Request:
+		res := new(describeconfigs.Response)
+		for _, rr := range req.Resources {
+			resource := describeconfigs.ResponseResource{ResourceType: rr.ResourceType, ResourceName: rr.ResourceName}
+			t, ok := c.topics[rr.ResourceName]
+			if !ok {
+				resource.ErrorCode = int16(kafkago.UnknownTopicOrPartition)
+			}
+			for k, v := range t.configOrNil() {
+				resource.ConfigEntries = append(resource.ConfigEntries, describeconfigs.ResponseConfigEntry{ConfigName: k, ConfigValue: v})
+			}
+			res.Resources = append(res.Resources, resource)
+		}
+		return res, nil
+	case *incrementalalterconfigs.Request:
+		res := new(incrementalalterconfigs.Response)
+		for _, rr := range req.Resources {
+			t := c.topics[rr.ResourceName]
+			for _, cfg := range rr.Configs {
+				t.config[cfg.Name] = cfg.Value
+			}
+			res.Responses = append(res.Responses, incrementalalterconfigs.ResponseAlterResponse{ResourceType: rr.ResourceType, ResourceName: rr.ResourceName})
+		}
+		return res, nil
+	case *createpartitions.Request:
+		res := new(createpartitions.Response)
+		for _, rt := range req.Topics {
+			result := createpartitions.ResponseResult{Name: rt.Name}
+			if t, ok := c.topics[rt.Name]; !ok {
+				result.ErrorCode = int16(kafkago.UnknownTopicOrPartition)
+			} else if int(rt.Count) <= t.partitions {
+				result.ErrorCode = int16(kafkago.InvalidPartitionNumber)
+			} else {
+				t.partitions = int(rt.Count)
+			}
+			res.Results = append(res.Results, result)
+		}
+		return res, nil
+	case *deletetopics.Request:
+		res := new(deletetopics.Response)
+		for _, name := range req.TopicNames {
+			topic := deletetopics.ResponseTopic{Name: name}
+			if _, ok := c.topics[name]; !ok {
+				topic.ErrorCode = int16(kafkago.UnknownTopicOrPartition)
+			}
+			delete(c.topics, name)
+			res.Responses = append(res.Responses, topic)
+		}
+		return res, nil
+	}
+	return nil, fmt.Errorf("unexpected request %T", req)
+}
+
+func (t *fakeTopic) configOrNil() map[string]string {
+	if t == nil {
+		return nil
+	}
+	return t.config
+}
+
+func newTestTopicManager(cluster *fakeCluster, config *kafka.TopicManagerConfig) *topicManager {
+	return &topicManager{
+		client: &kafkago.Client{Addr: kafkago.TCP("localhost:9092"), Transport: cluster},
+		config: config,
+	}
+}
+
+func TestTopicManager_create(t *testing.T) {
+	cluster := newFakeCluster()
+	cfg := kafka.NewTopicManagerConfig()
+	cfg.Table.Replication = 3
+	tm := newTestTopicManager(cluster, cfg)
+
+	// missing topics are created with the configuration of the topic manager
+	ensure.Nil(t, tm.EnsureTableExists("table", 10))
+	ensure.Nil(t, tm.EnsureStreamExists("stream", 5))
+	ensure.DeepEqual(t, *cluster.topics["table"], fakeTopic{partitions: 10, replicas: 3, config: map[string]string{"cleanup.policy": "compact"}})
+	ensure.DeepEqual(t, *cluster.topics["stream"], fakeTopic{partitions: 5, replicas: 2, config: map[string]string{"retention.ms": "3600000"}})
+
+	partitions, err := tm.Partitions("stream")
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, partitions, []int32{0, 1, 2, 3, 4})
+	_, err = tm.Partitions("missing")
+	ensure.NotNil(t, err)
+
+	// existing topics must have the required number of partitions
+	ensure.Nil(t, tm.EnsureTableExists("table", 10))
+	ensure.StringContains(t, tm.EnsureTableExists("table", 5).Error(), "has 10 partitions instead of 5")
+
+	// the default replication factor of the brokers is used by default
+	tm = newTestTopicManager(cluster, new(kafka.TopicManagerConfig))
+	ensure.Nil(t, tm.EnsureStreamExists("default", 1))
+	ensure.DeepEqual(t, *cluster.topics["default"], fakeTopic{partitions: 1, replicas: 1, config: map[string]string{}})
+
+	_, err = NewTopicManager(nil, nil)
+	ensure.NotNil(t, err)
+}
+
+func TestTopicManager_config(t *testing.T) {
+	cluster := newFakeCluster()
+	cluster.topics["table"] = &fakeTopic{partitions: 1, replicas: 2, config: map[string]string{"cleanup.policy": "delete", "segment.bytes": "1000"}}
+	cfg := kafka.NewTopicManagerConfig()
+	tm := newTestTopicManager(cluster, cfg)
+
+	// the configuration of existing topics is not checked by default
+	ensure.Nil(t, tm.EnsureTableExists("table", 1))
+
+	cfg.VerifyConfig = true
+	ensure.StringContains(t, tm.EnsureTableExists("table", 1).Error(), "expected cleanup.policy=compact, but found delete")
+	ensure.StringContains(t, tm.EnsureTopicExists("table", 1, 3, nil).Error(), "has replication factor 2 instead of 3")
+	ensure.Nil(t, tm.EnsureTopicExists("table", 1, 2, map[string]string{"segment.bytes": "1000"}))
+
+	// differing entries are updated, the others are kept
+	cfg.FixConfig = true
+	ensure.Nil(t, tm.EnsureTableExists("table", 1))
+	ensure.DeepEqual(t, cluster.topics["table"].config, map[string]string{"cleanup.policy": "compact", "segment.bytes": "1000"})
+	ensure.Nil(t, tm.EnsureTopicExists("table", 1, 2, map[string]string{"segment.bytes": "2000"}))
+	ensure.DeepEqual(t, cluster.topics["table"].config, map[string]string{"cleanup.policy": "compact", "segment.bytes": "2000"})
+}
+
+func TestTopicManager_EnsurePartitions(t *testing.T) {
+	cluster := newFakeCluster()
+	cluster.topics["topic"] = &fakeTopic{partitions: 2, replicas: 1}
+	tm := newTestTopicManager(cluster, new(kafka.TopicManagerConfig))
+
+	ensure.Nil(t, tm.EnsurePartitions("topic", 2))
+	ensure.Nil(t, tm.EnsurePartitions("topic", 4))
+	ensure.DeepEqual(t, cluster.topics["topic"].partitions, 4)
+
+	// partitions cannot be removed
+	ensure.StringContains(t, tm.EnsurePartitions("topic", 3).Error(), "cannot decrease to 3")
+	ensure.StringContains(t, tm.EnsurePartitions("missing", 3).Error(), "does not exist")
+}
+
+func TestTopicManager_DeleteTopic(t *testing.T) {
+	cluster := newFakeCluster()
+	tm := newTestTopicManager(cluster, new(kafka.TopicManagerConfig))
+	ensure.Nil(t, tm.EnsureStreamExists("topic", 1))
+
+	ensure.Nil(t, tm.DeleteTopic("topic"))
+	_, ok := cluster.topics["topic"]
+	ensure.False(t, ok)
+
+	// the errors of the brokers are returned
+	err := tm.DeleteTopic("topic")
+	ensure.NotNil(t, err)
+	ensure.StringContains(t, err.Error(), "error deleting topic topic")
+}
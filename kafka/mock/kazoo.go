@@ -4,6 +4,7 @@
 package mock
 
 import (
+	sarama "github.com/Shopify/sarama"
 	gomock "github.com/golang/mock/gomock"
 	kazoo_go "github.com/wvanbergen/kazoo-go"
 )
@@ -59,6 +60,26 @@ func (_mr *_MockTopicManagerRecorder) EnsureTopicExists(arg0, arg1, arg2, arg3 i
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "EnsureTopicExists", arg0, arg1, arg2, arg3)
 }
 
+func (_m *MockTopicManager) EnsurePartitions(topic string, npar int) error {
+	ret := _m.ctrl.Call(_m, "EnsurePartitions", topic, npar)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockTopicManagerRecorder) EnsurePartitions(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "EnsurePartitions", arg0, arg1)
+}
+
+func (_m *MockTopicManager) DeleteTopic(topic string) error {
+	ret := _m.ctrl.Call(_m, "DeleteTopic", topic)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockTopicManagerRecorder) DeleteTopic(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "DeleteTopic", arg0)
+}
+
 func (_m *MockTopicManager) Partitions(topic string) ([]int32, error) {
 	ret := _m.ctrl.Call(_m, "Partitions", topic)
 	ret0, _ := ret[0].([]int32)
@@ -132,6 +153,16 @@ func (_mr *_MockkzooRecorder) CreateTopic(arg0, arg1, arg2, arg3 interface{}) *g
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "CreateTopic", arg0, arg1, arg2, arg3)
 }
 
+func (_m *Mockkzoo) DeleteTopic(topic string) error {
+	ret := _m.ctrl.Call(_m, "DeleteTopic", topic)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockkzooRecorder) DeleteTopic(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "DeleteTopic", arg0)
+}
+
 func (_m *Mockkzoo) Close() error {
 	ret := _m.ctrl.Call(_m, "Close")
 	ret0, _ := ret[0].(error)
@@ -141,3 +172,96 @@ func (_m *Mockkzoo) Close() error {
 func (_mr *_MockkzooRecorder) Close() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Close")
 }
+
+// Mock of clusterAdmin interface
+type MockclusterAdmin struct {
+	ctrl     *gomock.Controller
+	recorder *_MockclusterAdminRecorder
+}
+
+// Recorder for MockclusterAdmin (not exported)
+type _MockclusterAdminRecorder struct {
+	mock *MockclusterAdmin
+}
+
+func NewMockclusterAdmin(ctrl *gomock.Controller) *MockclusterAdmin {
+	mock := &MockclusterAdmin{ctrl: ctrl}
+	mock.recorder = &_MockclusterAdminRecorder{mock}
+	return mock
+}
+
+func (_m *MockclusterAdmin) EXPECT() *_MockclusterAdminRecorder {
+	return _m.recorder
+}
+
+func (_m *MockclusterAdmin) ListTopics() (map[string]sarama.TopicDetail, error) {
+	ret := _m.ctrl.Call(_m, "ListTopics")
+	ret0, _ := ret[0].(map[string]sarama.TopicDetail)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockclusterAdminRecorder) ListTopics() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "ListTopics")
+}
+
+func (_m *MockclusterAdmin) CreateTopic(topic string, detail *sarama.TopicDetail, validateOnly bool) error {
+	ret := _m.ctrl.Call(_m, "CreateTopic", topic, detail, validateOnly)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockclusterAdminRecorder) CreateTopic(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "CreateTopic", arg0, arg1, arg2)
+}
+
+func (_m *MockclusterAdmin) DescribeConfig(resource sarama.ConfigResource) ([]sarama.ConfigEntry, error) {
+	ret := _m.ctrl.Call(_m, "DescribeConfig", resource)
+	ret0, _ := ret[0].([]sarama.ConfigEntry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockclusterAdminRecorder) DescribeConfig(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "DescribeConfig", arg0)
+}
+
+func (_m *MockclusterAdmin) AlterConfig(resourceType sarama.ConfigResourceType, name string, entries map[string]*string, validateOnly bool) error {
+	ret := _m.ctrl.Call(_m, "AlterConfig", resourceType, name, entries, validateOnly)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockclusterAdminRecorder) AlterConfig(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "AlterConfig", arg0, arg1, arg2, arg3)
+}
+
+func (_m *MockclusterAdmin) CreatePartitions(topic string, count int32, assignment [][]int32, validateOnly bool) error {
+	ret := _m.ctrl.Call(_m, "CreatePartitions", topic, count, assignment, validateOnly)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockclusterAdminRecorder) CreatePartitions(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "CreatePartitions", arg0, arg1, arg2, arg3)
+}
+
+func (_m *MockclusterAdmin) DeleteTopic(topic string) error {
+	ret := _m.ctrl.Call(_m, "DeleteTopic", topic)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockclusterAdminRecorder) DeleteTopic(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "DeleteTopic", arg0)
+}
+
+func (_m *MockclusterAdmin) Close() error {
+	ret := _m.ctrl.Call(_m, "Close")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockclusterAdminRecorder) Close() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Close")
+}
@@ -1,347 +1,664 @@
-// Automatically generated by MockGen. DO NOT EDIT!
+// Code generated by MockGen. DO NOT EDIT.
 // Source: github.com/Shopify/sarama (interfaces: Client,Consumer,PartitionConsumer)
 
+// Package mock is a generated GoMock package.
 package mock
 
 import (
+	reflect "reflect"
+
 	sarama "github.com/Shopify/sarama"
 	gomock "github.com/golang/mock/gomock"
 )
 
-// Mock of Client interface
+// MockClient is a mock of Client interface.
 type MockClient struct {
 	ctrl     *gomock.Controller
-	recorder *_MockClientRecorder
+	recorder *MockClientMockRecorder
 }
 
-// Recorder for MockClient (not exported)
-type _MockClientRecorder struct {
+// MockClientMockRecorder is the mock recorder for MockClient.
+type MockClientMockRecorder struct {
 	mock *MockClient
 }
 
+// NewMockClient creates a new mock instance.
 func NewMockClient(ctrl *gomock.Controller) *MockClient {
 	mock := &MockClient{ctrl: ctrl}
-	mock.recorder = &_MockClientRecorder{mock}
+	mock.recorder = &MockClientMockRecorder{mock}
 	return mock
 }
 
-func (_m *MockClient) EXPECT() *_MockClientRecorder {
-	return _m.recorder
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockClient) EXPECT() *MockClientMockRecorder {
+	return m.recorder
+}
+
+// Broker mocks base method.
+func (m *MockClient) Broker(arg0 int32) (*sarama.Broker, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Broker", arg0)
+	ret0, _ := ret[0].(*sarama.Broker)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
-func (_m *MockClient) Brokers() []*sarama.Broker {
-	ret := _m.ctrl.Call(_m, "Brokers")
+// Broker indicates an expected call of Broker.
+func (mr *MockClientMockRecorder) Broker(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Broker", reflect.TypeOf((*MockClient)(nil).Broker), arg0)
+}
+
+// Brokers mocks base method.
+func (m *MockClient) Brokers() []*sarama.Broker {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Brokers")
 	ret0, _ := ret[0].([]*sarama.Broker)
 	return ret0
 }
 
-func (_mr *_MockClientRecorder) Brokers() *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "Brokers")
+// Brokers indicates an expected call of Brokers.
+func (mr *MockClientMockRecorder) Brokers() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Brokers", reflect.TypeOf((*MockClient)(nil).Brokers))
 }
 
-func (_m *MockClient) Close() error {
-	ret := _m.ctrl.Call(_m, "Close")
+// Close mocks base method.
+func (m *MockClient) Close() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Close")
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-func (_mr *_MockClientRecorder) Close() *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "Close")
+// Close indicates an expected call of Close.
+func (mr *MockClientMockRecorder) Close() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockClient)(nil).Close))
 }
 
-func (_m *MockClient) Closed() bool {
-	ret := _m.ctrl.Call(_m, "Closed")
+// Closed mocks base method.
+func (m *MockClient) Closed() bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Closed")
 	ret0, _ := ret[0].(bool)
 	return ret0
 }
 
-func (_mr *_MockClientRecorder) Closed() *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "Closed")
+// Closed indicates an expected call of Closed.
+func (mr *MockClientMockRecorder) Closed() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Closed", reflect.TypeOf((*MockClient)(nil).Closed))
 }
 
-func (_m *MockClient) Config() *sarama.Config {
-	ret := _m.ctrl.Call(_m, "Config")
+// Config mocks base method.
+func (m *MockClient) Config() *sarama.Config {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Config")
 	ret0, _ := ret[0].(*sarama.Config)
 	return ret0
 }
 
-func (_mr *_MockClientRecorder) Config() *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "Config")
+// Config indicates an expected call of Config.
+func (mr *MockClientMockRecorder) Config() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Config", reflect.TypeOf((*MockClient)(nil).Config))
 }
 
-func (_m *MockClient) Controller() (*sarama.Broker, error) {
-	ret := _m.ctrl.Call(_m, "Controller")
+// Controller mocks base method.
+func (m *MockClient) Controller() (*sarama.Broker, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Controller")
 	ret0, _ := ret[0].(*sarama.Broker)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-func (_mr *_MockClientRecorder) Controller() *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "Controller")
+// Controller indicates an expected call of Controller.
+func (mr *MockClientMockRecorder) Controller() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Controller", reflect.TypeOf((*MockClient)(nil).Controller))
 }
 
-func (_m *MockClient) Coordinator(_param0 string) (*sarama.Broker, error) {
-	ret := _m.ctrl.Call(_m, "Coordinator", _param0)
+// Coordinator mocks base method.
+func (m *MockClient) Coordinator(arg0 string) (*sarama.Broker, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Coordinator", arg0)
 	ret0, _ := ret[0].(*sarama.Broker)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-func (_mr *_MockClientRecorder) Coordinator(arg0 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "Coordinator", arg0)
+// Coordinator indicates an expected call of Coordinator.
+func (mr *MockClientMockRecorder) Coordinator(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Coordinator", reflect.TypeOf((*MockClient)(nil).Coordinator), arg0)
 }
 
-func (_m *MockClient) GetOffset(_param0 string, _param1 int32, _param2 int64) (int64, error) {
-	ret := _m.ctrl.Call(_m, "GetOffset", _param0, _param1, _param2)
+// GetOffset mocks base method.
+func (m *MockClient) GetOffset(arg0 string, arg1 int32, arg2 int64) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOffset", arg0, arg1, arg2)
 	ret0, _ := ret[0].(int64)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-func (_mr *_MockClientRecorder) GetOffset(arg0, arg1, arg2 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetOffset", arg0, arg1, arg2)
+// GetOffset indicates an expected call of GetOffset.
+func (mr *MockClientMockRecorder) GetOffset(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOffset", reflect.TypeOf((*MockClient)(nil).GetOffset), arg0, arg1, arg2)
 }
 
-func (_m *MockClient) InSyncReplicas(_param0 string, _param1 int32) ([]int32, error) {
-	ret := _m.ctrl.Call(_m, "InSyncReplicas", _param0, _param1)
+// InSyncReplicas mocks base method.
+func (m *MockClient) InSyncReplicas(arg0 string, arg1 int32) ([]int32, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InSyncReplicas", arg0, arg1)
 	ret0, _ := ret[0].([]int32)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-func (_mr *_MockClientRecorder) InSyncReplicas(arg0, arg1 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "InSyncReplicas", arg0, arg1)
+// InSyncReplicas indicates an expected call of InSyncReplicas.
+func (mr *MockClientMockRecorder) InSyncReplicas(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InSyncReplicas", reflect.TypeOf((*MockClient)(nil).InSyncReplicas), arg0, arg1)
 }
 
-func (_m *MockClient) InitProducerID() (*sarama.InitProducerIDResponse, error) {
-	ret := _m.ctrl.Call(_m, "InitProducerID")
+// InitProducerID mocks base method.
+func (m *MockClient) InitProducerID() (*sarama.InitProducerIDResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InitProducerID")
 	ret0, _ := ret[0].(*sarama.InitProducerIDResponse)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-func (_mr *_MockClientRecorder) InitProducerID() *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "InitProducerID")
+// InitProducerID indicates an expected call of InitProducerID.
+func (mr *MockClientMockRecorder) InitProducerID() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InitProducerID", reflect.TypeOf((*MockClient)(nil).InitProducerID))
 }
 
-func (_m *MockClient) Leader(_param0 string, _param1 int32) (*sarama.Broker, error) {
-	ret := _m.ctrl.Call(_m, "Leader", _param0, _param1)
+// Leader mocks base method.
+func (m *MockClient) Leader(arg0 string, arg1 int32) (*sarama.Broker, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Leader", arg0, arg1)
 	ret0, _ := ret[0].(*sarama.Broker)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-func (_mr *_MockClientRecorder) Leader(arg0, arg1 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "Leader", arg0, arg1)
+// Leader indicates an expected call of Leader.
+func (mr *MockClientMockRecorder) Leader(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Leader", reflect.TypeOf((*MockClient)(nil).Leader), arg0, arg1)
+}
+
+// LeaderAndEpoch mocks base method.
+func (m *MockClient) LeaderAndEpoch(arg0 string, arg1 int32) (*sarama.Broker, int32, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LeaderAndEpoch", arg0, arg1)
+	ret0, _ := ret[0].(*sarama.Broker)
+	ret1, _ := ret[1].(int32)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
 }
 
-func (_m *MockClient) Partitions(_param0 string) ([]int32, error) {
-	ret := _m.ctrl.Call(_m, "Partitions", _param0)
+// LeaderAndEpoch indicates an expected call of LeaderAndEpoch.
+func (mr *MockClientMockRecorder) LeaderAndEpoch(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LeaderAndEpoch", reflect.TypeOf((*MockClient)(nil).LeaderAndEpoch), arg0, arg1)
+}
+
+// LeastLoadedBroker mocks base method.
+func (m *MockClient) LeastLoadedBroker() *sarama.Broker {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LeastLoadedBroker")
+	ret0, _ := ret[0].(*sarama.Broker)
+	return ret0
+}
+
+// LeastLoadedBroker indicates an expected call of LeastLoadedBroker.
+func (mr *MockClientMockRecorder) LeastLoadedBroker() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LeastLoadedBroker", reflect.TypeOf((*MockClient)(nil).LeastLoadedBroker))
+}
+
+// OfflineReplicas mocks base method.
+func (m *MockClient) OfflineReplicas(arg0 string, arg1 int32) ([]int32, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "OfflineReplicas", arg0, arg1)
 	ret0, _ := ret[0].([]int32)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-func (_mr *_MockClientRecorder) Partitions(arg0 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "Partitions", arg0)
+// OfflineReplicas indicates an expected call of OfflineReplicas.
+func (mr *MockClientMockRecorder) OfflineReplicas(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OfflineReplicas", reflect.TypeOf((*MockClient)(nil).OfflineReplicas), arg0, arg1)
 }
 
-func (_m *MockClient) RefreshCoordinator(_param0 string) error {
-	ret := _m.ctrl.Call(_m, "RefreshCoordinator", _param0)
+// Partitions mocks base method.
+func (m *MockClient) Partitions(arg0 string) ([]int32, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Partitions", arg0)
+	ret0, _ := ret[0].([]int32)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Partitions indicates an expected call of Partitions.
+func (mr *MockClientMockRecorder) Partitions(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Partitions", reflect.TypeOf((*MockClient)(nil).Partitions), arg0)
+}
+
+// RefreshBrokers mocks base method.
+func (m *MockClient) RefreshBrokers(arg0 []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RefreshBrokers", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RefreshBrokers indicates an expected call of RefreshBrokers.
+func (mr *MockClientMockRecorder) RefreshBrokers(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RefreshBrokers", reflect.TypeOf((*MockClient)(nil).RefreshBrokers), arg0)
+}
+
+// RefreshController mocks base method.
+func (m *MockClient) RefreshController() (*sarama.Broker, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RefreshController")
+	ret0, _ := ret[0].(*sarama.Broker)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RefreshController indicates an expected call of RefreshController.
+func (mr *MockClientMockRecorder) RefreshController() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RefreshController", reflect.TypeOf((*MockClient)(nil).RefreshController))
+}
+
+// RefreshCoordinator mocks base method.
+func (m *MockClient) RefreshCoordinator(arg0 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RefreshCoordinator", arg0)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-func (_mr *_MockClientRecorder) RefreshCoordinator(arg0 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "RefreshCoordinator", arg0)
+// RefreshCoordinator indicates an expected call of RefreshCoordinator.
+func (mr *MockClientMockRecorder) RefreshCoordinator(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RefreshCoordinator", reflect.TypeOf((*MockClient)(nil).RefreshCoordinator), arg0)
 }
 
-func (_m *MockClient) RefreshMetadata(_param0 ...string) error {
-	_s := []interface{}{}
-	for _, _x := range _param0 {
-		_s = append(_s, _x)
+// RefreshMetadata mocks base method.
+func (m *MockClient) RefreshMetadata(arg0 ...string) error {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{}
+	for _, a := range arg0 {
+		varargs = append(varargs, a)
 	}
-	ret := _m.ctrl.Call(_m, "RefreshMetadata", _s...)
+	ret := m.ctrl.Call(m, "RefreshMetadata", varargs...)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RefreshMetadata indicates an expected call of RefreshMetadata.
+func (mr *MockClientMockRecorder) RefreshMetadata(arg0 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RefreshMetadata", reflect.TypeOf((*MockClient)(nil).RefreshMetadata), arg0...)
+}
+
+// RefreshTransactionCoordinator mocks base method.
+func (m *MockClient) RefreshTransactionCoordinator(arg0 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RefreshTransactionCoordinator", arg0)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-func (_mr *_MockClientRecorder) RefreshMetadata(arg0 ...interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "RefreshMetadata", arg0...)
+// RefreshTransactionCoordinator indicates an expected call of RefreshTransactionCoordinator.
+func (mr *MockClientMockRecorder) RefreshTransactionCoordinator(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RefreshTransactionCoordinator", reflect.TypeOf((*MockClient)(nil).RefreshTransactionCoordinator), arg0)
 }
 
-func (_m *MockClient) Replicas(_param0 string, _param1 int32) ([]int32, error) {
-	ret := _m.ctrl.Call(_m, "Replicas", _param0, _param1)
+// Replicas mocks base method.
+func (m *MockClient) Replicas(arg0 string, arg1 int32) ([]int32, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Replicas", arg0, arg1)
 	ret0, _ := ret[0].([]int32)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-func (_mr *_MockClientRecorder) Replicas(arg0, arg1 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "Replicas", arg0, arg1)
+// Replicas indicates an expected call of Replicas.
+func (mr *MockClientMockRecorder) Replicas(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Replicas", reflect.TypeOf((*MockClient)(nil).Replicas), arg0, arg1)
 }
 
-func (_m *MockClient) Topics() ([]string, error) {
-	ret := _m.ctrl.Call(_m, "Topics")
+// Topics mocks base method.
+func (m *MockClient) Topics() ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Topics")
 	ret0, _ := ret[0].([]string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-func (_mr *_MockClientRecorder) Topics() *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "Topics")
+// Topics indicates an expected call of Topics.
+func (mr *MockClientMockRecorder) Topics() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Topics", reflect.TypeOf((*MockClient)(nil).Topics))
+}
+
+// TransactionCoordinator mocks base method.
+func (m *MockClient) TransactionCoordinator(arg0 string) (*sarama.Broker, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TransactionCoordinator", arg0)
+	ret0, _ := ret[0].(*sarama.Broker)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// TransactionCoordinator indicates an expected call of TransactionCoordinator.
+func (mr *MockClientMockRecorder) TransactionCoordinator(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TransactionCoordinator", reflect.TypeOf((*MockClient)(nil).TransactionCoordinator), arg0)
 }
 
-func (_m *MockClient) WritablePartitions(_param0 string) ([]int32, error) {
-	ret := _m.ctrl.Call(_m, "WritablePartitions", _param0)
+// WritablePartitions mocks base method.
+func (m *MockClient) WritablePartitions(arg0 string) ([]int32, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WritablePartitions", arg0)
 	ret0, _ := ret[0].([]int32)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-func (_mr *_MockClientRecorder) WritablePartitions(arg0 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "WritablePartitions", arg0)
+// WritablePartitions indicates an expected call of WritablePartitions.
+func (mr *MockClientMockRecorder) WritablePartitions(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WritablePartitions", reflect.TypeOf((*MockClient)(nil).WritablePartitions), arg0)
 }
 
-// Mock of Consumer interface
+// MockConsumer is a mock of Consumer interface.
 type MockConsumer struct {
 	ctrl     *gomock.Controller
-	recorder *_MockConsumerRecorder
+	recorder *MockConsumerMockRecorder
 }
 
-// Recorder for MockConsumer (not exported)
-type _MockConsumerRecorder struct {
+// MockConsumerMockRecorder is the mock recorder for MockConsumer.
+type MockConsumerMockRecorder struct {
 	mock *MockConsumer
 }
 
+// NewMockConsumer creates a new mock instance.
 func NewMockConsumer(ctrl *gomock.Controller) *MockConsumer {
 	mock := &MockConsumer{ctrl: ctrl}
-	mock.recorder = &_MockConsumerRecorder{mock}
+	mock.recorder = &MockConsumerMockRecorder{mock}
 	return mock
 }
 
-func (_m *MockConsumer) EXPECT() *_MockConsumerRecorder {
-	return _m.recorder
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockConsumer) EXPECT() *MockConsumerMockRecorder {
+	return m.recorder
 }
 
-func (_m *MockConsumer) Close() error {
-	ret := _m.ctrl.Call(_m, "Close")
+// Close mocks base method.
+func (m *MockConsumer) Close() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Close")
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-func (_mr *_MockConsumerRecorder) Close() *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "Close")
+// Close indicates an expected call of Close.
+func (mr *MockConsumerMockRecorder) Close() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockConsumer)(nil).Close))
 }
 
-func (_m *MockConsumer) ConsumePartition(_param0 string, _param1 int32, _param2 int64) (sarama.PartitionConsumer, error) {
-	ret := _m.ctrl.Call(_m, "ConsumePartition", _param0, _param1, _param2)
+// ConsumePartition mocks base method.
+func (m *MockConsumer) ConsumePartition(arg0 string, arg1 int32, arg2 int64) (sarama.PartitionConsumer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConsumePartition", arg0, arg1, arg2)
 	ret0, _ := ret[0].(sarama.PartitionConsumer)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-func (_mr *_MockConsumerRecorder) ConsumePartition(arg0, arg1, arg2 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "ConsumePartition", arg0, arg1, arg2)
+// ConsumePartition indicates an expected call of ConsumePartition.
+func (mr *MockConsumerMockRecorder) ConsumePartition(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConsumePartition", reflect.TypeOf((*MockConsumer)(nil).ConsumePartition), arg0, arg1, arg2)
 }
 
-func (_m *MockConsumer) HighWaterMarks() map[string]map[int32]int64 {
-	ret := _m.ctrl.Call(_m, "HighWaterMarks")
+// HighWaterMarks mocks base method.
+func (m *MockConsumer) HighWaterMarks() map[string]map[int32]int64 {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HighWaterMarks")
 	ret0, _ := ret[0].(map[string]map[int32]int64)
 	return ret0
 }
 
-func (_mr *_MockConsumerRecorder) HighWaterMarks() *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "HighWaterMarks")
+// HighWaterMarks indicates an expected call of HighWaterMarks.
+func (mr *MockConsumerMockRecorder) HighWaterMarks() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HighWaterMarks", reflect.TypeOf((*MockConsumer)(nil).HighWaterMarks))
 }
 
-func (_m *MockConsumer) Partitions(_param0 string) ([]int32, error) {
-	ret := _m.ctrl.Call(_m, "Partitions", _param0)
+// Partitions mocks base method.
+func (m *MockConsumer) Partitions(arg0 string) ([]int32, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Partitions", arg0)
 	ret0, _ := ret[0].([]int32)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-func (_mr *_MockConsumerRecorder) Partitions(arg0 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "Partitions", arg0)
+// Partitions indicates an expected call of Partitions.
+func (mr *MockConsumerMockRecorder) Partitions(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Partitions", reflect.TypeOf((*MockConsumer)(nil).Partitions), arg0)
+}
+
+// Pause mocks base method.
+func (m *MockConsumer) Pause(arg0 map[string][]int32) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Pause", arg0)
+}
+
+// Pause indicates an expected call of Pause.
+func (mr *MockConsumerMockRecorder) Pause(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Pause", reflect.TypeOf((*MockConsumer)(nil).Pause), arg0)
+}
+
+// PauseAll mocks base method.
+func (m *MockConsumer) PauseAll() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "PauseAll")
+}
+
+// PauseAll indicates an expected call of PauseAll.
+func (mr *MockConsumerMockRecorder) PauseAll() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PauseAll", reflect.TypeOf((*MockConsumer)(nil).PauseAll))
+}
+
+// Resume mocks base method.
+func (m *MockConsumer) Resume(arg0 map[string][]int32) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Resume", arg0)
 }
 
-func (_m *MockConsumer) Topics() ([]string, error) {
-	ret := _m.ctrl.Call(_m, "Topics")
+// Resume indicates an expected call of Resume.
+func (mr *MockConsumerMockRecorder) Resume(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Resume", reflect.TypeOf((*MockConsumer)(nil).Resume), arg0)
+}
+
+// ResumeAll mocks base method.
+func (m *MockConsumer) ResumeAll() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "ResumeAll")
+}
+
+// ResumeAll indicates an expected call of ResumeAll.
+func (mr *MockConsumerMockRecorder) ResumeAll() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResumeAll", reflect.TypeOf((*MockConsumer)(nil).ResumeAll))
+}
+
+// Topics mocks base method.
+func (m *MockConsumer) Topics() ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Topics")
 	ret0, _ := ret[0].([]string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-func (_mr *_MockConsumerRecorder) Topics() *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "Topics")
+// Topics indicates an expected call of Topics.
+func (mr *MockConsumerMockRecorder) Topics() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Topics", reflect.TypeOf((*MockConsumer)(nil).Topics))
 }
 
-// Mock of PartitionConsumer interface
+// MockPartitionConsumer is a mock of PartitionConsumer interface.
 type MockPartitionConsumer struct {
 	ctrl     *gomock.Controller
-	recorder *_MockPartitionConsumerRecorder
+	recorder *MockPartitionConsumerMockRecorder
 }
 
-// Recorder for MockPartitionConsumer (not exported)
-type _MockPartitionConsumerRecorder struct {
+// MockPartitionConsumerMockRecorder is the mock recorder for MockPartitionConsumer.
+type MockPartitionConsumerMockRecorder struct {
 	mock *MockPartitionConsumer
 }
 
+// NewMockPartitionConsumer creates a new mock instance.
 func NewMockPartitionConsumer(ctrl *gomock.Controller) *MockPartitionConsumer {
 	mock := &MockPartitionConsumer{ctrl: ctrl}
-	mock.recorder = &_MockPartitionConsumerRecorder{mock}
+	mock.recorder = &MockPartitionConsumerMockRecorder{mock}
 	return mock
 }
 
-func (_m *MockPartitionConsumer) EXPECT() *_MockPartitionConsumerRecorder {
-	return _m.recorder
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockPartitionConsumer) EXPECT() *MockPartitionConsumerMockRecorder {
+	return m.recorder
 }
 
-func (_m *MockPartitionConsumer) AsyncClose() {
-	_m.ctrl.Call(_m, "AsyncClose")
+// AsyncClose mocks base method.
+func (m *MockPartitionConsumer) AsyncClose() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "AsyncClose")
 }
 
-func (_mr *_MockPartitionConsumerRecorder) AsyncClose() *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "AsyncClose")
+// AsyncClose indicates an expected call of AsyncClose.
+func (mr *MockPartitionConsumerMockRecorder) AsyncClose() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AsyncClose", reflect.TypeOf((*MockPartitionConsumer)(nil).AsyncClose))
 }
 
-func (_m *MockPartitionConsumer) Close() error {
-	ret := _m.ctrl.Call(_m, "Close")
+// Close mocks base method.
+func (m *MockPartitionConsumer) Close() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Close")
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-func (_mr *_MockPartitionConsumerRecorder) Close() *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "Close")
+// Close indicates an expected call of Close.
+func (mr *MockPartitionConsumerMockRecorder) Close() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockPartitionConsumer)(nil).Close))
 }
 
-func (_m *MockPartitionConsumer) Errors() <-chan *sarama.ConsumerError {
-	ret := _m.ctrl.Call(_m, "Errors")
+// Errors mocks base method.
+func (m *MockPartitionConsumer) Errors() <-chan *sarama.ConsumerError {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Errors")
 	ret0, _ := ret[0].(<-chan *sarama.ConsumerError)
 	return ret0
 }
 
-func (_mr *_MockPartitionConsumerRecorder) Errors() *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "Errors")
+// Errors indicates an expected call of Errors.
+func (mr *MockPartitionConsumerMockRecorder) Errors() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Errors", reflect.TypeOf((*MockPartitionConsumer)(nil).Errors))
 }
 
-func (_m *MockPartitionConsumer) HighWaterMarkOffset() int64 {
-	ret := _m.ctrl.Call(_m, "HighWaterMarkOffset")
+// HighWaterMarkOffset mocks base method.
+func (m *MockPartitionConsumer) HighWaterMarkOffset() int64 {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HighWaterMarkOffset")
 	ret0, _ := ret[0].(int64)
 	return ret0
 }
 
-func (_mr *_MockPartitionConsumerRecorder) HighWaterMarkOffset() *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "HighWaterMarkOffset")
+// HighWaterMarkOffset indicates an expected call of HighWaterMarkOffset.
+func (mr *MockPartitionConsumerMockRecorder) HighWaterMarkOffset() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HighWaterMarkOffset", reflect.TypeOf((*MockPartitionConsumer)(nil).HighWaterMarkOffset))
+}
+
+// IsPaused mocks base method.
+func (m *MockPartitionConsumer) IsPaused() bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsPaused")
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// IsPaused indicates an expected call of IsPaused.
+func (mr *MockPartitionConsumerMockRecorder) IsPaused() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsPaused", reflect.TypeOf((*MockPartitionConsumer)(nil).IsPaused))
 }
 
-func (_m *MockPartitionConsumer) Messages() <-chan *sarama.ConsumerMessage {
-	ret := _m.ctrl.Call(_m, "Messages")
+// Messages mocks base method.
+func (m *MockPartitionConsumer) Messages() <-chan *sarama.ConsumerMessage {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Messages")
 	ret0, _ := ret[0].(<-chan *sarama.ConsumerMessage)
 	return ret0
 }
 
-func (_mr *_MockPartitionConsumerRecorder) Messages() *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "Messages")
+// Messages indicates an expected call of Messages.
+func (mr *MockPartitionConsumerMockRecorder) Messages() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Messages", reflect.TypeOf((*MockPartitionConsumer)(nil).Messages))
+}
+
+// Pause mocks base method.
+func (m *MockPartitionConsumer) Pause() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Pause")
+}
+
+// Pause indicates an expected call of Pause.
+func (mr *MockPartitionConsumerMockRecorder) Pause() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Pause", reflect.TypeOf((*MockPartitionConsumer)(nil).Pause))
+}
+
+// Resume mocks base method.
+func (m *MockPartitionConsumer) Resume() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Resume")
+}
+
+// Resume indicates an expected call of Resume.
+func (mr *MockPartitionConsumerMockRecorder) Resume() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Resume", reflect.TypeOf((*MockPartitionConsumer)(nil).Resume))
 }
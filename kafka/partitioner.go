@@ -0,0 +1,96 @@
+package kafka
+
+import (
+	"fmt"
+	"hash"
+
+	"github.com/Shopify/sarama"
+)
+
+// Partitioner assigns a message key to one of numPartitions partitions.
+type Partitioner func(key string, numPartitions int32) (int32, error)
+
+// NewPartitionerConstructor creates a sarama partitioner constructor that
+// assigns messages of the topics in partitioners with their Partitioner and
+// messages of all other topics by hashing the key with hasher.
+func NewPartitionerConstructor(hasher func() hash.Hash32, partitioners map[string]Partitioner) sarama.PartitionerConstructor {
+	fallback := sarama.NewCustomHashPartitioner(hasher)
+	return func(topic string) sarama.Partitioner {
+		p, ok := partitioners[topic]
+		if !ok {
+			return fallback(topic)
+		}
+		return &topicPartitioner{topic: topic, partitioner: p}
+	}
+}
+
+type topicPartitioner struct {
+	topic       string
+	partitioner Partitioner
+}
+
+func (p *topicPartitioner) Partition(msg *sarama.ProducerMessage, numPartitions int32) (int32, error) {
+	var key string
+	if msg.Key != nil {
+		k, err := msg.Key.Encode()
+		if err != nil {
+			return -1, fmt.Errorf("error encoding key of message to %s: %v", p.topic, err)
+		}
+		key = string(k)
+	}
+	partition, err := p.partitioner(key, numPartitions)
+	if err != nil {
+		return -1, err
+	}
+	if partition < 0 || partition >= numPartitions {
+		return -1, fmt.Errorf("partitioner of %s returned partition %d, topic has %d partitions",
+			p.topic, partition, numPartitions)
+	}
+	return partition, nil
+}
+
+func (p *topicPartitioner) RequiresConsistency() bool {
+	return true
+}
+
+// newExplicitPartitionerConstructor wraps a partitioner constructor so that
+// messages with an explicit partition are sent to that partition and messages
+// without key are distributed round-robin. All other messages are assigned by
+// the partitioners of constructor, which defaults to hashing the keys.
+func newExplicitPartitionerConstructor(constructor sarama.PartitionerConstructor) sarama.PartitionerConstructor {
+	if constructor == nil {
+		constructor = sarama.NewHashPartitioner
+	}
+	return func(topic string) sarama.Partitioner {
+		return &explicitPartitioner{Partitioner: constructor(topic), topic: topic}
+	}
+}
+
+type explicitPartitioner struct {
+	sarama.Partitioner
+	topic string
+	// next is the partition of the next message without key. Sarama calls
+	// the partitioner of a topic from a single goroutine.
+	next int32
+}
+
+func (p *explicitPartitioner) Partition(msg *sarama.ProducerMessage, numPartitions int32) (int32, error) {
+	meta, ok := msg.Metadata.(*messageMetadata)
+	if ok && meta.roundRobin && meta.partition == nil {
+		if p.next >= numPartitions {
+			p.next = 0
+		}
+		partition := p.next
+		p.next++
+		return partition, nil
+	}
+	if !ok || meta.partition == nil {
+		return p.Partitioner.Partition(msg, numPartitions)
+	}
+	partition := *meta.partition
+	if partition < 0 || partition >= numPartitions {
+		return -1, fmt.Errorf("cannot send message to partition %d of %s, topic has %d partitions",
+			partition, p.topic, numPartitions)
+	}
+	return partition, nil
+}
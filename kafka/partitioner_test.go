@@ -0,0 +1,67 @@
+package kafka
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/facebookgo/ensure"
+)
+
+func TestPartitionerConstructor(t *testing.T) {
+	region := func(key string, numPartitions int32) (int32, error) {
+		switch key {
+		case "eu":
+			return 0, nil
+		case "us":
+			return 1, nil
+		case "invalid":
+			return numPartitions, nil
+		}
+		return -1, errors.New("unknown region")
+	}
+	pc := NewPartitionerConstructor(nil, map[string]Partitioner{"regions": region})
+
+	p := pc("regions")
+	ensure.True(t, p.RequiresConsistency())
+
+	par, err := p.Partition(&sarama.ProducerMessage{Key: sarama.StringEncoder("us")}, 4)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, par, int32(1))
+
+	_, err = p.Partition(&sarama.ProducerMessage{Key: sarama.StringEncoder("asia")}, 4)
+	ensure.NotNil(t, err)
+
+	_, err = p.Partition(&sarama.ProducerMessage{Key: sarama.StringEncoder("invalid")}, 4)
+	ensure.StringContains(t, err.Error(), "returned partition 4")
+}
+
+func TestExplicitPartitionerConstructor(t *testing.T) {
+	byKey := func(key string, numPartitions int32) (int32, error) {
+		return int32(len(key)) % numPartitions, nil
+	}
+	pc := newExplicitPartitionerConstructor(NewPartitionerConstructor(nil, map[string]Partitioner{"topic": byKey}))
+	p := pc("topic")
+	ensure.True(t, p.RequiresConsistency())
+
+	// messages without explicit partition use the wrapped partitioner
+	par, err := p.Partition(&sarama.ProducerMessage{Key: sarama.StringEncoder("abc"), Metadata: &messageMetadata{}}, 4)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, par, int32(3))
+
+	partition := int32(1)
+	par, err = p.Partition(&sarama.ProducerMessage{Key: sarama.StringEncoder("abc"), Metadata: &messageMetadata{partition: &partition}}, 4)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, par, int32(1))
+
+	partition = 4
+	_, err = p.Partition(&sarama.ProducerMessage{Key: sarama.StringEncoder("abc"), Metadata: &messageMetadata{partition: &partition}}, 4)
+	ensure.StringContains(t, err.Error(), "topic has 4 partitions")
+
+	// messages without key are distributed round-robin
+	for i := 0; i < 6; i++ {
+		par, err = p.Partition(&sarama.ProducerMessage{Metadata: &messageMetadata{roundRobin: true}}, 4)
+		ensure.Nil(t, err)
+		ensure.DeepEqual(t, par, int32(i%4))
+	}
+}
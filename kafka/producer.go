@@ -2,17 +2,95 @@ package kafka
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/Shopify/sarama"
 )
 
+// Headers are the headers of a Kafka message.
+type Headers map[string][]byte
+
+// HeadersOf returns the headers of a sarama message, eg, of the message
+// passed to the callbacks of Promise.ThenWithMessage. If a header occurs
+// several times, the last value is returned.
+func HeadersOf(msg *sarama.ProducerMessage) Headers {
+	if msg == nil || len(msg.Headers) == 0 {
+		return nil
+	}
+	headers := make(Headers, len(msg.Headers))
+	for _, h := range msg.Headers {
+		headers[string(h.Key)] = h.Value
+	}
+	return headers
+}
+
+// consumedHeaders converts the headers of a consumed sarama message.
+func consumedHeaders(records []*sarama.RecordHeader) Headers {
+	if len(records) == 0 {
+		return nil
+	}
+	headers := make(Headers, len(records))
+	for _, h := range records {
+		if h != nil {
+			headers[string(h.Key)] = h.Value
+		}
+	}
+	return headers
+}
+
+// ProducerMessage is a message to be sent by a producer including the
+// optional attributes of Kafka messages.
+type ProducerMessage struct {
+	Topic string
+	Key   string
+	// NoKey sends the message without key instead of Key. Messages without
+	// key are distributed over the partitions round-robin.
+	NoKey   bool
+	Value   []byte
+	Headers Headers
+	// Partition is the partition the message is sent to. If nil, the
+	// partitioner of the producer assigns the partition.
+	Partition *int32
+	// Timestamp is the timestamp of the message. If zero, the time of
+	// producing the message is used.
+	Timestamp time.Time
+}
+
+// messageMetadata is attached to the sarama messages of the producer.
+type messageMetadata struct {
+	promise    *Promise
+	partition  *int32
+	roundRobin bool
+}
+
 // Producer abstracts the kafka producer
 type Producer interface {
 	// Emit sends a message to topic.
 	Emit(topic string, key string, value []byte) *Promise
+	// EmitMessage sends a message with optional attributes, eg, headers.
+	EmitMessage(msg *ProducerMessage) *Promise
 	Close() error
 }
 
+// TransactionalProducer is a producer writing messages in transactions, so
+// that the messages of a transaction and the consumer offsets added to it are
+// committed atomically. Consumers reading committed messages only see the
+// messages of a transaction once it is committed, all at once or, if aborted,
+// never.
+type TransactionalProducer interface {
+	Producer
+	// BeginTxn begins a transaction. The messages emitted until the
+	// transaction is committed or aborted are part of it.
+	BeginTxn() error
+	// AddOffsetsToTxn adds the last processed offsets of group to the
+	// transaction. They are committed together with the messages.
+	AddOffsetsToTxn(group string, offsets map[string]map[int32]int64) error
+	// CommitTxn commits the transaction after all its messages were sent.
+	CommitTxn() error
+	// AbortTxn aborts the transaction.
+	AbortTxn() error
+}
+
 type producer struct {
 	producer sarama.AsyncProducer
 	stop     chan bool
@@ -21,7 +99,12 @@ type producer struct {
 
 // NewProducer creates new kafka producer for passed brokers.
 func NewProducer(brokers []string, config *sarama.Config) (Producer, error) {
-	aprod, err := sarama.NewAsyncProducer(brokers, config)
+	// messages with explicit partitions bypass the partitioner. The config is
+	// copied, so that the partitioner of the caller's config is not wrapped
+	// again by each call.
+	cfg := *config
+	cfg.Producer.Partitioner = newExplicitPartitionerConstructor(config.Producer.Partitioner)
+	aprod, err := sarama.NewAsyncProducer(brokers, &cfg)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to start Sarama producer: %v", err)
 	}
@@ -34,9 +117,70 @@ func NewProducer(brokers []string, config *sarama.Config) (Producer, error) {
 
 	go p.run()
 
+	if config.Producer.Transaction.ID != "" {
+		return &transactionalProducer{&p}, nil
+	}
 	return &p, nil
 }
 
+// NewTransactionalProducer creates a producer writing messages in
+// transactions. The config must contain a transactional ID and enable the
+// idempotent producer (see WithTransactionalID). Producers with the same ID fence each other, so each
+// producer instance needs its own ID.
+func NewTransactionalProducer(brokers []string, config *sarama.Config) (TransactionalProducer, error) {
+	if config.Producer.Transaction.ID == "" {
+		return nil, fmt.Errorf("transactional producer requires a transactional ID")
+	}
+	p, err := NewProducer(brokers, config)
+	if err != nil {
+		return nil, err
+	}
+	return p.(TransactionalProducer), nil
+}
+
+// transactionalProducer is a producer created with a transactional ID.
+type transactionalProducer struct {
+	*producer
+}
+
+func (p *transactionalProducer) BeginTxn() error {
+	if err := p.producer.producer.BeginTxn(); err != nil {
+		return fmt.Errorf("error beginning transaction: %v", err)
+	}
+	return nil
+}
+
+func (p *transactionalProducer) AddOffsetsToTxn(group string, offsets map[string]map[int32]int64) error {
+	pom := make(map[string][]*sarama.PartitionOffsetMetadata, len(offsets))
+	for topic, partitions := range offsets {
+		for partition, offset := range partitions {
+			// Kafka stores the next offset to consume
+			pom[topic] = append(pom[topic], &sarama.PartitionOffsetMetadata{
+				Partition: partition,
+				Offset:    offset + 1,
+			})
+		}
+	}
+	if err := p.producer.producer.AddOffsetsToTxn(pom, group); err != nil {
+		return fmt.Errorf("error adding offsets to transaction: %v", err)
+	}
+	return nil
+}
+
+func (p *transactionalProducer) CommitTxn() error {
+	if err := p.producer.producer.CommitTxn(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
+	return nil
+}
+
+func (p *transactionalProducer) AbortTxn() error {
+	if err := p.producer.producer.AbortTxn(); err != nil {
+		return fmt.Errorf("error aborting transaction: %v", err)
+	}
+	return nil
+}
+
 func (p *producer) Close() error {
 	close(p.stop)
 	<-p.done
@@ -44,13 +188,25 @@ func (p *producer) Close() error {
 }
 
 func (p *producer) Emit(topic string, key string, value []byte) *Promise {
+	return p.EmitMessage(&ProducerMessage{Topic: topic, Key: key, Value: value})
+}
+
+func (p *producer) EmitMessage(msg *ProducerMessage) *Promise {
 	promise := NewPromise()
-	p.producer.Input() <- &sarama.ProducerMessage{
-		Topic:    topic,
-		Key:      sarama.StringEncoder(key),
-		Value:    sarama.ByteEncoder(value),
-		Metadata: promise,
+	pm := &sarama.ProducerMessage{
+		Topic:     msg.Topic,
+		Key:       sarama.StringEncoder(msg.Key),
+		Value:     sarama.ByteEncoder(msg.Value),
+		Metadata:  &messageMetadata{promise: promise, partition: msg.Partition, roundRobin: msg.NoKey},
+		Timestamp: msg.Timestamp,
+	}
+	if msg.NoKey {
+		pm.Key = nil
+	}
+	for k, v := range msg.Headers {
+		pm.Headers = append(pm.Headers, sarama.RecordHeader{Key: []byte(k), Value: v})
 	}
+	p.producer.Input() <- pm
 	return promise
 }
 
@@ -63,12 +219,12 @@ func (p *producer) run() {
 			return
 
 		case err := <-p.producer.Errors():
-			promise := err.Msg.Metadata.(*Promise)
-			promise.Finish(err.Err)
+			meta := err.Msg.Metadata.(*messageMetadata)
+			meta.promise.FinishWithMessage(err.Msg, err.Err)
 
 		case msg := <-p.producer.Successes():
-			promise := msg.Metadata.(*Promise)
-			promise.Finish(nil)
+			meta := msg.Metadata.(*messageMetadata)
+			meta.promise.FinishWithMessage(msg, nil)
 		}
 	}
 }
@@ -0,0 +1,68 @@
+package kafka
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/facebookgo/ensure"
+)
+
+// newMockedProducer creates a producer sending to a mocked sarama producer.
+func newMockedProducer(t *testing.T) (*producer, *mocks.AsyncProducer) {
+	config := sarama.NewConfig()
+	config.Producer.Return.Successes = true
+	mp := mocks.NewAsyncProducer(t, config)
+	p := &producer{
+		producer: mp,
+		stop:     make(chan bool),
+		done:     make(chan bool),
+	}
+	go p.run()
+	return p, mp
+}
+
+func TestProducer_timestamp(t *testing.T) {
+	p, mp := newMockedProducer(t)
+	defer p.Close()
+
+	ts := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	mp.ExpectInputWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		if !msg.Timestamp.Equal(ts) {
+			return fmt.Errorf("unexpected timestamp %v", msg.Timestamp)
+		}
+		return nil
+	})
+	// without a timestamp, sarama sets the time of producing
+	mp.ExpectInputWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		if !msg.Timestamp.IsZero() {
+			return fmt.Errorf("unexpected timestamp %v", msg.Timestamp)
+		}
+		return nil
+	})
+
+	ensure.Nil(t, waitForPromise(p.EmitMessage(&ProducerMessage{Topic: "topic", Key: "key", Value: []byte("value"), Timestamp: ts})))
+	ensure.Nil(t, waitForPromise(p.Emit("topic", "key", []byte("value"))))
+}
+
+func TestNewProducer_keepsConfig(t *testing.T) {
+	config := sarama.NewConfig()
+	partitioner := config.Producer.Partitioner
+
+	// the partitioner is wrapped in a copy of the config, even if creating
+	// the producer fails
+	_, err := NewProducer(nil, config)
+	ensure.NotNil(t, err)
+	ensure.DeepEqual(t, reflect.ValueOf(config.Producer.Partitioner).Pointer(), reflect.ValueOf(partitioner).Pointer())
+}
+
+func waitForPromise(promise *Promise) error {
+	done := make(chan error, 1)
+	promise.Then(func(err error) {
+		done <- err
+	})
+	return <-done
+}
@@ -1,14 +1,19 @@
 package kafka
 
-import "sync"
+import (
+	"sync"
+
+	"github.com/Shopify/sarama"
+)
 
 // Promise as in https://en.wikipedia.org/wiki/Futures_and_promises
 type Promise struct {
 	sync.Mutex
 	err      error
+	msg      *sarama.ProducerMessage
 	finished bool
 
-	callbacks []func(err error)
+	callbacks []func(msg *sarama.ProducerMessage, err error)
 }
 
 // NewPromise creates a new Promise
@@ -24,7 +29,7 @@ func (p *Promise) executeCallbacks() {
 		return
 	}
 	for _, s := range p.callbacks {
-		s(p.err)
+		s(p.msg, p.err)
 	}
 	// mark as finished
 	p.finished = true
@@ -32,12 +37,21 @@ func (p *Promise) executeCallbacks() {
 
 // Then chains a callback to the Promise
 func (p *Promise) Then(s func(err error)) *Promise {
+	return p.ThenWithMessage(func(msg *sarama.ProducerMessage, err error) {
+		s(err)
+	})
+}
+
+// ThenWithMessage chains a callback to the Promise that receives the produced
+// message, eg, to read the partition and offset the message was written to.
+// The message is nil if the promise was not finished by a producer.
+func (p *Promise) ThenWithMessage(s func(msg *sarama.ProducerMessage, err error)) *Promise {
 	p.Lock()
 	defer p.Unlock()
 
 	// promise already run, call the callback immediately
 	if p.finished {
-		s(p.err)
+		s(p.msg, p.err)
 		// append it to the subscribers otherwise
 	} else {
 		p.callbacks = append(p.callbacks, s)
@@ -47,10 +61,17 @@ func (p *Promise) Then(s func(err error)) *Promise {
 
 // Finish finishes the promise by executing all callbacks and saving the message/error for late subscribers
 func (p *Promise) Finish(err error) *Promise {
+	return p.FinishWithMessage(nil, err)
+}
+
+// FinishWithMessage finishes the promise like Finish and passes the produced
+// message to the callbacks chained with ThenWithMessage.
+func (p *Promise) FinishWithMessage(msg *sarama.ProducerMessage, err error) *Promise {
 	p.Lock()
 	defer p.Unlock()
 
 	p.err = err
+	p.msg = msg
 
 	p.executeCallbacks()
 	return p
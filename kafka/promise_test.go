@@ -4,6 +4,7 @@ import (
 	"errors"
 	"testing"
 
+	"github.com/Shopify/sarama"
 	"github.com/facebookgo/ensure"
 )
 
@@ -36,3 +37,40 @@ func TestPromise_thenAfterFinish(t *testing.T) {
 
 	ensure.DeepEqual(t, promiseErr.Error(), "test")
 }
+
+func TestPromise_thenWithMessage(t *testing.T) {
+	p := new(Promise)
+
+	var (
+		promiseMsg *sarama.ProducerMessage
+		promiseErr error
+	)
+	p.ThenWithMessage(func(msg *sarama.ProducerMessage, err error) {
+		promiseMsg = msg
+		promiseErr = err
+	})
+
+	msg := &sarama.ProducerMessage{Topic: "topic", Partition: 1, Offset: 2}
+	p.FinishWithMessage(msg, nil)
+
+	ensure.True(t, promiseMsg == msg)
+	ensure.Nil(t, promiseErr)
+
+	// late subscribers receive the message too
+	p.ThenWithMessage(func(msg *sarama.ProducerMessage, err error) {
+		ensure.True(t, msg == promiseMsg)
+	})
+}
+
+func TestPromise_headers(t *testing.T) {
+	var headers Headers
+	p := new(Promise).ThenWithMessage(func(msg *sarama.ProducerMessage, err error) {
+		headers = HeadersOf(msg)
+	})
+	p.FinishWithMessage(&sarama.ProducerMessage{
+		Headers: []sarama.RecordHeader{{Key: []byte("header"), Value: []byte("value")}},
+	}, nil)
+	ensure.DeepEqual(t, headers, Headers{"header": []byte("value")})
+
+	ensure.True(t, HeadersOf(nil) == nil)
+}
@@ -0,0 +1,78 @@
+package kafka
+
+import (
+	"crypto/tls"
+
+	"github.com/Shopify/sarama"
+	cluster "github.com/bsm/sarama-cluster"
+)
+
+// ConfigOption modifies the configuration of the Kafka clients, eg, to
+// connect to secured clusters without building the whole configuration.
+type ConfigOption func(config *cluster.Config)
+
+// NewConfigWithOptions creates a configuration like NewConfig and applies
+// opts to it.
+func NewConfigWithOptions(opts ...ConfigOption) *cluster.Config {
+	config := NewConfig()
+	for _, opt := range opts {
+		opt(config)
+	}
+	return config
+}
+
+// WithTLS connects to the brokers via TLS configured by tlsConfig. If
+// tlsConfig is nil, the default configuration of crypto/tls is used.
+func WithTLS(tlsConfig *tls.Config) ConfigOption {
+	return func(config *cluster.Config) {
+		config.Net.TLS.Enable = true
+		config.Net.TLS.Config = tlsConfig
+	}
+}
+
+// WithSASLPlain authenticates with user and password using SASL/PLAIN. The
+// password is sent in plain text, so the option should be combined with
+// WithTLS.
+func WithSASLPlain(user, password string) ConfigOption {
+	return func(config *cluster.Config) {
+		enableSASL(config, sarama.SASLTypePlaintext)
+		config.Net.SASL.User = user
+		config.Net.SASL.Password = password
+	}
+}
+
+// WithSASLSCRAM authenticates with user and password using SASL/SCRAM.
+// The mechanism is either sarama.SASLTypeSCRAMSHA256 or
+// sarama.SASLTypeSCRAMSHA512. Sarama does not implement SCRAM itself, so
+// client has to create SCRAM clients, eg, based on github.com/xdg/scram.
+func WithSASLSCRAM(user, password string, mechanism sarama.SASLMechanism, client func() sarama.SCRAMClient) ConfigOption {
+	return func(config *cluster.Config) {
+		enableSASL(config, mechanism)
+		config.Net.SASL.User = user
+		config.Net.SASL.Password = password
+		config.Net.SASL.SCRAMClientGeneratorFunc = client
+	}
+}
+
+// WithSASLOAuth authenticates with the tokens of provider using
+// SASL/OAUTHBEARER. The provider is asked for a token on every connection, so
+// it should cache and refresh its tokens.
+func WithSASLOAuth(provider sarama.AccessTokenProvider) ConfigOption {
+	return func(config *cluster.Config) {
+		enableSASL(config, sarama.SASLTypeOAuth)
+		config.Net.SASL.TokenProvider = provider
+	}
+}
+
+func enableSASL(config *cluster.Config, mechanism sarama.SASLMechanism) {
+	config.Net.SASL.Enable = true
+	config.Net.SASL.Handshake = true
+	config.Net.SASL.Mechanism = mechanism
+	// OAUTHBEARER requires the SASL handshake of Kafka 1.0
+	if mechanism == sarama.SASLTypeOAuth {
+		config.Net.SASL.Version = sarama.SASLHandshakeV1
+		if !config.Version.IsAtLeast(sarama.V1_0_0_0) {
+			config.Version = sarama.V1_0_0_0
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package kafka
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/facebookgo/ensure"
+)
+
+type tokenProvider struct{}
+
+func (tokenProvider) Token() (*sarama.AccessToken, error) {
+	return &sarama.AccessToken{Token: "token"}, nil
+}
+
+func TestConfigOptions(t *testing.T) {
+	tlsConfig := new(tls.Config)
+	config := NewConfigWithOptions(WithTLS(tlsConfig), WithSASLPlain("user", "password"))
+	ensure.True(t, config.Net.TLS.Enable)
+	ensure.True(t, config.Net.TLS.Config == tlsConfig)
+	ensure.True(t, config.Net.SASL.Enable)
+	ensure.DeepEqual(t, config.Net.SASL.Mechanism, sarama.SASLMechanism(sarama.SASLTypePlaintext))
+	ensure.DeepEqual(t, config.Net.SASL.User, "user")
+	ensure.DeepEqual(t, config.Net.SASL.Password, "password")
+
+	config = NewConfigWithOptions(WithSASLSCRAM("user", "password", sarama.SASLTypeSCRAMSHA512, nil))
+	ensure.DeepEqual(t, config.Net.SASL.Mechanism, sarama.SASLMechanism(sarama.SASLTypeSCRAMSHA512))
+
+	config = NewConfigWithOptions(WithSASLOAuth(tokenProvider{}))
+	ensure.DeepEqual(t, config.Net.SASL.Mechanism, sarama.SASLMechanism(sarama.SASLTypeOAuth))
+	ensure.DeepEqual(t, config.Net.SASL.Version, sarama.SASLHandshakeV1)
+	ensure.NotNil(t, config.Net.SASL.TokenProvider)
+}
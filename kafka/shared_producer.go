@@ -0,0 +1,93 @@
+package kafka
+
+import (
+	"errors"
+	"fmt"
+	"hash"
+	"sync"
+)
+
+// errProducerRefClosed is returned when emitting with a closed shared producer.
+var errProducerRefClosed = errors.New("shared producer closed")
+
+// sharedProducer is a producer used by several clients, eg, processors of
+// different groups. It is closed once all clients closed it.
+type sharedProducer struct {
+	m        sync.Mutex
+	builder  ProducerBuilder
+	producer Producer
+	refs     int
+}
+
+// SharedProducerBuilder creates a ProducerBuilder that shares a single
+// producer created with builder among all its users, reducing the number of
+// connections of binaries running many processors. The producer is created
+// with the brokers, client ID and hasher of the first user and closed when
+// the last user closes it, so all users should connect to the same brokers
+// and use the same hasher.
+func SharedProducerBuilder(builder ProducerBuilder) ProducerBuilder {
+	s := &sharedProducer{builder: builder}
+	return func(brokers []string, clientID string, hasher func() hash.Hash32) (Producer, error) {
+		s.m.Lock()
+		defer s.m.Unlock()
+		if s.producer == nil {
+			p, err := s.builder(brokers, clientID, hasher)
+			if err != nil {
+				return nil, fmt.Errorf("error creating shared producer: %v", err)
+			}
+			s.producer = p
+		}
+		s.refs++
+		return &producerRef{shared: s, producer: s.producer}, nil
+	}
+}
+
+func (s *sharedProducer) release() error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.refs--
+	if s.refs > 0 {
+		return nil
+	}
+	p := s.producer
+	s.producer = nil
+	return p.Close()
+}
+
+// producerRef is the handle of one user of a shared producer. It keeps the
+// producer acquired on creation, so it never sees the producer of a later
+// generation, and refuses to emit once closed.
+type producerRef struct {
+	m        sync.RWMutex
+	shared   *sharedProducer
+	producer Producer
+	closed   bool
+}
+
+func (r *producerRef) Emit(topic string, key string, value []byte) *Promise {
+	r.m.RLock()
+	defer r.m.RUnlock()
+	if r.closed {
+		return NewPromise().Finish(errProducerRefClosed)
+	}
+	return r.producer.Emit(topic, key, value)
+}
+
+func (r *producerRef) EmitMessage(msg *ProducerMessage) *Promise {
+	r.m.RLock()
+	defer r.m.RUnlock()
+	if r.closed {
+		return NewPromise().Finish(errProducerRefClosed)
+	}
+	return r.producer.EmitMessage(msg)
+}
+
+func (r *producerRef) Close() error {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	return r.shared.release()
+}
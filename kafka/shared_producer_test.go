@@ -0,0 +1,78 @@
+package kafka
+
+import (
+	"errors"
+	"hash"
+	"testing"
+
+	"github.com/facebookgo/ensure"
+)
+
+type countingProducer struct {
+	emits  int
+	closed int
+}
+
+func (p *countingProducer) Emit(topic string, key string, value []byte) *Promise {
+	p.emits++
+	return NewPromise().Finish(nil)
+}
+
+func (p *countingProducer) EmitMessage(msg *ProducerMessage) *Promise {
+	return p.Emit(msg.Topic, msg.Key, msg.Value)
+}
+
+func (p *countingProducer) Close() error {
+	p.closed++
+	return nil
+}
+
+func TestSharedProducerBuilder(t *testing.T) {
+	var created []*countingProducer
+	builder := SharedProducerBuilder(func(brokers []string, clientID string, hasher func() hash.Hash32) (Producer, error) {
+		p := new(countingProducer)
+		created = append(created, p)
+		return p, nil
+	})
+
+	p1, err := builder(brokers, "client", nil)
+	ensure.Nil(t, err)
+	p2, err := builder(brokers, "client", nil)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, len(created), 1)
+
+	p1.Emit("topic", "key", nil)
+	p2.Emit("topic", "key", nil)
+	ensure.DeepEqual(t, created[0].emits, 2)
+
+	// closing twice releases only once
+	ensure.Nil(t, p1.Close())
+	ensure.Nil(t, p1.Close())
+	ensure.DeepEqual(t, created[0].closed, 0)
+	ensure.Nil(t, p2.Close())
+	ensure.DeepEqual(t, created[0].closed, 1)
+
+	// emitting after close fails without reaching the producer
+	var emitErr error
+	p1.Emit("topic", "key", nil).Then(func(err error) { emitErr = err })
+	ensure.DeepEqual(t, emitErr, errProducerRefClosed)
+	p2.EmitMessage(&ProducerMessage{Topic: "topic"}).Then(func(err error) { emitErr = err })
+	ensure.DeepEqual(t, emitErr, errProducerRefClosed)
+	ensure.DeepEqual(t, created[0].emits, 2)
+
+	// a new producer is created after all users closed the shared one
+	p3, err := builder(brokers, "client", nil)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, len(created), 2)
+	p3.Emit("topic", "key", nil)
+	ensure.DeepEqual(t, created[0].emits, 2)
+	ensure.DeepEqual(t, created[1].emits, 1)
+	ensure.Nil(t, p3.Close())
+
+	// errors creating the producer are passed on
+	builder = SharedProducerBuilder(func(brokers []string, clientID string, hasher func() hash.Hash32) (Producer, error) {
+		return nil, errors.New("some error")
+	})
+	_, err = builder(brokers, "client", nil)
+	ensure.StringContains(t, err.Error(), "some error")
+}
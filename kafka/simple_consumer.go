@@ -147,6 +147,7 @@ func (c *simpleConsumer) run(pc sarama.PartitionConsumer, topic string, partitio
 				Key:       string(m.Key),
 				Value:     m.Value,
 				Timestamp: m.Timestamp,
+				Headers:   consumedHeaders(m.Headers),
 			}:
 			case <-c.dying:
 				return
@@ -107,6 +107,7 @@ func TestSimpleConsumer_AddPartition(t *testing.T) {
 		consumer:   consumer,
 		partitions: make(map[topicPartition]sarama.PartitionConsumer),
 		events:     ch,
+		dying:      make(chan bool),
 	}
 
 	client.EXPECT().GetOffset(topic, partition, sarama.OffsetOldest).Return(oldest, errors.New("some error"))
@@ -137,7 +138,6 @@ func TestSimpleConsumer_AddPartition(t *testing.T) {
 		close(messages)
 		pc.EXPECT().AsyncClose()
 		consumer.EXPECT().Close().Return(errors.New("some error"))
-		c.dying = make(chan bool)
 		err = c.Close()
 		ensure.NotNil(t, err)
 
@@ -178,6 +178,7 @@ func TestSimpleConsumer_RemovePartition(t *testing.T) {
 		consumer:   consumer,
 		partitions: make(map[topicPartition]sarama.PartitionConsumer),
 		events:     ch,
+		dying:      make(chan bool),
 	}
 
 	err := c.RemovePartition(topic, partition)
@@ -211,7 +212,6 @@ func TestSimpleConsumer_RemovePartition(t *testing.T) {
 		close(messages)
 		consumer.EXPECT().Close().Return(nil)
 		client.EXPECT().Close().Return(nil)
-		c.dying = make(chan bool)
 		err = c.Close()
 		ensure.Nil(t, err)
 	})
@@ -272,11 +272,13 @@ func TestSimpleConsumer_ErrorBlocked(t *testing.T) {
 		Value:     []byte("somevalue"),
 		Topic:     "sometopic",
 		Partition: 123,
+		Headers:   []*sarama.RecordHeader{{Key: []byte("header"), Value: []byte("value")}},
 	}
 	pc.EXPECT().HighWaterMarkOffset().Return(int64(0))
 	mo, ok := (<-ch).(*Message)
 	ensure.True(t, ok)
-	ensure.DeepEqual(t, mo, &Message{Topic: "sometopic", Partition: 123, Key: "somekey", Value: []byte("somevalue")})
+	ensure.DeepEqual(t, mo, &Message{Topic: "sometopic", Partition: 123, Key: "somekey", Value: []byte("somevalue"),
+		Headers: Headers{"header": []byte("value")}})
 
 	// we now write, but don't read events
 	messages <- &sarama.ConsumerMessage{
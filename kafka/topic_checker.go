@@ -0,0 +1,88 @@
+package kafka
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// TopicChecker is implemented by topic managers that can check existing topics
+// against the configuration required by a group graph without creating or
+// changing them.
+type TopicChecker interface {
+	// CheckTable checks that the table topic has npar partitions, is log
+	// compacted and matches the table configuration of the topic manager.
+	CheckTable(topic string, npar int) error
+	// CheckStream checks that the stream topic has npar partitions and
+	// matches the stream configuration of the topic manager.
+	CheckStream(topic string, npar int) error
+}
+
+// TopicMismatch is a setting of a topic that differs from the required one.
+type TopicMismatch struct {
+	Setting  string
+	Expected string
+	Actual   string
+}
+
+// TopicConfigError is returned by TopicChecker if an existing topic conflicts
+// with its required configuration. It lists every mismatching setting.
+type TopicConfigError struct {
+	Topic      string
+	Mismatches []TopicMismatch
+}
+
+func (e *TopicConfigError) Error() string {
+	var ms []string
+	for _, m := range e.Mismatches {
+		ms = append(ms, fmt.Sprintf("%s is %s instead of %s", m.Setting, m.Actual, m.Expected))
+	}
+	return fmt.Sprintf("topic %s conflicts with its configuration: %s", e.Topic, strings.Join(ms, ", "))
+}
+
+// compareTopic compares the number of partitions and the configuration of a
+// topic with the required ones. cleanup.policy is compared ignoring the order
+// of its policies.
+func compareTopic(topic string, npar, partitions int, required, actual map[string]string) error {
+	err := &TopicConfigError{Topic: topic}
+	if partitions != npar {
+		err.Mismatches = append(err.Mismatches, TopicMismatch{
+			Setting:  "partitions",
+			Expected: fmt.Sprintf("%d", npar),
+			Actual:   fmt.Sprintf("%d", partitions),
+		})
+	}
+
+	var keys []string
+	for k := range required {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		expected, value := required[k], actual[k]
+		if k == "cleanup.policy" {
+			expected, value = sortedPolicy(expected), sortedPolicy(value)
+		}
+		if expected != value {
+			err.Mismatches = append(err.Mismatches, TopicMismatch{
+				Setting:  k,
+				Expected: required[k],
+				Actual:   actual[k],
+			})
+		}
+	}
+
+	if len(err.Mismatches) == 0 {
+		return nil
+	}
+	return err
+}
+
+func sortedPolicy(policy string) string {
+	ps := strings.Split(policy, ",")
+	for i := range ps {
+		ps[i] = strings.TrimSpace(ps[i])
+	}
+	sort.Strings(ps)
+	return strings.Join(ps, ",")
+}
@@ -2,11 +2,13 @@ package kafka
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/Shopify/sarama"
+	"github.com/lovoo/goka/multierr"
 	kazoo "github.com/wvanbergen/kazoo-go"
 )
 
@@ -19,6 +21,11 @@ type TopicManager interface {
 	// EnsureTopicExists checks that a topic exists, or create one if possible,
 	// enforcing the given configuration
 	EnsureTopicExists(topic string, npar, rfactor int, config map[string]string) error
+	// EnsurePartitions increases the number of partitions of topic to npar.
+	// Decreasing the number of partitions is not possible.
+	EnsurePartitions(topic string, npar int) error
+	// DeleteTopic deletes topic
+	DeleteTopic(topic string) error
 
 	// Partitions returns the number of partitions of a topic, that are assigned to the running
 	// instance, i.e. it doesn't represent all partitions of a topic.
@@ -31,6 +38,8 @@ type TopicManager interface {
 type saramaTopicManager struct {
 	brokers []string
 	client  sarama.Client
+	// admin is created from client on the first check of a topic
+	admin clusterAdmin
 }
 
 // NewSaramaTopicManager creates a new topic manager using the sarama library
@@ -73,16 +82,310 @@ func (m *saramaTopicManager) EnsureTopicExists(topic string, npar, rfactor int,
 	return fmt.Errorf("not implemented in SaramaTopicManager")
 }
 
+func (m *saramaTopicManager) EnsurePartitions(topic string, npar int) error {
+	return fmt.Errorf("not implemented in SaramaTopicManager")
+}
+
+func (m *saramaTopicManager) DeleteTopic(topic string) error {
+	return fmt.Errorf("not implemented in SaramaTopicManager")
+}
+
+// CheckTable checks that the table topic has npar partitions and is log
+// compacted. The admin API requires the version of the client config to be at
+// least V0_11_0_0.
+func (m *saramaTopicManager) CheckTable(topic string, npar int) error {
+	admin, err := m.getAdmin()
+	if err != nil {
+		return err
+	}
+	return checkAdminTopic(admin, topic, npar, map[string]string{"cleanup.policy": "compact"})
+}
+
+// CheckStream checks that the stream topic has npar partitions.
+func (m *saramaTopicManager) CheckStream(topic string, npar int) error {
+	admin, err := m.getAdmin()
+	if err != nil {
+		return err
+	}
+	return checkAdminTopic(admin, topic, npar, nil)
+}
+
+func (m *saramaTopicManager) getAdmin() (clusterAdmin, error) {
+	if m.admin == nil {
+		// the admin shares the client, so it is not closed separately
+		admin, err := sarama.NewClusterAdminFromClient(m.client)
+		if err != nil {
+			return nil, fmt.Errorf("Error creating the kafka admin: %v", err)
+		}
+		m.admin = admin
+	}
+	return m.admin, nil
+}
+
+type adminTopicManager struct {
+	client sarama.Client
+	admin  clusterAdmin
+	config *TopicManagerConfig
+}
+
+// NewAdminTopicManager creates a new topic manager using the admin API of the
+// brokers, which creates missing topics and verifies or updates the
+// configuration of existing ones as set in tmConfig. The admin API requires
+// config.Version to be at least V0_11_0_0.
+func NewAdminTopicManager(brokers []string, config *sarama.Config, tmConfig *TopicManagerConfig) (TopicManager, error) {
+	if tmConfig == nil {
+		tmConfig = NewTopicManagerConfig()
+	}
+	client, err := sarama.NewClient(brokers, config)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating the kafka client: %v", err)
+	}
+	admin, err := sarama.NewClusterAdmin(brokers, config)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("Error creating the kafka admin: %v", err)
+	}
+
+	return &adminTopicManager{
+		client: client,
+		admin:  admin,
+		config: tmConfig,
+	}, nil
+}
+
+func (m *adminTopicManager) Close() error {
+	errs := new(multierr.Errors)
+	errs.Collect(m.admin.Close())
+	errs.Collect(m.client.Close())
+	return errs.NilOrError()
+}
+
+func (m *adminTopicManager) Partitions(topic string) ([]int32, error) {
+	return m.client.Partitions(topic)
+}
+
+func (m *adminTopicManager) EnsureTableExists(topic string, npar int) error {
+	return m.ensureTopic(topic, npar, m.config.Table.Replication, m.config.tableEntries(),
+		m.config.VerifyConfig || m.config.FixConfig, m.config.FixConfig)
+}
+
+func (m *adminTopicManager) EnsureStreamExists(topic string, npar int) error {
+	return m.ensureTopic(topic, npar, m.config.Stream.Replication, m.config.Stream.Entries(),
+		m.config.VerifyConfig || m.config.FixConfig, m.config.FixConfig)
+}
+
+func (m *adminTopicManager) EnsureTopicExists(topic string, npar, rfactor int, config map[string]string) error {
+	return m.ensureTopic(topic, npar, rfactor, config, true, m.config.FixConfig)
+}
+
+func (m *adminTopicManager) EnsurePartitions(topic string, npar int) error {
+	topics, err := m.admin.ListTopics()
+	if err != nil {
+		return fmt.Errorf("Error listing topics: %v", err)
+	}
+	detail, ok := topics[topic]
+	if !ok {
+		return fmt.Errorf("topic %s does not exist", topic)
+	}
+	switch n := int(detail.NumPartitions); {
+	case n == npar:
+		return nil
+	case n > npar:
+		return fmt.Errorf("topic %s has %d partitions, cannot decrease to %d", topic, n, npar)
+	}
+	if err := m.admin.CreatePartitions(topic, int32(npar), nil, false); err != nil {
+		return fmt.Errorf("Error increasing partitions of topic %s: %v", topic, err)
+	}
+	return nil
+}
+
+func (m *adminTopicManager) DeleteTopic(topic string) error {
+	if err := m.admin.DeleteTopic(topic); err != nil {
+		return fmt.Errorf("Error deleting topic %s: %v", topic, err)
+	}
+	return nil
+}
+
+func (m *adminTopicManager) CheckTable(topic string, npar int) error {
+	return checkAdminTopic(m.admin, topic, npar, m.config.tableEntries())
+}
+
+func (m *adminTopicManager) CheckStream(topic string, npar int) error {
+	return checkAdminTopic(m.admin, topic, npar, m.config.Stream.Entries())
+}
+
+// checkAdminTopic compares the number of partitions and the configuration of
+// topic with npar and cfg using the admin API.
+func checkAdminTopic(admin clusterAdmin, topic string, npar int, cfg map[string]string) error {
+	topics, err := admin.ListTopics()
+	if err != nil {
+		return fmt.Errorf("Error listing topics: %v", err)
+	}
+	detail, ok := topics[topic]
+	if !ok {
+		return fmt.Errorf("topic %s does not exist", topic)
+	}
+	entries, err := admin.DescribeConfig(sarama.ConfigResource{
+		Type: sarama.TopicResource,
+		Name: topic,
+	})
+	if err != nil {
+		return fmt.Errorf("Error describing config of topic %s: %v", topic, err)
+	}
+	actual := make(map[string]string)
+	for _, e := range entries {
+		actual[e.Name] = e.Value
+	}
+	return compareTopic(topic, npar, int(detail.NumPartitions), cfg, actual)
+}
+
+// ensureTopic creates topic if it does not exist. Otherwise it checks the
+// number of partitions and, if verify is set, the replication factor and the
+// configuration entries, which are updated if fix is set.
+func (m *adminTopicManager) ensureTopic(topic string, npar, rfactor int, cfg map[string]string, verify, fix bool) error {
+	topics, err := m.admin.ListTopics()
+	if err != nil {
+		return fmt.Errorf("Error listing topics: %v", err)
+	}
+	detail, ok := topics[topic]
+	if !ok {
+		entries := make(map[string]*string)
+		for k, v := range cfg {
+			v := v
+			entries[k] = &v
+		}
+		err = m.admin.CreateTopic(topic, &sarama.TopicDetail{
+			NumPartitions:     int32(npar),
+			ReplicationFactor: int16(rfactor),
+			ConfigEntries:     entries,
+		}, false)
+		if err != nil {
+			return fmt.Errorf("Error creating topic %s: %v", topic, err)
+		}
+		return nil
+	}
+
+	if int(detail.NumPartitions) != npar {
+		return fmt.Errorf("topic %s has %d partitions instead of %d", topic, detail.NumPartitions, npar)
+	}
+	if !verify {
+		return nil
+	}
+	if rfactor > 0 && int(detail.ReplicationFactor) != rfactor {
+		return fmt.Errorf("topic %s has replication factor %d instead of %d", topic, detail.ReplicationFactor, rfactor)
+	}
+	return m.ensureConfig(topic, cfg, fix)
+}
+
+// ensureConfig compares the configuration of topic with cfg and, if fix is
+// set, updates the differing entries.
+func (m *adminTopicManager) ensureConfig(topic string, cfg map[string]string, fix bool) error {
+	entries, err := m.admin.DescribeConfig(sarama.ConfigResource{
+		Type: sarama.TopicResource,
+		Name: topic,
+	})
+	if err != nil {
+		return fmt.Errorf("Error describing config of topic %s: %v", topic, err)
+	}
+	current := make(map[string]string)
+	for _, e := range entries {
+		current[e.Name] = e.Value
+	}
+
+	var diff []string
+	for k, v := range cfg {
+		if current[k] != v {
+			diff = append(diff, k)
+		}
+	}
+	if len(diff) == 0 {
+		return nil
+	}
+	if !fix {
+		sort.Strings(diff)
+		k := diff[0]
+		return fmt.Errorf("topic %s: expected %s=%s, but found %s", topic, k, cfg[k], current[k])
+	}
+
+	// AlterConfigs replaces the whole topic configuration, so the entries
+	// set explicitly on the topic have to be retained.
+	update := make(map[string]*string)
+	for _, e := range entries {
+		if e.Default || e.ReadOnly || e.Sensitive {
+			continue
+		}
+		v := e.Value
+		update[e.Name] = &v
+	}
+	for k, v := range cfg {
+		v := v
+		update[k] = &v
+	}
+	if err := m.admin.AlterConfig(sarama.TopicResource, topic, update, false); err != nil {
+		return fmt.Errorf("Error updating config of topic %s: %v", topic, err)
+	}
+	return nil
+}
+
+// TopicConfig contains the desired configuration of a topic. Zero values are
+// left to the defaults of the brokers.
+type TopicConfig struct {
+	// Replication is the replication factor of the topic.
+	Replication int
+	// Retention sets retention.ms. A negative value retains messages forever.
+	Retention time.Duration
+	// SegmentBytes sets segment.bytes.
+	SegmentBytes int
+	// SegmentTime sets segment.ms.
+	SegmentTime time.Duration
+	// CleanupPolicy sets cleanup.policy, eg, "delete", "compact" or
+	// "compact,delete".
+	CleanupPolicy string
+}
+
+// Entries returns the topic-level configuration entries of c.
+func (c *TopicConfig) Entries() map[string]string {
+	entries := make(map[string]string)
+	if c.Retention < 0 {
+		entries["retention.ms"] = "-1"
+	} else if c.Retention > 0 {
+		entries["retention.ms"] = strconv.FormatInt(int64(c.Retention/time.Millisecond), 10)
+	}
+	if c.SegmentBytes > 0 {
+		entries["segment.bytes"] = strconv.Itoa(c.SegmentBytes)
+	}
+	if c.SegmentTime > 0 {
+		entries["segment.ms"] = strconv.FormatInt(int64(c.SegmentTime/time.Millisecond), 10)
+	}
+	if c.CleanupPolicy != "" {
+		entries["cleanup.policy"] = c.CleanupPolicy
+	}
+	return entries
+}
+
 // TopicManagerConfig contains the configuration to access the Zookeeper servers
 // as well as the desired options of to create tables and stream topics.
 type TopicManagerConfig struct {
-	Table struct {
-		Replication int
-	}
-	Stream struct {
-		Replication int
-		Retention   time.Duration
+	Table  TopicConfig
+	Stream TopicConfig
+
+	// VerifyConfig makes EnsureTableExists and EnsureStreamExists check the
+	// configuration of existing topics and fail if it differs.
+	VerifyConfig bool
+	// FixConfig makes EnsureTableExists and EnsureStreamExists update the
+	// configuration of existing topics if it differs. Only supported by the
+	// admin and kafka-go topic managers.
+	FixConfig bool
+}
+
+// tableEntries returns the configuration entries of tables, which are always
+// log compacted.
+func (c *TopicManagerConfig) tableEntries() map[string]string {
+	entries := c.Table.Entries()
+	if entries["cleanup.policy"] == "" {
+		entries["cleanup.policy"] = "compact"
 	}
+	return entries
 }
 
 type topicManager struct {
@@ -92,10 +395,11 @@ type topicManager struct {
 }
 
 // NewTopicManagerConfig provides a default configuration for auto-creation
-// with replication factor of 1 and rentention time of 1 hour.
+// with replication factor of 2 and rentention time of 1 hour for streams.
 func NewTopicManagerConfig() *TopicManagerConfig {
 	cfg := new(TopicManagerConfig)
 	cfg.Table.Replication = 2
+	cfg.Table.CleanupPolicy = "compact"
 	cfg.Stream.Replication = 2
 	cfg.Stream.Retention = 1 * time.Hour
 	return cfg
@@ -134,8 +438,8 @@ func (m *topicManager) EnsureTableExists(topic string, npar int) error {
 	err := checkTopic(
 		m.zk, topic, npar,
 		m.config.Table.Replication,
-		map[string]string{"cleanup.policy": "compact"},
-		false,
+		m.config.tableEntries(),
+		m.config.VerifyConfig || m.config.FixConfig,
 	)
 	if err != nil {
 		return err
@@ -145,12 +449,11 @@ func (m *topicManager) EnsureTableExists(topic string, npar int) error {
 }
 
 func (m *topicManager) EnsureStreamExists(topic string, npar int) error {
-	retention := int(m.config.Stream.Retention.Nanoseconds() / time.Millisecond.Nanoseconds())
 	err := checkTopic(
 		m.zk, topic, npar,
 		m.config.Stream.Replication,
-		map[string]string{"retention.ms": strconv.Itoa(retention)},
-		false,
+		m.config.Stream.Entries(),
+		m.config.VerifyConfig || m.config.FixConfig,
 	)
 	if err != nil {
 		return err
@@ -165,6 +468,54 @@ func (m *topicManager) EnsureTopicExists(topic string, npar, rfactor int, config
 	return m.checkPartitions(topic, npar)
 }
 
+func (m *topicManager) CheckTable(topic string, npar int) error {
+	return m.checkTopic(topic, npar, m.config.tableEntries())
+}
+
+func (m *topicManager) CheckStream(topic string, npar int) error {
+	return m.checkTopic(topic, npar, m.config.Stream.Entries())
+}
+
+func (m *topicManager) checkTopic(topic string, npar int, cfg map[string]string) error {
+	ok, err := hasTopic(m.zk, topic)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("topic %s does not exist", topic)
+	}
+	t := m.zk.Topic(topic)
+	partitions, err := t.Partitions()
+	if err != nil {
+		return fmt.Errorf("Error fetching partitions for topic %s: %v", topic, err)
+	}
+	actual, err := t.Config()
+	if err != nil {
+		return fmt.Errorf("Error fetching config of topic %s: %v", topic, err)
+	}
+	return compareTopic(topic, npar, len(partitions), cfg, actual)
+}
+
+// EnsurePartitions checks that topic has npar partitions. ZooKeeper cannot
+// increase the number of partitions.
+func (m *topicManager) EnsurePartitions(topic string, npar int) error {
+	partitions, err := m.zk.Topic(topic).Partitions()
+	if err != nil {
+		return fmt.Errorf("Error fetching partitions for topic %s: %v", topic, err)
+	}
+	if len(partitions) != npar {
+		return fmt.Errorf("topic %s has %d partitions instead of %d, increasing partitions is not supported with ZooKeeper", topic, len(partitions), npar)
+	}
+	return nil
+}
+
+func (m *topicManager) DeleteTopic(topic string) error {
+	if err := m.zk.DeleteTopic(topic); err != nil {
+		return fmt.Errorf("Error deleting topic %s: %v", topic, err)
+	}
+	return nil
+}
+
 func (m *topicManager) Partitions(topic string) ([]int32, error) {
 	tl, err := m.zk.Topics()
 	if err != nil {
@@ -208,7 +559,7 @@ func checkTopic(kz kzoo, topic string, npar int, rfactor int, cfg map[string]str
 	}
 	for k, v := range cfg {
 		if c[k] != v {
-			return fmt.Errorf("expected %s=%s, but found %s", k, cfg[k], c[k])
+			return fmt.Errorf("topic %s: expected %s=%s, but found %s", topic, k, cfg[k], c[k])
 		}
 	}
 	return nil
@@ -288,5 +639,17 @@ type kzoo interface {
 	Topic(topic string) *kazoo.Topic
 	Topics() (kazoo.TopicList, error)
 	CreateTopic(topic string, npar int, rep int, config map[string]string) error
+	DeleteTopic(topic string) error
+	Close() error
+}
+
+// clusterAdmin is the subset of sarama.ClusterAdmin used by the admin topic manager
+type clusterAdmin interface {
+	ListTopics() (map[string]sarama.TopicDetail, error)
+	CreateTopic(topic string, detail *sarama.TopicDetail, validateOnly bool) error
+	DescribeConfig(resource sarama.ConfigResource) ([]sarama.ConfigEntry, error)
+	AlterConfig(resourceType sarama.ConfigResourceType, name string, entries map[string]*string, validateOnly bool) error
+	CreatePartitions(topic string, count int32, assignment [][]int32, validateOnly bool) error
+	DeleteTopic(topic string) error
 	Close() error
 }
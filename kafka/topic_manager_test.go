@@ -3,9 +3,11 @@ package kafka
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/lovoo/goka/kafka/mock"
 
+	"github.com/Shopify/sarama"
 	"github.com/facebookgo/ensure"
 	"github.com/golang/mock/gomock"
 	kazoo "github.com/wvanbergen/kazoo-go"
@@ -158,3 +160,223 @@ func TestTopicManager_checkPartitions(t *testing.T) {
 	ensure.Nil(t, err)
 }
 */
+
+func TestTopicConfig_Entries(t *testing.T) {
+	cfg := TopicConfig{
+		Retention:     time.Hour,
+		SegmentBytes:  1 << 20,
+		SegmentTime:   time.Minute,
+		CleanupPolicy: "compact,delete",
+	}
+	ensure.DeepEqual(t, cfg.Entries(), map[string]string{
+		"retention.ms":   "3600000",
+		"segment.bytes":  "1048576",
+		"segment.ms":     "60000",
+		"cleanup.policy": "compact,delete",
+	})
+
+	cfg = TopicConfig{Retention: -1}
+	ensure.DeepEqual(t, cfg.Entries(), map[string]string{"retention.ms": "-1"})
+
+	tmc := &TopicManagerConfig{}
+	ensure.DeepEqual(t, tmc.tableEntries(), map[string]string{"cleanup.policy": "compact"})
+}
+
+func TestAdminTopicManager_ensureTopic(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	admin := mock.NewMockclusterAdmin(ctrl)
+
+	topic := "table"
+	tmc := NewTopicManagerConfig()
+	tmc.Table.Retention = time.Hour
+	m := &adminTopicManager{admin: admin, config: tmc}
+
+	// create missing topic
+	admin.EXPECT().ListTopics().Return(map[string]sarama.TopicDetail{}, nil)
+	admin.EXPECT().CreateTopic(topic, gomock.Any(), false).Do(func(_ string, detail *sarama.TopicDetail, _ bool) {
+		ensure.DeepEqual(t, detail.NumPartitions, int32(3))
+		ensure.DeepEqual(t, detail.ReplicationFactor, int16(2))
+		ensure.DeepEqual(t, *detail.ConfigEntries["cleanup.policy"], "compact")
+		ensure.DeepEqual(t, *detail.ConfigEntries["retention.ms"], "3600000")
+	}).Return(nil)
+	ensure.Nil(t, m.EnsureTableExists(topic, 3))
+
+	existing := map[string]sarama.TopicDetail{
+		topic: {NumPartitions: 3, ReplicationFactor: 2},
+	}
+
+	// existing topic with wrong number of partitions
+	admin.EXPECT().ListTopics().Return(existing, nil)
+	err := m.EnsureTableExists(topic, 2)
+	ensure.NotNil(t, err)
+	ensure.StringContains(t, err.Error(), "partitions instead")
+
+	// config is not checked by default
+	admin.EXPECT().ListTopics().Return(existing, nil)
+	ensure.Nil(t, m.EnsureTableExists(topic, 3))
+
+	entries := []sarama.ConfigEntry{
+		{Name: "cleanup.policy", Value: "delete"},
+		{Name: "retention.ms", Value: "3600000"},
+		{Name: "max.message.bytes", Value: "2000000"},
+		{Name: "segment.ms", Value: "604800000", Default: true},
+	}
+	resource := sarama.ConfigResource{Type: sarama.TopicResource, Name: topic}
+
+	// verify fails on differing config
+	tmc.VerifyConfig = true
+	admin.EXPECT().ListTopics().Return(existing, nil)
+	admin.EXPECT().DescribeConfig(resource).Return(entries, nil)
+	err = m.EnsureTableExists(topic, 3)
+	ensure.NotNil(t, err)
+	ensure.StringContains(t, err.Error(), "expected cleanup.policy=compact, but found delete")
+
+	// fix updates the config, retaining the entries set on the topic
+	tmc.FixConfig = true
+	admin.EXPECT().ListTopics().Return(existing, nil)
+	admin.EXPECT().DescribeConfig(resource).Return(entries, nil)
+	admin.EXPECT().AlterConfig(sarama.TopicResource, topic, gomock.Any(), false).Do(
+		func(_ sarama.ConfigResourceType, _ string, update map[string]*string, _ bool) {
+			ensure.DeepEqual(t, len(update), 3)
+			ensure.DeepEqual(t, *update["cleanup.policy"], "compact")
+			ensure.DeepEqual(t, *update["retention.ms"], "3600000")
+			ensure.DeepEqual(t, *update["max.message.bytes"], "2000000")
+		}).Return(nil)
+	ensure.Nil(t, m.EnsureTableExists(topic, 3))
+
+	// replication factor cannot be fixed
+	tmc.Table.Replication = 3
+	admin.EXPECT().ListTopics().Return(existing, nil)
+	err = m.EnsureTableExists(topic, 3)
+	ensure.NotNil(t, err)
+	ensure.StringContains(t, err.Error(), "replication factor 2 instead of 3")
+}
+
+func TestAdminTopicManager_EnsurePartitions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	admin := mock.NewMockclusterAdmin(ctrl)
+
+	topic := "stream"
+	m := &adminTopicManager{admin: admin, config: NewTopicManagerConfig()}
+	existing := map[string]sarama.TopicDetail{
+		topic: {NumPartitions: 3, ReplicationFactor: 2},
+	}
+
+	admin.EXPECT().ListTopics().Return(existing, nil)
+	ensure.Nil(t, m.EnsurePartitions(topic, 3))
+
+	admin.EXPECT().ListTopics().Return(existing, nil)
+	admin.EXPECT().CreatePartitions(topic, int32(5), nil, false).Return(nil)
+	ensure.Nil(t, m.EnsurePartitions(topic, 5))
+
+	admin.EXPECT().ListTopics().Return(existing, nil)
+	err := m.EnsurePartitions(topic, 2)
+	ensure.NotNil(t, err)
+	ensure.StringContains(t, err.Error(), "cannot decrease")
+
+	admin.EXPECT().ListTopics().Return(existing, nil)
+	err = m.EnsurePartitions("other", 2)
+	ensure.NotNil(t, err)
+	ensure.StringContains(t, err.Error(), "does not exist")
+
+	admin.EXPECT().DeleteTopic(topic).Return(nil)
+	ensure.Nil(t, m.DeleteTopic(topic))
+
+	admin.EXPECT().DeleteTopic(topic).Return(fmt.Errorf("some error"))
+	ensure.NotNil(t, m.DeleteTopic(topic))
+}
+
+func TestAdminTopicManager_CheckTable(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	admin := mock.NewMockclusterAdmin(ctrl)
+
+	topic := "table"
+	tmc := NewTopicManagerConfig()
+	tmc.Table.Retention = time.Hour
+	m := &adminTopicManager{admin: admin, config: tmc}
+	resource := sarama.ConfigResource{Type: sarama.TopicResource, Name: topic}
+	existing := map[string]sarama.TopicDetail{
+		topic: {NumPartitions: 3, ReplicationFactor: 2},
+	}
+
+	admin.EXPECT().ListTopics().Return(map[string]sarama.TopicDetail{}, nil)
+	err := m.CheckTable(topic, 3)
+	ensure.NotNil(t, err)
+	ensure.StringContains(t, err.Error(), "does not exist")
+
+	admin.EXPECT().ListTopics().Return(existing, nil)
+	admin.EXPECT().DescribeConfig(resource).Return([]sarama.ConfigEntry{
+		{Name: "cleanup.policy", Value: "compact"},
+		{Name: "retention.ms", Value: "3600000"},
+	}, nil)
+	ensure.Nil(t, m.CheckTable(topic, 3))
+
+	admin.EXPECT().ListTopics().Return(existing, nil)
+	admin.EXPECT().DescribeConfig(resource).Return([]sarama.ConfigEntry{
+		{Name: "cleanup.policy", Value: "delete"},
+		{Name: "retention.ms", Value: "604800000"},
+	}, nil)
+	err = m.CheckTable(topic, 4)
+	ensure.NotNil(t, err)
+	tce, ok := err.(*TopicConfigError)
+	ensure.True(t, ok)
+	ensure.DeepEqual(t, tce.Mismatches, []TopicMismatch{
+		{Setting: "partitions", Expected: "4", Actual: "3"},
+		{Setting: "cleanup.policy", Expected: "compact", Actual: "delete"},
+		{Setting: "retention.ms", Expected: "3600000", Actual: "604800000"},
+	})
+	ensure.DeepEqual(t, err.Error(), "topic table conflicts with its configuration: "+
+		"partitions is 3 instead of 4, cleanup.policy is delete instead of compact, "+
+		"retention.ms is 604800000 instead of 3600000")
+}
+
+func TestSaramaTopicManager_Check(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	admin := mock.NewMockclusterAdmin(ctrl)
+
+	var tm TopicManager = &saramaTopicManager{admin: admin}
+	tc, ok := tm.(TopicChecker)
+	ensure.True(t, ok)
+
+	existing := map[string]sarama.TopicDetail{
+		"table":  {NumPartitions: 3, ReplicationFactor: 2},
+		"stream": {NumPartitions: 3, ReplicationFactor: 2},
+	}
+
+	// tables have to be log compacted
+	admin.EXPECT().ListTopics().Return(existing, nil)
+	admin.EXPECT().DescribeConfig(sarama.ConfigResource{Type: sarama.TopicResource, Name: "table"}).Return([]sarama.ConfigEntry{
+		{Name: "cleanup.policy", Value: "delete"},
+	}, nil)
+	err := tc.CheckTable("table", 3)
+	ensure.NotNil(t, err)
+	ensure.DeepEqual(t, err.(*TopicConfigError).Mismatches, []TopicMismatch{
+		{Setting: "cleanup.policy", Expected: "compact", Actual: "delete"},
+	})
+
+	admin.EXPECT().ListTopics().Return(existing, nil)
+	admin.EXPECT().DescribeConfig(sarama.ConfigResource{Type: sarama.TopicResource, Name: "table"}).Return([]sarama.ConfigEntry{
+		{Name: "cleanup.policy", Value: "compact"},
+	}, nil)
+	ensure.Nil(t, tc.CheckTable("table", 3))
+
+	// streams only need the number of partitions
+	admin.EXPECT().ListTopics().Return(existing, nil)
+	admin.EXPECT().DescribeConfig(sarama.ConfigResource{Type: sarama.TopicResource, Name: "stream"}).Return(nil, nil)
+	ensure.Nil(t, tc.CheckStream("stream", 3))
+
+	admin.EXPECT().ListTopics().Return(existing, nil)
+	admin.EXPECT().DescribeConfig(sarama.ConfigResource{Type: sarama.TopicResource, Name: "stream"}).Return(nil, nil)
+	err = tc.CheckStream("stream", 4)
+	ensure.NotNil(t, err)
+	ensure.StringContains(t, err.Error(), "partitions is 3 instead of 4")
+
+	admin.EXPECT().ListTopics().Return(existing, nil)
+	err = tc.CheckStream("missing", 3)
+	ensure.NotNil(t, err)
+	ensure.StringContains(t, err.Error(), "does not exist")
+}
@@ -0,0 +1,54 @@
+package goka
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// rateLimiter spaces events evenly to allow at most a fixed number of events
+// per second.
+type rateLimiter struct {
+	m        sync.Mutex
+	interval time.Duration
+	next     time.Time
+	// window is the time by which next may lag behind, allowing bursts
+	window time.Duration
+}
+
+func newRateLimiter(rate float64) *rateLimiter {
+	return &rateLimiter{interval: time.Duration(float64(time.Second) / rate)}
+}
+
+// newBurstRateLimiter creates a rate limiter that allows up to burst events
+// at once after a period of inactivity.
+func newBurstRateLimiter(rate float64, burst int) *rateLimiter {
+	l := newRateLimiter(rate)
+	if burst > 1 {
+		l.window = time.Duration(burst-1) * l.interval
+	}
+	return l
+}
+
+// wait blocks until the next event is allowed. It returns false if ctx is done
+// before that.
+func (l *rateLimiter) wait(ctx context.Context) bool {
+	l.m.Lock()
+	now := time.Now()
+	if earliest := now.Add(-l.window); l.next.Before(earliest) {
+		l.next = earliest
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.m.Unlock()
+
+	if delay <= 0 {
+		return true
+	}
+	select {
+	case <-time.After(delay):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,77 @@
+package goka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lovoo/goka/kafka"
+	"github.com/lovoo/goka/logger"
+
+	"github.com/facebookgo/ensure"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l := newRateLimiter(100)
+
+	start := time.Now()
+	for i := 0; i < 11; i++ {
+		ensure.True(t, l.wait(context.Background()))
+	}
+	ensure.True(t, time.Since(start) >= 100*time.Millisecond)
+
+	// waiting is aborted when the context is done
+	l = newRateLimiter(0.1)
+	ctx, cancel := context.WithCancel(context.Background())
+	ensure.True(t, l.wait(ctx))
+	cancel()
+	ensure.False(t, l.wait(ctx))
+}
+
+func TestRateLimiter_burst(t *testing.T) {
+	l := newBurstRateLimiter(10, 5)
+
+	// the burst passes immediately
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		ensure.True(t, l.wait(context.Background()))
+	}
+	ensure.True(t, time.Since(start) < 50*time.Millisecond)
+
+	// further events are limited
+	ensure.True(t, l.wait(context.Background()))
+	ensure.True(t, time.Since(start) >= 100*time.Millisecond)
+}
+
+func TestProcessor_limiter(t *testing.T) {
+	p := &Processor{opts: new(poptions)}
+	ensure.True(t, p.limiter(0) == nil)
+
+	WithMaxProcessingRate(10)(p.opts, nil)
+	ensure.True(t, p.limiter(0) != nil)
+	ensure.True(t, p.limiter(0) == p.limiter(1))
+
+	p = &Processor{opts: new(poptions)}
+	WithMaxPartitionProcessingRate(10)(p.opts, nil)
+	ensure.True(t, p.limiter(0) != nil)
+	ensure.True(t, p.limiter(0) != p.limiter(1))
+	ensure.True(t, p.limiter(1) == p.limiter(1))
+}
+
+func TestProcessor_processLimiterAborted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Processor{opts: new(poptions), ctx: ctx}
+	WithMaxProcessingRate(0.1)(p.opts, nil)
+
+	// the first message passes, the next one waits until the processor stops
+	msg := &message{Topic: "sometopic", Key: "key", Partition: 1, Offset: 123}
+	ensure.True(t, p.limiter(1).wait(ctx))
+	cancel()
+	_, err := p.process(msg, nil, nil, newPartitionStats())
+	ensure.DeepEqual(t, err, errProcessingAborted)
+
+	// the aborted message is not counted
+	par := newPartition(logger.Default(), topic, p.process, newNullStorageProxy(1), nil, 0)
+	ensure.Nil(t, par.processMessage(&kafka.Message{Topic: "sometopic", Key: "key", Partition: 1, Offset: 123}, nil))
+	ensure.DeepEqual(t, par.stats.Input["sometopic"].Count, uint(0))
+}
@@ -1,5 +1,5 @@
 // Code generated by MockGen. DO NOT EDIT.
-// Source: github.com/lovoo/goka/kafka (interfaces: Consumer,TopicManager,Producer)
+// Source: github.com/lovoo/goka/kafka (interfaces: Consumer,TopicManager,TopicChecker,Producer,TransactionalProducer)
 
 // Package mock is a generated GoMock package.
 package mock
@@ -166,6 +166,34 @@ func (mr *MockTopicManagerMockRecorder) Close() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockTopicManager)(nil).Close))
 }
 
+// DeleteTopic mocks base method
+func (m *MockTopicManager) DeleteTopic(arg0 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteTopic", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteTopic indicates an expected call of DeleteTopic
+func (mr *MockTopicManagerMockRecorder) DeleteTopic(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteTopic", reflect.TypeOf((*MockTopicManager)(nil).DeleteTopic), arg0)
+}
+
+// EnsurePartitions mocks base method
+func (m *MockTopicManager) EnsurePartitions(arg0 string, arg1 int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EnsurePartitions", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// EnsurePartitions indicates an expected call of EnsurePartitions
+func (mr *MockTopicManagerMockRecorder) EnsurePartitions(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnsurePartitions", reflect.TypeOf((*MockTopicManager)(nil).EnsurePartitions), arg0, arg1)
+}
+
 // EnsureStreamExists mocks base method
 func (m *MockTopicManager) EnsureStreamExists(arg0 string, arg1 int) error {
 	m.ctrl.T.Helper()
@@ -223,6 +251,57 @@ func (mr *MockTopicManagerMockRecorder) Partitions(arg0 interface{}) *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Partitions", reflect.TypeOf((*MockTopicManager)(nil).Partitions), arg0)
 }
 
+// MockTopicChecker is a mock of TopicChecker interface
+type MockTopicChecker struct {
+	ctrl     *gomock.Controller
+	recorder *MockTopicCheckerMockRecorder
+}
+
+// MockTopicCheckerMockRecorder is the mock recorder for MockTopicChecker
+type MockTopicCheckerMockRecorder struct {
+	mock *MockTopicChecker
+}
+
+// NewMockTopicChecker creates a new mock instance
+func NewMockTopicChecker(ctrl *gomock.Controller) *MockTopicChecker {
+	mock := &MockTopicChecker{ctrl: ctrl}
+	mock.recorder = &MockTopicCheckerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockTopicChecker) EXPECT() *MockTopicCheckerMockRecorder {
+	return m.recorder
+}
+
+// CheckStream mocks base method
+func (m *MockTopicChecker) CheckStream(arg0 string, arg1 int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CheckStream", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CheckStream indicates an expected call of CheckStream
+func (mr *MockTopicCheckerMockRecorder) CheckStream(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckStream", reflect.TypeOf((*MockTopicChecker)(nil).CheckStream), arg0, arg1)
+}
+
+// CheckTable mocks base method
+func (m *MockTopicChecker) CheckTable(arg0 string, arg1 int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CheckTable", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CheckTable indicates an expected call of CheckTable
+func (mr *MockTopicCheckerMockRecorder) CheckTable(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckTable", reflect.TypeOf((*MockTopicChecker)(nil).CheckTable), arg0, arg1)
+}
+
 // MockProducer is a mock of Producer interface
 type MockProducer struct {
 	ctrl     *gomock.Controller
@@ -273,3 +352,138 @@ func (mr *MockProducerMockRecorder) Emit(arg0, arg1, arg2 interface{}) *gomock.C
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Emit", reflect.TypeOf((*MockProducer)(nil).Emit), arg0, arg1, arg2)
 }
+
+// EmitMessage mocks base method
+func (m *MockProducer) EmitMessage(arg0 *kafka.ProducerMessage) *kafka.Promise {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EmitMessage", arg0)
+	ret0, _ := ret[0].(*kafka.Promise)
+	return ret0
+}
+
+// EmitMessage indicates an expected call of EmitMessage
+func (mr *MockProducerMockRecorder) EmitMessage(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EmitMessage", reflect.TypeOf((*MockProducer)(nil).EmitMessage), arg0)
+}
+
+// MockTransactionalProducer is a mock of TransactionalProducer interface
+type MockTransactionalProducer struct {
+	ctrl     *gomock.Controller
+	recorder *MockTransactionalProducerMockRecorder
+}
+
+// MockTransactionalProducerMockRecorder is the mock recorder for MockTransactionalProducer
+type MockTransactionalProducerMockRecorder struct {
+	mock *MockTransactionalProducer
+}
+
+// NewMockTransactionalProducer creates a new mock instance
+func NewMockTransactionalProducer(ctrl *gomock.Controller) *MockTransactionalProducer {
+	mock := &MockTransactionalProducer{ctrl: ctrl}
+	mock.recorder = &MockTransactionalProducerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockTransactionalProducer) EXPECT() *MockTransactionalProducerMockRecorder {
+	return m.recorder
+}
+
+// AbortTxn mocks base method
+func (m *MockTransactionalProducer) AbortTxn() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AbortTxn")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AbortTxn indicates an expected call of AbortTxn
+func (mr *MockTransactionalProducerMockRecorder) AbortTxn() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AbortTxn", reflect.TypeOf((*MockTransactionalProducer)(nil).AbortTxn))
+}
+
+// AddOffsetsToTxn mocks base method
+func (m *MockTransactionalProducer) AddOffsetsToTxn(arg0 string, arg1 map[string]map[int32]int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddOffsetsToTxn", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddOffsetsToTxn indicates an expected call of AddOffsetsToTxn
+func (mr *MockTransactionalProducerMockRecorder) AddOffsetsToTxn(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddOffsetsToTxn", reflect.TypeOf((*MockTransactionalProducer)(nil).AddOffsetsToTxn), arg0, arg1)
+}
+
+// BeginTxn mocks base method
+func (m *MockTransactionalProducer) BeginTxn() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BeginTxn")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// BeginTxn indicates an expected call of BeginTxn
+func (mr *MockTransactionalProducerMockRecorder) BeginTxn() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BeginTxn", reflect.TypeOf((*MockTransactionalProducer)(nil).BeginTxn))
+}
+
+// Close mocks base method
+func (m *MockTransactionalProducer) Close() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Close")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Close indicates an expected call of Close
+func (mr *MockTransactionalProducerMockRecorder) Close() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockTransactionalProducer)(nil).Close))
+}
+
+// CommitTxn mocks base method
+func (m *MockTransactionalProducer) CommitTxn() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CommitTxn")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CommitTxn indicates an expected call of CommitTxn
+func (mr *MockTransactionalProducerMockRecorder) CommitTxn() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CommitTxn", reflect.TypeOf((*MockTransactionalProducer)(nil).CommitTxn))
+}
+
+// Emit mocks base method
+func (m *MockTransactionalProducer) Emit(arg0, arg1 string, arg2 []byte) *kafka.Promise {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Emit", arg0, arg1, arg2)
+	ret0, _ := ret[0].(*kafka.Promise)
+	return ret0
+}
+
+// Emit indicates an expected call of Emit
+func (mr *MockTransactionalProducerMockRecorder) Emit(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Emit", reflect.TypeOf((*MockTransactionalProducer)(nil).Emit), arg0, arg1, arg2)
+}
+
+// EmitMessage mocks base method
+func (m *MockTransactionalProducer) EmitMessage(arg0 *kafka.ProducerMessage) *kafka.Promise {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EmitMessage", arg0)
+	ret0, _ := ret[0].(*kafka.Promise)
+	return ret0
+}
+
+// EmitMessage indicates an expected call of EmitMessage
+func (mr *MockTransactionalProducerMockRecorder) EmitMessage(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EmitMessage", reflect.TypeOf((*MockTransactionalProducer)(nil).EmitMessage), arg0)
+}
@@ -5,7 +5,9 @@ import (
 	"hash"
 	"hash/fnv"
 	"path/filepath"
+	"time"
 
+	"github.com/Shopify/sarama"
 	"github.com/lovoo/goka/kafka"
 	"github.com/lovoo/goka/logger"
 	"github.com/lovoo/goka/storage"
@@ -22,6 +24,11 @@ type UpdateCallback func(s storage.Storage, partition int32, key string, value [
 const (
 	defaultBaseStoragePath = "/tmp/goka"
 	defaultClientID        = "goka"
+	defaultRetries         = 3
+	defaultRetryBackoff    = 100 * time.Millisecond
+
+	// defaultFastRecoveryBatchSize is the batch size of WithFastRecovery
+	defaultFastRecoveryBatchSize = 10000
 )
 
 // DefaultProcessorStoragePath is the default path where processor state
@@ -48,6 +55,32 @@ func DefaultUpdate(s storage.Storage, partition int32, key string, value []byte)
 	return s.Set(key, value)
 }
 
+// TombstoneUpdate returns an update callback deleting the keys of the values
+// that are tombstones according to policy and storing the other values, like
+// DefaultUpdate does with storage.TombstoneNil. The group table or the view
+// should be stored with the same policy (see storage.BuilderWithTombstones),
+// so that the values set while processing are treated like recovered ones.
+func TombstoneUpdate(policy storage.TombstonePolicy) UpdateCallback {
+	return func(s storage.Storage, partition int32, key string, value []byte) error {
+		if policy.IsTombstone(value) {
+			return s.Delete(key)
+		}
+		if value == nil {
+			value = []byte{}
+		}
+		return s.Set(key, value)
+	}
+}
+
+// defaultUpdate returns the update callback recovering tables whose
+// tombstones are defined by policy.
+func defaultUpdate(policy storage.TombstonePolicy) UpdateCallback {
+	if policy == storage.TombstoneNil {
+		return DefaultUpdate
+	}
+	return TombstoneUpdate(policy)
+}
+
 // DefaultHasher returns an FNV hasher builder to assign keys to partitions.
 func DefaultHasher() func() hash.Hash32 {
 	return func() hash.Hash32 {
@@ -72,9 +105,28 @@ type poptions struct {
 	partitionChannelSize int
 	hasher               func() hash.Hash32
 	nilHandling          NilHandling
+	tombstonePolicy      storage.TombstonePolicy
+	nilKeyHandling       NilKeyHandling
+	callbackTimeout      time.Duration
+	retries              int
+	retryBackoff         time.Duration
+	startOffsets         map[string]int64
+	priorityTopics       map[string]bool
+	maxRate              float64
+	maxRatePerPartition  bool
+	maxPending           int
+	panicPolicy          PanicPolicy
+	orderedEmits         bool
+	warmStart            bool
+	deadLetterTopic      Stream
+	backpressure         BackpressurePolicy
+	recoveryBatchSize    int
+	recoveryNoSync       bool
+	kafkaConfig          []kafka.ConfigOption
+	checkTopics          bool
 
 	builders struct {
-		storage  storage.Builder
+		storage  storage.ContextBuilder
 		consumer kafka.ConsumerBuilder
 		producer kafka.ProducerBuilder
 		topicmgr kafka.TopicManagerBuilder
@@ -98,6 +150,14 @@ func WithClientID(clientID string) ProcessorOption {
 
 // WithStorageBuilder defines a builder for the storage of each partition.
 func WithStorageBuilder(sb storage.Builder) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.builders.storage = storage.AdaptBuilder(sb)
+	}
+}
+
+// WithContextStorageBuilder defines a builder for the storage of each
+// partition, which receives the context of the processor and its logger.
+func WithContextStorageBuilder(sb storage.ContextBuilder) ProcessorOption {
 	return func(o *poptions, gg *GroupGraph) {
 		o.builders.storage = sb
 	}
@@ -117,13 +177,26 @@ func WithConsumerBuilder(cb kafka.ConsumerBuilder) ProcessorOption {
 	}
 }
 
-// WithProducerBuilder replaces the default producer builder.
+// WithProducerBuilder replaces the default producer builder. The partitioners
+// of OutputWithPartitioner edges are not passed to the producers built by pb.
 func WithProducerBuilder(pb kafka.ProducerBuilder) ProcessorOption {
 	return func(o *poptions, gg *GroupGraph) {
 		o.builders.producer = pb
 	}
 }
 
+// WithKafkaConfig modifies the configuration of the default consumer,
+// producer and topic manager builders, eg, to connect via TLS and SASL:
+//
+//	goka.WithKafkaConfig(kafka.WithTLS(tlsConfig), kafka.WithSASLPlain(user, password))
+//
+// Builders set with other options are not affected.
+func WithKafkaConfig(opts ...kafka.ConfigOption) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.kafkaConfig = append(o.kafkaConfig, opts...)
+	}
+}
+
 // WithPartitionChannelSize replaces the default partition channel size.
 // This is mostly used for testing by setting it to 0 to have synchronous behavior
 // of goka.
@@ -161,13 +234,263 @@ const (
 )
 
 // WithNilHandling configures how the processor should handle messages with nil
-// value. By default the processor ignores nil messages.
+// value. By default the processor ignores nil messages. Callbacks can check for
+// nil messages (tombstones) with IsTombstone(ctx).
 func WithNilHandling(nh NilHandling) ProcessorOption {
 	return func(o *poptions, gg *GroupGraph) {
 		o.nilHandling = nh
 	}
 }
 
+// WithTombstonePolicy defines which values of the input streams and tables
+// are tombstones (see storage.TombstonePolicy). Unless another update callback
+// is set, the group table and the joined and lookup tables are recovered with
+// TombstoneUpdate(policy) instead of DefaultUpdate, and IsTombstone reports
+// the input messages that are tombstones according to policy. The storages
+// should apply the same policy (see storage.BuilderWithTombstones). Which
+// messages are passed to the callbacks is still defined by WithNilHandling. By
+// default, only nil values are tombstones.
+func WithTombstonePolicy(policy storage.TombstonePolicy) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.tombstonePolicy = policy
+	}
+}
+
+// NilKeyHandling defines how messages without key should be handled by the
+// processor. Messages produced by goka always have a key, but other producers
+// may write messages without key into input streams.
+type NilKeyHandling int
+
+const (
+	// NilKeyProcess passes messages without key to the ProcessCallback, where
+	// Context.Key() returns an empty string.
+	NilKeyProcess NilKeyHandling = 0 + iota
+	// NilKeySkip drops any message without key.
+	NilKeySkip
+	// NilKeyFail fails the processor if a message has no key.
+	NilKeyFail
+)
+
+// WithNilKeyHandling configures how the processor should handle messages
+// without key. By default the processor processes them with an empty key.
+func WithNilKeyHandling(nkh NilKeyHandling) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.nilKeyHandling = nkh
+	}
+}
+
+// WithOrderedEmits guarantees that messages emitted by the processor are
+// written in the order they were emitted, for the messages of one callback
+// invocation as well as for subsequent messages of the same key. For that,
+// the processor waits until all emits of a message are acknowledged before
+// processing the next message of the partition, so that messages of a failed
+// emit are never overtaken, and the default producer sends at most one
+// request per broker at a time, so that retries of the producer cannot reorder
+// messages. Both reduce the throughput of the processor considerably. If a
+// custom producer builder is used, it has to limit the requests in flight
+// itself (eg, by setting Net.MaxOpenRequests to 1).
+func WithOrderedEmits() ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.orderedEmits = true
+	}
+}
+
+// WithIdempotentProducer makes the default producer of the processor
+// idempotent, so that retries of the producer do not emit duplicates (see
+// kafka.WithIdempotentProducer). It is a shortcut for
+// WithKafkaConfig(kafka.WithIdempotentProducer()).
+func WithIdempotentProducer() ProcessorOption {
+	return WithKafkaConfig(kafka.WithIdempotentProducer())
+}
+
+// WithWarmStart lets the processor trust the local storage of its group table.
+// Partitions with local state skip the recovery from the table topic and start
+// processing from the stored offset immediately, which cuts restart times for
+// large tables. The local state is validated against the table topic in the
+// background: if the table topic contains updates that are missing in the
+// local storage, the partition fails and the processor has to be restarted
+// without warm start to recover the table. Partitions without local state are
+// recovered as usual.
+func WithWarmStart() ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.warmStart = true
+	}
+}
+
+// PanicPolicy defines how the processor handles panics in callbacks that are
+// not caused by Context.Fail.
+type PanicPolicy int
+
+const (
+	// PanicFail stops the processor with a PanicError (default).
+	PanicFail PanicPolicy = 0 + iota
+	// PanicSkip logs the PanicError and commits the message.
+	PanicSkip
+	// PanicRetry handles the panic like a RetryableError.
+	PanicRetry
+	// PanicDeadLetter emits the message unchanged into the dead letter topic
+	// (see WithDeadLetterTopic) and commits it.
+	PanicDeadLetter
+)
+
+// WithPanicPolicy configures how the processor handles panics in callbacks.
+// By default (PanicFail), the processor stops.
+func WithPanicPolicy(policy PanicPolicy) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.panicPolicy = policy
+	}
+}
+
+// WithDeadLetterTopic sets the topic messages are emitted into with the
+// PanicDeadLetter policy. The topic is created on startup if it does not
+// exist yet.
+func WithDeadLetterTopic(topic Stream) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.deadLetterTopic = topic
+	}
+}
+
+// WithCallbackTimeout limits the time a ProcessCallback may take to process a
+// single message. The context returned by Context.Context() is canceled once
+// the timeout is exceeded. If the callback does not return in time, it is
+// abandoned instead of stalling the partition forever: its further table
+// updates and emits are dropped and the message fails with a TimeoutError,
+// which is handled according to the panic policy (see WithPanicPolicy). Timed
+// out callbacks are not retried. When the partition shuts down, it waits for
+// its timed out callbacks to return, so callbacks should return once the
+// context is canceled. A timeout of 0 (default) disables the limit.
+func WithCallbackTimeout(timeout time.Duration) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.callbackTimeout = timeout
+	}
+}
+
+// WithCallbackRetries defines how often a callback is retried for the same
+// message if it fails with a RetryableError and how long to wait between
+// attempts. By default, callbacks are retried 3 times with a backoff of 100ms.
+func WithCallbackRetries(retries int, backoff time.Duration) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.retries = retries
+		o.retryBackoff = backoff
+	}
+}
+
+// WithStartAtOffset defines the offset at which the processor starts consuming
+// the input stream topic if the group has not committed any offset for it
+// yet. By default, a new group starts at the newest offset. Use
+// kafka.OffsetOldest to consume the whole topic. The topic must be an input
+// stream of the group.
+func WithStartAtOffset(topic Stream, offset int64) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		if o.startOffsets == nil {
+			o.startOffsets = make(map[string]int64)
+		}
+		o.startOffsets[string(topic)] = offset
+	}
+}
+
+// WithStartAtTime defines that the processor starts consuming the input
+// stream topic at the first message produced at or after t if the group has
+// not committed any offset for it yet.
+func WithStartAtTime(topic Stream, t time.Time) ProcessorOption {
+	return WithStartAtOffset(topic, kafka.OffsetTime(t))
+}
+
+// WithPriorityInputs marks input streams as high priority. Messages of these
+// topics are processed before pending messages of other input streams of the
+// same partition, eg, to let control messages preempt bulk data. The order of
+// messages within each topic is preserved.
+func WithPriorityInputs(topics ...Stream) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		if o.priorityTopics == nil {
+			o.priorityTopics = make(map[string]bool)
+		}
+		for _, t := range topics {
+			o.priorityTopics[string(t)] = true
+		}
+	}
+}
+
+// WithMaxProcessingRate limits the number of messages the processor processes
+// per second over all its partitions, eg, to protect a database the callbacks
+// write to. By default, the processing rate is not limited.
+func WithMaxProcessingRate(msgsPerSecond float64) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.maxRate = msgsPerSecond
+		o.maxRatePerPartition = false
+	}
+}
+
+// WithMaxPartitionProcessingRate limits the number of messages the processor
+// processes per second in each of its partitions.
+func WithMaxPartitionProcessingRate(msgsPerSecond float64) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.maxRate = msgsPerSecond
+		o.maxRatePerPartition = true
+	}
+}
+
+// WithRecoveryBatchSize makes the processor write the updates of recovering
+// tables in batches of the given size (see storage.Batch), which speeds up the
+// recovery of storages with a high overhead per write. While recovering, the
+// update callback writes into the batch. By default, updates are written one by
+// one.
+func WithRecoveryBatchSize(size int) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.recoveryBatchSize = size
+	}
+}
+
+// WithTopicCheck makes the processor check all topics of its group graph after
+// ensuring they exist, failing with a kafka.TopicConfigError if an existing
+// topic conflicts with the partitions of the group or the configuration of the
+// topic manager, eg, a table that is not log compacted. Input, loop and rekey
+// streams are checked like streams, joined, lookup and group tables like
+// tables. Lookup tables are not required to be copartitioned. The topic
+// manager has to implement kafka.TopicChecker.
+func WithTopicCheck() ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.checkTopics = true
+	}
+}
+
+// WithFastRecovery makes the processor recover its tables in batches of 10000
+// updates without syncing them to disk. Durability is not needed while
+// recovering since the table topic is the source of truth, so storages
+// implementing storage.Syncer, like pebble and bbolt, only sync once before
+// being marked as recovered. LevelDB recovers into a transaction anyway.
+func WithFastRecovery() ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.recoveryBatchSize = defaultFastRecoveryBatchSize
+		o.recoveryNoSync = true
+	}
+}
+
+// BackpressurePolicy defines how the processor behaves if a callback emits a
+// message while the producer queue is full.
+type BackpressurePolicy int
+
+const (
+	// BackpressureBlock blocks the callback until the producer has delivered
+	// enough messages.
+	BackpressureBlock BackpressurePolicy = 0 + iota
+	// BackpressureFail fails the processor.
+	BackpressureFail
+)
+
+// WithProducerBackpressure limits the number of messages emitted by the
+// processor that are not yet acknowledged by Kafka to maxPending. If the limit
+// is reached, policy defines whether the emitting callback blocks or the
+// processor fails. The number of blocked emits and the time blocked are
+// reported in the OutputStats. By default, the number of pending messages is
+// only limited by the buffers of the producer.
+func WithProducerBackpressure(maxPending int, policy BackpressurePolicy) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.maxPending = maxPending
+		o.backpressure = policy
+	}
+}
+
 // Tester interface to avoid import cycles when a processor needs to register to
 // the tester.
 type Tester interface {
@@ -183,7 +506,7 @@ type Tester interface {
 // consumer and producer
 func WithTester(t Tester) ProcessorOption {
 	return func(o *poptions, gg *GroupGraph) {
-		o.builders.storage = t.StorageBuilder()
+		o.builders.storage = storage.AdaptBuilder(t.StorageBuilder())
 		o.builders.consumer = t.ConsumerBuilder()
 		o.builders.producer = t.ProducerBuilder()
 		o.builders.topicmgr = t.TopicManagerBuilder()
@@ -196,28 +519,84 @@ func (opt *poptions) applyOptions(gg *GroupGraph, opts ...ProcessorOption) error
 	opt.clientID = defaultClientID
 	opt.log = logger.Default()
 	opt.hasher = DefaultHasher()
+	opt.retries = defaultRetries
+	opt.retryBackoff = defaultRetryBackoff
+	opt.panicPolicy = PanicFail
 
 	for _, o := range opts {
 		o(opt, gg)
 	}
+	if opt.updateCallback == nil {
+		opt.updateCallback = defaultUpdate(opt.tombstonePolicy)
+	}
 
 	// StorageBuilder should always be set as a default option in NewProcessor
 	if opt.builders.storage == nil {
 		return fmt.Errorf("StorageBuilder not set")
 	}
+	if opt.panicPolicy == PanicDeadLetter && opt.deadLetterTopic == "" {
+		return fmt.Errorf("PanicDeadLetter policy requires a dead letter topic")
+	}
+	if len(opt.startOffsets) > 0 {
+		inputs := make(map[string]bool)
+		for _, t := range gg.InputStreams().Topics() {
+			inputs[t] = true
+		}
+		for topic := range opt.startOffsets {
+			if !inputs[topic] {
+				return fmt.Errorf("cannot set start offset of %s: not an input stream of the group", topic)
+			}
+		}
+	}
 	if opt.builders.consumer == nil {
-		opt.builders.consumer = kafka.DefaultConsumerBuilder
+		opt.builders.consumer = defaultConsumerBuilder(opt.kafkaConfig)
 	}
 	if opt.builders.producer == nil {
-		opt.builders.producer = kafka.DefaultProducerBuilder
+		opt.builders.producer = defaultProducerBuilder(opt.kafkaConfig)
+		if partitioners := gg.partitioners(); len(partitioners) > 0 || opt.orderedEmits {
+			config := kafka.NewConfigWithOptions(opt.kafkaConfig...)
+			if opt.orderedEmits {
+				// a single request in flight prevents producer retries from
+				// reordering messages
+				config.Net.MaxOpenRequests = 1
+			}
+			opt.builders.producer = kafka.ProducerBuilderWithPartitioners(config, partitioners)
+		}
 	}
 	if opt.builders.topicmgr == nil {
-		opt.builders.topicmgr = kafka.DefaultTopicManagerBuilder
+		opt.builders.topicmgr = defaultTopicManagerBuilder(opt.kafkaConfig)
 	}
 
 	return nil
 }
 
+// defaultConsumerBuilder returns the default consumer builder configured with
+// opts.
+func defaultConsumerBuilder(opts []kafka.ConfigOption) kafka.ConsumerBuilder {
+	if len(opts) == 0 {
+		return kafka.DefaultConsumerBuilder
+	}
+	return kafka.ConsumerBuilderWithConfig(kafka.NewConfigWithOptions(opts...))
+}
+
+// defaultProducerBuilder returns the default producer builder configured with
+// opts.
+func defaultProducerBuilder(opts []kafka.ConfigOption) kafka.ProducerBuilder {
+	if len(opts) == 0 {
+		return kafka.DefaultProducerBuilder
+	}
+	return kafka.ProducerBuilderWithConfig(kafka.NewConfigWithOptions(opts...))
+}
+
+// defaultTopicManagerBuilder returns the default topic manager builder
+// configured with opts.
+func defaultTopicManagerBuilder(opts []kafka.ConfigOption) kafka.TopicManagerBuilder {
+	if len(opts) == 0 {
+		return kafka.DefaultTopicManagerBuilder
+	}
+	return kafka.TopicManagerBuilderWithConfig(kafka.NewConfigWithOptions(opts...))
+}
+
 ///////////////////////////////////////////////////////////////////////////////
 // view options
 ///////////////////////////////////////////////////////////////////////////////
@@ -230,12 +609,37 @@ type voptions struct {
 	clientID             string
 	tableCodec           Codec
 	updateCallback       UpdateCallback
+	tombstonePolicy      storage.TombstonePolicy
 	partitionChannelSize int
 	hasher               func() hash.Hash32
 	restartable          bool
+	indexes              []viewIndex
+	partitions           map[int32]bool
+	reconnectBackoff     time.Duration
+	progress             RecoveryProgressCallback
+	cacheSize            int
+	cacheTTL             time.Duration
+	lazy                 bool
+	lazyTimeout          time.Duration
+	recoveryRate         float64
+	recoveryBatchSize    int
+	recoveryNoSync       bool
+	tail                 bool
+	filter               ViewFilter
+	projection           Projection
+	projectionCodec      Codec
+	// topicCodec decodes the messages of the table topic if they are stored
+	// with another codec (see WithViewProjection)
+	topicCodec Codec
+	observers  []ViewObserver
+	// createPartitions is the number of partitions of the table topic if the
+	// view creates it
+	createPartitions int
+	kafkaConfig      []kafka.ConfigOption
+	checkTopics      bool
 
 	builders struct {
-		storage  storage.Builder
+		storage  storage.ContextBuilder
 		consumer kafka.ConsumerBuilder
 		topicmgr kafka.TopicManagerBuilder
 	}
@@ -257,8 +661,26 @@ func WithViewCallback(cb UpdateCallback) ViewOption {
 	}
 }
 
+// WithViewTombstonePolicy defines which values of the table are tombstones
+// (see WithTombstonePolicy). Unless another callback is set, the view updates
+// its partitions with TombstoneUpdate(policy) instead of DefaultUpdate.
+func WithViewTombstonePolicy(policy storage.TombstonePolicy) ViewOption {
+	return func(o *voptions) {
+		o.tombstonePolicy = policy
+	}
+}
+
 // WithViewStorageBuilder defines a builder for the storage of each partition.
 func WithViewStorageBuilder(sb storage.Builder) ViewOption {
+	return func(o *voptions) {
+		o.builders.storage = storage.AdaptBuilder(sb)
+	}
+}
+
+// WithViewContextStorageBuilder defines a builder for the storage of each
+// partition, which receives the logger of the view. The partitions are
+// created by NewView, so the context is never canceled.
+func WithViewContextStorageBuilder(sb storage.ContextBuilder) ViewOption {
 	return func(o *voptions) {
 		o.builders.storage = sb
 	}
@@ -278,6 +700,14 @@ func WithViewTopicManagerBuilder(tmb kafka.TopicManagerBuilder) ViewOption {
 	}
 }
 
+// WithViewKafkaConfig modifies the configuration of the default consumer and
+// topic manager builders (see WithKafkaConfig).
+func WithViewKafkaConfig(opts ...kafka.ConfigOption) ViewOption {
+	return func(o *voptions) {
+		o.kafkaConfig = append(o.kafkaConfig, opts...)
+	}
+}
+
 // WithViewPartitionChannelSize replaces the default partition channel size.
 // This is mostly used for testing by setting it to 0 to have synchronous behavior
 // of goka.
@@ -294,6 +724,35 @@ func WithViewHasher(hasher func() hash.Hash32) ViewOption {
 	}
 }
 
+// WithViewIndex registers a secondary index called name on the view. For every
+// table entry, fn returns the values under which the entry is indexed. The
+// indexes are kept in a separate storage per partition, created with the
+// storage builder of the view, and are updated whenever the view updates or
+// evicts a key. They are rebuilt from the table whenever a partition is
+// opened, which reads the whole partition. Use View.IndexIterator to query an
+// index.
+func WithViewIndex(name string, fn IndexFunc) ViewOption {
+	return func(o *voptions) {
+		o.indexes = append(o.indexes, viewIndex{name: name, fn: fn})
+	}
+}
+
+// WithViewPartitions restricts the view to materialize only the given
+// partitions of the table, so that each instance of a sharded service can hold
+// a slice of a large table. Keys are still assigned to partitions with the
+// hasher of the view. Get, Has and Evict fail for keys of other partitions and
+// iterators only return the keys of the materialized partitions.
+func WithViewPartitions(partitions ...int32) ViewOption {
+	return func(o *voptions) {
+		if o.partitions == nil {
+			o.partitions = make(map[int32]bool)
+		}
+		for _, p := range partitions {
+			o.partitions[p] = true
+		}
+	}
+}
+
 // WithViewClientID defines the client ID used to identify with Kafka.
 func WithViewClientID(clientID string) ViewOption {
 	return func(o *voptions) {
@@ -310,6 +769,158 @@ func WithViewRestartable() ViewOption {
 	}
 }
 
+// RecoveryProgressCallback is called with the current offset and the high
+// water mark of a table partition while the partition recovers.
+type RecoveryProgressCallback func(partition int32, offset, hwm int64, recovered bool)
+
+// WithViewRecoveryProgress sets a callback that reports the recovery progress
+// of each partition of the view. The callback is called when the partition
+// starts loading, at most once per second while it recovers, and once the
+// partition has recovered. It is called from the goroutine of the partition and
+// should return quickly.
+func WithViewRecoveryProgress(cb RecoveryProgressCallback) ViewOption {
+	return func(o *voptions) {
+		o.progress = cb
+	}
+}
+
+// WithViewCache enables a cache of decoded values in View.Get holding up to
+// size keys for at most ttl each (no expiry if ttl is 0). Cached values are
+// invalidated when the view updates or evicts their keys. Get returns the
+// cached values themselves, so callers must not modify them.
+func WithViewCache(size int, ttl time.Duration) ViewOption {
+	return func(o *voptions) {
+		o.cacheSize = size
+		o.cacheTTL = ttl
+	}
+}
+
+// WithViewAutoReconnect makes Run reconnect to Kafka and resume consuming
+// after errors of the Kafka consumer instead of returning them, waiting
+// backoff between the attempts. Errors of the local storage still terminate
+// Run. Unlike WithViewRestartable, the view does not have to be restarted by
+// the client and the local storage is closed when Run returns.
+func WithViewAutoReconnect(backoff time.Duration) ViewOption {
+	return func(o *voptions) {
+		o.reconnectBackoff = backoff
+	}
+}
+
+// WithViewLazyRecovery makes the view recover partitions on demand. Run does
+// not recover any partition upfront. Instead, the first lookup of a key of a
+// partition starts recovering the whole partition, since Kafka cannot fetch
+// single keys, and waits until the partition has caught up with the table
+// topic. Lookups fail if the partition does not recover within timeout, a zero
+// timeout makes them fail right away. GetWithStaleness never waits but returns
+// the values recovered so far. Once recovered, the partition is kept up to
+// date like in a regular view. Partitions recovered in the local storage by
+// earlier runs are only resumed once they are accessed again.
+func WithViewLazyRecovery(timeout time.Duration) ViewOption {
+	return func(o *voptions) {
+		o.lazy = true
+		o.lazyTimeout = timeout
+	}
+}
+
+// WithViewMaxRecoveryRate limits the number of messages the view recovers per
+// second over all its partitions, so that many views recovering at the same
+// time do not overload the brokers. Once a partition has recovered, its
+// updates are not limited anymore. By default, the recovery rate is not
+// limited.
+func WithViewMaxRecoveryRate(msgsPerSecond float64) ViewOption {
+	return func(o *voptions) {
+		o.recoveryRate = msgsPerSecond
+	}
+}
+
+// WithViewRecoveryBatchSize makes the view write the updates of recovering
+// partitions in batches of the given size (see WithRecoveryBatchSize).
+func WithViewRecoveryBatchSize(size int) ViewOption {
+	return func(o *voptions) {
+		o.recoveryBatchSize = size
+	}
+}
+
+// WithViewFastRecovery makes the view recover its partitions in large batches
+// without syncing them to disk (see WithFastRecovery).
+func WithViewFastRecovery() ViewOption {
+	return func(o *voptions) {
+		o.recoveryBatchSize = defaultFastRecoveryBatchSize
+		o.recoveryNoSync = true
+	}
+}
+
+// WithViewTail makes the view start consuming the table topic at the newest
+// offsets instead of recovering the table, so the view only contains the
+// updates received while running. The view is recovered as soon as it is
+// connected. Values stored locally by earlier runs are kept, so tailing views
+// should use a storage that does not outlive the view, eg,
+// storage.MemoryBuilder().
+func WithViewTail() ViewOption {
+	return func(o *voptions) {
+		o.tail = true
+	}
+}
+
+// ViewFilter decides whether an entry of the table is stored by the view. The
+// value is decoded with the codec of the view.
+type ViewFilter func(key string, value interface{}) bool
+
+// WithViewFilter makes the view store only the entries of the table for which
+// filter returns true. Entries that stop matching are deleted from the view,
+// so the view contains exactly the matching entries of the table.
+func WithViewFilter(filter ViewFilter) ViewOption {
+	return func(o *voptions) {
+		o.filter = filter
+	}
+}
+
+// Projection maps a value of the table to the representation stored by the
+// view. Returning nil deletes the key from the view.
+type Projection func(key string, value interface{}) (interface{}, error)
+
+// WithViewProjection makes the view store the values of the table in the
+// representation returned by projection, eg, only a few fields of a large
+// message, encoded with codec. Get and the iterators of the view return the
+// projected values. Filters (see WithViewFilter) receive the values before the
+// projection.
+func WithViewProjection(projection Projection, codec Codec) ViewOption {
+	return func(o *voptions) {
+		o.projection = projection
+		o.projectionCodec = codec
+	}
+}
+
+// WithViewObserver registers an observer that is notified of every update the
+// view applies. Observers are called synchronously by the partitions of the
+// view, so they have to return quickly. The option can be given several times.
+func WithViewObserver(o ViewObserver) ViewOption {
+	return func(opt *voptions) {
+		opt.observers = append(opt.observers, o)
+	}
+}
+
+// WithViewAutoCreateTable makes the view create the table topic with the given
+// number of partitions if it does not exist yet, eg, if the view starts before
+// the processor writing the table. The topic is created by the topic manager
+// like the tables of processors, ie, log-compacted and with the replication
+// configured in the topic manager.
+func WithViewAutoCreateTable(partitions int) ViewOption {
+	return func(o *voptions) {
+		o.createPartitions = partitions
+	}
+}
+
+// WithViewTopicCheck makes the view check that the table topic is configured
+// like the tables of the topic manager, eg, log compacted, and has the
+// partitions set by WithViewAutoCreateTable. The topic manager has to
+// implement kafka.TopicChecker.
+func WithViewTopicCheck() ViewOption {
+	return func(o *voptions) {
+		o.checkTopics = true
+	}
+}
+
 func (opt *voptions) applyOptions(topic Table, opts ...ViewOption) error {
 	opt.clientID = defaultClientID
 	opt.log = logger.Default()
@@ -318,16 +929,34 @@ func (opt *voptions) applyOptions(topic Table, opts ...ViewOption) error {
 	for _, o := range opts {
 		o(opt)
 	}
+	if opt.updateCallback == nil {
+		opt.updateCallback = defaultUpdate(opt.tombstonePolicy)
+	}
 
 	// StorageBuilder should always be set as a default option in NewView
 	if opt.builders.storage == nil {
 		return fmt.Errorf("StorageBuilder not set")
 	}
 	if opt.builders.consumer == nil {
-		opt.builders.consumer = kafka.DefaultConsumerBuilder
+		opt.builders.consumer = defaultConsumerBuilder(opt.kafkaConfig)
 	}
 	if opt.builders.topicmgr == nil {
-		opt.builders.topicmgr = kafka.DefaultTopicManagerBuilder
+		opt.builders.topicmgr = defaultTopicManagerBuilder(opt.kafkaConfig)
+	}
+
+	if opt.projection != nil && opt.projectionCodec == nil {
+		return fmt.Errorf("projection requires a codec")
+	}
+
+	names := make(map[string]bool)
+	for _, idx := range opt.indexes {
+		if idx.name == "" || idx.fn == nil {
+			return fmt.Errorf("index requires a name and an index function")
+		}
+		if names[idx.name] {
+			return fmt.Errorf("index %s registered twice", idx.name)
+		}
+		names[idx.name] = true
 	}
 
 	return nil
@@ -348,6 +977,15 @@ type eoptions struct {
 
 	hasher func() hash.Hash32
 
+	rate      float64
+	burst     int
+	delivered func(report *DeliveryReport)
+
+	retries      int
+	retryBackoff time.Duration
+
+	kafkaConfig []kafka.ConfigOption
+
 	builders struct {
 		topicmgr kafka.TopicManagerBuilder
 		producer kafka.ProducerBuilder
@@ -383,6 +1021,28 @@ func WithEmitterProducerBuilder(pb kafka.ProducerBuilder) EmitterOption {
 	}
 }
 
+// WithEmitterKafkaConfig modifies the configuration of the default producer
+// and topic manager builders (see WithKafkaConfig).
+func WithEmitterKafkaConfig(opts ...kafka.ConfigOption) EmitterOption {
+	return func(o *eoptions, topic Stream, codec Codec) {
+		o.kafkaConfig = append(o.kafkaConfig, opts...)
+	}
+}
+
+// WithEmitterIdempotentProducer makes the default producer of the emitter
+// idempotent (see WithIdempotentProducer).
+func WithEmitterIdempotentProducer() EmitterOption {
+	return WithEmitterKafkaConfig(kafka.WithIdempotentProducer())
+}
+
+// WithEmitterTransactionalID makes the default producer of the emitter
+// transactional with the given transactional ID, which enables
+// Emitter.BeginTransaction (see kafka.WithTransactionalID). Every emitter
+// instance needs its own ID, since producers with the same ID fence each other.
+func WithEmitterTransactionalID(id string) EmitterOption {
+	return WithEmitterKafkaConfig(kafka.WithTransactionalID(id))
+}
+
 // WithEmitterHasher sets the hash function that assigns keys to partitions.
 func WithEmitterHasher(hasher func() hash.Hash32) EmitterOption {
 	return func(o *eoptions, topic Stream, codec Codec) {
@@ -390,6 +1050,46 @@ func WithEmitterHasher(hasher func() hash.Hash32) EmitterOption {
 	}
 }
 
+// WithEmitterCompression sets the codec used to compress the messages of the
+// default producer of the emitter, eg, sarama.CompressionLZ4 (see
+// kafka.WithCompression). By default, messages are compressed with snappy.
+func WithEmitterCompression(compression sarama.CompressionCodec) EmitterOption {
+	return WithEmitterKafkaConfig(kafka.WithCompression(compression))
+}
+
+// WithEmitRateLimit limits the number of messages the emitter sends per second.
+// Up to burst messages are sent at once after a period of inactivity. Emits
+// exceeding the rate block until the message can be sent.
+func WithEmitRateLimit(msgsPerSecond float64, burst int) EmitterOption {
+	return func(o *eoptions, topic Stream, codec Codec) {
+		o.rate = msgsPerSecond
+		o.burst = burst
+	}
+}
+
+// WithEmitterDeliveryCallback sets a callback receiving the delivery report of
+// every message sent by the emitter, eg, to log the partitions and offsets the
+// messages were written to. The callback is called from the goroutine of the
+// producer, so it must not block.
+func WithEmitterDeliveryCallback(cb func(report *DeliveryReport)) EmitterOption {
+	return func(o *eoptions, topic Stream, codec Codec) {
+		o.delivered = cb
+	}
+}
+
+// WithEmitterRetry makes the emitter resend messages that failed up to retries
+// times, waiting backoff before each retry. The retries come on top of the
+// retries of the producer (see kafka.NewConfig), so they help to ride out
+// longer broker outages. If the last retry fails, the promise of the message
+// finishes with the error. Permanent errors, eg, messages exceeding the maximum
+// message size or messages emitted outside of a transaction, are not retried.
+func WithEmitterRetry(retries int, backoff time.Duration) EmitterOption {
+	return func(o *eoptions, topic Stream, codec Codec) {
+		o.retries = retries
+		o.retryBackoff = backoff
+	}
+}
+
 func WithEmitterTester(t Tester) EmitterOption {
 	return func(o *eoptions, topic Stream, codec Codec) {
 		o.builders.producer = t.ProducerBuilder()
@@ -409,10 +1109,10 @@ func (opt *eoptions) applyOptions(topic Stream, codec Codec, opts ...EmitterOpti
 
 	// config not set, use default one
 	if opt.builders.producer == nil {
-		opt.builders.producer = kafka.DefaultProducerBuilder
+		opt.builders.producer = defaultProducerBuilder(opt.kafkaConfig)
 	}
 	if opt.builders.topicmgr == nil {
-		opt.builders.topicmgr = kafka.DefaultTopicManagerBuilder
+		opt.builders.topicmgr = defaultTopicManagerBuilder(opt.kafkaConfig)
 	}
 
 	return nil
@@ -1,10 +1,16 @@
 package goka
 
 import (
+	"crypto/tls"
 	"fmt"
 	"regexp"
 	"testing"
 
+	"github.com/Shopify/sarama"
+	"github.com/lovoo/goka/codec"
+	"github.com/lovoo/goka/kafka"
+	"github.com/lovoo/goka/storage"
+
 	"github.com/facebookgo/ensure"
 )
 
@@ -13,10 +19,114 @@ func newMockOptions(t *testing.T) *poptions {
 	err := opts.applyOptions(new(GroupGraph))
 	ensure.Err(t, err, regexp.MustCompile("StorageBuilder not set$"))
 
-	opts.builders.storage = nullStorageBuilder()
+	opts.builders.storage = storage.AdaptBuilder(nullStorageBuilder())
 	err = opts.applyOptions(new(GroupGraph))
 	ensure.Nil(t, err)
 
 	fmt.Printf("%+v\n", opts)
 	return opts
 }
+
+func TestTombstoneUpdate(t *testing.T) {
+	st := storage.NewMemory()
+	update := TombstoneUpdate(storage.TombstoneEmpty)
+	ensure.Nil(t, update(st, 0, "key", []byte("value")))
+	ensure.Nil(t, update(st, 0, "key", []byte{}))
+	has, err := st.Has("key")
+	ensure.Nil(t, err)
+	ensure.False(t, has)
+
+	update = TombstoneUpdate(storage.TombstoneNever)
+	ensure.Nil(t, update(st, 0, "key", nil))
+	value, err := st.Get("key")
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, value, []byte{})
+}
+
+func TestOptions_tombstonePolicy(t *testing.T) {
+	gg := DefineGroup(group, Input("input", rawCodec, cb), Persist(rawCodec))
+
+	// by default, nil values delete their keys
+	opts := new(poptions)
+	ensure.Nil(t, opts.applyOptions(gg, WithStorageBuilder(nullStorageBuilder())))
+	st := storage.NewMemory()
+	ensure.Nil(t, st.Set("key", []byte("value")))
+	ensure.Nil(t, opts.updateCallback(st, 0, "key", nil))
+	has, err := st.Has("key")
+	ensure.Nil(t, err)
+	ensure.False(t, has)
+
+	// nil values are stored with TombstoneNever
+	opts = new(poptions)
+	ensure.Nil(t, opts.applyOptions(gg, WithStorageBuilder(nullStorageBuilder()), WithTombstonePolicy(storage.TombstoneNever)))
+	ensure.Nil(t, opts.updateCallback(st, 0, "key", nil))
+	has, err = st.Has("key")
+	ensure.Nil(t, err)
+	ensure.True(t, has)
+
+	// other update callbacks are kept
+	var called bool
+	opts = new(poptions)
+	ensure.Nil(t, opts.applyOptions(gg,
+		WithStorageBuilder(nullStorageBuilder()),
+		WithTombstonePolicy(storage.TombstoneNever),
+		WithUpdateCallback(func(storage.Storage, int32, string, []byte) error {
+			called = true
+			return nil
+		}),
+	))
+	ensure.Nil(t, opts.updateCallback(st, 0, "key", nil))
+	ensure.True(t, called)
+
+	// views apply the policy as well
+	vopts := new(voptions)
+	ensure.Nil(t, vopts.applyOptions("table", WithViewStorageBuilder(storage.MemoryBuilder()), WithViewTombstonePolicy(storage.TombstoneEmpty)))
+	ensure.Nil(t, vopts.updateCallback(st, 0, "key", []byte{}))
+	has, err = st.Has("key")
+	ensure.Nil(t, err)
+	ensure.False(t, has)
+}
+
+func TestOptions_startAtOffset(t *testing.T) {
+	gg := DefineGroup(group,
+		Input("input", rawCodec, cb),
+		Output("output", rawCodec),
+	)
+
+	opts := new(poptions)
+	err := opts.applyOptions(gg,
+		WithStorageBuilder(nullStorageBuilder()),
+		WithStartAtOffset("input", 10),
+	)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, opts.startOffsets, map[string]int64{"input": 10})
+
+	// only input streams can be seeded
+	for _, topic := range []Stream{"output", "unknown"} {
+		err = new(poptions).applyOptions(gg,
+			WithStorageBuilder(nullStorageBuilder()),
+			WithStartAtOffset(topic, 10),
+		)
+		ensure.StringContains(t, err.Error(), "not an input stream")
+	}
+}
+
+func TestOptions_emitterCompression(t *testing.T) {
+	tlsConfig := &tls.Config{ServerName: "kafka"}
+	opts := new(eoptions)
+	ensure.Nil(t, opts.applyOptions("topic", new(codec.String),
+		WithEmitterKafkaConfig(kafka.WithTLS(tlsConfig), kafka.WithSASLPlain("user", "password")),
+		WithEmitterTransactionalID("emitter-0"),
+		WithEmitterCompression(sarama.CompressionLZ4),
+	))
+
+	// the compression is applied on top of all other settings
+	config := kafka.NewConfigWithOptions(opts.kafkaConfig...)
+	ensure.DeepEqual(t, config.Producer.Compression, sarama.CompressionLZ4)
+	ensure.True(t, config.Net.TLS.Enable)
+	ensure.DeepEqual(t, config.Net.TLS.Config, tlsConfig)
+	ensure.True(t, config.Net.SASL.Enable)
+	ensure.DeepEqual(t, config.Net.SASL.User, "user")
+	ensure.True(t, config.Producer.Idempotent)
+	ensure.DeepEqual(t, config.Producer.Transaction.ID, "emitter-0")
+}
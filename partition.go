@@ -19,6 +19,7 @@ const (
 	defaultPartitionChannelSize = 10
 	stallPeriod                 = 30 * time.Second
 	stalledTimeout              = 2 * time.Minute
+	progressInterval            = time.Second
 )
 
 // partition represents one partition of a group table and handles the updates to
@@ -42,6 +43,8 @@ type partition struct {
 	topic string
 
 	ch      chan kafka.Event
+	prio    chan kafka.Event
+	visits  chan *visit
 	st      *storageProxy
 	proxy   kafkaProxy
 	process processCallback
@@ -50,6 +53,25 @@ type partition struct {
 	hwm           int64
 	offset        int64
 
+	// warmStart skips the recovery if the storage has local state and
+	// validates the state while running.
+	warmStart  bool
+	warmed     bool
+	validating bool
+
+	// progress is called while loading the table partition
+	progress     func(offset, hwm int64, recovered bool)
+	lastProgress time.Time
+
+	// limiter limits the rate of messages loaded before recovering
+	limiter *rateLimiter
+
+	// tail starts loading at the newest offset instead of the local offset
+	tail bool
+
+	// stored is called for every message stored while loading
+	stored func(msg *kafka.Message)
+
 	recoveredOnce sync.Once
 
 	stats         *PartitionStats
@@ -67,12 +89,21 @@ type kafkaProxy interface {
 
 type processCallback func(msg *message, st storage.Storage, wg *sync.WaitGroup, pstats *PartitionStats) (int, error)
 
+// visit is executed by the partition in between processing input messages.
+// fn returns the number of updates to the partition storage.
+type visit struct {
+	fn   func(st storage.Storage, wg *sync.WaitGroup, pstats *PartitionStats) (int, error)
+	done chan error
+}
+
 func newPartition(log logger.Logger, topic string, cb processCallback, st *storageProxy, proxy kafkaProxy, channelSize int) *partition {
 	return &partition{
 		log:   log,
 		topic: topic,
 
 		ch:      make(chan kafka.Event, channelSize),
+		prio:    make(chan kafka.Event, channelSize),
+		visits:  make(chan *visit),
 		st:      st,
 		proxy:   proxy,
 		process: cb,
@@ -100,8 +131,12 @@ func (p *partition) start(ctx context.Context) error {
 		if err := p.markRecovered(false); err != nil {
 			return fmt.Errorf("error marking stateless partition as recovered: %v", err)
 		}
-	} else if err := p.recover(ctx); err != nil {
+	} else if warmed, err := p.warmup(); err != nil {
 		return err
+	} else if !warmed {
+		if err := p.recover(ctx); err != nil {
+			return err
+		}
 	}
 
 	// if stopped, just return
@@ -133,6 +168,8 @@ func newMessage(ev *kafka.Message) *message {
 		Timestamp: ev.Timestamp,
 		Data:      ev.Value,
 		Key:       ev.Key,
+		NilKey:    ev.NilKey,
+		Headers:   ev.Headers,
 	}
 }
 
@@ -142,7 +179,23 @@ func (p *partition) run(ctx context.Context) error {
 	defer wg.Wait()
 
 	for {
+		// messages of high priority input streams are processed before any
+		// other pending event
 		select {
+		case ev := <-p.prio:
+			if err := p.processMessage(ev.(*kafka.Message), &wg); err != nil {
+				return err
+			}
+			continue
+		default:
+		}
+
+		select {
+		case ev := <-p.prio:
+			if err := p.processMessage(ev.(*kafka.Message), &wg); err != nil {
+				return err
+			}
+
 		case ev, isOpen := <-p.ch:
 			// channel already closed, ev will be nil
 			if !isOpen {
@@ -150,25 +203,14 @@ func (p *partition) run(ctx context.Context) error {
 			}
 			switch ev := ev.(type) {
 			case *kafka.Message:
-				if ev.Topic == p.topic {
-					return fmt.Errorf("received message from group table topic after recovery: %s", p.topic)
-				}
-
-				updates, err := p.process(newMessage(ev), p.st, &wg, p.stats)
-				if err != nil {
-					return fmt.Errorf("error processing message: %v", err)
+				if err := p.processMessage(ev, &wg); err != nil {
+					return err
 				}
-				p.offset += int64(updates)
-				p.hwm = p.offset + 1
 
-				// metrics
-				s := p.stats.Input[ev.Topic]
-				s.Count++
-				s.Bytes += len(ev.Value)
-				if !ev.Timestamp.IsZero() {
-					s.Delay = time.Since(ev.Timestamp)
+			case *kafka.BOF:
+				if err := p.validate(ev); err != nil {
+					return err
 				}
-				p.stats.Input[ev.Topic] = s
 
 			case *kafka.NOP:
 				// don't do anything but also don't log.
@@ -180,8 +222,14 @@ func (p *partition) run(ctx context.Context) error {
 				return fmt.Errorf("load: cannot handle %T = %v", ev, ev)
 			}
 
+		case v := <-p.visits:
+			updates, err := v.fn(p.st, &wg, p.stats)
+			p.offset += int64(updates)
+			p.hwm = p.offset + 1
+			v.done <- err
+
 		case <-p.requestStats:
-			p.lastStats = newPartitionStats().init(p.stats, p.offset, p.hwm)
+			p.lastStats = p.collectStats()
 			select {
 			case p.responseStats <- p.lastStats:
 			case <-ctx.Done():
@@ -195,6 +243,35 @@ func (p *partition) run(ctx context.Context) error {
 	}
 }
 
+func (p *partition) processMessage(ev *kafka.Message, wg *sync.WaitGroup) error {
+	if ev.Topic == p.topic && p.warmed {
+		// table topic is read for validation only
+		return nil
+	} else if ev.Topic == p.topic {
+		return fmt.Errorf("received message from group table topic after recovery: %s", p.topic)
+	}
+
+	updates, err := p.process(newMessage(ev), p.st, wg, p.stats)
+	if err == errProcessingAborted {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error processing message: %v", err)
+	}
+	p.offset += int64(updates)
+	p.hwm = p.offset + 1
+
+	// metrics
+	s := p.stats.Input[ev.Topic]
+	s.Count++
+	s.Bytes += len(ev.Value)
+	if !ev.Timestamp.IsZero() {
+		s.Delay = time.Since(ev.Timestamp)
+	}
+	p.stats.Input[ev.Topic] = s
+	return nil
+}
+
 ///////////////////////////////////////////////////////////////////////////////
 // loading storage
 ///////////////////////////////////////////////////////////////////////////////
@@ -207,13 +284,74 @@ func (p *partition) recover(ctx context.Context) error {
 	return p.load(ctx, false)
 }
 
+// warmup marks the partition as recovered without loading the table topic if
+// warm start is enabled and the storage has local state. The local state is
+// validated by validate once the table topic delivers its BOF.
+func (p *partition) warmup() (bool, error) {
+	if !p.warmStart {
+		return false, nil
+	}
+	local, err := p.st.GetOffset(sarama.OffsetOldest)
+	if err != nil {
+		return false, fmt.Errorf("error reading local offset: %v", err)
+	}
+	if local < 0 {
+		// no local state, recover as usual
+		return false, nil
+	}
+
+	p.offset = local
+	p.hwm = local + 1
+	if err = p.markRecovered(false); err != nil {
+		return false, fmt.Errorf("error setting recovered: %v", err)
+	}
+	if err = p.proxy.Add(p.topic, local); err != nil {
+		return false, err
+	}
+	p.warmed = true
+	p.validating = true
+	return true, nil
+}
+
+// validate checks that the local state of a warm started partition contains
+// all updates of the table topic and stops reading the table topic.
+func (p *partition) validate(ev *kafka.BOF) error {
+	if ev.Topic != p.topic || !p.validating {
+		return nil
+	}
+	p.validating = false
+	if err := p.proxy.Remove(p.topic); err != nil {
+		return err
+	}
+	// the hwm includes the updates the partition wrote since warming up, which
+	// are already accounted for in p.offset
+	if ev.Hwm > p.offset+1 {
+		return fmt.Errorf("local storage of %s is missing %d updates of the table topic (local offset %d, hwm %d), restart without warm start",
+			p.topic, ev.Hwm-p.offset-1, p.offset, ev.Hwm)
+	}
+	return nil
+}
+
 func (p *partition) recovered() bool {
 	return atomic.LoadInt32(&p.recoveredFlag) == 1
 }
 
 func (p *partition) load(ctx context.Context, catchup bool) (rerr error) {
+	// write the updates of the recovery in batches, without syncing them if
+	// configured
+	if !p.recovered() {
+		if err := p.st.startRecovery(); err != nil {
+			return fmt.Errorf("error starting recovery: %v", err)
+		}
+	}
+
 	// fetch local offset
-	if local, err := p.st.GetOffset(sarama.OffsetOldest); err != nil {
+	if p.tail {
+		// skip recovery, only new updates are loaded
+		if err := p.proxy.Add(p.topic, sarama.OffsetNewest); err != nil {
+			return err
+		}
+	} else if local, err := p.st.GetOffset(sarama.OffsetOldest); err != nil {
 		return fmt.Errorf("error reading local offset: %v", err)
 	} else if err = p.proxy.Add(p.topic, local); err != nil {
 		return err
@@ -222,6 +360,9 @@ func (p *partition) load(ctx context.Context, catchup bool) (rerr error) {
 	defer func() {
 		var derr multierr.Errors
 		_ = derr.Collect(rerr)
+		if e := p.st.stopBatch(); e != nil {
+			_ = derr.Collect(fmt.Errorf("error writing batch: %v", e))
+		}
 		if e := p.proxy.Remove(p.topic); e != nil {
 			_ = derr.Collect(e)
 		}
@@ -254,14 +395,17 @@ func (p *partition) load(ctx context.Context, catchup bool) (rerr error) {
 						return fmt.Errorf("error setting recovered: %v", err)
 					}
 				}
+				p.reportProgress(true)
 
 			case *kafka.EOF:
 				p.offset = ev.Hwm - 1
 				p.hwm = ev.Hwm
 
+				wasRecovered := p.recovered()
 				if err := p.markRecovered(catchup); err != nil {
 					return fmt.Errorf("error setting recovered: %v", err)
 				}
+				p.reportProgress(!wasRecovered)
 
 				if catchup {
 					continue
@@ -274,15 +418,20 @@ func (p *partition) load(ctx context.Context, catchup bool) (rerr error) {
 					p.log.Printf("dropping message from topic = %s while loading", ev.Topic)
 					continue
 				}
+				if p.limiter != nil && !p.recovered() && !p.limiter.wait(ctx) {
+					return nil
+				}
 				if err := p.storeEvent(ev); err != nil {
 					return fmt.Errorf("load: error updating storage: %v", err)
 				}
 				p.offset = ev.Offset
+				wasRecovered := p.recovered()
 				if p.offset >= p.hwm-1 {
 					if err := p.markRecovered(catchup); err != nil {
 						return fmt.Errorf("error setting recovered: %v", err)
 					}
 				}
+				p.reportProgress(!wasRecovered && p.recovered())
 
 				// update metrics
 				s := p.stats.Input[ev.Topic]
@@ -309,7 +458,7 @@ func (p *partition) load(ctx context.Context, catchup bool) (rerr error) {
 			}
 
 		case <-p.requestStats:
-			p.lastStats = newPartitionStats().init(p.stats, p.offset, p.hwm)
+			p.lastStats = p.collectStats()
 			select {
 			case p.responseStats <- p.lastStats:
 			case <-ctx.Done():
@@ -322,8 +471,22 @@ func (p *partition) load(ctx context.Context, catchup bool) (rerr error) {
 	}
 }
 
+// reportProgress calls the progress callback if the partition has not
+// recovered yet and the last report is older than progressInterval, or if
+// force is set.
+func (p *partition) reportProgress(force bool) {
+	if p.progress == nil {
+		return
+	}
+	if !force && (p.recovered() || time.Since(p.lastProgress) < progressInterval) {
+		return
+	}
+	p.lastProgress = time.Now()
+	p.progress(p.offset, p.hwm, p.recovered())
+}
+
 func (p *partition) storeEvent(msg *kafka.Message) error {
-	err := p.st.Update(msg.Key, msg.Value)
+	err := p.st.UpdateWithTimestamp(msg.Key, msg.Value, msg.Timestamp)
 	if err != nil {
 		return fmt.Errorf("Error from the update callback while recovering from the log: %v", err)
 	}
@@ -331,6 +494,9 @@ func (p *partition) storeEvent(msg *kafka.Message) error {
 	if err != nil {
 		return fmt.Errorf("Error updating offset in local storage while recovering from the log: %v", err)
 	}
+	if p.stored != nil {
+		p.stored(msg)
+	}
 	return nil
 }
 
@@ -394,6 +560,19 @@ func (p *partition) markRecovered(catchup bool) (err error) {
 	return
 }
 
+// collectStats returns a copy of the current stats including the metrics of
+// the storage. If the storage fails to report metrics, the last ones are kept.
+func (p *partition) collectStats() *PartitionStats {
+	stats := newPartitionStats().init(p.stats, p.offset, p.hwm)
+	stats.Storage = p.lastStats.Storage
+	if st, err := p.st.stats(); err != nil {
+		p.log.Printf("error reading storage stats of %s: %v", p.topic, err)
+	} else {
+		stats.Storage = st
+	}
+	return stats
+}
+
 func (p *partition) fetchStats(ctx context.Context) *PartitionStats {
 	timer := time.NewTimer(100 * time.Millisecond)
 	defer timer.Stop()
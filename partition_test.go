@@ -3,6 +3,7 @@ package goka
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
 	"sync"
 	"sync/atomic"
@@ -163,6 +164,47 @@ func TestPartition_runStateless(t *testing.T) {
 	ensure.Nil(t, err)
 }
 
+func TestPartition_runPriority(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var (
+		proxy       = mock.NewMockkafkaProxy(ctrl)
+		step        = make(chan string, 3)
+		wait        = make(chan bool)
+		ctx, cancel = context.WithCancel(context.Background())
+	)
+
+	consume := func(msg *message, st storage.Storage, wg *sync.WaitGroup, pstats *PartitionStats) (int, error) {
+		step <- msg.Topic
+		return 0, nil
+	}
+
+	p := newPartition(logger.Default(), topic, consume, newNullStorageProxy(0), proxy, defaultPartitionChannelSize)
+
+	// fill partition before starting it
+	p.ch <- &kafka.Message{Topic: "bulk", Offset: 1}
+	p.ch <- &kafka.Message{Topic: "bulk", Offset: 2}
+	p.prio <- &kafka.Message{Topic: "control", Offset: 1}
+
+	proxy.EXPECT().AddGroup()
+	proxy.EXPECT().Stop()
+	go func() {
+		err := p.start(ctx)
+		ensure.Nil(t, err)
+		close(wait)
+	}()
+
+	err := doTimed(t, func() {
+		ensure.DeepEqual(t, <-step, "control")
+		ensure.DeepEqual(t, <-step, "bulk")
+		ensure.DeepEqual(t, <-step, "bulk")
+		cancel()
+		<-wait
+	})
+	ensure.Nil(t, err)
+}
+
 func TestPartition_runStatelessWithError(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -385,6 +427,183 @@ func TestPartition_runStatefulWithError(t *testing.T) {
 	ensure.Nil(t, err)
 }
 
+func TestPartition_warmStart(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var (
+		proxy             = mock.NewMockkafkaProxy(ctrl)
+		st                = mock.NewMockStorage(ctrl)
+		par         int32 = 1
+		offset      int64 = 4
+		wait              = make(chan bool)
+		step              = make(chan bool)
+		ctx, cancel       = context.WithCancel(context.Background())
+		count       int64
+	)
+
+	consume := func(msg *message, st storage.Storage, wg *sync.WaitGroup, pstats *PartitionStats) (int, error) {
+		atomic.AddInt64(&count, 1)
+		step <- true
+		return 0, nil
+	}
+
+	p := newPartition(logger.Default(), topic, consume, newStorageProxy(st, 0, nil), proxy, 0)
+	p.warmStart = true
+
+	gomock.InOrder(
+		st.EXPECT().GetOffset(int64(-2)).Return(int64(offset), nil),
+		st.EXPECT().MarkRecovered(),
+		proxy.EXPECT().Add(topic, offset),
+		proxy.EXPECT().AddGroup(),
+		proxy.EXPECT().Remove(topic),
+		proxy.EXPECT().Stop(),
+	)
+
+	go func() {
+		err := p.start(ctx)
+		ensure.Nil(t, err)
+		close(wait)
+	}()
+
+	// messages are processed before the table topic was validated
+	p.ch <- &kafka.Message{
+		Key:       "key",
+		Offset:    offset,
+		Partition: par,
+		Topic:     "some-other-topic",
+		Value:     []byte("value"),
+	}
+	err := doTimed(t, func() { <-step })
+	ensure.Nil(t, err)
+	ensure.True(t, p.recovered())
+
+	// local state contains the last update of the table topic
+	p.ch <- &kafka.BOF{
+		Partition: par,
+		Topic:     topic,
+		Offset:    offset,
+		Hwm:       offset + 1,
+	}
+	// updates read for validation are dropped
+	p.ch <- &kafka.Message{
+		Key:       "key",
+		Offset:    offset,
+		Partition: par,
+		Topic:     topic,
+		Value:     []byte("value"),
+	}
+	p.ch <- new(kafka.NOP)
+
+	err = doTimed(t, func() {
+		cancel()
+		<-wait
+	})
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, atomic.LoadInt64(&count), int64(1))
+}
+
+func TestPartition_warmStartOwnUpdates(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var (
+		proxy             = mock.NewMockkafkaProxy(ctrl)
+		st                = mock.NewMockStorage(ctrl)
+		offset      int64 = 4
+		wait              = make(chan bool)
+		step              = make(chan bool)
+		ctx, cancel       = context.WithCancel(context.Background())
+	)
+
+	// every message writes two updates into the table
+	consume := func(msg *message, st storage.Storage, wg *sync.WaitGroup, pstats *PartitionStats) (int, error) {
+		step <- true
+		return 2, nil
+	}
+
+	p := newPartition(logger.Default(), topic, consume, newStorageProxy(st, 0, nil), proxy, 0)
+	p.warmStart = true
+
+	gomock.InOrder(
+		st.EXPECT().GetOffset(int64(-2)).Return(int64(offset), nil),
+		st.EXPECT().MarkRecovered(),
+		proxy.EXPECT().Add(topic, offset),
+		proxy.EXPECT().AddGroup(),
+		proxy.EXPECT().Remove(topic),
+		proxy.EXPECT().Stop(),
+	)
+
+	go func() {
+		err := p.start(ctx)
+		ensure.Nil(t, err)
+		close(wait)
+	}()
+
+	p.ch <- &kafka.Message{
+		Key:    "key",
+		Offset: 10,
+		Topic:  "some-other-topic",
+		Value:  []byte("value"),
+	}
+	err := doTimed(t, func() { <-step })
+	ensure.Nil(t, err)
+
+	// the hwm includes the updates written by the partition itself
+	p.ch <- &kafka.BOF{
+		Topic:  topic,
+		Offset: offset,
+		Hwm:    offset + 3,
+	}
+	p.ch <- new(kafka.NOP)
+
+	err = doTimed(t, func() {
+		cancel()
+		<-wait
+	})
+	ensure.Nil(t, err)
+}
+
+func TestPartition_warmStartMissingUpdates(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var (
+		proxy        = mock.NewMockkafkaProxy(ctrl)
+		st           = mock.NewMockStorage(ctrl)
+		offset int64 = 4
+		wait         = make(chan bool)
+	)
+
+	p := newPartition(logger.Default(), topic, nil, newStorageProxy(st, 0, nil), proxy, 0)
+	p.warmStart = true
+
+	gomock.InOrder(
+		st.EXPECT().GetOffset(int64(-2)).Return(int64(offset), nil),
+		st.EXPECT().MarkRecovered(),
+		proxy.EXPECT().Add(topic, offset),
+		proxy.EXPECT().AddGroup(),
+		proxy.EXPECT().Remove(topic),
+		proxy.EXPECT().Stop(),
+	)
+
+	go func() {
+		err := p.start(context.Background())
+		ensure.NotNil(t, err)
+		ensure.StringContains(t, err.Error(), "missing 2 updates")
+		close(wait)
+	}()
+
+	p.ch <- &kafka.BOF{
+		Topic:  topic,
+		Offset: offset,
+		Hwm:    offset + 3,
+	}
+
+	err := doTimed(t, func() { <-wait })
+	ensure.Nil(t, err)
+}
+
 func TestPartition_loadStateful(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -470,6 +689,286 @@ func TestPartition_loadStateful(t *testing.T) {
 	ensure.Nil(t, err)
 }
 
+func TestPartition_loadProgress(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	type report struct {
+		offset, hwm int64
+		recovered   bool
+	}
+
+	var (
+		proxy   = mock.NewMockkafkaProxy(ctrl)
+		reports []report
+		wait    = make(chan bool)
+	)
+
+	p := newPartition(logger.Default(), topic, nil, newStorageProxy(storage.NewMemory(), 0, DefaultUpdate), proxy, defaultPartitionChannelSize)
+	p.progress = func(offset, hwm int64, recovered bool) {
+		reports = append(reports, report{offset, hwm, recovered})
+	}
+
+	gomock.InOrder(
+		proxy.EXPECT().Add(topic, int64(-2)),
+		proxy.EXPECT().Remove(topic),
+	)
+
+	go func() {
+		err := p.recover(context.Background())
+		ensure.Nil(t, err)
+		close(wait)
+	}()
+
+	p.ch <- &kafka.BOF{Topic: topic, Offset: 0, Hwm: 3}
+	for i := int64(0); i < 3; i++ {
+		p.ch <- &kafka.Message{Topic: topic, Key: "key", Offset: i, Value: []byte("value")}
+	}
+	p.ch <- &kafka.EOF{Topic: topic, Hwm: 3}
+
+	err := doTimed(t, func() { <-wait })
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, reports, []report{
+		{0, 3, false},
+		{2, 3, true},
+	})
+}
+
+func TestPartition_loadRateLimited(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var (
+		proxy = mock.NewMockkafkaProxy(ctrl)
+		wait  = make(chan bool)
+	)
+
+	p := newPartition(logger.Default(), topic, nil, newStorageProxy(storage.NewMemory(), 0, DefaultUpdate), proxy, defaultPartitionChannelSize)
+	p.limiter = newRateLimiter(100)
+
+	gomock.InOrder(
+		proxy.EXPECT().Add(topic, int64(-2)),
+		proxy.EXPECT().Remove(topic),
+	)
+
+	go func() {
+		err := p.recover(context.Background())
+		ensure.Nil(t, err)
+		close(wait)
+	}()
+
+	start := time.Now()
+	p.ch <- &kafka.BOF{Topic: topic, Offset: 0, Hwm: 5}
+	for i := int64(0); i < 5; i++ {
+		p.ch <- &kafka.Message{Topic: topic, Key: "key", Offset: i, Value: []byte("value")}
+	}
+	p.ch <- &kafka.EOF{Topic: topic, Hwm: 5}
+
+	err := doTimed(t, func() { <-wait })
+	ensure.Nil(t, err)
+	// 5 messages at 100 messages per second take at least 40ms
+	ensure.True(t, time.Since(start) >= 40*time.Millisecond)
+}
+
+// recordingBatcher records the length and offset of the batches written
+// natively to the storage.
+type recordingBatcher struct {
+	storage.Storage
+	batches [][2]int64
+}
+
+func (s *recordingBatcher) WriteBatch(b *storage.Batch) error {
+	offset, _ := b.Offset()
+	s.batches = append(s.batches, [2]int64{int64(b.Len()), offset})
+	return storage.WriteBatch(s.Storage, b)
+}
+
+func TestPartition_loadBatched(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var (
+		proxy = mock.NewMockkafkaProxy(ctrl)
+		st    = &recordingBatcher{Storage: storage.NewMemory()}
+		wait  = make(chan bool)
+	)
+
+	sp := newStorageProxy(st, 0, DefaultUpdate)
+	sp.batchSize = 2
+	p := newPartition(logger.Default(), topic, nil, sp, proxy, defaultPartitionChannelSize)
+
+	gomock.InOrder(
+		proxy.EXPECT().Add(topic, int64(-2)),
+		proxy.EXPECT().Remove(topic),
+	)
+
+	go func() {
+		err := p.recover(context.Background())
+		ensure.Nil(t, err)
+		close(wait)
+	}()
+
+	p.ch <- &kafka.BOF{Topic: topic, Offset: 0, Hwm: 5}
+	for i := int64(0); i < 5; i++ {
+		p.ch <- &kafka.Message{Topic: topic, Key: fmt.Sprintf("key-%d", i), Offset: i, Value: []byte("value")}
+	}
+	p.ch <- &kafka.EOF{Topic: topic, Hwm: 5}
+
+	err := doTimed(t, func() { <-wait })
+	ensure.Nil(t, err)
+
+	// updates are written with their offset once the batch is full, the rest
+	// when the partition has recovered
+	ensure.DeepEqual(t, st.batches, [][2]int64{{2, 1}, {2, 3}, {1, 4}})
+	offset, err := st.GetOffset(0)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, offset, int64(4))
+	value, err := st.Get("key-4")
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, value, []byte("value"))
+}
+
+func TestPartition_loadBatchedFallback(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var (
+		proxy = mock.NewMockkafkaProxy(ctrl)
+		st    = mock.NewMockStorage(ctrl)
+		wait  = make(chan bool)
+	)
+
+	sp := newStorageProxy(st, 0, DefaultUpdate)
+	sp.batchSize = 2
+	p := newPartition(logger.Default(), topic, nil, sp, proxy, defaultPartitionChannelSize)
+
+	gomock.InOrder(
+		st.EXPECT().GetOffset(int64(-2)).Return(int64(-2), nil),
+		proxy.EXPECT().Add(topic, int64(-2)),
+		// storages without native batches get the updates of a batch key by
+		// key followed by the offset
+		st.EXPECT().Set("key", []byte("value")).Times(2),
+		st.EXPECT().SetOffset(int64(1)),
+		st.EXPECT().Set("key", []byte("value")).Times(2),
+		st.EXPECT().SetOffset(int64(3)),
+		st.EXPECT().Set("key", []byte("value")),
+		st.EXPECT().SetOffset(int64(4)),
+		st.EXPECT().MarkRecovered(),
+		proxy.EXPECT().Remove(topic),
+	)
+
+	go func() {
+		err := p.recover(context.Background())
+		ensure.Nil(t, err)
+		close(wait)
+	}()
+
+	p.ch <- &kafka.BOF{Topic: topic, Offset: 0, Hwm: 5}
+	for i := int64(0); i < 5; i++ {
+		p.ch <- &kafka.Message{Topic: topic, Key: "key", Offset: i, Value: []byte("value")}
+	}
+	p.ch <- &kafka.EOF{Topic: topic, Hwm: 5}
+
+	err := doTimed(t, func() { <-wait })
+	ensure.Nil(t, err)
+}
+
+func TestPartition_loadTTL(t *testing.T) {
+	for _, batchSize := range []int{0, 2} {
+		t.Run(fmt.Sprintf("batch-%d", batchSize), func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			var (
+				proxy = mock.NewMockkafkaProxy(ctrl)
+				st    = storage.NewTTL(storage.NewMemory(), time.Hour)
+				wait  = make(chan bool)
+				now   = time.Now()
+			)
+
+			sp := newStorageProxy(st, 0, DefaultUpdate)
+			sp.batchSize = batchSize
+			p := newPartition(logger.Default(), topic, nil, sp, proxy, defaultPartitionChannelSize)
+
+			gomock.InOrder(
+				proxy.EXPECT().Add(topic, int64(-2)),
+				proxy.EXPECT().Remove(topic),
+			)
+
+			go func() {
+				err := p.recover(context.Background())
+				ensure.Nil(t, err)
+				close(wait)
+			}()
+
+			// the entries expire after the ttl counted from the message
+			// timestamps, not from the recovery
+			p.ch <- &kafka.BOF{Topic: topic, Offset: 0, Hwm: 3}
+			p.ch <- &kafka.Message{Topic: topic, Key: "old", Offset: 0, Value: []byte("value"), Timestamp: now.Add(-2 * time.Hour)}
+			p.ch <- &kafka.Message{Topic: topic, Key: "recent", Offset: 1, Value: []byte("value"), Timestamp: now.Add(-time.Minute)}
+			p.ch <- &kafka.Message{Topic: topic, Key: "untimed", Offset: 2, Value: []byte("value")}
+			p.ch <- &kafka.EOF{Topic: topic, Hwm: 3}
+
+			err := doTimed(t, func() { <-wait })
+			ensure.Nil(t, err)
+
+			has, err := st.Has("old")
+			ensure.Nil(t, err)
+			ensure.False(t, has)
+			has, err = st.Has("recent")
+			ensure.Nil(t, err)
+			ensure.True(t, has)
+			has, err = st.Has("untimed")
+			ensure.Nil(t, err)
+			ensure.True(t, has)
+		})
+	}
+}
+
+func TestPartition_loadTail(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var (
+		proxy = mock.NewMockkafkaProxy(ctrl)
+		st    = storage.NewMemory()
+		wait  = make(chan bool)
+	)
+	ensure.Nil(t, st.SetOffset(2))
+
+	p := newPartition(logger.Default(), topic, nil, newStorageProxy(st, 0, DefaultUpdate), proxy, defaultPartitionChannelSize)
+	p.tail = true
+
+	// the local offset is ignored
+	gomock.InOrder(
+		proxy.EXPECT().Add(topic, int64(kafka.OffsetNewest)),
+		proxy.EXPECT().Remove(topic),
+	)
+
+	go func() {
+		err := p.recover(context.Background())
+		ensure.Nil(t, err)
+		close(wait)
+	}()
+
+	p.ch <- &kafka.BOF{Topic: topic, Offset: 10, Hwm: 10}
+	err := doTimed(t, func() {
+		for !p.recovered() {
+			time.Sleep(time.Millisecond)
+		}
+	})
+	ensure.Nil(t, err)
+
+	p.ch <- &kafka.Message{Topic: topic, Key: "key", Offset: 10, Value: []byte("value")}
+	p.ch <- &kafka.EOF{Topic: topic, Hwm: 11}
+	err = doTimed(t, func() { <-wait })
+	ensure.Nil(t, err)
+
+	value, err := st.Get("key")
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, value, []byte("value"))
+}
+
 func TestPartition_loadStatefulWithError(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -914,3 +1413,48 @@ func BenchmarkPartition_load(b *testing.B) {
 	cancel()
 	<-wait
 }
+
+// statsStorage provides stats for a mocked storage.
+type statsStorage struct {
+	*mock.MockStorage
+	stats *storage.Stats
+	err   error
+}
+
+func (s *statsStorage) Stats() (*storage.Stats, error) {
+	return s.stats, s.err
+}
+
+func TestPartition_collectStats(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	st := &statsStorage{MockStorage: mock.NewMockStorage(ctrl)}
+	p := newPartition(logger.Default(), topic, nil, newStorageProxy(st, 0, nil), nil, defaultPartitionChannelSize)
+
+	st.EXPECT().Set("key", []byte("value")).Return(nil)
+	st.EXPECT().Get("key").Return([]byte("value"), nil).Times(2)
+	ensure.Nil(t, p.st.Set("key", []byte("value")))
+	for i := 0; i < 2; i++ {
+		_, err := p.st.Get("key")
+		ensure.Nil(t, err)
+	}
+
+	st.stats = &storage.Stats{Keys: 1, Bytes: 8, OpenFiles: 2}
+	stats := p.collectStats()
+	ensure.DeepEqual(t, stats.Storage.Keys, int64(1))
+	ensure.DeepEqual(t, stats.Storage.Bytes, int64(8))
+	ensure.DeepEqual(t, stats.Storage.OpenFiles, 2)
+	ensure.DeepEqual(t, stats.Storage.Reads, uint64(2))
+	ensure.DeepEqual(t, stats.Storage.Writes, uint64(1))
+
+	// failing storages keep the last metrics
+	p.lastStats = stats
+	st.stats, st.err = nil, errors.New("some error")
+	ensure.DeepEqual(t, p.collectStats().Storage, stats.Storage)
+
+	// the keys and bytes of storages without stats are unknown
+	p = newPartition(logger.Default(), topic, nil, newStorageProxy(st.MockStorage, 0, nil), nil, defaultPartitionChannelSize)
+	stats = p.collectStats()
+	ensure.DeepEqual(t, stats.Storage.Keys, int64(-1))
+	ensure.DeepEqual(t, stats.Storage.Bytes, int64(-1))
+}
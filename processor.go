@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"runtime/debug"
+	"strings"
 	"sync"
 	"time"
 
@@ -30,6 +31,12 @@ type Processor struct {
 	graph *GroupGraph
 	m     sync.RWMutex
 
+	limiters map[int32]*rateLimiter
+	lm       sync.Mutex
+
+	// pending emits if the producer queue is bounded
+	pending chan struct{}
+
 	consumer kafka.Consumer
 	producer kafka.Producer
 	asCh     chan kafka.Assignment
@@ -47,6 +54,8 @@ type message struct {
 	Partition int32
 	Offset    int64
 	Timestamp time.Time
+	NilKey    bool
+	Headers   kafka.Headers
 }
 
 // ProcessCallback function is called for every message received by the
@@ -61,7 +70,6 @@ func NewProcessor(brokers []string, gg *GroupGraph, options ...ProcessorOption)
 		// default options comes first
 		[]ProcessorOption{
 			WithLogger(logger.Default()),
-			WithUpdateCallback(DefaultUpdate),
 			WithPartitionChannelSize(defaultPartitionChannelSize),
 			WithStorageBuilder(storage.DefaultBuilder(DefaultProcessorStoragePath(gg.Group()))),
 		},
@@ -94,8 +102,9 @@ func NewProcessor(brokers []string, gg *GroupGraph, options ...ProcessorOption)
 			WithViewPartitionChannelSize(opts.partitionChannelSize),
 			WithViewClientID(opts.clientID),
 			WithViewTopicManagerBuilder(opts.builders.topicmgr),
-			WithViewStorageBuilder(opts.builders.storage),
+			WithViewContextStorageBuilder(opts.builders.storage),
 			WithViewConsumerBuilder(opts.builders.consumer),
+			WithViewTombstonePolicy(opts.tombstonePolicy),
 		)
 		if err != nil {
 			return nil, fmt.Errorf("error creating view: %v", err)
@@ -117,6 +126,9 @@ func NewProcessor(brokers []string, gg *GroupGraph, options ...ProcessorOption)
 
 		asCh: make(chan kafka.Assignment, 1),
 	}
+	if opts.maxPending > 0 {
+		processor.pending = make(chan struct{}, opts.maxPending)
+	}
 
 	return processor, nil
 }
@@ -141,12 +153,13 @@ func prepareTopics(brokers []string, gg *GroupGraph, opts *poptions) (npar int,
 	}
 
 	// TODO(diogo): add output topics
+	ensureStreams := gg.RekeyStreams().Topics()
 	if ls := gg.LoopStream(); ls != nil {
-		ensureStreams := []string{ls.Topic()}
-		for _, t := range ensureStreams {
-			if err = tm.EnsureStreamExists(t, npar); err != nil {
-				return 0, err
-			}
+		ensureStreams = append([]string{ls.Topic()}, ensureStreams...)
+	}
+	for _, t := range ensureStreams {
+		if err = tm.EnsureStreamExists(t, npar); err != nil {
+			return 0, err
 		}
 	}
 
@@ -156,32 +169,104 @@ func prepareTopics(brokers []string, gg *GroupGraph, opts *poptions) (npar int,
 		}
 	}
 
-	return
+	if opts.panicPolicy == PanicDeadLetter {
+		if err = tm.EnsureStreamExists(string(opts.deadLetterTopic), npar); err != nil {
+			return 0, fmt.Errorf("error ensuring dead letter topic: %v", err)
+		}
+	}
+
+	if !opts.checkTopics {
+		return
+	}
+	tc, ok := tm.(kafka.TopicChecker)
+	if !ok {
+		return 0, fmt.Errorf("topic manager cannot check topics")
+	}
+	return npar, checkTopics(tm, tc, gg, npar)
+}
+
+// checkTopics checks all topics of the group graph. Streams and tables consumed
+// or written by the group must have npar partitions, lookup tables keep their
+// own number of partitions.
+func checkTopics(tm kafka.TopicManager, tc kafka.TopicChecker, gg *GroupGraph, npar int) error {
+	checked := make(map[string]bool)
+	check := func(topic string, npar int, table bool) error {
+		if checked[topic] {
+			return nil
+		}
+		checked[topic] = true
+		if table {
+			return tc.CheckTable(topic, npar)
+		}
+		return tc.CheckStream(topic, npar)
+	}
+
+	streams := append(gg.InputStreams().Topics(), gg.RekeyStreams().Topics()...)
+	if ls := gg.LoopStream(); ls != nil {
+		streams = append(streams, ls.Topic())
+	}
+	for _, t := range streams {
+		if err := check(t, npar, false); err != nil {
+			return err
+		}
+	}
+	tables := gg.JointTables().Topics()
+	if gt := gg.GroupTable(); gt != nil {
+		tables = append(tables, gt.Topic())
+	}
+	for _, t := range tables {
+		if err := check(t, npar, true); err != nil {
+			return err
+		}
+	}
+	for _, t := range gg.LookupTables().Topics() {
+		pars, err := tm.Partitions(t)
+		if err != nil {
+			return fmt.Errorf("Error fetching partitions for topic %s: %v", t, err)
+		}
+		if err := check(t, len(pars), true); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // returns the number of partitions the topics have, and an error if topics are
-// not copartitionea.
+// not copartitioned. The error names every topic with its partition count.
 func ensureCopartitioned(tm kafka.TopicManager, topics []string) (int, error) {
-	var npar int
-	for _, topic := range topics {
-		partitions, err := tm.Partitions(topic)
+	var (
+		npar       int
+		mismatch   bool
+		partitions = make([]int, len(topics))
+	)
+	for i, topic := range topics {
+		pars, err := tm.Partitions(topic)
 		if err != nil {
 			return 0, fmt.Errorf("Error fetching partitions for topic %s: %v", topic, err)
 		}
 
 		// check assumption that partitions are gap-less
-		for i, p := range partitions {
-			if i != int(p) {
-				return 0, fmt.Errorf("Topic %s has partition gap: %v", topic, partitions)
+		for j, p := range pars {
+			if j != int(p) {
+				return 0, fmt.Errorf("Topic %s has partition gap: %v", topic, pars)
 			}
 		}
 
-		if npar == 0 {
-			npar = len(partitions)
+		partitions[i] = len(pars)
+		if i == 0 {
+			npar = len(pars)
+		} else if len(pars) != npar {
+			mismatch = true
 		}
-		if len(partitions) != npar {
-			return 0, fmt.Errorf("Topic %s does not have %d partitions", topic, npar)
+	}
+	if mismatch {
+		counts := make([]string, len(topics))
+		for i, topic := range topics {
+			counts[i] = fmt.Sprintf("%s (%d partitions)", topic, partitions[i])
 		}
+		return 0, fmt.Errorf("Topics are not copartitioned: %s. "+
+			"All input streams and joined tables of a group must have the same number of partitions",
+			strings.Join(counts, ", "))
 	}
 	return npar, nil
 }
@@ -230,17 +315,102 @@ func (g *Processor) Get(key string) (interface{}, error) {
 	return value, nil
 }
 
+// IterateRange returns an iterator over the keys of the group table in the
+// range [from, to) that are stored in the partitions of the processor
+// instance. If to is empty, the iterator returns all keys with prefix from.
+// The keys of all partitions are returned in ascending order. Like Get,
+// IterateRange can be only used with stateful processors.
+func (g *Processor) IterateRange(from, to string) (Iterator, error) {
+	if g.isStateless() {
+		return nil, fmt.Errorf("can't iterate over stateless processor")
+	}
+
+	g.m.RLock()
+	defer g.m.RUnlock()
+
+	iters := make([]storage.Iterator, 0, len(g.partitions))
+	for _, p := range g.partitions {
+		iter, err := p.st.IteratorWithRange([]byte(from), []byte(to))
+		if err != nil {
+			// release already opened iterators
+			for i := range iters {
+				iters[i].Release()
+			}
+			return nil, fmt.Errorf("error opening partition iterator: %v", err)
+		}
+		iters = append(iters, iter)
+	}
+
+	return NewIterator(storage.NewMergeIterator(iters), g.graph.GroupTable().Codec()), nil
+}
+
+// VisitAll calls the Visitor callback registered with name for every key of the
+// group table stored in the partitions of the processor, passing meta as
+// message. Each partition visits all its keys at once in between processing
+// input messages, so a partition does not process input messages until all of
+// its keys are visited. VisitAll returns once all keys are visited, a callback
+// failed or ctx is done.
+func (g *Processor) VisitAll(ctx context.Context, name string, meta interface{}) error {
+	cb := g.graph.visitor(name)
+	if cb == nil {
+		return fmt.Errorf("visitor %s not defined", name)
+	}
+
+	// copy the partitions since a rebalance may change them while visiting
+	g.m.RLock()
+	partitions := make(map[int32]*partition, len(g.partitions))
+	for id, p := range g.partitions {
+		partitions[id] = p
+	}
+	g.m.RUnlock()
+
+	errg, ctx := multierr.NewErrGroup(ctx)
+	for id, p := range partitions {
+		id, p := id, p
+		errg.Go(func() error {
+			v := &visit{
+				fn: func(st storage.Storage, wg *sync.WaitGroup, pstats *PartitionStats) (int, error) {
+					return g.visitPartition(id, name, cb, meta, st, wg, pstats)
+				},
+				done: make(chan error, 1),
+			}
+			select {
+			case p.visits <- v:
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-g.ctx.Done():
+				return errors.New("processor stopped")
+			}
+			select {
+			case err := <-v.done:
+				if err != nil {
+					return fmt.Errorf("error visiting partition %d: %v", id, err)
+				}
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-g.ctx.Done():
+				return errors.New("processor stopped")
+			}
+		})
+	}
+	return errg.Wait().NilOrError()
+}
+
 func (g *Processor) find(key string) (storage.Storage, error) {
 	p, err := g.hash(key)
 	if err != nil {
 		return nil, err
 	}
 
-	if _, ok := g.partitions[p]; !ok {
+	g.m.RLock()
+	par, ok := g.partitions[p]
+	g.m.RUnlock()
+	if !ok {
 		return nil, fmt.Errorf("this processor does not contain partition %v", p)
 	}
 
-	return g.partitions[p].st, nil
+	return par.st, nil
 }
 
 func (g *Processor) hash(key string) (int32, error) {
@@ -330,11 +500,17 @@ func (g *Processor) Run(ctx context.Context) (rerr error) {
 	// subscribe for streams
 	topics := make(map[string]int64)
 	for _, e := range g.graph.InputStreams() {
-		topics[e.Topic()] = -1
+		topics[e.Topic()] = kafka.OffsetNewest
+		if offset, ok := g.opts.startOffsets[e.Topic()]; ok {
+			topics[e.Topic()] = offset
+		}
 	}
 	if lt := g.graph.LoopStream(); lt != nil {
 		topics[lt.Topic()] = -1
 	}
+	for _, e := range g.graph.RekeyStreams() {
+		topics[e.Topic()] = kafka.OffsetNewest
+	}
 	if err := g.consumer.Subscribe(topics); err != nil {
 		g.cancel()
 		_ = g.errors.Merge(errg.Wait())
@@ -364,8 +540,12 @@ func (g *Processor) pushToPartition(ctx context.Context, part int32, ev kafka.Ev
 	if !ok {
 		return fmt.Errorf("dropping message, no partition yet: %v", ev)
 	}
+	ch := p.ch
+	if msg, ok := ev.(*kafka.Message); ok && g.opts.priorityTopics[msg.Topic] {
+		ch = p.prio
+	}
 	select {
-	case p.ch <- ev:
+	case ch <- ev:
 	case <-ctx.Done():
 	}
 	return nil
@@ -502,8 +682,8 @@ func (g *Processor) fail(err error) {
 // partition management (rebalance)
 ///////////////////////////////////////////////////////////////////////////////
 
-func (g *Processor) newJoinStorage(topic string, id int32, update UpdateCallback) (*storageProxy, error) {
-	st, err := g.opts.builders.storage(topic, id)
+func (g *Processor) newJoinStorage(ctx context.Context, topic string, id int32, update UpdateCallback) (*storageProxy, error) {
+	st, err := g.opts.builders.storage(ctx, g.opts.log, topic, id)
 	if err != nil {
 		return nil, err
 	}
@@ -511,10 +691,12 @@ func (g *Processor) newJoinStorage(topic string, id int32, update UpdateCallback
 		Storage:   st,
 		partition: id,
 		update:    update,
+		batchSize: g.opts.recoveryBatchSize,
+		noSync:    g.opts.recoveryNoSync,
 	}, nil
 }
 
-func (g *Processor) newStorage(topic string, id int32, update UpdateCallback) (*storageProxy, error) {
+func (g *Processor) newStorage(ctx context.Context, topic string, id int32, update UpdateCallback) (*storageProxy, error) {
 	if g.isStateless() {
 		return &storageProxy{
 			Storage:   storage.NewMemory(),
@@ -523,7 +705,7 @@ func (g *Processor) newStorage(topic string, id int32, update UpdateCallback) (*
 		}, nil
 	}
 
-	st, err := g.opts.builders.storage(topic, id)
+	st, err := g.opts.builders.storage(ctx, g.opts.log, topic, id)
 	if err != nil {
 		return nil, err
 	}
@@ -531,6 +713,8 @@ func (g *Processor) newStorage(topic string, id int32, update UpdateCallback) (*
 		Storage:   st,
 		partition: id,
 		update:    update,
+		batchSize: g.opts.recoveryBatchSize,
+		noSync:    g.opts.recoveryNoSync,
 	}, nil
 }
 
@@ -546,7 +730,7 @@ func (g *Processor) createPartitionViews(errg *multierr.ErrGroup, ctx context.Co
 		if _, has := g.partitions[id]; has {
 			continue
 		}
-		st, err := g.newJoinStorage(t.Topic(), id, DefaultUpdate)
+		st, err := g.newJoinStorage(ctx, t.Topic(), id, defaultUpdate(g.opts.tombstonePolicy))
 		if err != nil {
 			return fmt.Errorf("processor: error creating storage: %v", err)
 		}
@@ -589,7 +773,7 @@ func (g *Processor) createPartition(errg *multierr.ErrGroup, ctx context.Context
 	if gt := g.graph.GroupTable(); gt != nil {
 		groupTable = gt.Topic()
 	}
-	st, err := g.newStorage(groupTable, id, g.opts.updateCallback)
+	st, err := g.newStorage(ctx, groupTable, id, g.opts.updateCallback)
 	if err != nil {
 		return fmt.Errorf("processor: error creating storage: %v", err)
 	}
@@ -605,13 +789,16 @@ func (g *Processor) createPartition(errg *multierr.ErrGroup, ctx context.Context
 		wait = append(wait, v.Recovered)
 	}
 
-	g.partitions[id] = newPartition(
+	par := newPartition(
 		g.opts.log,
 		groupTable,
 		g.process, st, &delayProxy{proxy: proxy{partition: id, consumer: g.consumer}, wait: wait},
 		g.opts.partitionChannelSize,
 	)
-	par := g.partitions[id]
+	g.m.Lock()
+	g.partitions[id] = par
+	g.m.Unlock()
+	par.warmStart = g.opts.warmStart
 	errg.Go(func() (err error) {
 		defer func() {
 			if rerr := recover(); rerr != nil {
@@ -666,7 +853,9 @@ func (g *Processor) removePartition(partition int32) *multierr.Errors {
 	if err := g.partitions[partition].st.Close(); err != nil {
 		_ = errs.Collect(fmt.Errorf("error closing storage partition %d: %v", partition, err))
 	}
+	g.m.Lock()
 	delete(g.partitions, partition)
+	g.m.Unlock()
 
 	// remove partition views
 	pv, has := g.partitionViews[partition]
@@ -679,7 +868,9 @@ func (g *Processor) removePartition(partition int32) *multierr.Errors {
 			_ = errs.Collect(fmt.Errorf("error closing storage %s/%d: %v", topic, partition, err))
 		}
 	}
+	g.m.Lock()
 	delete(g.partitionViews, partition)
+	g.m.Unlock()
 
 	return errs
 }
@@ -688,49 +879,30 @@ func (g *Processor) removePartition(partition int32) *multierr.Errors {
 // context builder
 ///////////////////////////////////////////////////////////////////////////////
 
-func (g *Processor) process(msg *message, st storage.Storage, wg *sync.WaitGroup, pstats *PartitionStats) (int, error) {
-	g.m.RLock()
-	views := g.partitionViews[msg.Partition]
-	g.m.RUnlock()
+// errProcessingAborted is returned by process if the processor stopped before
+// the message was processed. The message is neither committed nor counted.
+var errProcessingAborted = errors.New("processing aborted")
 
-	ctx := &cbContext{
-		ctx:   g.ctx,
-		graph: g.graph,
+func (g *Processor) process(msg *message, st storage.Storage, wg *sync.WaitGroup, pstats *PartitionStats) (int, error) {
+	if l := g.limiter(msg.Partition); l != nil && !l.wait(g.ctx) {
+		// processor is shutting down, message is not committed
+		return 0, errProcessingAborted
+	}
 
-		pstats: pstats,
-		pviews: views,
-		views:  g.views,
-		wg:     wg,
-		msg:    msg,
-		failer: func(err error) {
-			// only fail processor if context not already Done
-			select {
-			case <-g.ctx.Done():
-				return
-			default:
-			}
-			g.fail(err)
-		},
-		emitter: func(topic string, key string, value []byte) *kafka.Promise {
-			return g.producer.Emit(topic, key, value).Then(func(err error) {
-				if err != nil {
-					g.fail(err)
-				}
-			})
-		},
+	if msg.NilKey {
+		switch g.opts.nilKeyHandling {
+		case NilKeySkip:
+			// drop messages without key
+			return 0, nil
+		case NilKeyFail:
+			return 0, fmt.Errorf("message from %s/%d at offset %d has no key", msg.Topic, msg.Partition, msg.Offset)
+		}
 	}
+
+	ctx := g.newContext(msg, st, wg, pstats)
 	ctx.commit = func() {
-		// write group table offset to local storage
-		if ctx.counters.stores > 0 {
-			if offset, err := ctx.storage.GetOffset(0); err != nil {
-				ctx.failer(fmt.Errorf("error getting storage offset for %s/%d: %v",
-					g.graph.GroupTable().Topic(), msg.Partition, err))
-				return
-			} else if err = ctx.storage.SetOffset(offset + int64(ctx.counters.stores)); err != nil {
-				ctx.failer(fmt.Errorf("error writing storage offset for %s/%d: %v",
-					g.graph.GroupTable().Topic(), msg.Partition, err))
-				return
-			}
+		if !g.commitStores(ctx) {
+			return
 		}
 
 		// mark upstream offset
@@ -740,11 +912,6 @@ func (g *Processor) process(msg *message, st storage.Storage, wg *sync.WaitGroup
 		}
 	}
 
-	// use the storage if the processor is not stateless. Ignore otherwise
-	if !g.isStateless() {
-		ctx.storage = st
-	}
-
 	var (
 		m   interface{}
 		err error
@@ -777,6 +944,10 @@ func (g *Processor) process(msg *message, st storage.Storage, wg *sync.WaitGroup
 		return 0, fmt.Errorf("error processing message for key %s from %s/%d: %v", msg.Key, msg.Topic, msg.Partition, err)
 	}
 
+	if g.opts.orderedEmits {
+		ctx.acked = make(chan struct{})
+	}
+
 	// start context and call the ProcessorCallback cb
 	ctx.start()
 	// call finish(err) if a panic occurs in cb
@@ -787,13 +958,381 @@ func (g *Processor) process(msg *message, st storage.Storage, wg *sync.WaitGroup
 		}
 	}()
 	// now call cb
-	cb(ctx, m)
+	if err = g.invoke(cb, ctx, m); err != nil {
+		ctx.finish(err)
+		return 0, err
+	}
 	// if everything went fine, call finish(nil)
 	ctx.finish(nil)
 
+	if ctx.acked != nil {
+		// wait for all emits before processing the next message
+		select {
+		case <-ctx.acked:
+		case <-g.ctx.Done():
+		}
+	}
+
 	return ctx.counters.stores, nil
 }
 
+// newContext creates the context for a callback processing msg.
+func (g *Processor) newContext(msg *message, st storage.Storage, wg *sync.WaitGroup, pstats *PartitionStats) *cbContext {
+	g.m.RLock()
+	views := g.partitionViews[msg.Partition]
+	g.m.RUnlock()
+
+	ctx := &cbContext{
+		ctx:   g.ctx,
+		graph: g.graph,
+
+		pstats:     pstats,
+		pviews:     views,
+		views:      g.views,
+		wg:         wg,
+		msg:        msg,
+		tombstones: g.opts.tombstonePolicy,
+		failer: func(err error) {
+			// only fail processor if context not already Done
+			select {
+			case <-g.ctx.Done():
+				return
+			default:
+			}
+			g.fail(err)
+		},
+		reserve: g.acquireEmit,
+		release: g.releaseEmit,
+		emitter: func(topic string, key string, value []byte, headers kafka.Headers) *kafka.Promise {
+			var promise *kafka.Promise
+			if headers == nil {
+				promise = g.producer.Emit(topic, key, value)
+			} else {
+				promise = g.producer.EmitMessage(&kafka.ProducerMessage{Topic: topic, Key: key, Value: value, Headers: headers})
+			}
+			return promise.Then(func(err error) {
+				g.releaseEmit()
+				if err != nil {
+					g.fail(err)
+				}
+			})
+		},
+	}
+
+	// use the storage if the processor is not stateless. Ignore otherwise
+	if !g.isStateless() {
+		ctx.storage = st
+	}
+	return ctx
+}
+
+// visitPartition calls the visitor callback for every key in st and returns
+// the number of updates to st. It runs in the partition goroutine and blocks
+// the partition until all keys are visited, so that the callbacks see and
+// update the same state as the ProcessCallbacks.
+func (g *Processor) visitPartition(id int32, name string, cb ProcessCallback, meta interface{}, st storage.Storage, wg *sync.WaitGroup, pstats *PartitionStats) (int, error) {
+	it, err := st.Iterator()
+	if err != nil {
+		return 0, fmt.Errorf("error creating iterator: %v", err)
+	}
+	defer it.Release()
+
+	var updates int
+	for it.Next() {
+		msg := &message{
+			Key:       string(it.Key()),
+			Topic:     name,
+			Partition: id,
+			Offset:    -1,
+			Timestamp: time.Now(),
+		}
+		stores, err := g.visitKey(cb, meta, msg, st, wg, pstats)
+		updates += stores
+		if err != nil {
+			return updates, err
+		}
+	}
+	return updates, nil
+}
+
+func (g *Processor) visitKey(cb ProcessCallback, meta interface{}, msg *message, st storage.Storage, wg *sync.WaitGroup, pstats *PartitionStats) (int, error) {
+	ctx := g.newContext(msg, st, wg, pstats)
+	// visits are not consumed from Kafka, so only the storage offset is written
+	ctx.commit = func() { g.commitStores(ctx) }
+
+	ctx.start()
+	defer func() {
+		if r := recover(); r != nil {
+			ctx.finish(fmt.Errorf("panic: %v", r))
+			panic(r) // propagate panic up
+		}
+	}()
+	if err := g.invoke(cb, ctx, meta); err != nil {
+		ctx.finish(err)
+		return 0, err
+	}
+	ctx.finish(nil)
+	return ctx.counters.stores, nil
+}
+
+// commitStores writes the group table offset to the local storage if the
+// callback updated the table. It returns false if the processor failed.
+func (g *Processor) commitStores(ctx *cbContext) bool {
+	if ctx.counters.stores == 0 {
+		return true
+	}
+	if offset, err := ctx.storage.GetOffset(0); err != nil {
+		ctx.failer(fmt.Errorf("error getting storage offset for %s/%d: %v",
+			g.graph.GroupTable().Topic(), ctx.msg.Partition, err))
+		return false
+	} else if err = ctx.storage.SetOffset(offset + int64(ctx.counters.stores)); err != nil {
+		ctx.failer(fmt.Errorf("error writing storage offset for %s/%d: %v",
+			g.graph.GroupTable().Topic(), ctx.msg.Partition, err))
+		return false
+	}
+	return true
+}
+
+// acquireEmit reserves a slot in the producer queue for a message. If the
+// queue is full, it blocks or fails depending on the backpressure policy. It
+// returns the time it blocked, which is 0 if the queue was not full.
+func (g *Processor) acquireEmit() (time.Duration, error) {
+	if g.pending == nil {
+		return 0, nil
+	}
+	select {
+	case g.pending <- struct{}{}:
+		return 0, nil
+	default:
+	}
+	if g.opts.backpressure == BackpressureFail {
+		return 0, fmt.Errorf("producer queue is full (%d messages pending)", cap(g.pending))
+	}
+
+	start := time.Now()
+	select {
+	case g.pending <- struct{}{}:
+	case <-g.ctx.Done():
+		return 0, fmt.Errorf("processor stopped while waiting for producer queue")
+	}
+	return time.Since(start), nil
+}
+
+// releaseEmit frees the slot of a message acknowledged by the producer.
+func (g *Processor) releaseEmit() {
+	if g.pending != nil {
+		<-g.pending
+	}
+}
+
+// limiter returns the rate limiter for messages of partition or nil if the
+// processing rate is not limited.
+func (g *Processor) limiter(partition int32) *rateLimiter {
+	if g.opts.maxRate <= 0 {
+		return nil
+	}
+	if !g.opts.maxRatePerPartition {
+		// all partitions share the same limiter
+		partition = -1
+	}
+
+	g.lm.Lock()
+	defer g.lm.Unlock()
+	if g.limiters == nil {
+		g.limiters = make(map[int32]*rateLimiter)
+	}
+	l, ok := g.limiters[partition]
+	if !ok {
+		l = newRateLimiter(g.opts.maxRate)
+		g.limiters[partition] = l
+	}
+	return l
+}
+
+// invoke calls the callback and handles errors the callback failed with
+// according to their class: RetryableErrors cause the callback to be called
+// again, SkipMessageErrors are logged and the message is considered processed.
+// Any other error is propagated. The table updates and emits of the callback
+// are only applied if an attempt succeeds, those of failed attempts are
+// dropped.
+func (g *Processor) invoke(cb ProcessCallback, ctx *cbContext, m interface{}) error {
+	for attempt := 0; ; attempt++ {
+		ctx.resetAttempt()
+		failure, err := g.callClassified(cb, ctx, m)
+		if ferr := ctx.flushAttempt(failure == nil && err == nil); ferr != nil {
+			return ferr
+		}
+		switch failure := failure.(type) {
+		case nil:
+			return err
+		case *SkipMessageError:
+			g.opts.log.Printf("Processor: skipping message for key %s from %s/%d: %v",
+				ctx.msg.Key, ctx.msg.Topic, ctx.msg.Partition, failure.Err)
+			return nil
+		case *RetryableError:
+			if attempt >= g.opts.retries {
+				return fmt.Errorf("error processing message for key %s from %s/%d after %d retries: %v",
+					ctx.msg.Key, ctx.msg.Topic, ctx.msg.Partition, attempt, failure.Err)
+			}
+			g.opts.log.Printf("Processor: retrying message for key %s from %s/%d (attempt %d): %v",
+				ctx.msg.Key, ctx.msg.Topic, ctx.msg.Partition, attempt+1, failure.Err)
+			select {
+			case <-time.After(g.opts.retryBackoff):
+			case <-g.ctx.Done():
+				return fmt.Errorf("error processing message for key %s from %s/%d: %v",
+					ctx.msg.Key, ctx.msg.Topic, ctx.msg.Partition, failure.Err)
+			}
+		}
+	}
+}
+
+// callClassified calls the callback and recovers from panics caused by
+// Context.Fail with a RetryableError or a SkipMessageError, which may be
+// wrapped in other errors. Other panics and timeouts of the callback are
+// handled according to the panic policy, except for panics caused by
+// Context.Fail, which are propagated.
+func (g *Processor) callClassified(cb ProcessCallback, ctx *cbContext, m interface{}) (failure error, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			var stack []byte
+			if cp, ok := r.(*callbackPanic); ok {
+				r, stack = cp.value, cp.stack
+			}
+			switch f := classify(r); {
+			case f != nil:
+				failure = f
+			case ctx.hasFailed():
+				panic(r)
+			default:
+				if stack == nil {
+					stack = debug.Stack()
+				}
+				failure, err = g.handlePanic(ctx, &PanicError{
+					Topic:     ctx.msg.Topic,
+					Partition: ctx.msg.Partition,
+					Offset:    ctx.msg.Offset,
+					Key:       ctx.msg.Key,
+					Value:     r,
+					Stack:     stack,
+				})
+			}
+		}
+	}()
+	if err := g.call(cb, ctx, m); err != nil {
+		return g.handlePanic(ctx, err)
+	}
+	return nil, nil
+}
+
+// classify returns the RetryableError or SkipMessageError a callback failed
+// with, which may be wrapped in another error, or nil if the failure is fatal.
+func classify(r interface{}) error {
+	err, ok := r.(error)
+	if !ok {
+		return nil
+	}
+	var (
+		fatal *FatalError
+		retry *RetryableError
+		skip  *SkipMessageError
+	)
+	switch {
+	case errors.As(err, &fatal):
+		return nil
+	case errors.As(err, &retry):
+		return retry
+	case errors.As(err, &skip):
+		return skip
+	}
+	return nil
+}
+
+// handlePanic applies the panic policy to a panic or a timeout of a callback.
+func (g *Processor) handlePanic(ctx *cbContext, perr error) (failure error, err error) {
+	if pe, ok := perr.(*PanicError); ok {
+		g.opts.log.Printf("%v\nstack:%s", pe, pe.Stack)
+	}
+	switch g.opts.panicPolicy {
+	case PanicSkip:
+		return &SkipMessageError{Err: perr}, nil
+	case PanicRetry:
+		if _, ok := perr.(*TimeoutError); ok {
+			// the timed out callback may still be running
+			return nil, perr
+		}
+		return &RetryableError{Err: perr}, nil
+	case PanicDeadLetter:
+		ctx.deadLetter(string(g.opts.deadLetterTopic))
+		return &SkipMessageError{Err: perr}, nil
+	default:
+		return nil, perr
+	}
+}
+
+// callbackPanic carries a panic of a callback run in its own goroutine to the
+// partition goroutine, together with the stack of the panic.
+type callbackPanic struct {
+	value interface{}
+	stack []byte
+}
+
+// call invokes the callback. If a callback timeout is configured, the
+// callback is run with a context that is canceled on timeout and a
+// TimeoutError is returned if the callback did not return in time. The table
+// updates and emits of a timed out callback are dropped. The goroutine of the
+// callback is tracked in the wait group of the partition, so that the
+// partition does not close its storage before a timed out callback returned.
+func (g *Processor) call(cb ProcessCallback, ctx *cbContext, m interface{}) error {
+	if g.opts.callbackTimeout <= 0 {
+		cb(ctx, m)
+		return nil
+	}
+
+	cctx, cancel := context.WithTimeout(g.ctx, g.opts.callbackTimeout)
+	defer cancel()
+	ctx.ctx = cctx
+
+	var (
+		done = make(chan struct{})
+		perr *callbackPanic
+	)
+	ctx.wg.Add(1)
+	go func() {
+		defer ctx.wg.Done()
+		defer close(done)
+		defer func() {
+			if r := recover(); r != nil {
+				perr = &callbackPanic{value: r, stack: debug.Stack()}
+			}
+		}()
+		cb(ctx, m)
+	}()
+
+	select {
+	case <-done:
+	case <-cctx.Done():
+		if cctx.Err() != context.DeadlineExceeded {
+			// processor is shutting down, wait for the callback to return
+			<-done
+			break
+		}
+		ctx.abandon()
+		return &TimeoutError{
+			Topic:     ctx.msg.Topic,
+			Partition: ctx.msg.Partition,
+			Offset:    ctx.msg.Offset,
+			Key:       ctx.msg.Key,
+			Timeout:   g.opts.callbackTimeout,
+		}
+	}
+
+	// propagate panic to the partition goroutine
+	if perr != nil {
+		panic(perr)
+	}
+	return nil
+}
+
 // Recovered returns true when the processor has caught up with events from kafka.
 func (g *Processor) Recovered() bool {
 	for _, v := range g.views {
@@ -8,6 +8,7 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
 	"testing"
@@ -82,6 +83,12 @@ func createTopicManagerBuilder(tm kafka.TopicManager) kafka.TopicManagerBuilder
 	}
 }
 
+// checkingTopicManager is a topic manager that implements kafka.TopicChecker
+type checkingTopicManager struct {
+	*mock.MockTopicManager
+	*mock.MockTopicChecker
+}
+
 func createFailedTopicManagerBuilder(tm kafka.TopicManager) kafka.TopicManagerBuilder {
 	return func(b []string) (kafka.TopicManager, error) {
 		return nil, errors.New("failed creating topic manager")
@@ -249,6 +256,7 @@ func TestProcessor_process(t *testing.T) {
 
 		consumer: consumer,
 		producer: producer,
+		opts:     new(poptions),
 
 		ctx: context.Background(),
 	}
@@ -310,15 +318,750 @@ func TestProcessor_process(t *testing.T) {
 		ctx.SetValue("message")
 		ctx.SetValue("message2")
 	}
-	updates, err = p.process(msg, st, &wg, pstats)
+	updates, err = p.process(msg, st, &wg, pstats)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, updates, 2)
+	promise.Finish(nil)
+	promise2.Finish(nil)
+
+}
+
+func TestProcessor_processNilKey(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var (
+		wg       sync.WaitGroup
+		st       = mock.NewMockStorage(ctrl)
+		consumer = mock.NewMockConsumer(ctrl)
+		pstats   = newPartitionStats()
+		keys     []string
+	)
+
+	p := &Processor{
+		graph: DefineGroup(group,
+			Input("sometopic", rawCodec, func(ctx Context, msg interface{}) {
+				keys = append(keys, ctx.Key())
+			}),
+		),
+		consumer: consumer,
+		opts:     new(poptions),
+		ctx:      context.Background(),
+	}
+	msg := &message{Topic: "sometopic", Partition: 1, Offset: 123, Data: []byte("something"), NilKey: true}
+
+	// process with empty key by default
+	consumer.EXPECT().Commit("sometopic", int32(1), int64(123))
+	_, err := p.process(msg, st, &wg, pstats)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, keys, []string{""})
+
+	// skip
+	WithNilKeyHandling(NilKeySkip)(p.opts, p.graph)
+	_, err = p.process(msg, st, &wg, pstats)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, len(keys), 1)
+
+	// fail
+	WithNilKeyHandling(NilKeyFail)(p.opts, p.graph)
+	_, err = p.process(msg, st, &wg, pstats)
+	ensure.StringContains(t, err.Error(), "has no key")
+	ensure.DeepEqual(t, len(keys), 1)
+}
+
+func TestProcessor_processFail(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var (
+		wg       sync.WaitGroup
+		st       = mock.NewMockStorage(ctrl)
+		consumer = mock.NewMockConsumer(ctrl)
+		producer = mock.NewMockProducer(ctrl)
+		pstats   = newPartitionStats()
+	)
+	var canceled chan bool
+	newProcessor := func() *Processor {
+		canceled = make(chan bool)
+		p := &Processor{
+			graph: DefineGroup(group,
+				Persist(new(codec.String)),
+				Loop(c, cb),
+				Input("sometopic", rawCodec, cb),
+				Output("anothertopic", new(codec.String)),
+			),
+
+			consumer: consumer,
+			producer: producer,
+			opts:     new(poptions),
+
+			errors: new(multierr.Errors),
+			cancel: func() { close(canceled) },
+			ctx:    context.Background(),
+		}
+
+		p.opts.log = logger.Default()
+		return p
+	}
+	// fail get offset
+	p := newProcessor()
+	promise := new(kafka.Promise)
+	gomock.InOrder(
+		st.EXPECT().Set("key", []byte("message")),
+		producer.EXPECT().Emit(tableName(group), "key", []byte("message")).Return(promise),
+		st.EXPECT().GetOffset(int64(0)).Return(int64(321), errors.New("getOffset failed")),
+	)
+	msg := &message{Topic: "sometopic", Key: "key", Partition: 1, Offset: 123, Data: []byte("something")}
+	p.graph.callbacks["sometopic"] = func(ctx Context, msg interface{}) {
+		ctx.SetValue("message")
+	}
+	updates, err := p.process(msg, st, &wg, pstats)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, updates, 1)
+	promise.Finish(nil)
+	err = doTimed(t, func() {
+		<-canceled
+	})
+	ensure.Nil(t, err)
+
+	// fail set offset
+	promise = new(kafka.Promise)
+	p = newProcessor()
+	gomock.InOrder(
+		st.EXPECT().Set("key", []byte("message")),
+		producer.EXPECT().Emit(tableName(group), "key", []byte("message")).Return(promise),
+		st.EXPECT().GetOffset(int64(0)).Return(int64(321), nil),
+		st.EXPECT().SetOffset(int64(322)).Return(errors.New("setOffset failed")),
+	)
+	msg = &message{Topic: "sometopic", Key: "key", Partition: 1, Offset: 123, Data: []byte("something")}
+	p.graph.callbacks["sometopic"] = func(ctx Context, msg interface{}) {
+		ctx.SetValue("message")
+	}
+	updates, err = p.process(msg, st, &wg, pstats)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, updates, 1)
+	promise.Finish(nil)
+	err = doTimed(t, func() {
+		<-canceled
+	})
+	ensure.Nil(t, err)
+
+	// fail commit
+	promise = new(kafka.Promise)
+	p = newProcessor()
+	gomock.InOrder(
+		st.EXPECT().Set("key", []byte("message")),
+		producer.EXPECT().Emit(tableName(group), "key", []byte("message")).Return(promise),
+		st.EXPECT().GetOffset(int64(0)).Return(int64(321), nil),
+		st.EXPECT().SetOffset(int64(322)),
+		consumer.EXPECT().Commit("sometopic", int32(1), int64(123)).Return(errors.New("commit error")),
+	)
+	msg = &message{Topic: "sometopic", Key: "key", Partition: 1, Offset: 123, Data: []byte("something")}
+	p.graph.callbacks["sometopic"] = func(ctx Context, msg interface{}) {
+		ctx.SetValue("message")
+	}
+	updates, err = p.process(msg, st, &wg, pstats)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, updates, 1)
+	promise.Finish(nil)
+	err = doTimed(t, func() {
+		<-canceled
+	})
+	ensure.Nil(t, err)
+
+	// fail with panic (ctx.Fatal)
+	p = newProcessor()
+	// we dont add expect consumer.EXPECT().Commit() here, so if the context
+	// would call it, the test would fail
+	p.graph.callbacks["sometopic"] = func(ctx Context, msg interface{}) {
+		ctx.Fail(errSome)
+		t.Errorf("should never reach this point")
+		t.Fail()
+	}
+	go func() {
+		defer func() {
+			if x := recover(); x != nil {
+				ensure.StringContains(t, fmt.Sprintf("%v", x), errSome.Error())
+			}
+		}()
+		updates, err = p.process(msg, st, &wg, pstats)
+	}()
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, updates, 1)
+	err = doTimed(t, func() {
+		<-canceled
+	})
+	ensure.Nil(t, err)
+
+}
+
+func TestProcessor_processTimeout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var (
+		wg       sync.WaitGroup
+		st       = mock.NewMockStorage(ctrl)
+		consumer = mock.NewMockConsumer(ctrl)
+		producer = mock.NewMockProducer(ctrl)
+		pstats   = newPartitionStats()
+		canceled = make(chan bool)
+		block    = make(chan bool)
+	)
+	defer close(block)
+
+	p := &Processor{
+		graph: DefineGroup(group,
+			Input("sometopic", rawCodec, cb),
+		),
+
+		consumer: consumer,
+		producer: producer,
+		opts:     &poptions{log: logger.Default(), callbackTimeout: 10 * time.Millisecond},
+
+		errors: new(multierr.Errors),
+		cancel: func() { close(canceled) },
+		ctx:    context.Background(),
+	}
+
+	// callback returns in time
+	consumer.EXPECT().Commit("sometopic", int32(1), int64(123))
+	msg := &message{Topic: "sometopic", Key: "key", Partition: 1, Offset: 123, Data: []byte("something")}
+	updates, err := p.process(msg, st, &wg, pstats)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, updates, 0)
+
+	// callback hangs, no commit expected
+	ctxErr := make(chan error, 1)
+	p.graph.callbacks["sometopic"] = func(ctx Context, msg interface{}) {
+		<-ctx.Context().Done()
+		ctxErr <- ctx.Context().Err()
+		<-block
+	}
+	updates, err = p.process(msg, st, &wg, pstats)
+	ensure.NotNil(t, err)
+	ensure.StringContains(t, err.Error(), "exceeded timeout")
+	ensure.DeepEqual(t, updates, 0)
+	err = doTimed(t, func() {
+		<-canceled
+	})
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, <-ctxErr, context.DeadlineExceeded)
+}
+
+func TestProcessor_processTimeoutAbandoned(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var (
+		wg       sync.WaitGroup
+		st       = mock.NewMockStorage(ctrl)
+		consumer = mock.NewMockConsumer(ctrl)
+		producer = mock.NewMockProducer(ctrl)
+		pstats   = newPartitionStats()
+		resume   = make(chan bool)
+		late     = make(chan interface{}, 1)
+	)
+
+	p := &Processor{
+		graph: DefineGroup(group,
+			Input("sometopic", rawCodec, func(ctx Context, msg interface{}) {
+				defer func() { late <- recover() }()
+				<-resume
+				// must not reach the storage or producer
+				ctx.SetValue("late")
+			}),
+			Persist(rawCodec),
+		),
+
+		consumer: consumer,
+		producer: producer,
+		opts: &poptions{
+			log:             logger.Default(),
+			callbackTimeout: 10 * time.Millisecond,
+			panicPolicy:     PanicDeadLetter,
+			deadLetterTopic: "dead-letters",
+		},
+
+		errors: new(multierr.Errors),
+		cancel: func() {},
+		ctx:    context.Background(),
+	}
+	msg := &message{Topic: "sometopic", Key: "key", Partition: 1, Offset: 123, Data: []byte("something")}
+
+	// the timed out message is sent to the dead letter topic and committed
+	promise := new(kafka.Promise)
+	gomock.InOrder(
+		producer.EXPECT().Emit("dead-letters", "key", []byte("something")).Return(promise),
+		consumer.EXPECT().Commit("sometopic", int32(1), int64(123)),
+	)
+	updates, err := p.process(msg, st, &wg, pstats)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, updates, 0)
+	promise.Finish(nil)
+
+	// the table update of the abandoned callback is dropped
+	close(resume)
+	ensure.DeepEqual(t, <-late, errAbandoned)
+
+	// timed out callbacks are not retried
+	p.opts.panicPolicy = PanicRetry
+	p.graph.callbacks["sometopic"] = func(ctx Context, msg interface{}) {
+		<-ctx.Context().Done()
+	}
+	_, err = p.process(msg, st, &wg, pstats)
+	ensure.NotNil(t, err)
+	_, ok := err.(*TimeoutError)
+	ensure.True(t, ok)
+}
+
+func TestProcessor_processTimeoutBlockedEmit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var (
+		wg       sync.WaitGroup
+		st       = mock.NewMockStorage(ctrl)
+		consumer = mock.NewMockConsumer(ctrl)
+		producer = mock.NewMockProducer(ctrl)
+		pstats   = newPartitionStats()
+		done     = make(chan error, 1)
+	)
+
+	p := &Processor{
+		graph: DefineGroup(group,
+			Input("sometopic", rawCodec, func(ctx Context, msg interface{}) {
+				// the table update is buffered until the callback returns, so
+				// the full producer queue does not block the callback
+				ctx.SetValue([]byte("value"))
+			}),
+			Persist(rawCodec),
+		),
+
+		consumer: consumer,
+		producer: producer,
+		opts:     &poptions{log: logger.Default(), callbackTimeout: 10 * time.Millisecond},
+		pending:  make(chan struct{}, 1),
+
+		errors: new(multierr.Errors),
+		cancel: func() {},
+		ctx:    context.Background(),
+	}
+	p.pending <- struct{}{}
+	msg := &message{Topic: "sometopic", Key: "key", Partition: 1, Offset: 123, Data: []byte("something")}
+
+	go func() {
+		_, err := p.process(msg, st, &wg, pstats)
+		done <- err
+	}()
+
+	// the update waits for space in the queue without timing out the callback
+	select {
+	case err := <-done:
+		t.Fatalf("process returned before the queue had space: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	promise := new(kafka.Promise)
+	gomock.InOrder(
+		st.EXPECT().Set("key", []byte("value")),
+		producer.EXPECT().Emit(tableName(group), "key", []byte("value")).Return(promise),
+		st.EXPECT().GetOffset(int64(0)).Return(int64(321), nil),
+		st.EXPECT().SetOffset(int64(322)),
+		consumer.EXPECT().Commit("sometopic", int32(1), int64(123)),
+	)
+	<-p.pending
+	err := doTimed(t, func() {
+		ensure.Nil(t, <-done)
+	})
+	ensure.Nil(t, err)
+	promise.Finish(nil)
+	ensure.DeepEqual(t, pstats.Output[tableName(group)].Count, uint(1))
+}
+
+// panicInCallback panics to check that the stack of a PanicError points here.
+func panicInCallback() {
+	panic("boom")
+}
+
+func TestProcessor_processTimeoutPanicStack(t *testing.T) {
+	var (
+		wg     sync.WaitGroup
+		pstats = newPartitionStats()
+	)
+
+	p := &Processor{
+		graph: DefineGroup(group,
+			Input("sometopic", rawCodec, func(ctx Context, msg interface{}) {
+				panicInCallback()
+			}),
+		),
+		opts:   &poptions{log: logger.Default(), callbackTimeout: time.Second},
+		errors: new(multierr.Errors),
+		cancel: func() {},
+		ctx:    context.Background(),
+	}
+	msg := &message{Topic: "sometopic", Key: "key", Partition: 1, Offset: 123, Data: []byte("something")}
+
+	_, err := p.process(msg, nil, &wg, pstats)
+	ensure.NotNil(t, err)
+	perr, ok := err.(*PanicError)
+	ensure.True(t, ok)
+	ensure.DeepEqual(t, perr.Value, "boom")
+	ensure.StringContains(t, string(perr.Stack), "panicInCallback")
+}
+
+func TestProcessor_processClassifiedErrors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var (
+		wg       sync.WaitGroup
+		st       = mock.NewMockStorage(ctrl)
+		consumer = mock.NewMockConsumer(ctrl)
+		producer = mock.NewMockProducer(ctrl)
+		pstats   = newPartitionStats()
+		canceled = make(chan bool)
+	)
+
+	p := &Processor{
+		graph: DefineGroup(group,
+			Input("sometopic", rawCodec, cb),
+		),
+
+		consumer: consumer,
+		producer: producer,
+		opts:     &poptions{log: logger.Default(), retries: 2},
+
+		errors: new(multierr.Errors),
+		cancel: func() { close(canceled) },
+		ctx:    context.Background(),
+	}
+	msg := &message{Topic: "sometopic", Key: "key", Partition: 1, Offset: 123, Data: []byte("something")}
+
+	// skipped message is committed
+	consumer.EXPECT().Commit("sometopic", int32(1), int64(123))
+	p.graph.callbacks["sometopic"] = func(ctx Context, msg interface{}) {
+		ctx.Fail(&SkipMessageError{Err: errSome})
+	}
+	updates, err := p.process(msg, st, &wg, pstats)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, updates, 0)
+
+	// retry succeeds on the second attempt
+	var calls int
+	consumer.EXPECT().Commit("sometopic", int32(1), int64(123))
+	p.graph.callbacks["sometopic"] = func(ctx Context, msg interface{}) {
+		calls++
+		if calls == 1 {
+			ctx.Fail(&RetryableError{Err: errSome})
+		}
+	}
+	updates, err = p.process(msg, st, &wg, pstats)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, updates, 0)
+	ensure.DeepEqual(t, calls, 2)
+
+	// wrapped errors are classified
+	calls = 0
+	consumer.EXPECT().Commit("sometopic", int32(1), int64(123)).Times(2)
+	p.graph.callbacks["sometopic"] = func(ctx Context, msg interface{}) {
+		calls++
+		if calls == 1 {
+			ctx.Fail(fmt.Errorf("first attempt: %w", &RetryableError{Err: errSome}))
+		}
+		ctx.Fail(fmt.Errorf("second attempt: %w", &SkipMessageError{Err: errSome}))
+	}
+	_, err = p.process(msg, st, &wg, pstats)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, calls, 2)
+
+	// a failed attempt does not turn panics of the next attempt into failures
+	calls = 0
+	p.opts.panicPolicy = PanicSkip
+	p.graph.callbacks["sometopic"] = func(ctx Context, msg interface{}) {
+		calls++
+		if calls == 1 {
+			ctx.Fail(&RetryableError{Err: errSome})
+		}
+		panic("boom")
+	}
+	_, err = p.process(msg, st, &wg, pstats)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, calls, 2)
+	p.opts.panicPolicy = PanicFail
+
+	// retries exhausted, no commit
+	calls = 0
+	p.graph.callbacks["sometopic"] = func(ctx Context, msg interface{}) {
+		calls++
+		ctx.Fail(&RetryableError{Err: errSome})
+	}
+	updates, err = p.process(msg, st, &wg, pstats)
+	ensure.NotNil(t, err)
+	ensure.StringContains(t, err.Error(), errSome.Error())
+	ensure.DeepEqual(t, calls, 3)
+	err = doTimed(t, func() {
+		<-canceled
+	})
+	ensure.Nil(t, err)
+}
+
+func TestProcessor_processRetriedEmits(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var (
+		wg       sync.WaitGroup
+		consumer = mock.NewMockConsumer(ctrl)
+		producer = mock.NewMockProducer(ctrl)
+		pstats   = newPartitionStats()
+		calls    int
+	)
+
+	p := &Processor{
+		graph: DefineGroup(group,
+			Input("sometopic", rawCodec, func(ctx Context, msg interface{}) {
+				calls++
+				ctx.Emit("othertopic", "key", []byte(fmt.Sprintf("attempt-%d", calls)))
+				if calls == 1 {
+					ctx.Fail(&RetryableError{Err: errSome})
+				}
+			}),
+			Output("othertopic", rawCodec),
+		),
+
+		consumer: consumer,
+		producer: producer,
+		opts:     &poptions{log: logger.Default(), retries: 2},
+
+		errors: new(multierr.Errors),
+		cancel: func() {},
+		ctx:    context.Background(),
+	}
+	msg := &message{Topic: "sometopic", Key: "key", Partition: 1, Offset: 123, Data: []byte("something")}
+
+	// only the emit of the successful attempt is sent
+	gomock.InOrder(
+		producer.EXPECT().Emit("othertopic", "key", []byte("attempt-2")).Return(kafka.NewPromise().Finish(nil)),
+		consumer.EXPECT().Commit("sometopic", int32(1), int64(123)),
+	)
+	_, err := p.process(msg, nil, &wg, pstats)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, calls, 2)
+
+	// the emits of skipped messages are dropped
+	p.graph.callbacks["sometopic"] = func(ctx Context, msg interface{}) {
+		ctx.Emit("othertopic", "key", []byte("skipped"))
+		ctx.Fail(&SkipMessageError{Err: errSome})
+	}
+	consumer.EXPECT().Commit("sometopic", int32(1), int64(123))
+	_, err = p.process(msg, nil, &wg, pstats)
+	ensure.Nil(t, err)
+}
+
+func TestProcessor_processRetriedTableUpdates(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var (
+		wg       sync.WaitGroup
+		st       = storage.NewMemory()
+		consumer = mock.NewMockConsumer(ctrl)
+		producer = mock.NewMockProducer(ctrl)
+		pstats   = newPartitionStats()
+		calls    int
+	)
+
+	p := &Processor{
+		graph: DefineGroup(group,
+			Input("sometopic", rawCodec, func(ctx Context, msg interface{}) {
+				calls++
+				var counter int64
+				if v := ctx.Value(); v != nil {
+					counter = v.(int64)
+				}
+				ctx.SetValue(counter + 1)
+				// the attempt reads its own table updates
+				ensure.DeepEqual(t, ctx.Value(), counter+1)
+				ctx.Emit("othertopic", "key", []byte(fmt.Sprintf("attempt-%d", calls)))
+				if calls == 1 {
+					ctx.Fail(&RetryableError{Err: errSome})
+				}
+			}),
+			Output("othertopic", rawCodec),
+			Persist(new(codec.Int64)),
+		),
+
+		consumer: consumer,
+		producer: producer,
+		opts:     &poptions{log: logger.Default(), retries: 2},
+
+		errors: new(multierr.Errors),
+		cancel: func() {},
+		ctx:    context.Background(),
+	}
+	ensure.Nil(t, st.Set("key", []byte("1")))
+	msg := &message{Topic: "sometopic", Key: "key", Partition: 1, Offset: 123, Data: []byte("something")}
+
+	// the value is incremented once and the table update is sent before the
+	// emit of the successful attempt
+	gomock.InOrder(
+		producer.EXPECT().Emit(tableName(group), "key", []byte("2")).Return(kafka.NewPromise().Finish(nil)),
+		producer.EXPECT().Emit("othertopic", "key", []byte("attempt-2")).Return(kafka.NewPromise().Finish(nil)),
+		consumer.EXPECT().Commit("sometopic", int32(1), int64(123)),
+	)
+	updates, err := p.process(msg, st, &wg, pstats)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, updates, 1)
+	ensure.DeepEqual(t, calls, 2)
+	value, err := st.Get("key")
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, value, []byte("2"))
+
+	// the table updates of skipped messages are dropped
+	p.graph.callbacks["sometopic"] = func(ctx Context, msg interface{}) {
+		ctx.Delete()
+		ctx.Fail(&SkipMessageError{Err: errSome})
+	}
+	consumer.EXPECT().Commit("sometopic", int32(1), int64(123))
+	updates, err = p.process(msg, st, &wg, pstats)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, updates, 0)
+	value, err = st.Get("key")
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, value, []byte("2"))
+}
+
+func TestProcessor_processPanicPolicy(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var (
+		wg       sync.WaitGroup
+		st       = mock.NewMockStorage(ctrl)
+		consumer = mock.NewMockConsumer(ctrl)
+		producer = mock.NewMockProducer(ctrl)
+		pstats   = newPartitionStats()
+		calls    int
+	)
+
+	p := &Processor{
+		graph: DefineGroup(group,
+			Input("sometopic", rawCodec, func(ctx Context, msg interface{}) {
+				calls++
+				if calls == 1 {
+					panic("boom")
+				}
+			}),
+		),
+
+		consumer: consumer,
+		producer: producer,
+		opts:     &poptions{log: logger.Default(), retries: 2},
+
+		errors: new(multierr.Errors),
+		cancel: func() {},
+		ctx:    context.Background(),
+	}
+	msg := &message{Topic: "sometopic", Key: "key", Partition: 1, Offset: 123, Data: []byte("something")}
+
+	// by default the panic fails the processor with the message's context
+	_, err := p.process(msg, st, &wg, pstats)
+	ensure.NotNil(t, err)
+	ensure.StringContains(t, err.Error(), "panic processing message for key key from sometopic/1 at offset 123: boom")
+	ensure.False(t, strings.Contains(err.Error(), "stack:"))
+	var perr *PanicError
+	ensure.True(t, errors.As(err, &perr))
+	ensure.True(t, len(perr.Stack) > 0)
+
+	// skip commits the message
+	calls = 0
+	WithPanicPolicy(PanicSkip)(p.opts, p.graph)
+	consumer.EXPECT().Commit("sometopic", int32(1), int64(123))
+	_, err = p.process(msg, st, &wg, pstats)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, calls, 1)
+
+	// retry calls the callback again
+	calls = 0
+	WithPanicPolicy(PanicRetry)(p.opts, p.graph)
+	consumer.EXPECT().Commit("sometopic", int32(1), int64(123))
+	_, err = p.process(msg, st, &wg, pstats)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, calls, 2)
+
+	// dead letter emits the message before committing it
+	calls = 0
+	WithPanicPolicy(PanicDeadLetter)(p.opts, p.graph)
+	WithDeadLetterTopic("dead-letters")(p.opts, p.graph)
+	promise := new(kafka.Promise)
+	gomock.InOrder(
+		producer.EXPECT().Emit("dead-letters", "key", []byte("something")).Return(promise),
+		consumer.EXPECT().Commit("sometopic", int32(1), int64(123)),
+	)
+	_, err = p.process(msg, st, &wg, pstats)
+	ensure.Nil(t, err)
+	promise.Finish(nil)
+
+	// dead letters keep the headers of the message
+	calls = 0
+	headers := kafka.Headers{"trace-id": []byte("42")}
+	hmsg := &message{Topic: "sometopic", Key: "key", Partition: 1, Offset: 123, Data: []byte("something"), Headers: headers}
+	gomock.InOrder(
+		producer.EXPECT().EmitMessage(&kafka.ProducerMessage{
+			Topic:   "dead-letters",
+			Key:     "key",
+			Value:   []byte("something"),
+			Headers: headers,
+		}).Return(kafka.NewPromise().Finish(nil)),
+		consumer.EXPECT().Commit("sometopic", int32(1), int64(123)),
+	)
+	_, err = p.process(hmsg, st, &wg, pstats)
+	ensure.Nil(t, err)
+
+	// dead letter policy requires a topic
+	err = new(poptions).applyOptions(p.graph,
+		WithStorageBuilder(storage.MemoryBuilder()),
+		WithPanicPolicy(PanicDeadLetter),
+	)
+	ensure.StringContains(t, err.Error(), "requires a dead letter topic")
+
+	// processors fail by default
+	opts := new(poptions)
+	ensure.Nil(t, opts.applyOptions(p.graph, WithStorageBuilder(storage.MemoryBuilder())))
+	ensure.DeepEqual(t, opts.panicPolicy, PanicFail)
+}
+
+func TestProcessor_deadLetterTopic(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tm := mock.NewMockTopicManager(ctrl)
+	graph := DefineGroup(group, Input(topic, rawCodec, cb))
+	opts := []ProcessorOption{
+		WithTopicManagerBuilder(createTopicManagerBuilder(tm)),
+		WithPanicPolicy(PanicDeadLetter),
+		WithDeadLetterTopic("dead-letters"),
+	}
+
+	// the dead letter topic is created at startup
+	tm.EXPECT().Partitions(topic).Return([]int32{0, 1}, nil)
+	tm.EXPECT().EnsureStreamExists("dead-letters", 2).Return(nil)
+	tm.EXPECT().Close().Return(nil)
+	_, err := NewProcessor(nil, graph, opts...)
 	ensure.Nil(t, err)
-	ensure.DeepEqual(t, updates, 2)
-	promise.Finish(nil)
-	promise2.Finish(nil)
 
+	// failing to create it fails the processor
+	tm.EXPECT().Partitions(topic).Return([]int32{0, 1}, nil)
+	tm.EXPECT().EnsureStreamExists("dead-letters", 2).Return(errors.New("some error"))
+	tm.EXPECT().Close().Return(nil)
+	_, err = NewProcessor(nil, graph, opts...)
+	ensure.NotNil(t, err)
+	ensure.StringContains(t, err.Error(), "error ensuring dead letter topic: some error")
 }
 
-func TestProcessor_processFail(t *testing.T) {
+func TestProcessor_processOrderedEmits(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
@@ -328,120 +1071,215 @@ func TestProcessor_processFail(t *testing.T) {
 		consumer = mock.NewMockConsumer(ctrl)
 		producer = mock.NewMockProducer(ctrl)
 		pstats   = newPartitionStats()
+		promise  = new(kafka.Promise)
+		done     = make(chan bool)
 	)
-	var canceled chan bool
-	newProcessor := func() *Processor {
-		canceled = make(chan bool)
-		p := &Processor{
-			graph: DefineGroup(group,
-				Persist(new(codec.String)),
-				Loop(c, cb),
-				Input("sometopic", rawCodec, cb),
-				Output("anothertopic", new(codec.String)),
-			),
-
-			consumer: consumer,
-			producer: producer,
-			opts:     new(poptions),
-
-			errors: new(multierr.Errors),
-			cancel: func() { close(canceled) },
-			ctx:    context.Background(),
-		}
 
-		p.opts.log = logger.Default()
-		return p
+	p := &Processor{
+		graph: DefineGroup(group,
+			Input("sometopic", rawCodec, func(ctx Context, msg interface{}) {
+				ctx.Emit("anothertopic", "key", "message")
+			}),
+			Output("anothertopic", new(codec.String)),
+		),
+		consumer: consumer,
+		producer: producer,
+		opts:     new(poptions),
+		ctx:      context.Background(),
 	}
-	// fail get offset
-	p := newProcessor()
-	promise := new(kafka.Promise)
+	WithOrderedEmits()(p.opts, p.graph)
+
 	gomock.InOrder(
-		st.EXPECT().Set("key", []byte("message")),
-		producer.EXPECT().Emit(tableName(group), "key", []byte("message")).Return(promise),
-		st.EXPECT().GetOffset(int64(0)).Return(int64(321), errors.New("getOffset failed")),
+		producer.EXPECT().Emit("anothertopic", "key", []byte("message")).Return(promise),
+		consumer.EXPECT().Commit("sometopic", int32(1), int64(123)),
 	)
-	msg := &message{Topic: "sometopic", Key: "key", Partition: 1, Offset: 123, Data: []byte("something")}
-	p.graph.callbacks["sometopic"] = func(ctx Context, msg interface{}) {
-		ctx.SetValue("message")
+	msg := &message{Topic: "sometopic", Partition: 1, Offset: 123, Data: []byte("something")}
+	go func() {
+		_, err := p.process(msg, st, &wg, pstats)
+		ensure.Nil(t, err)
+		close(done)
+	}()
+
+	// process waits for the emit to be acknowledged
+	select {
+	case <-done:
+		t.Fatalf("process returned before emit was acknowledged")
+	case <-time.After(50 * time.Millisecond):
 	}
-	updates, err := p.process(msg, st, &wg, pstats)
-	ensure.Nil(t, err)
-	ensure.DeepEqual(t, updates, 1)
 	promise.Finish(nil)
-	err = doTimed(t, func() {
-		<-canceled
-	})
+	err := doTimed(t, func() { <-done })
 	ensure.Nil(t, err)
+}
 
-	// fail set offset
-	promise = new(kafka.Promise)
-	p = newProcessor()
-	gomock.InOrder(
-		st.EXPECT().Set("key", []byte("message")),
-		producer.EXPECT().Emit(tableName(group), "key", []byte("message")).Return(promise),
-		st.EXPECT().GetOffset(int64(0)).Return(int64(321), nil),
-		st.EXPECT().SetOffset(int64(322)).Return(errors.New("setOffset failed")),
-	)
-	msg = &message{Topic: "sometopic", Key: "key", Partition: 1, Offset: 123, Data: []byte("something")}
-	p.graph.callbacks["sometopic"] = func(ctx Context, msg interface{}) {
-		ctx.SetValue("message")
+func TestProcessor_producerBackpressure(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := &Processor{
+		opts:    new(poptions),
+		ctx:     ctx,
+		pending: make(chan struct{}, 1),
 	}
-	updates, err = p.process(msg, st, &wg, pstats)
+
+	// block until the pending message is acknowledged
+	blocked, err := p.acquireEmit()
 	ensure.Nil(t, err)
-	ensure.DeepEqual(t, updates, 1)
-	promise.Finish(nil)
-	err = doTimed(t, func() {
-		<-canceled
-	})
+	ensure.DeepEqual(t, blocked, time.Duration(0))
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		p.releaseEmit()
+	}()
+	blocked, err = p.acquireEmit()
+	ensure.Nil(t, err)
+	ensure.True(t, blocked > 0)
+
+	// fail if queue is full
+	WithProducerBackpressure(1, BackpressureFail)(p.opts, nil)
+	_, err = p.acquireEmit()
+	ensure.StringContains(t, err.Error(), "producer queue is full")
+	p.releaseEmit()
+	_, err = p.acquireEmit()
 	ensure.Nil(t, err)
+}
 
-	// fail commit
-	promise = new(kafka.Promise)
-	p = newProcessor()
-	gomock.InOrder(
-		st.EXPECT().Set("key", []byte("message")),
-		producer.EXPECT().Emit(tableName(group), "key", []byte("message")).Return(promise),
-		st.EXPECT().GetOffset(int64(0)).Return(int64(321), nil),
-		st.EXPECT().SetOffset(int64(322)),
-		consumer.EXPECT().Commit("sometopic", int32(1), int64(123)).Return(errors.New("commit error")),
+func TestProcessor_producerBackpressureStats(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var (
+		wg       sync.WaitGroup
+		consumer = mock.NewMockConsumer(ctrl)
+		producer = mock.NewMockProducer(ctrl)
+		pstats   = newPartitionStats()
 	)
-	msg = &message{Topic: "sometopic", Key: "key", Partition: 1, Offset: 123, Data: []byte("something")}
-	p.graph.callbacks["sometopic"] = func(ctx Context, msg interface{}) {
-		ctx.SetValue("message")
-	}
-	updates, err = p.process(msg, st, &wg, pstats)
-	ensure.Nil(t, err)
-	ensure.DeepEqual(t, updates, 1)
-	promise.Finish(nil)
-	err = doTimed(t, func() {
-		<-canceled
-	})
-	ensure.Nil(t, err)
 
-	// fail with panic (ctx.Fatal)
-	p = newProcessor()
-	// we dont add expect consumer.EXPECT().Commit() here, so if the context
-	// would call it, the test would fail
-	p.graph.callbacks["sometopic"] = func(ctx Context, msg interface{}) {
-		ctx.Fail(errSome)
-		t.Errorf("should never reach this point")
-		t.Fail()
+	p := &Processor{
+		graph: DefineGroup(group,
+			Input("sometopic", rawCodec, func(ctx Context, msg interface{}) {
+				ctx.Emit("othertopic", "key", []byte("value"))
+			}),
+			Output("othertopic", rawCodec),
+		),
+
+		consumer: consumer,
+		producer: producer,
+		opts:     &poptions{log: logger.Default(), callbackTimeout: time.Second},
+		pending:  make(chan struct{}, 1),
+
+		errors: new(multierr.Errors),
+		cancel: func() {},
+		ctx:    context.Background(),
 	}
+	msg := &message{Topic: "sometopic", Key: "key", Partition: 1, Offset: 123, Data: []byte("something")}
+
+	// the emit blocks until the pending message is acknowledged
+	p.pending <- struct{}{}
 	go func() {
-		defer func() {
-			if x := recover(); x != nil {
-				ensure.StringContains(t, fmt.Sprintf("%v", x), errSome.Error())
-			}
-		}()
-		updates, err = p.process(msg, st, &wg, pstats)
+		time.Sleep(10 * time.Millisecond)
+		p.releaseEmit()
 	}()
+	gomock.InOrder(
+		producer.EXPECT().Emit("othertopic", "key", []byte("value")).Return(kafka.NewPromise().Finish(nil)),
+		consumer.EXPECT().Commit("sometopic", int32(1), int64(123)),
+	)
+	_, err := p.process(msg, nil, &wg, pstats)
 	ensure.Nil(t, err)
-	ensure.DeepEqual(t, updates, 1)
-	err = doTimed(t, func() {
-		<-canceled
+	ensure.DeepEqual(t, pstats.Output["othertopic"].Blocked, uint(1))
+	ensure.True(t, pstats.Output["othertopic"].BlockedTime > 0)
+}
+
+func TestNewProcessor_topicCheck(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var (
+		tm  = mock.NewMockTopicManager(ctrl)
+		tc  = mock.NewMockTopicChecker(ctrl)
+		ctm = &checkingTopicManager{tm, tc}
+	)
+
+	// topics conflict with the graph
+	tm.EXPECT().Partitions(topic).Return([]int32{0, 1}, nil)
+	tm.EXPECT().EnsureStreamExists(loopName(group), 2).Return(nil)
+	tm.EXPECT().EnsureTableExists(tableName(group), 2).Return(nil)
+	tc.EXPECT().CheckStream(topic, 2).Return(nil)
+	tc.EXPECT().CheckStream(loopName(group), 2).Return(nil)
+	tc.EXPECT().CheckTable(tableName(group), 2).Return(&kafka.TopicConfigError{
+		Topic:      tableName(group),
+		Mismatches: []kafka.TopicMismatch{{Setting: "cleanup.policy", Expected: "compact", Actual: "delete"}},
 	})
-	ensure.Nil(t, err)
+	tm.EXPECT().Close().Return(nil)
+	_, err := NewProcessor(nil,
+		DefineGroup(group,
+			Input(topic, rawCodec, cb),
+			Loop(rawCodec, cb),
+			Persist(rawCodec),
+		),
+		WithTopicManagerBuilder(createTopicManagerBuilder(ctm)),
+		WithStorageBuilder(storage.MemoryBuilder()),
+		WithTopicCheck(),
+	)
+	ensure.NotNil(t, err)
+	ensure.StringContains(t, err.Error(), "cleanup.policy is delete instead of compact")
+
+	// topic manager cannot check topics
+	tm.EXPECT().Partitions(topic).Return([]int32{0, 1}, nil)
+	tm.EXPECT().EnsureTableExists(tableName(group), 2).Return(nil)
+	tm.EXPECT().Close().Return(nil)
+	_, err = NewProcessor(nil,
+		DefineGroup(group,
+			Input(topic, rawCodec, cb),
+			Persist(rawCodec),
+		),
+		WithTopicManagerBuilder(createTopicManagerBuilder(tm)),
+		WithStorageBuilder(storage.MemoryBuilder()),
+		WithTopicCheck(),
+	)
+	ensure.NotNil(t, err)
+	ensure.StringContains(t, err.Error(), "cannot check topics")
+
+	// input streams, joined and lookup tables are checked too
+	tm.EXPECT().Partitions(topic).Return([]int32{0, 1}, nil)
+	tm.EXPECT().Partitions("joined").Return([]int32{0, 1}, nil)
+	tm.EXPECT().EnsureTableExists(tableName(group), 2).Return(nil)
+	tc.EXPECT().CheckStream(topic, 2).Return(nil)
+	tc.EXPECT().CheckTable("joined", 2).Return(nil)
+	tc.EXPECT().CheckTable(tableName(group), 2).Return(nil)
+	tm.EXPECT().Partitions("lookup").Return([]int32{0, 1, 2}, nil)
+	tc.EXPECT().CheckTable("lookup", 3).Return(&kafka.TopicConfigError{
+		Topic:      "lookup",
+		Mismatches: []kafka.TopicMismatch{{Setting: "cleanup.policy", Expected: "compact", Actual: "delete"}},
+	})
+	tm.EXPECT().Close().Return(nil)
+	_, err = NewProcessor(nil,
+		DefineGroup(group,
+			Input(topic, rawCodec, cb),
+			Join("joined", rawCodec),
+			Lookup("lookup", rawCodec),
+			Persist(rawCodec),
+		),
+		WithTopicManagerBuilder(createTopicManagerBuilder(ctm)),
+		WithStorageBuilder(storage.MemoryBuilder()),
+		WithTopicCheck(),
+	)
+	ensure.NotNil(t, err)
+	ensure.StringContains(t, err.Error(), "topic lookup conflicts")
 
+	// topics match the graph
+	tm.EXPECT().Partitions(topic).Return([]int32{0, 1}, nil)
+	tm.EXPECT().EnsureTableExists(tableName(group), 2).Return(nil)
+	tc.EXPECT().CheckStream(topic, 2).Return(nil)
+	tc.EXPECT().CheckTable(tableName(group), 2).Return(nil)
+	tm.EXPECT().Close().Return(nil)
+	_, err = NewProcessor(nil,
+		DefineGroup(group,
+			Input(topic, rawCodec, cb),
+			Persist(rawCodec),
+		),
+		WithTopicManagerBuilder(createTopicManagerBuilder(ctm)),
+		WithStorageBuilder(storage.MemoryBuilder()),
+		WithTopicCheck(),
+	)
+	ensure.Nil(t, err)
 }
 
 func TestNewProcessor(t *testing.T) {
@@ -516,6 +1354,9 @@ func TestNewProcessor(t *testing.T) {
 		WithTopicManagerBuilder(createTopicManagerBuilder(tm)),
 	)
 	ensure.NotNil(t, err)
+	ensure.StringContains(t, err.Error(), "not copartitioned")
+	ensure.StringContains(t, err.Error(), fmt.Sprintf("%s (2 partitions)", topic))
+	ensure.StringContains(t, err.Error(), fmt.Sprintf("%s (3 partitions)", topic2))
 
 	// error ensuring streams
 	tm.EXPECT().Partitions(topic).Return([]int32{0, 1}, nil)
@@ -731,6 +1572,43 @@ func TestProcessor_StartStopEmpty(t *testing.T) {
 	ensure.Nil(t, err)
 }
 
+func TestProcessor_StartAtOffset(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var (
+		consumer = mock.NewMockConsumer(ctrl)
+		wait     = make(chan bool)
+		final    = make(chan bool)
+		ch       = make(chan kafka.Event)
+		p        = createProcessor(t, ctrl, consumer, 2, nullStorageBuilder())
+		start    = time.Unix(1500000000, 0)
+	)
+	WithStartAtOffset(topic, 10)(p.opts, p.graph)
+	WithStartAtTime(topic2, start)(p.opts, p.graph)
+
+	consumer.EXPECT().Subscribe(map[string]int64{
+		topic:           10,
+		topic2:          kafka.OffsetTime(start),
+		loopName(group): -1,
+	}).Return(nil)
+	consumer.EXPECT().Events().Return(ch).Do(func() { close(wait) })
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		err := p.Run(ctx)
+		ensure.Nil(t, err)
+		close(final)
+	}()
+
+	consumer.EXPECT().Close().Return(nil).Do(func() { close(ch) })
+	err := doTimed(t, func() {
+		<-wait
+		cancel()
+		<-final
+	})
+	ensure.Nil(t, err)
+}
+
 func TestProcessor_StartStopEmptyError(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -1150,7 +2028,7 @@ func TestProcessor_StartStateless(t *testing.T) {
 	// 2. rebalance
 	ensure.True(t, len(p.partitions) == 0)
 	ch <- (*kafka.Assignment)(&map[int32]int64{0: -1, 1: -1})
-	err := syncWith(t, ch, -1, 1, 2)
+	err := syncWith(t, ch, -1, 0, 1)
 	ensure.Nil(t, err)
 	ensure.True(t, len(p.partitions) == 2)
 
@@ -1328,12 +2206,12 @@ func TestProcessor_rebalanceError(t *testing.T) {
 	ensure.True(t, len(p.partitions) == 0)
 	ch <- (*kafka.Assignment)(&map[int32]int64{0: -1})
 
-	// stop processor
+	// processor stops because the storage cannot be created
 	err := doTimed(t, func() {
-		cancel()
 		<-wait
 	})
 	ensure.Nil(t, err)
+	cancel()
 }
 
 func TestProcessor_HasGet(t *testing.T) {
@@ -1440,6 +2318,45 @@ func TestProcessor_HasGetStateless(t *testing.T) {
 	ensure.True(t, value == nil)
 }
 
+func TestProcessor_IterateRange(t *testing.T) {
+	p := &Processor{graph: DefineGroup(group, Input("input", rawCodec, nil))}
+	_, err := p.IterateRange("a", "b")
+	ensure.StringContains(t, err.Error(), "stateless")
+
+	st0 := storage.NewMemory()
+	st1 := storage.NewMemory()
+	ensure.Nil(t, st0.Set("key-1", []byte("value-1")))
+	ensure.Nil(t, st0.Set("other", []byte("other")))
+	ensure.Nil(t, st1.Set("key-0", []byte("value-0")))
+	ensure.Nil(t, st1.Set("key-2", []byte("value-2")))
+
+	p = &Processor{graph: DefineGroup(group, Persist(new(codec.String)))}
+	p.partitions = map[int32]*partition{
+		0: {st: &storageProxy{Storage: st0, partition: 0}},
+		1: {st: &storageProxy{Storage: st1, partition: 1}},
+	}
+
+	iter, err := p.IterateRange("key-", "")
+	ensure.Nil(t, err)
+	var values []interface{}
+	for iter.Next() {
+		value, err := iter.Value()
+		ensure.Nil(t, err)
+		values = append(values, value)
+	}
+	iter.Release()
+	ensure.DeepEqual(t, values, []interface{}{"value-0", "value-1", "value-2"})
+
+	iter, err = p.IterateRange("key-1", "key-3")
+	ensure.Nil(t, err)
+	var keys []string
+	for iter.Next() {
+		keys = append(keys, iter.Key())
+	}
+	iter.Release()
+	ensure.DeepEqual(t, keys, []string{"key-1", "key-2"})
+}
+
 // Example shows how to use a callback. For each partition of the topics, a new
 // goroutine will be created. Topics should be co-partitioned (they should have
 // the same number of partitions and be partitioned by the same key).
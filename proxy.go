@@ -3,6 +3,7 @@ package goka
 import (
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/lovoo/goka/kafka"
@@ -85,12 +86,46 @@ func (p *delayProxy) Stop() {
 	p.m.Unlock()
 }
 
+// storageMetrics counts the accesses of a storage and their total latency in
+// nanoseconds. The fields are accessed atomically.
+type storageMetrics struct {
+	reads     int64
+	writes    int64
+	readTime  int64
+	writeTime int64
+}
+
+func (m *storageMetrics) read(start time.Time) {
+	atomic.AddInt64(&m.reads, 1)
+	atomic.AddInt64(&m.readTime, int64(time.Since(start)))
+}
+
+func (m *storageMetrics) write(start time.Time) {
+	atomic.AddInt64(&m.writes, 1)
+	atomic.AddInt64(&m.writeTime, int64(time.Since(start)))
+}
+
 type storageProxy struct {
+	// metrics is the first field to be 64-bit aligned for atomic access
+	metrics storageMetrics
+
 	storage.Storage
 	partition int32
 	stateless bool
 	update    UpdateCallback
 
+	// batchSize is the number of updates written at once while recovering.
+	// Zero disables batching.
+	batchSize int
+	// batch holds the updates and offset not written yet while recovering
+	batch *storage.Batch
+	// batchMu is held while writing a batch if set, eg, so that the batches
+	// of a view are not written while a snapshot is taken.
+	batchMu sync.Locker
+	// noSync disables syncing the writes of storages implementing
+	// storage.Syncer while recovering.
+	noSync bool
+
 	openedOnce once
 	closedOnce once
 }
@@ -109,14 +144,212 @@ func (s *storageProxy) Close() error {
 	return s.closedOnce.Do(s.Storage.Close)
 }
 
+func (s *storageProxy) Has(key string) (bool, error) {
+	defer s.metrics.read(time.Now())
+	return s.Storage.Has(key)
+}
+
+func (s *storageProxy) Get(key string) ([]byte, error) {
+	defer s.metrics.read(time.Now())
+	return s.Storage.Get(key)
+}
+
+// GetFunc passes the value of key to fn without copying it if the storage
+// implements storage.ZeroCopyGetter.
+func (s *storageProxy) GetFunc(key string, fn func(value []byte) error) error {
+	defer s.metrics.read(time.Now())
+	return storage.GetFunc(s.Storage, key, fn)
+}
+
+func (s *storageProxy) Set(key string, value []byte) error {
+	defer s.metrics.write(time.Now())
+	return s.Storage.Set(key, value)
+}
+
+func (s *storageProxy) Delete(key string) error {
+	defer s.metrics.write(time.Now())
+	return s.Storage.Delete(key)
+}
+
+// stats returns the metrics of the storage and of its accesses.
+func (s *storageProxy) stats() (StorageStats, error) {
+	var stats StorageStats
+	if s == nil {
+		return stats, nil
+	}
+	st, err := storage.GetStats(s.Storage)
+	if err != nil {
+		return stats, err
+	}
+	stats.Keys, stats.Bytes, stats.OpenFiles = st.Keys, st.Bytes, st.OpenFiles
+
+	reads, writes := atomic.LoadInt64(&s.metrics.reads), atomic.LoadInt64(&s.metrics.writes)
+	stats.Reads, stats.Writes = uint64(reads), uint64(writes)
+	if reads > 0 {
+		stats.ReadLatency = time.Duration(atomic.LoadInt64(&s.metrics.readTime) / reads)
+	}
+	if writes > 0 {
+		stats.WriteLatency = time.Duration(atomic.LoadInt64(&s.metrics.writeTime) / writes)
+	}
+	return stats, nil
+}
+
 func (s *storageProxy) Update(k string, v []byte) error {
+	return s.UpdateWithTimestamp(k, v, time.Time{})
+}
+
+// UpdateWithTimestamp calls the update callback for a message with timestamp
+// ts. Storages implementing storage.TimestampSetter, like TTL storages, get
+// the values set by the callback with the timestamp.
+func (s *storageProxy) UpdateWithTimestamp(k string, v []byte, ts time.Time) error {
+	if s.batch != nil {
+		return s.update(&batchedStorage{Storage: s.Storage, proxy: s, ts: ts}, s.partition, k, v)
+	}
+	if _, ok := s.Storage.(storage.TimestampSetter); ok && !ts.IsZero() {
+		return s.update(&timestampedStorage{Storage: s.Storage, ts: ts}, s.partition, k, v)
+	}
 	return s.update(s.Storage, s.partition, k, v)
 }
 
+// SetOffset stores the offset. While recovering in batches, the offset is
+// written with the updates of the batch it covers once the batch is full.
+func (s *storageProxy) SetOffset(offset int64) error {
+	if s.batch == nil {
+		return s.Storage.SetOffset(offset)
+	}
+	s.batch.SetOffset(offset)
+	if s.batch.Len() >= s.batchSize {
+		return s.flushBatch()
+	}
+	return nil
+}
+
+// startRecovery starts collecting the updates of the recovery in batches and
+// disables syncing them if noSync is set.
+func (s *storageProxy) startRecovery() error {
+	if s == nil {
+		return nil
+	}
+	if s.batchSize > 0 && s.batch == nil {
+		s.batch = new(storage.Batch)
+	}
+	if s.noSync {
+		return storage.SetSync(s.Storage, false)
+	}
+	return nil
+}
+
+// stopBatch writes the pending updates and stops batching.
+func (s *storageProxy) stopBatch() error {
+	if s == nil || s.batch == nil {
+		return nil
+	}
+	err := s.flushBatch()
+	s.batch = nil
+	return err
+}
+
+// flushBatch writes the updates of the batch together with their offset,
+// holding batchMu.
+func (s *storageProxy) flushBatch() error {
+	if s.batchMu != nil {
+		s.batchMu.Lock()
+		defer s.batchMu.Unlock()
+	}
+	return s.writeBatch()
+}
+
+// writeBatch writes the updates of the batch together with their offset. If
+// the storage does not write batches natively, the updates are written one by
+// one. Callers hold batchMu, eg, the update callback.
+func (s *storageProxy) writeBatch() error {
+	if _, ok := s.batch.Offset(); !ok && s.batch.Len() == 0 {
+		return nil
+	}
+	if err := storage.WriteBatch(s.Storage, s.batch); err != nil {
+		return err
+	}
+	s.batch.Reset()
+	return nil
+}
+
 func (s *storageProxy) Stateless() bool {
 	return s.stateless
 }
 
+// MarkRecovered writes the pending updates and syncs them if syncing was
+// disabled while recovering, before marking the storage as recovered.
 func (s *storageProxy) MarkRecovered() error {
+	if err := s.stopBatch(); err != nil {
+		return err
+	}
+	if s.noSync {
+		if err := storage.SetSync(s.Storage, true); err != nil {
+			return err
+		}
+	}
 	return s.Storage.MarkRecovered()
 }
+
+// batchedStorage is passed to the update callback while recovering in
+// batches. Updates are added to the batch of the proxy, reads see the updates
+// of the batch.
+type batchedStorage struct {
+	storage.Storage
+	proxy *storageProxy
+	ts    time.Time
+}
+
+func (s *batchedStorage) Has(key string) (bool, error) {
+	if value, ok := s.proxy.batch.Lookup(key); ok {
+		return value != nil, nil
+	}
+	return s.Storage.Has(key)
+}
+
+func (s *batchedStorage) Get(key string) ([]byte, error) {
+	if value, ok := s.proxy.batch.Lookup(key); ok {
+		return value, nil
+	}
+	return s.Storage.Get(key)
+}
+
+func (s *batchedStorage) Set(key string, value []byte) error {
+	s.proxy.batch.SetWithTimestamp(key, value, s.ts)
+	return nil
+}
+
+func (s *batchedStorage) Delete(key string) error {
+	s.proxy.batch.Delete(key)
+	return nil
+}
+
+func (s *batchedStorage) WriteBatch(b *storage.Batch) error {
+	return b.Replay(s.Set, s.Delete)
+}
+
+func (s *batchedStorage) Iterator() (storage.Iterator, error) {
+	if err := s.proxy.writeBatch(); err != nil {
+		return nil, err
+	}
+	return s.Storage.Iterator()
+}
+
+func (s *batchedStorage) IteratorWithRange(start, limit []byte) (storage.Iterator, error) {
+	if err := s.proxy.writeBatch(); err != nil {
+		return nil, err
+	}
+	return s.Storage.IteratorWithRange(start, limit)
+}
+
+// timestampedStorage is passed to the update callback for storages
+// implementing storage.TimestampSetter, so that the values are set with the
+// timestamp of the message.
+type timestampedStorage struct {
+	storage.Storage
+	ts time.Time
+}
+
+func (s *timestampedStorage) Set(key string, value []byte) error {
+	return storage.SetWithTimestamp(s.Storage, key, value, s.ts)
+}
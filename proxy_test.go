@@ -1,8 +1,85 @@
 package goka
 
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/facebookgo/ensure"
+	"github.com/lovoo/goka/storage"
+)
+
 type nullProxy struct{}
 
 func (p *nullProxy) Add(topic string, offset int64) error { return nil }
 func (p *nullProxy) Remove(topic string) error            { return nil }
 func (p *nullProxy) AddGroup()                            {}
 func (p *nullProxy) Stop()                                {}
+
+func TestStorageProxy_batchMu(t *testing.T) {
+	var (
+		mu sync.RWMutex
+		st = storage.NewMemory()
+		sp = &storageProxy{Storage: st, update: DefaultUpdate, batchSize: 10, batchMu: mu.RLocker()}
+	)
+	ensure.Nil(t, sp.startRecovery())
+	ensure.Nil(t, sp.Update("key", []byte("value")))
+	ensure.Nil(t, sp.SetOffset(1))
+
+	// batches are not written while the lock is held, eg, by a snapshot
+	mu.Lock()
+	done := make(chan error)
+	go func() { done <- sp.stopBatch() }()
+	select {
+	case <-done:
+		t.Fatalf("batch written while locked")
+	case <-time.After(10 * time.Millisecond):
+	}
+	mu.Unlock()
+	ensure.Nil(t, <-done)
+
+	value, err := st.Get("key")
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, value, []byte("value"))
+	offset, err := st.GetOffset(0)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, offset, int64(1))
+}
+
+// syncStorage records the calls of SetSync and the offset written when
+// syncing is enabled.
+type syncStorage struct {
+	storage.Storage
+	syncs  []bool
+	synced int64
+}
+
+func (s *syncStorage) SetSync(sync bool) error {
+	s.syncs = append(s.syncs, sync)
+	if sync {
+		s.synced, _ = s.Storage.GetOffset(-1)
+	}
+	return nil
+}
+
+func TestStorageProxy_noSync(t *testing.T) {
+	st := &syncStorage{Storage: storage.NewMemory()}
+	sp := &storageProxy{Storage: st, update: DefaultUpdate, batchSize: 10, noSync: true}
+
+	// syncing is disabled while recovering and enabled once the pending
+	// updates are written
+	ensure.Nil(t, sp.startRecovery())
+	ensure.DeepEqual(t, st.syncs, []bool{false})
+	ensure.Nil(t, sp.Update("key", []byte("value")))
+	ensure.Nil(t, sp.SetOffset(1))
+	ensure.Nil(t, sp.MarkRecovered())
+	ensure.DeepEqual(t, st.syncs, []bool{false, true})
+	ensure.DeepEqual(t, st.synced, int64(1))
+
+	// syncing is not changed by default
+	st = &syncStorage{Storage: storage.NewMemory()}
+	sp = &storageProxy{Storage: st, update: DefaultUpdate, batchSize: 10}
+	ensure.Nil(t, sp.startRecovery())
+	ensure.Nil(t, sp.MarkRecovered())
+	ensure.True(t, st.syncs == nil)
+}
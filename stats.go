@@ -11,10 +11,35 @@ type InputStats struct {
 }
 
 // OutputStats represents the number of messages and the number of bytes emitted
-// into a stream or table since the process started.
+// into a stream or table since the process started. Blocked counts the emits
+// that waited for the producer queue, BlockedTime the total time waited.
 type OutputStats struct {
-	Count uint
-	Bytes int
+	Count       uint
+	Bytes       int
+	Blocked     uint
+	BlockedTime time.Duration
+}
+
+// EmitterStats represents the metrics of an emitter since it was created.
+// Messages count as emitted once they are acknowledged by Kafka and as failed
+// once they fail for good, ie, after all retries.
+type EmitterStats struct {
+	Emitted  uint
+	Failed   uint
+	InFlight int
+	Bytes    int // bytes of the emitted values
+
+	AckLatency    time.Duration // total time until the emitted messages were acknowledged
+	MaxAckLatency time.Duration
+}
+
+// AvgAckLatency returns the average time until the emitted messages were
+// acknowledged.
+func (s *EmitterStats) AvgAckLatency() time.Duration {
+	if s.Emitted == 0 {
+		return 0
+	}
+	return s.AckLatency / time.Duration(s.Emitted)
 }
 
 // PartitionStatus is the status of the partition of a table (group table or joined table).
@@ -42,12 +67,29 @@ type PartitionStats struct {
 
 		Offset int64 // last offset processed or recovered
 		Hwm    int64 // next offset to be written
+		Lag    int64 // messages written but not processed or recovered yet
 
 		StartTime    time.Time
 		RecoveryTime time.Time
 	}
-	Input  map[string]InputStats
-	Output map[string]OutputStats
+	Input   map[string]InputStats
+	Output  map[string]OutputStats
+	Storage StorageStats
+}
+
+// StorageStats represents the metrics of the storage of a partition. Keys,
+// Bytes and OpenFiles are reported by the storage and are -1 if the storage
+// does not determine them (see storage.Stats). The reads and writes count the
+// accesses of callbacks and lookups since the storage was opened.
+type StorageStats struct {
+	Keys      int64
+	Bytes     int64
+	OpenFiles int
+
+	Reads        uint64
+	Writes       uint64
+	ReadLatency  time.Duration // average latency of the reads
+	WriteLatency time.Duration // average latency of the writes
 }
 
 func newPartitionStats() *PartitionStats {
@@ -65,6 +107,8 @@ func (s *PartitionStats) init(o *PartitionStats, offset, hwm int64) *PartitionSt
 	s.Table.RecoveryTime = o.Table.RecoveryTime
 	s.Table.Offset = offset
 	s.Table.Hwm = hwm
+	s.Table.Lag = lag(offset, hwm)
+	s.Storage = o.Storage
 	s.Now = time.Now()
 	for k, v := range o.Input {
 		s.Input[k] = v
@@ -75,6 +119,18 @@ func (s *PartitionStats) init(o *PartitionStats, offset, hwm int64) *PartitionSt
 	return s
 }
 
+// lag returns the number of messages between offset and hwm. Negative offsets
+// denote that nothing was consumed yet.
+func lag(offset, hwm int64) int64 {
+	if offset < 0 {
+		offset = -1
+	}
+	if l := hwm - offset - 1; l > 0 {
+		return l
+	}
+	return 0
+}
+
 func (s *PartitionStats) reset() {
 	s.Input = make(map[string]InputStats)
 	s.Output = make(map[string]OutputStats)
@@ -85,6 +141,18 @@ type ViewStats struct {
 	Partitions map[int32]*PartitionStats
 }
 
+// MaxLag returns the highest lag of the partitions of the view, ie, how many
+// messages the view is behind the table topic in its most stale partition.
+func (s *ViewStats) MaxLag() int64 {
+	var max int64
+	for _, p := range s.Partitions {
+		if p.Table.Lag > max {
+			max = p.Table.Lag
+		}
+	}
+	return max
+}
+
 func newViewStats() *ViewStats {
 	return &ViewStats{
 		Partitions: make(map[int32]*PartitionStats),
@@ -111,3 +179,29 @@ func newProcessorStats(partitions int) *ProcessorStats {
 	}
 	return stats
 }
+
+// ViewUpdateInfo describes an update applied by a view.
+type ViewUpdateInfo struct {
+	Topic     string
+	Partition int32
+	Key       string
+	Offset    int64
+	// Latency is the time between producing and applying the update. It is
+	// zero if the message has no timestamp.
+	Latency time.Duration
+}
+
+// ViewObserver is notified of the updates applied by a view, eg, to export
+// metrics.
+type ViewObserver interface {
+	// OnUpdate is called after the view applied an update.
+	OnUpdate(info *ViewUpdateInfo)
+}
+
+// ViewObserverFunc is an adapter to use functions as ViewObservers.
+type ViewObserverFunc func(info *ViewUpdateInfo)
+
+// OnUpdate calls fn.
+func (fn ViewObserverFunc) OnUpdate(info *ViewUpdateInfo) {
+	fn(info)
+}
@@ -0,0 +1,35 @@
+package goka
+
+import (
+	"testing"
+	"time"
+
+	"github.com/facebookgo/ensure"
+)
+
+func TestPartitionStats_lag(t *testing.T) {
+	s := newPartitionStats().init(newPartitionStats(), 4, 10)
+	ensure.DeepEqual(t, s.Table.Lag, int64(5))
+
+	// nothing consumed yet
+	s = newPartitionStats().init(newPartitionStats(), -2, 10)
+	ensure.DeepEqual(t, s.Table.Lag, int64(10))
+
+	// caught up
+	s = newPartitionStats().init(newPartitionStats(), 9, 10)
+	ensure.DeepEqual(t, s.Table.Lag, int64(0))
+
+	vs := newViewStats()
+	vs.Partitions[0] = newPartitionStats().init(newPartitionStats(), 4, 10)
+	vs.Partitions[1] = newPartitionStats().init(newPartitionStats(), 1, 10)
+	ensure.DeepEqual(t, vs.MaxLag(), int64(8))
+}
+
+func TestEmitterStats_AvgAckLatency(t *testing.T) {
+	s := &EmitterStats{}
+	ensure.DeepEqual(t, s.AvgAckLatency(), time.Duration(0))
+
+	s.Emitted = 4
+	s.AckLatency = 8 * time.Millisecond
+	ensure.DeepEqual(t, s.AvgAckLatency(), 2*time.Millisecond)
+}
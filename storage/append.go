@@ -64,6 +64,15 @@ func (f *file) Delete(string) error {
 	return nil
 }
 
+// Stats returns the number of bytes written. The keys are not stored.
+func (f *file) Stats() (*Stats, error) {
+	return &Stats{Keys: -1, Bytes: f.bytesWritten, OpenFiles: 1}, nil
+}
+
+func (f *file) WriteBatch(b *Batch) error {
+	return b.Replay(f.Set, f.Delete)
+}
+
 func (f *file) GetOffset(def int64) (int64, error) {
 	return def, nil
 }
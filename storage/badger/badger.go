@@ -0,0 +1,305 @@
+package badger
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lovoo/goka/storage"
+
+	badger "github.com/dgraph-io/badger"
+)
+
+const (
+	offsetKey = "__offset"
+)
+
+// GCOptions configures the garbage collection of the value log of badger.
+type GCOptions struct {
+	// Interval is the interval in which the value log is garbage collected.
+	// Zero disables the garbage collection.
+	Interval time.Duration
+	// DiscardRatio is the ratio of stale data a value log file must contain
+	// to be rewritten.
+	DiscardRatio float64
+}
+
+// DefaultGCOptions collects the value log every 5 minutes.
+var DefaultGCOptions = GCOptions{
+	Interval:     5 * time.Minute,
+	DiscardRatio: 0.5,
+}
+
+type badgerStorage struct {
+	db *badger.DB
+	gc GCOptions
+
+	recovered bool
+	stop      chan struct{}
+	done      sync.WaitGroup
+}
+
+// New creates a new Storage backed by badger. The value log of db is garbage
+// collected as configured by gc while the storage is open.
+func New(db *badger.DB, gc GCOptions) (storage.Storage, error) {
+	if db == nil {
+		return nil, errors.New("invalid badger db")
+	}
+	return &badgerStorage{
+		db: db,
+		gc: gc,
+	}, nil
+}
+
+func (s *badgerStorage) Has(key string) (bool, error) {
+	err := s.db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get([]byte(key))
+		return err
+	})
+	if err == badger.ErrKeyNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("error checking for existence in badger (key %s): %v", key, err)
+	}
+	return true, nil
+}
+
+func (s *badgerStorage) Get(key string) ([]byte, error) {
+	var value []byte
+	err := s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(key))
+		if err != nil {
+			return err
+		}
+		value, err = item.ValueCopy(nil)
+		return err
+	})
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error getting from badger (key %s): %v", key, err)
+	}
+	return value, nil
+}
+
+func (s *badgerStorage) GetOffset(defValue int64) (int64, error) {
+	data, err := s.Get(offsetKey)
+	if err != nil {
+		return 0, err
+	}
+	if data == nil {
+		return defValue, nil
+	}
+
+	value, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("error decoding offset: %v", err)
+	}
+	return value, nil
+}
+
+func (s *badgerStorage) Set(key string, value []byte) error {
+	err := s.db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte(key), value)
+	})
+	if err != nil {
+		return fmt.Errorf("error setting to badger (key %s): %v", key, err)
+	}
+	return nil
+}
+
+func (s *badgerStorage) SetOffset(offset int64) error {
+	return s.Set(offsetKey, []byte(strconv.FormatInt(offset, 10)))
+}
+
+func (s *badgerStorage) Delete(key string) error {
+	err := s.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete([]byte(key))
+	})
+	if err != nil {
+		return fmt.Errorf("error deleting from badger (key %s): %v", key, err)
+	}
+	return nil
+}
+
+// WriteBatch writes the updates of the batch in a single transaction. Badger
+// rejects transactions that are too big, so batches should not hold more than
+// a few thousand updates.
+// Stats returns the size of the LSM tree and the value log and the number of
+// keys in the tables of the LSM tree, which approximates the number of keys
+// since the tables also count overwritten and deleted keys. Badger does not
+// count its open files.
+func (s *badgerStorage) Stats() (*storage.Stats, error) {
+	lsm, vlog := s.db.Size()
+	var keys int64
+	for _, t := range s.db.Tables(true) {
+		keys += int64(t.KeyCount)
+	}
+	return &storage.Stats{Keys: keys, Bytes: lsm + vlog, OpenFiles: -1}, nil
+}
+
+func (s *badgerStorage) WriteBatch(b *storage.Batch) error {
+	err := s.db.Update(func(txn *badger.Txn) error {
+		err := b.Replay(
+			func(key string, value []byte) error { return txn.Set([]byte(key), value) },
+			func(key string) error { return txn.Delete([]byte(key)) },
+		)
+		if offset, ok := b.Offset(); ok && err == nil {
+			err = txn.Set([]byte(offsetKey), []byte(strconv.FormatInt(offset, 10)))
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("error writing batch to badger: %v", err)
+	}
+	return nil
+}
+
+// Iterator returns an iterator that traverses over a snapshot of the storage.
+func (s *badgerStorage) Iterator() (storage.Iterator, error) {
+	return s.newIterator(nil, nil, nil), nil
+}
+
+// IteratorWithRange returns an iterator that traverses over a snapshot of the
+// storage in the range [start, limit). If limit is empty, the iterator
+// traverses all keys with prefix start.
+func (s *badgerStorage) IteratorWithRange(start, limit []byte) (storage.Iterator, error) {
+	if len(limit) == 0 {
+		return s.newIterator(start, nil, start), nil
+	}
+	return s.newIterator(start, limit, nil), nil
+}
+
+func (s *badgerStorage) newIterator(start, limit, prefix []byte) *iterator {
+	txn := s.db.NewTransaction(false)
+	return &iterator{
+		txn:    txn,
+		iter:   txn.NewIterator(badger.DefaultIteratorOptions),
+		start:  start,
+		limit:  limit,
+		prefix: prefix,
+	}
+}
+
+func (s *badgerStorage) MarkRecovered() error {
+	s.recovered = true
+	return nil
+}
+
+func (s *badgerStorage) Recovered() bool {
+	return s.recovered
+}
+
+// Open starts the garbage collection of the value log.
+func (s *badgerStorage) Open() error {
+	if s.gc.Interval <= 0 || s.stop != nil {
+		return nil
+	}
+	s.stop = make(chan struct{})
+	s.done.Add(1)
+	go s.collectGarbage()
+	return nil
+}
+
+func (s *badgerStorage) collectGarbage() {
+	defer s.done.Done()
+	ticker := time.NewTicker(s.gc.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			// every run rewrites at most one file, so repeat until there
+			// is nothing left to collect
+			for s.db.RunValueLogGC(s.gc.DiscardRatio) == nil {
+			}
+		}
+	}
+}
+
+func (s *badgerStorage) Close() error {
+	if s.stop != nil {
+		close(s.stop)
+		s.done.Wait()
+		s.stop = nil
+	}
+	return s.db.Close()
+}
+
+// iterator iterates over a read-only transaction of badger, skipping the
+// offset key. Like LevelDB iterators, it is positioned before the first key
+// until Next or Seek is called.
+type iterator struct {
+	txn     *badger.Txn
+	iter    *badger.Iterator
+	started bool
+
+	start  []byte
+	limit  []byte
+	prefix []byte
+}
+
+func (i *iterator) valid() bool {
+	if !i.iter.Valid() {
+		return false
+	}
+	key := i.iter.Item().Key()
+	if i.limit != nil && bytes.Compare(key, i.limit) >= 0 {
+		return false
+	}
+	return i.prefix == nil || bytes.HasPrefix(key, i.prefix)
+}
+
+// skipOffset moves the iterator past the offset key.
+func (i *iterator) skipOffset() bool {
+	if i.valid() && string(i.iter.Item().Key()) == offsetKey {
+		i.iter.Next()
+	}
+	return i.valid()
+}
+
+func (i *iterator) Next() bool {
+	if !i.started {
+		i.started = true
+		if i.start != nil {
+			i.iter.Seek(i.start)
+		} else {
+			i.iter.Rewind()
+		}
+	} else if i.iter.Valid() {
+		i.iter.Next()
+	}
+	return i.skipOffset()
+}
+
+func (i *iterator) Key() []byte {
+	if !i.started || !i.valid() {
+		return nil
+	}
+	return i.iter.Item().KeyCopy(nil)
+}
+
+func (i *iterator) Value() ([]byte, error) {
+	if !i.started || !i.valid() {
+		return nil, nil
+	}
+	return i.iter.Item().ValueCopy(nil)
+}
+
+func (i *iterator) Release() {
+	i.iter.Close()
+	i.txn.Discard()
+}
+
+func (i *iterator) Seek(key []byte) bool {
+	i.started = true
+	if bytes.Compare(key, i.start) < 0 {
+		key = i.start
+	}
+	i.iter.Seek(key)
+	return i.skipOffset()
+}
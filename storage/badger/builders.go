@@ -0,0 +1,31 @@
+package badger
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/lovoo/goka/storage"
+
+	badger "github.com/dgraph-io/badger"
+)
+
+// DefaultBuilder builds a badger storage with default configuration. The
+// databases are stored in the given path.
+func DefaultBuilder(path string) storage.Builder {
+	return BuilderWithOptions(path, badger.DefaultOptions(""), DefaultGCOptions)
+}
+
+// BuilderWithOptions builds badger storages with the given options in the given
+// path. The directories of opts are set to the path of each partition.
+func BuilderWithOptions(path string, opts badger.Options, gc GCOptions) storage.Builder {
+	return func(topic string, partition int32) (storage.Storage, error) {
+		fp := filepath.Join(path, fmt.Sprintf("%s.%d", topic, partition))
+		opts.Dir = fp
+		opts.ValueDir = fp
+		db, err := badger.Open(opts)
+		if err != nil {
+			return nil, fmt.Errorf("error opening badger: %v", err)
+		}
+		return New(db, gc)
+	}
+}
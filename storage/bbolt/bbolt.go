@@ -0,0 +1,275 @@
+package bbolt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/lovoo/goka/storage"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	offsetKey = "__offset"
+)
+
+// bucket is the bucket holding the keys and values of the storage.
+var bucket = []byte("goka")
+
+type boltStorage struct {
+	db        *bolt.DB
+	recovered bool
+}
+
+// New creates a new Storage backed by bbolt. Updates are synced to disk unless
+// disabled with SetSync or the NoSync flag of db.
+func New(db *bolt.DB) (storage.Storage, error) {
+	if db == nil {
+		return nil, errors.New("invalid bbolt db")
+	}
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucket)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating bbolt bucket: %v", err)
+	}
+	return &boltStorage{db: db}, nil
+}
+
+func (s *boltStorage) Has(key string) (bool, error) {
+	var has bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		has = tx.Bucket(bucket).Get([]byte(key)) != nil
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("error checking for existence in bbolt (key %s): %v", key, err)
+	}
+	return has, nil
+}
+
+func (s *boltStorage) Get(key string) ([]byte, error) {
+	var value []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		// values are only valid during the transaction
+		if v := tx.Bucket(bucket).Get([]byte(key)); v != nil {
+			value = append([]byte{}, v...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting from bbolt (key %s): %v", key, err)
+	}
+	return value, nil
+}
+
+func (s *boltStorage) GetOffset(defValue int64) (int64, error) {
+	data, err := s.Get(offsetKey)
+	if err != nil {
+		return 0, err
+	}
+	if data == nil {
+		return defValue, nil
+	}
+
+	value, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("error decoding offset: %v", err)
+	}
+	return value, nil
+}
+
+func (s *boltStorage) Set(key string, value []byte) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Put([]byte(key), value)
+	})
+	if err != nil {
+		return fmt.Errorf("error setting to bbolt (key %s): %v", key, err)
+	}
+	return nil
+}
+
+func (s *boltStorage) SetOffset(offset int64) error {
+	return s.Set(offsetKey, []byte(strconv.FormatInt(offset, 10)))
+}
+
+func (s *boltStorage) Delete(key string) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Delete([]byte(key))
+	})
+	if err != nil {
+		return fmt.Errorf("error deleting from bbolt (key %s): %v", key, err)
+	}
+	return nil
+}
+
+// Stats returns the size of the database file and the number of keys.
+// Counting the keys traverses the pages of the bucket.
+func (s *boltStorage) Stats() (*storage.Stats, error) {
+	stats := &storage.Stats{OpenFiles: 1}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(bucket)
+		stats.Bytes = tx.Size()
+		stats.Keys = int64(bkt.Stats().KeyN)
+		if bkt.Get([]byte(offsetKey)) != nil {
+			stats.Keys--
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading bbolt stats: %v", err)
+	}
+	return stats, nil
+}
+
+func (s *boltStorage) WriteBatch(b *storage.Batch) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(bucket)
+		err := b.Replay(
+			func(key string, value []byte) error { return bkt.Put([]byte(key), value) },
+			func(key string) error { return bkt.Delete([]byte(key)) },
+		)
+		if offset, ok := b.Offset(); ok && err == nil {
+			err = bkt.Put([]byte(offsetKey), []byte(strconv.FormatInt(offset, 10)))
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("error writing batch to bbolt: %v", err)
+	}
+	return nil
+}
+
+// Iterator returns an iterator that traverses over a snapshot of the storage.
+// The snapshot is a read transaction, which should be released soon because it
+// keeps bbolt from reusing pages.
+func (s *boltStorage) Iterator() (storage.Iterator, error) {
+	return s.newIterator(nil, nil, nil)
+}
+
+// IteratorWithRange returns an iterator that traverses over a snapshot of the
+// storage in the range [start, limit). If limit is empty, the iterator
+// traverses all keys with prefix start.
+func (s *boltStorage) IteratorWithRange(start, limit []byte) (storage.Iterator, error) {
+	if len(limit) == 0 {
+		return s.newIterator(start, nil, start)
+	}
+	return s.newIterator(start, limit, nil)
+}
+
+func (s *boltStorage) newIterator(start, limit, prefix []byte) (storage.Iterator, error) {
+	tx, err := s.db.Begin(false)
+	if err != nil {
+		return nil, fmt.Errorf("error opening bbolt transaction: %v", err)
+	}
+	return &iterator{
+		tx:     tx,
+		cursor: tx.Bucket(bucket).Cursor(),
+		start:  start,
+		limit:  limit,
+		prefix: prefix,
+	}, nil
+}
+
+// SetSync enables or disables syncing the updates. Enabling it syncs the
+// updates written while it was disabled.
+func (s *boltStorage) SetSync(sync bool) error {
+	if sync && s.db.NoSync {
+		if err := s.db.Sync(); err != nil {
+			return fmt.Errorf("error syncing bbolt: %v", err)
+		}
+	}
+	s.db.NoSync = !sync
+	return nil
+}
+
+func (s *boltStorage) MarkRecovered() error {
+	s.recovered = true
+	return nil
+}
+
+func (s *boltStorage) Recovered() bool {
+	return s.recovered
+}
+
+func (s *boltStorage) Open() error {
+	return nil
+}
+
+func (s *boltStorage) Close() error {
+	if s.db.NoSync {
+		if err := s.db.Sync(); err != nil {
+			return fmt.Errorf("error syncing bbolt: %v", err)
+		}
+	}
+	return s.db.Close()
+}
+
+// iterator iterates over a cursor of a read transaction, skipping the offset
+// key. Like LevelDB iterators, it is positioned before the first key until
+// Next or Seek is called.
+type iterator struct {
+	tx      *bolt.Tx
+	cursor  *bolt.Cursor
+	started bool
+
+	key, value []byte
+
+	start  []byte
+	limit  []byte
+	prefix []byte
+}
+
+// set positions the iterator at key, skipping the offset key and keys out of
+// range.
+func (i *iterator) set(key, value []byte) bool {
+	if key != nil && string(key) == offsetKey {
+		key, value = i.cursor.Next()
+	}
+	if key == nil ||
+		(i.limit != nil && bytes.Compare(key, i.limit) >= 0) ||
+		(i.prefix != nil && !bytes.HasPrefix(key, i.prefix)) {
+		i.key, i.value = nil, nil
+		return false
+	}
+	i.key, i.value = key, value
+	return true
+}
+
+func (i *iterator) Next() bool {
+	if !i.started {
+		i.started = true
+		if i.start != nil {
+			return i.set(i.cursor.Seek(i.start))
+		}
+		return i.set(i.cursor.First())
+	}
+	if i.key == nil {
+		return false
+	}
+	return i.set(i.cursor.Next())
+}
+
+func (i *iterator) Key() []byte {
+	return i.key
+}
+
+func (i *iterator) Value() ([]byte, error) {
+	return i.value, nil
+}
+
+func (i *iterator) Release() {
+	i.key, i.value = nil, nil
+	_ = i.tx.Rollback()
+}
+
+func (i *iterator) Seek(key []byte) bool {
+	i.started = true
+	if bytes.Compare(key, i.start) < 0 {
+		key = i.start
+	}
+	return i.set(i.cursor.Seek(key))
+}
@@ -0,0 +1,33 @@
+package bbolt
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/lovoo/goka/storage"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// DefaultBuilder builds a bbolt storage with default configuration. Every
+// partition is stored in a single file in the given path.
+func DefaultBuilder(path string) storage.Builder {
+	return BuilderWithOptions(path, nil)
+}
+
+// BuilderWithOptions builds bbolt storages with the given options in the given
+// path.
+func BuilderWithOptions(path string, opts *bolt.Options) storage.Builder {
+	return func(topic string, partition int32) (storage.Storage, error) {
+		if err := os.MkdirAll(path, 0755); err != nil {
+			return nil, fmt.Errorf("error creating bbolt directory: %v", err)
+		}
+		fp := filepath.Join(path, fmt.Sprintf("%s.%d.db", topic, partition))
+		db, err := bolt.Open(fp, 0600, opts)
+		if err != nil {
+			return nil, fmt.Errorf("error opening bbolt: %v", err)
+		}
+		return New(db)
+	}
+}
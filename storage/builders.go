@@ -1,40 +1,154 @@
 package storage
 
 import (
+	"context"
 	"fmt"
+	"os"
 	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/lovoo/goka/logger"
 
 	"github.com/syndtr/goleveldb/leveldb"
+	lerrors "github.com/syndtr/goleveldb/leveldb/errors"
+	"github.com/syndtr/goleveldb/leveldb/filter"
 	"github.com/syndtr/goleveldb/leveldb/opt"
 )
 
+// corruptedMarker is the file marking a LevelDB directory as corrupted.
+const corruptedMarker = "GOKA-CORRUPTED"
+
+// keepQuarantined is the number of quarantined copies kept per partition. The
+// older copies are removed when a partition is quarantined again.
+const keepQuarantined = 1
+
+// openFile opens a LevelDB, replaced in tests.
+var openFile = leveldb.OpenFile
+
 // Builder creates a local storage (a persistent cache) for a topic
 // table. Builder creates one storage for each partition of the topic.
 type Builder func(topic string, partition int32) (Storage, error)
 
+// ContextBuilder is a Builder receiving the context of the processor or view
+// and its logger, so that slow opens can be canceled and backends can log
+// through the logger of the application.
+type ContextBuilder func(ctx context.Context, log logger.Logger, topic string, partition int32) (Storage, error)
+
+// AdaptBuilder adapts builder to a ContextBuilder ignoring the context and
+// logger.
+func AdaptBuilder(builder Builder) ContextBuilder {
+	return func(ctx context.Context, log logger.Logger, topic string, partition int32) (Storage, error) {
+		return builder(topic, partition)
+	}
+}
+
 // DefaultBuilder builds a LevelDB storage with default configuration.
 // The database will be stored in the given path.
 func DefaultBuilder(path string) Builder {
-	return func(topic string, partition int32) (Storage, error) {
-		fp := filepath.Join(path, fmt.Sprintf("%s.%d", topic, partition))
-		db, err := leveldb.OpenFile(fp, nil)
-		if err != nil {
-			return nil, fmt.Errorf("error opening leveldb: %v", err)
-		}
-		return New(db)
+	return BuilderWithOptions(path, nil)
+}
+
+// LargeTableOptions returns LevelDB options suited for tables of several
+// gigabytes. Compared to the defaults of LevelDB, they use a larger block
+// cache and write buffer, bloom filters to avoid reading tables on lookups of
+// missing keys and larger tables to reduce the number of files. The options
+// can be adjusted before passing them to BuilderWithOptions.
+func LargeTableOptions() *opt.Options {
+	return &opt.Options{
+		BlockCacheCapacity:     64 * opt.MiB,
+		WriteBuffer:            32 * opt.MiB,
+		Filter:                 filter.NewBloomFilter(10),
+		CompactionTableSize:    8 * opt.MiB,
+		CompactionTotalSize:    100 * opt.MiB,
+		OpenFilesCacheCapacity: 500,
 	}
 }
 
-// BuilderWithOptions builds LevelDB storage with the given options and
-// in the given path.
+// BuilderWithOptions builds LevelDB storage with the given options and in
+// the given path, eg, to tune the block cache (BlockCacheCapacity), the write
+// buffer (WriteBuffer), bloom filters (Filter) and compactions
+// (CompactionTableSize, CompactionTotalSize, CompactionL0Trigger). See
+// LargeTableOptions for a starting point for large tables. Corrupted
+// databases are moved aside and replaced by empty ones, so that the partitions
+// are recovered from the table topic.
 func BuilderWithOptions(path string, opts *opt.Options) Builder {
+	builder := ContextBuilderWithOptions(path, opts)
 	return func(topic string, partition int32) (Storage, error) {
+		return builder(context.Background(), logger.Default(), topic, partition)
+	}
+}
+
+// ContextBuilderWithOptions is the ContextBuilder of BuilderWithOptions. It
+// does not open the LevelDB if ctx is canceled and logs to the given logger.
+func ContextBuilderWithOptions(path string, opts *opt.Options) ContextBuilder {
+	return func(ctx context.Context, log logger.Logger, topic string, partition int32) (Storage, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		fp := filepath.Join(path, fmt.Sprintf("%s.%d", topic, partition))
-		db, err := leveldb.OpenFile(fp, opts)
+		db, err := openLevelDB(fp, opts, log)
 		if err != nil {
 			return nil, fmt.Errorf("error opening leveldb: %v", err)
 		}
-		return New(db)
+		st, err := New(db)
+		if err != nil {
+			return nil, err
+		}
+		st.(*storage).path = fp
+		return st, nil
+	}
+}
+
+// openLevelDB opens the LevelDB in path. If the LevelDB is corrupted or was
+// marked as corrupted by a storage, the directory is renamed to
+// <path>.corrupted-<unix nanoseconds> and an empty LevelDB is opened instead.
+// Only the most recent quarantined copies are kept (see keepQuarantined).
+func openLevelDB(path string, opts *opt.Options, log logger.Logger) (*leveldb.DB, error) {
+	if _, err := os.Stat(filepath.Join(path, corruptedMarker)); err == nil {
+		if err := quarantine(path, fmt.Errorf("marked as corrupted"), log); err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := openFile(path, opts)
+	if err == nil || !lerrors.IsCorrupted(err) {
+		return db, err
+	}
+	if err := quarantine(path, err, log); err != nil {
+		return nil, err
+	}
+	return openFile(path, opts)
+}
+
+// quarantine moves the corrupted LevelDB in path aside.
+func quarantine(path string, cause error, log logger.Logger) error {
+	dst := fmt.Sprintf("%s.corrupted-%d", path, time.Now().UnixNano())
+	if err := os.Rename(path, dst); err != nil {
+		return fmt.Errorf("error quarantining corrupted leveldb %s (%v): %v", path, cause, err)
+	}
+	log.Printf("storage: moved corrupted leveldb %s to %s (%v), recovering it from Kafka", path, dst, cause)
+
+	// the timestamps of the copies have the same length, so the names sort
+	// by age
+	copies, err := filepath.Glob(path + ".corrupted-*")
+	if err != nil {
+		return nil
+	}
+	sort.Strings(copies)
+	for i := 0; i < len(copies)-keepQuarantined; i++ {
+		if err := os.RemoveAll(copies[i]); err != nil {
+			log.Printf("storage: error removing quarantined leveldb %s: %v", copies[i], err)
+		}
+	}
+	return nil
+}
+
+// markCorrupted marks the LevelDB in path as corrupted. Errors are ignored,
+// since the storage is failing anyway.
+func markCorrupted(path string) {
+	if f, err := os.Create(filepath.Join(path, corruptedMarker)); err == nil {
+		f.Close()
 	}
 }
 
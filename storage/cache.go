@@ -0,0 +1,312 @@
+package storage
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// CacheOptions configures a caching storage.
+type CacheOptions struct {
+	// Size is the maximum number of values read from the backing storage that
+	// are kept in memory.
+	Size int
+	// MaxDirty is the number of written keys at which the writes are flushed
+	// to the backing storage.
+	MaxDirty int
+	// FlushInterval is the interval in which the writes are flushed to the
+	// backing storage while the storage is open. Zero flushes only when
+	// MaxDirty keys are written.
+	FlushInterval time.Duration
+}
+
+// DefaultCacheOptions caches 10000 values and flushes every second.
+var DefaultCacheOptions = CacheOptions{
+	Size:          10000,
+	MaxDirty:      10000,
+	FlushInterval: time.Second,
+}
+
+type cachedStorage struct {
+	Storage
+	opts CacheOptions
+
+	m sync.Mutex
+	// dirty holds the writes not flushed yet
+	dirty     map[string]dirtyWrite
+	offset    int64
+	hasOffset bool
+
+	// order and items are the LRU cache of the values read
+	order *list.List
+	items map[string]*list.Element
+	// generation is increased on every write, so that values read before the
+	// write are not added to the cache after the write
+	generation uint64
+
+	stop chan struct{}
+	done sync.WaitGroup
+}
+
+type cachedValue struct {
+	key   string
+	value []byte
+}
+
+// dirtyWrite is a write not flushed yet, either setting the value written at
+// ts or deleting the key.
+type dirtyWrite struct {
+	value  []byte
+	ts     time.Time
+	delete bool
+}
+
+// NewCached wraps st so that writes are kept in memory and flushed to st in
+// batches, and recently read values are kept in memory. The values and the
+// offset are flushed atomically if st writes batches atomically (see
+// Batch.SetOffset). Writes not flushed are lost if the process crashes and are
+// then recovered from the table topic.
+func NewCached(st Storage, opts CacheOptions) Storage {
+	return &cachedStorage{
+		Storage: st,
+		opts:    opts,
+		dirty:   make(map[string]dirtyWrite),
+		order:   list.New(),
+		items:   make(map[string]*list.Element),
+	}
+}
+
+// BuilderWithCache wraps the storages built by builder with NewCached.
+func BuilderWithCache(builder Builder, opts CacheOptions) Builder {
+	return func(topic string, partition int32) (Storage, error) {
+		st, err := builder(topic, partition)
+		if err != nil {
+			return nil, err
+		}
+		return NewCached(st, opts), nil
+	}
+}
+
+func (s *cachedStorage) Has(key string) (bool, error) {
+	value, err := s.Get(key)
+	return value != nil, err
+}
+
+func (s *cachedStorage) Get(key string) ([]byte, error) {
+	s.m.Lock()
+	if w, ok := s.dirty[key]; ok {
+		s.m.Unlock()
+		return w.value, nil
+	}
+	if el, ok := s.items[key]; ok {
+		s.order.MoveToFront(el)
+		s.m.Unlock()
+		return el.Value.(*cachedValue).value, nil
+	}
+	generation := s.generation
+	s.m.Unlock()
+
+	value, err := s.Storage.Get(key)
+	if err != nil || value == nil {
+		return value, err
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	if generation == s.generation && s.opts.Size > 0 {
+		s.cache(key, value)
+	}
+	return value, nil
+}
+
+// cache adds the value of key to the read cache. s.m must be held.
+func (s *cachedStorage) cache(key string, value []byte) {
+	if el, ok := s.items[key]; ok {
+		s.order.Remove(el)
+	}
+	s.items[key] = s.order.PushFront(&cachedValue{key: key, value: value})
+	for s.order.Len() > s.opts.Size {
+		el := s.order.Back()
+		s.order.Remove(el)
+		delete(s.items, el.Value.(*cachedValue).key)
+	}
+}
+
+// write adds the write of key to the dirty writes. s.m must be held.
+func (s *cachedStorage) write(key string, w dirtyWrite) {
+	s.generation++
+	if el, ok := s.items[key]; ok {
+		s.order.Remove(el)
+		delete(s.items, key)
+	}
+	s.dirty[key] = w
+}
+
+// set adds setting key to a copy of value written at ts to the dirty writes,
+// so that the caller may reuse value. s.m must be held.
+func (s *cachedStorage) set(key string, value []byte, ts time.Time) {
+	s.write(key, dirtyWrite{value: append(make([]byte, 0, len(value)), value...), ts: ts})
+}
+
+func (s *cachedStorage) Set(key string, value []byte) error {
+	return s.SetWithTimestamp(key, value, time.Time{})
+}
+
+// SetWithTimestamp keeps ts with the write, so that it is passed to the
+// backing storage when the write is flushed.
+func (s *cachedStorage) SetWithTimestamp(key string, value []byte, ts time.Time) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.set(key, value, ts)
+	return s.flushIfFull()
+}
+
+func (s *cachedStorage) Delete(key string) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.write(key, dirtyWrite{delete: true})
+	return s.flushIfFull()
+}
+
+func (s *cachedStorage) WriteBatch(b *Batch) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	for _, u := range b.updates {
+		if u.delete {
+			s.write(u.key, dirtyWrite{delete: true})
+		} else {
+			s.set(u.key, u.value, u.ts)
+		}
+	}
+	if offset, ok := b.Offset(); ok {
+		s.offset, s.hasOffset = offset, true
+	}
+	return s.flushIfFull()
+}
+
+func (s *cachedStorage) Unwrap() Storage {
+	return s.Storage
+}
+
+// SetOffset keeps the offset in memory until it is flushed with the writes
+// it covers.
+func (s *cachedStorage) SetOffset(offset int64) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.offset, s.hasOffset = offset, true
+	return nil
+}
+
+func (s *cachedStorage) GetOffset(defValue int64) (int64, error) {
+	s.m.Lock()
+	if s.hasOffset {
+		defer s.m.Unlock()
+		return s.offset, nil
+	}
+	s.m.Unlock()
+	return s.Storage.GetOffset(defValue)
+}
+
+func (s *cachedStorage) flushIfFull() error {
+	if len(s.dirty) < s.opts.MaxDirty {
+		return nil
+	}
+	return s.flush()
+}
+
+// Flush writes the dirty writes and the offset to the backing storage.
+func (s *cachedStorage) Flush() error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.flush()
+}
+
+// flush writes the dirty writes and the offset in a batch. s.m must be held.
+func (s *cachedStorage) flush() error {
+	if len(s.dirty) == 0 && !s.hasOffset {
+		return nil
+	}
+	b := new(Batch)
+	for key, w := range s.dirty {
+		if w.delete {
+			b.Delete(key)
+		} else {
+			b.SetWithTimestamp(key, w.value, w.ts)
+		}
+	}
+	if s.hasOffset {
+		b.SetOffset(s.offset)
+	}
+	if err := WriteBatch(s.Storage, b); err != nil {
+		return err
+	}
+	s.dirty = make(map[string]dirtyWrite)
+	s.hasOffset = false
+	return nil
+}
+
+// Iterator flushes the writes and returns an iterator of the backing storage.
+func (s *cachedStorage) Iterator() (Iterator, error) {
+	if err := s.Flush(); err != nil {
+		return nil, err
+	}
+	return s.Storage.Iterator()
+}
+
+// IteratorWithRange flushes the writes and returns an iterator of the backing
+// storage.
+func (s *cachedStorage) IteratorWithRange(start, limit []byte) (Iterator, error) {
+	if err := s.Flush(); err != nil {
+		return nil, err
+	}
+	return s.Storage.IteratorWithRange(start, limit)
+}
+
+func (s *cachedStorage) MarkRecovered() error {
+	if err := s.Flush(); err != nil {
+		return err
+	}
+	return s.Storage.MarkRecovered()
+}
+
+// Open opens the backing storage and starts flushing periodically.
+func (s *cachedStorage) Open() error {
+	if err := s.Storage.Open(); err != nil {
+		return err
+	}
+	if s.opts.FlushInterval > 0 {
+		s.stop = make(chan struct{})
+		s.done.Add(1)
+		go s.flushPeriodically()
+	}
+	return nil
+}
+
+func (s *cachedStorage) flushPeriodically() {
+	defer s.done.Done()
+	ticker := time.NewTicker(s.opts.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			// failed flushes are retried in the next interval and by Close
+			_ = s.Flush()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// Close flushes the writes and closes the backing storage.
+func (s *cachedStorage) Close() error {
+	if s.stop != nil {
+		close(s.stop)
+		s.done.Wait()
+		s.stop = nil
+	}
+	err := s.Flush()
+	if cerr := s.Storage.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/facebookgo/ensure"
+)
+
+func TestCachedStorage(t *testing.T) {
+	backing := NewMemory()
+	ensure.Nil(t, backing.Set("key-1", []byte("value-1")))
+	ensure.Nil(t, backing.Set("key-2", []byte("value-2")))
+	st := NewCached(backing, CacheOptions{Size: 1, MaxDirty: 3})
+	ensure.Nil(t, st.Open())
+
+	// writes are kept in memory with the offset
+	ensure.Nil(t, st.Set("key-1", []byte("new")))
+	ensure.Nil(t, st.Delete("key-2"))
+	ensure.Nil(t, st.SetOffset(10))
+	for key, value := range map[string]string{"key-1": "new", "key-2": ""} {
+		v, err := st.Get(key)
+		ensure.Nil(t, err)
+		ensure.DeepEqual(t, string(v), value)
+	}
+	offset, err := st.GetOffset(-1)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, offset, int64(10))
+	value, err := backing.Get("key-1")
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, string(value), "value-1")
+	offset, err = backing.GetOffset(-1)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, offset, int64(-1))
+
+	// writes are flushed when MaxDirty keys are written
+	ensure.Nil(t, st.Set("key-3", []byte("value-3")))
+	value, err = backing.Get("key-1")
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, string(value), "new")
+	has, err := backing.Has("key-2")
+	ensure.Nil(t, err)
+	ensure.False(t, has)
+	offset, err = backing.GetOffset(-1)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, offset, int64(10))
+
+	// values read are cached
+	value, err = st.Get("key-3")
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, string(value), "value-3")
+	ensure.Nil(t, backing.Set("key-3", []byte("changed")))
+	value, err = st.Get("key-3")
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, string(value), "value-3")
+
+	// pending writes are flushed on close
+	ensure.Nil(t, st.Set("key-4", []byte("value-4")))
+	ensure.Nil(t, st.Close())
+	value, err = backing.Get("key-4")
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, string(value), "value-4")
+}
+
+func TestCachedStorage_writes(t *testing.T) {
+	backing := NewMemory()
+	ensure.Nil(t, backing.Set("key-1", []byte("value-1")))
+	st := NewCached(backing, CacheOptions{Size: 10, MaxDirty: 10})
+
+	// values are copied, so callers may reuse them
+	buf := []byte("value-2")
+	ensure.Nil(t, st.Set("key-2", buf))
+	copy(buf, "changed")
+	value, err := st.Get("key-2")
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, string(value), "value-2")
+
+	// empty values are set, not deleted
+	ensure.Nil(t, st.Set("key-1", nil))
+	has, err := st.Has("key-1")
+	ensure.Nil(t, err)
+	ensure.True(t, has)
+	ensure.Nil(t, st.Delete("key-2"))
+	has, err = st.Has("key-2")
+	ensure.Nil(t, err)
+	ensure.False(t, has)
+
+	ensure.Nil(t, st.(*cachedStorage).Flush())
+	has, err = backing.Has("key-1")
+	ensure.Nil(t, err)
+	ensure.True(t, has)
+	has, err = backing.Has("key-2")
+	ensure.Nil(t, err)
+	ensure.False(t, has)
+}
+
+func TestCachedStorage_timestamp(t *testing.T) {
+	now := time.Unix(1000, 0)
+	ttl := NewTTL(NewMemory(), time.Minute)
+	ttl.(*ttlStorage).now = func() time.Time { return now }
+	st := NewCached(ttl, CacheOptions{MaxDirty: 10})
+
+	// the timestamps are kept until the writes are flushed
+	ensure.Nil(t, SetWithTimestamp(st, "key-1", []byte("value-1"), now.Add(-2*time.Minute)))
+	b := new(Batch)
+	b.SetWithTimestamp("key-2", []byte("value-2"), now.Add(-2*time.Minute))
+	b.Set("key-3", []byte("value-3"))
+	ensure.Nil(t, WriteBatch(st, b))
+	ensure.Nil(t, st.(*cachedStorage).Flush())
+
+	for _, key := range []string{"key-1", "key-2"} {
+		has, err := ttl.Has(key)
+		ensure.Nil(t, err)
+		ensure.False(t, has)
+	}
+	value, err := ttl.Get("key-3")
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, value, []byte("value-3"))
+}
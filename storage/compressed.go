@@ -0,0 +1,187 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is the algorithm a compressed storage compresses values with.
+type Compression byte
+
+// The compression algorithms. The algorithm is stored with every value, so
+// the algorithm of a storage can be changed without rewriting its values.
+const (
+	CompressionNone Compression = iota
+	CompressionSnappy
+	CompressionZstd
+)
+
+func (c Compression) String() string {
+	switch c {
+	case CompressionNone:
+		return "none"
+	case CompressionSnappy:
+		return "snappy"
+	case CompressionZstd:
+		return "zstd"
+	}
+	return fmt.Sprintf("compression(%d)", byte(c))
+}
+
+// minCompressSize is the size below which values are stored uncompressed.
+const minCompressSize = 64
+
+type compressedStorage struct {
+	Storage
+	compression Compression
+	enc         *zstd.Encoder
+	dec         *zstd.Decoder
+}
+
+// NewCompressed wraps st so that values are compressed before they are
+// written to st. Each value is prefixed with its compression algorithm. Small
+// values and values that do not shrink are stored uncompressed.
+func NewCompressed(st Storage, compression Compression) (Storage, error) {
+	if compression > CompressionZstd {
+		return nil, fmt.Errorf("unknown compression %v", compression)
+	}
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating zstd encoder: %v", err)
+	}
+	dec, err := zstd.NewReader(nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating zstd decoder: %v", err)
+	}
+	return &compressedStorage{
+		Storage:     st,
+		compression: compression,
+		enc:         enc,
+		dec:         dec,
+	}, nil
+}
+
+// BuilderWithCompression wraps the storages built by builder with
+// NewCompressed.
+func BuilderWithCompression(builder Builder, compression Compression) Builder {
+	return func(topic string, partition int32) (Storage, error) {
+		st, err := builder(topic, partition)
+		if err != nil {
+			return nil, err
+		}
+		return NewCompressed(st, compression)
+	}
+}
+
+func (s *compressedStorage) compress(value []byte) []byte {
+	compression := s.compression
+	var data []byte
+	if len(value) >= minCompressSize {
+		switch compression {
+		case CompressionSnappy:
+			data = snappy.Encode(nil, value)
+		case CompressionZstd:
+			data = s.enc.EncodeAll(value, nil)
+		}
+	}
+	if data == nil || len(data) >= len(value) {
+		compression, data = CompressionNone, value
+	}
+	return append([]byte{byte(compression)}, data...)
+}
+
+func (s *compressedStorage) decompress(key string, data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("invalid compressed value of key %s", key)
+	}
+	var (
+		value []byte
+		err   error
+	)
+	switch c := Compression(data[0]); c {
+	case CompressionNone:
+		return data[1:], nil
+	case CompressionSnappy:
+		value, err = snappy.Decode(nil, data[1:])
+	case CompressionZstd:
+		value, err = s.dec.DecodeAll(data[1:], nil)
+	default:
+		return nil, fmt.Errorf("unknown compression %v of key %s", c, key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing value of key %s: %v", key, err)
+	}
+	return value, nil
+}
+
+func (s *compressedStorage) Get(key string) ([]byte, error) {
+	data, err := s.Storage.Get(key)
+	if err != nil || data == nil {
+		return nil, err
+	}
+	return s.decompress(key, data)
+}
+
+func (s *compressedStorage) Set(key string, value []byte) error {
+	return s.Storage.Set(key, s.compress(value))
+}
+
+func (s *compressedStorage) WriteBatch(b *Batch) error {
+	compressed := new(Batch)
+	_ = b.Replay(
+		func(key string, value []byte) error {
+			compressed.Set(key, s.compress(value))
+			return nil
+		},
+		func(key string) error {
+			compressed.Delete(key)
+			return nil
+		},
+	)
+	if offset, ok := b.Offset(); ok {
+		compressed.SetOffset(offset)
+	}
+	return WriteBatch(s.Storage, compressed)
+}
+
+func (s *compressedStorage) Unwrap() Storage {
+	return s.Storage
+}
+
+func (s *compressedStorage) Iterator() (Iterator, error) {
+	iter, err := s.Storage.Iterator()
+	if err != nil {
+		return nil, err
+	}
+	return &compressedIterator{Iterator: iter, s: s}, nil
+}
+
+func (s *compressedStorage) IteratorWithRange(start, limit []byte) (Iterator, error) {
+	iter, err := s.Storage.IteratorWithRange(start, limit)
+	if err != nil {
+		return nil, err
+	}
+	return &compressedIterator{Iterator: iter, s: s}, nil
+}
+
+func (s *compressedStorage) Close() error {
+	s.enc.Close()
+	s.dec.Close()
+	return s.Storage.Close()
+}
+
+// compressedIterator decompresses the values of the wrapped iterator.
+type compressedIterator struct {
+	Iterator
+	s *compressedStorage
+}
+
+func (i *compressedIterator) Value() ([]byte, error) {
+	data, err := i.Iterator.Value()
+	if err != nil || data == nil {
+		return nil, err
+	}
+	return i.s.decompress(string(i.Key()), data)
+}
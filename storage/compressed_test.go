@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/facebookgo/ensure"
+)
+
+func TestCompressedStorage(t *testing.T) {
+	plain := NewMemory()
+	large := bytes.Repeat([]byte(`{"field":"value"}`), 100)
+
+	snappySt, err := NewCompressed(plain, CompressionSnappy)
+	ensure.Nil(t, err)
+	ensure.Nil(t, snappySt.Set("small", []byte("value")))
+	ensure.Nil(t, snappySt.Set("snappy", large))
+
+	// values of other algorithms remain readable
+	st, err := NewCompressed(plain, CompressionZstd)
+	ensure.Nil(t, err)
+	b := new(Batch)
+	b.Set("zstd", large)
+	ensure.Nil(t, WriteBatch(st, b))
+
+	data, err := plain.Get("small")
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, data, append([]byte{byte(CompressionNone)}, "value"...))
+	for _, key := range []string{"snappy", "zstd"} {
+		data, err := plain.Get(key)
+		ensure.Nil(t, err)
+		ensure.True(t, len(data) < len(large))
+
+		value, err := st.Get(key)
+		ensure.Nil(t, err)
+		ensure.DeepEqual(t, value, large)
+	}
+	value, err := st.Get("small")
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, string(value), "value")
+
+	iter, err := st.IteratorWithRange([]byte("snappy"), []byte("zzz"))
+	ensure.Nil(t, err)
+	var n int
+	for iter.Next() {
+		value, err := iter.Value()
+		ensure.Nil(t, err)
+		ensure.DeepEqual(t, value, large)
+		n++
+	}
+	iter.Release()
+	ensure.DeepEqual(t, n, 2)
+
+	_, err = NewCompressed(plain, Compression(42))
+	ensure.StringContains(t, err.Error(), "unknown compression")
+}
@@ -0,0 +1,215 @@
+package storage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// KeyProvider provides the keys of an encrypted storage. Keys are identified
+// by IDs stored with the values, so keys can be rotated while values encrypted
+// with older keys remain readable.
+type KeyProvider interface {
+	// CurrentKey returns the key new values are encrypted with and its ID.
+	CurrentKey() (id uint32, key []byte, err error)
+	// Key returns the key with the given ID.
+	Key(id uint32) ([]byte, error)
+}
+
+type staticKey []byte
+
+// StaticKey returns a KeyProvider providing a single key with ID 0. The key
+// must be 16, 24 or 32 bytes long to select AES-128, AES-192 or AES-256.
+func StaticKey(key []byte) KeyProvider {
+	return staticKey(key)
+}
+
+func (k staticKey) CurrentKey() (uint32, []byte, error) {
+	return 0, k, nil
+}
+
+func (k staticKey) Key(id uint32) ([]byte, error) {
+	if id != 0 {
+		return nil, fmt.Errorf("unknown key %d", id)
+	}
+	return k, nil
+}
+
+type encryptedStorage struct {
+	Storage
+	keys KeyProvider
+
+	m     sync.Mutex
+	aeads map[uint32]cipher.AEAD
+}
+
+// NewEncrypted wraps st so that values are encrypted with AES-GCM before they
+// are written to st. Keys and offsets are stored in plain text, since the
+// storage has to keep them in order. The key of an entry is authenticated
+// with its value, so values cannot be moved to other keys unnoticed.
+func NewEncrypted(st Storage, keys KeyProvider) Storage {
+	return &encryptedStorage{
+		Storage: st,
+		keys:    keys,
+		aeads:   make(map[uint32]cipher.AEAD),
+	}
+}
+
+// BuilderWithEncryption wraps the storages built by builder with
+// NewEncrypted.
+func BuilderWithEncryption(builder Builder, keys KeyProvider) Builder {
+	return func(topic string, partition int32) (Storage, error) {
+		st, err := builder(topic, partition)
+		if err != nil {
+			return nil, err
+		}
+		return NewEncrypted(st, keys), nil
+	}
+}
+
+func (s *encryptedStorage) aead(id uint32, key []byte) (cipher.AEAD, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if aead, ok := s.aeads[id]; ok {
+		return aead, nil
+	}
+
+	var err error
+	if key == nil {
+		if key, err = s.keys.Key(id); err != nil {
+			return nil, fmt.Errorf("error getting key %d: %v", id, err)
+		}
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key %d: %v", id, err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	s.aeads[id] = aead
+	return aead, nil
+}
+
+// encrypt returns the ID of the key, the nonce and the sealed value.
+func (s *encryptedStorage) encrypt(key string, value []byte) ([]byte, error) {
+	id, k, err := s.keys.CurrentKey()
+	if err != nil {
+		return nil, fmt.Errorf("error getting current key: %v", err)
+	}
+	aead, err := s.aead(id, k)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, 4+aead.NonceSize(), 4+aead.NonceSize()+len(value)+aead.Overhead())
+	binary.BigEndian.PutUint32(data, id)
+	if _, err := io.ReadFull(rand.Reader, data[4:]); err != nil {
+		return nil, fmt.Errorf("error generating nonce: %v", err)
+	}
+	return aead.Seal(data, data[4:], value, []byte(key)), nil
+}
+
+func (s *encryptedStorage) decrypt(key string, data []byte) ([]byte, error) {
+	if len(data) < 4 {
+		return nil, fmt.Errorf("invalid encrypted value of key %s", key)
+	}
+	aead, err := s.aead(binary.BigEndian.Uint32(data), nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 4+aead.NonceSize() {
+		return nil, fmt.Errorf("invalid encrypted value of key %s", key)
+	}
+	nonce := data[4 : 4+aead.NonceSize()]
+	value, err := aead.Open(nil, nonce, data[4+aead.NonceSize():], []byte(key))
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting value of key %s: %v", key, err)
+	}
+	return value, nil
+}
+
+func (s *encryptedStorage) Get(key string) ([]byte, error) {
+	data, err := s.Storage.Get(key)
+	if err != nil || data == nil {
+		return nil, err
+	}
+	return s.decrypt(key, data)
+}
+
+func (s *encryptedStorage) Set(key string, value []byte) error {
+	data, err := s.encrypt(key, value)
+	if err != nil {
+		return err
+	}
+	return s.Storage.Set(key, data)
+}
+
+// SetWithTimestamp encrypts value and passes ts to the wrapped storage.
+func (s *encryptedStorage) SetWithTimestamp(key string, value []byte, ts time.Time) error {
+	data, err := s.encrypt(key, value)
+	if err != nil {
+		return err
+	}
+	return SetWithTimestamp(s.Storage, key, data, ts)
+}
+
+// WriteBatch encrypts the values of the batch, keeping their timestamps.
+func (s *encryptedStorage) WriteBatch(b *Batch) error {
+	encrypted := new(Batch)
+	for _, u := range b.updates {
+		if u.delete {
+			encrypted.Delete(u.key)
+			continue
+		}
+		data, err := s.encrypt(u.key, u.value)
+		if err != nil {
+			return err
+		}
+		encrypted.SetWithTimestamp(u.key, data, u.ts)
+	}
+	if offset, ok := b.Offset(); ok {
+		encrypted.SetOffset(offset)
+	}
+	return WriteBatch(s.Storage, encrypted)
+}
+
+func (s *encryptedStorage) Unwrap() Storage {
+	return s.Storage
+}
+
+func (s *encryptedStorage) Iterator() (Iterator, error) {
+	iter, err := s.Storage.Iterator()
+	if err != nil {
+		return nil, err
+	}
+	return &encryptedIterator{Iterator: iter, s: s}, nil
+}
+
+func (s *encryptedStorage) IteratorWithRange(start, limit []byte) (Iterator, error) {
+	iter, err := s.Storage.IteratorWithRange(start, limit)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptedIterator{Iterator: iter, s: s}, nil
+}
+
+// encryptedIterator decrypts the values of the wrapped iterator.
+type encryptedIterator struct {
+	Iterator
+	s *encryptedStorage
+}
+
+func (i *encryptedIterator) Value() ([]byte, error) {
+	data, err := i.Iterator.Value()
+	if err != nil || data == nil {
+		return nil, err
+	}
+	return i.s.decrypt(string(i.Key()), data)
+}
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/facebookgo/ensure"
+)
+
+type rotatingKeys struct {
+	current uint32
+	keys    map[uint32][]byte
+}
+
+func (k *rotatingKeys) CurrentKey() (uint32, []byte, error) {
+	return k.current, k.keys[k.current], nil
+}
+
+func (k *rotatingKeys) Key(id uint32) ([]byte, error) {
+	key, ok := k.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %d", id)
+	}
+	return key, nil
+}
+
+func TestEncryptedStorage(t *testing.T) {
+	plain := NewMemory()
+	keys := &rotatingKeys{keys: map[uint32][]byte{
+		0: bytes.Repeat([]byte{1}, 32),
+		1: bytes.Repeat([]byte{2}, 16),
+	}}
+	st := NewEncrypted(plain, keys)
+
+	ensure.Nil(t, st.Set("key-1", []byte("value-1")))
+	data, err := plain.Get("key-1")
+	ensure.Nil(t, err)
+	ensure.False(t, bytes.Contains(data, []byte("value-1")))
+
+	// values encrypted with older keys remain readable
+	keys.current = 1
+	b := new(Batch)
+	b.Set("key-2", []byte("value-2"))
+	ensure.Nil(t, WriteBatch(st, b))
+
+	for _, key := range []string{"key-1", "key-2"} {
+		value, err := st.Get(key)
+		ensure.Nil(t, err)
+		ensure.DeepEqual(t, string(value), "value"+key[3:])
+	}
+	value, err := st.Get("key-3")
+	ensure.Nil(t, err)
+	ensure.True(t, value == nil)
+
+	iter, err := st.Iterator()
+	ensure.Nil(t, err)
+	var n int
+	for iter.Next() {
+		value, err := iter.Value()
+		ensure.Nil(t, err)
+		ensure.DeepEqual(t, string(value), "value"+string(iter.Key())[3:])
+		n++
+	}
+	iter.Release()
+	ensure.DeepEqual(t, n, 2)
+
+	// values moved to another key are rejected
+	ensure.Nil(t, plain.Set("key-3", data))
+	_, err = st.Get("key-3")
+	ensure.StringContains(t, err.Error(), "error decrypting")
+
+	// values written with unknown keys are rejected
+	_, err = NewEncrypted(plain, StaticKey(bytes.Repeat([]byte{1}, 32))).Get("key-2")
+	ensure.StringContains(t, err.Error(), "unknown key 1")
+}
+
+func TestEncryptedStorage_timestamp(t *testing.T) {
+	now := time.Unix(1000, 0)
+	ttl := NewTTL(NewMemory(), time.Minute)
+	ttl.(*ttlStorage).now = func() time.Time { return now }
+	st := NewEncrypted(ttl, StaticKey(bytes.Repeat([]byte{1}, 32)))
+
+	// the timestamps are passed to the wrapped storage
+	ensure.Nil(t, SetWithTimestamp(st, "key-1", []byte("value-1"), now.Add(-2*time.Minute)))
+	b := new(Batch)
+	b.SetWithTimestamp("key-2", []byte("value-2"), now.Add(-2*time.Minute))
+	b.Set("key-3", []byte("value-3"))
+	ensure.Nil(t, WriteBatch(st, b))
+
+	for _, key := range []string{"key-1", "key-2"} {
+		has, err := st.Has(key)
+		ensure.Nil(t, err)
+		ensure.False(t, has)
+	}
+	value, err := st.Get("key-3")
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, value, []byte("value-3"))
+}
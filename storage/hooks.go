@@ -0,0 +1,127 @@
+package storage
+
+import "sync"
+
+// SetHook is called after key of a partition of topic was set to value.
+type SetHook func(topic string, partition int32, key string, value []byte) error
+
+// DeleteHook is called after key of a partition of topic was deleted.
+type DeleteHook func(topic string, partition int32, key string) error
+
+// Hooks are the hooks called by hooked storages, eg, to maintain an external
+// search index in lock-step with the tables. Hooks can be registered while
+// the storages are in use.
+type Hooks struct {
+	m        sync.RWMutex
+	onSet    []SetHook
+	onDelete []DeleteHook
+}
+
+// NewHooks creates an empty set of hooks.
+func NewHooks() *Hooks {
+	return new(Hooks)
+}
+
+// OnSet registers a hook called after every Set, including the sets of
+// batches.
+func (h *Hooks) OnSet(hook SetHook) {
+	h.m.Lock()
+	defer h.m.Unlock()
+	h.onSet = append(h.onSet, hook)
+}
+
+// OnDelete registers a hook called after every Delete, including the deletes
+// of batches.
+func (h *Hooks) OnDelete(hook DeleteHook) {
+	h.m.Lock()
+	defer h.m.Unlock()
+	h.onDelete = append(h.onDelete, hook)
+}
+
+func (h *Hooks) set(topic string, partition int32, key string, value []byte) error {
+	h.m.RLock()
+	defer h.m.RUnlock()
+	for _, hook := range h.onSet {
+		if err := hook(topic, partition, key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *Hooks) delete(topic string, partition int32, key string) error {
+	h.m.RLock()
+	defer h.m.RUnlock()
+	for _, hook := range h.onDelete {
+		if err := hook(topic, partition, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type hookedStorage struct {
+	Storage
+	topic     string
+	partition int32
+	hooks     *Hooks
+}
+
+// NewHooked wraps st, the storage of a partition of topic, so that hooks are
+// called after each successful mutation. An error of a hook is returned by
+// the mutation, although the mutation has already been written to st.
+func NewHooked(st Storage, topic string, partition int32, hooks *Hooks) Storage {
+	return &hookedStorage{
+		Storage:   st,
+		topic:     topic,
+		partition: partition,
+		hooks:     hooks,
+	}
+}
+
+// BuilderWithHooks wraps the storages built by builder with NewHooked.
+func BuilderWithHooks(builder Builder, hooks *Hooks) Builder {
+	return func(topic string, partition int32) (Storage, error) {
+		st, err := builder(topic, partition)
+		if err != nil {
+			return nil, err
+		}
+		return NewHooked(st, topic, partition, hooks), nil
+	}
+}
+
+func (s *hookedStorage) Set(key string, value []byte) error {
+	if err := s.Storage.Set(key, value); err != nil {
+		return err
+	}
+	return s.hooks.set(s.topic, s.partition, key, value)
+}
+
+func (s *hookedStorage) Delete(key string) error {
+	if err := s.Storage.Delete(key); err != nil {
+		return err
+	}
+	return s.hooks.delete(s.topic, s.partition, key)
+}
+
+func (s *hookedStorage) WriteBatch(b *Batch) error {
+	if err := WriteBatch(s.Storage, b); err != nil {
+		return err
+	}
+	return b.Replay(
+		func(key string, value []byte) error {
+			return s.hooks.set(s.topic, s.partition, key, value)
+		},
+		func(key string) error {
+			return s.hooks.delete(s.topic, s.partition, key)
+		},
+	)
+}
+
+func (s *hookedStorage) Unwrap() Storage {
+	return s.Storage
+}
+
+func (s *hookedStorage) GetFunc(key string, fn func(value []byte) error) error {
+	return GetFunc(s.Storage, key, fn)
+}
@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/facebookgo/ensure"
+)
+
+func TestHookedStorage(t *testing.T) {
+	var events []string
+	hooks := NewHooks()
+	hooks.OnSet(func(topic string, partition int32, key string, value []byte) error {
+		events = append(events, fmt.Sprintf("set %s/%d %s=%s", topic, partition, key, value))
+		return nil
+	})
+	hooks.OnDelete(func(topic string, partition int32, key string) error {
+		events = append(events, fmt.Sprintf("delete %s/%d %s", topic, partition, key))
+		return nil
+	})
+
+	st, err := BuilderWithHooks(MemoryBuilder(), hooks)("topic", 1)
+	ensure.Nil(t, err)
+	ensure.Nil(t, st.Set("a", []byte("1")))
+	ensure.Nil(t, st.Delete("a"))
+	b := new(Batch)
+	b.Set("b", []byte("2"))
+	b.Delete("c")
+	b.SetOffset(3)
+	ensure.Nil(t, WriteBatch(st, b))
+	ensure.Nil(t, st.SetOffset(4))
+
+	ensure.DeepEqual(t, events, []string{
+		"set topic/1 a=1",
+		"delete topic/1 a",
+		"set topic/1 b=2",
+		"delete topic/1 c",
+	})
+
+	// errors of hooks are returned after the mutation is written
+	hooks.OnSet(func(topic string, partition int32, key string, value []byte) error {
+		return errors.New("index unavailable")
+	})
+	err = st.Set("d", []byte("4"))
+	ensure.StringContains(t, err.Error(), "index unavailable")
+	value, err := st.Get("d")
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, string(value), "4")
+}
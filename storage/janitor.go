@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/lovoo/goka/logger"
+)
+
+// partitionDir matches the directories of partitions created by the LevelDB
+// builders and their quarantined copies (see openLevelDB). The first group is
+// the topic.
+var partitionDir = regexp.MustCompile(`^(.+)\.\d+(\.corrupted-\d+)?$`)
+
+// Janitor removes the directories of partitions that are no longer used by
+// this instance, eg, after their partitions were assigned to other instances
+// in a rebalance. A directory is removed once none of the storages built by the
+// builder of the janitor used it for the grace period, so the grace period
+// should be longer than the time partitions are usually moved back and forth.
+// Quarantined copies of corrupted partitions are removed after the grace
+// period as well.
+//
+// Only the directories of topics the builder of the janitor built storages for
+// or registered with Register are removed, so other directories in the path
+// are left alone.
+type Janitor struct {
+	path  string
+	grace time.Duration
+	log   logger.Logger
+
+	m      sync.Mutex
+	topics map[string]bool
+	inUse  map[string]int
+	unused map[string]time.Time
+}
+
+// NewJanitor creates a janitor for the partition directories in path, which
+// has to be the path of the builder passed to Builder.
+func NewJanitor(path string, grace time.Duration) *Janitor {
+	return &Janitor{
+		path:   path,
+		grace:  grace,
+		log:    logger.Default(),
+		topics: make(map[string]bool),
+		inUse:  make(map[string]int),
+		unused: make(map[string]time.Time),
+	}
+}
+
+// Builder wraps builder so that the janitor keeps the directories of the
+// storages built by it until the storages are closed.
+func (j *Janitor) Builder(builder Builder) Builder {
+	return func(topic string, partition int32) (Storage, error) {
+		dir := fmt.Sprintf("%s.%d", topic, partition)
+		j.Register(topic)
+		j.acquire(dir)
+		st, err := builder(topic, partition)
+		if err != nil {
+			j.release(dir)
+			return nil, err
+		}
+		return &janitoredStorage{Storage: st, janitor: j, dir: dir}, nil
+	}
+}
+
+// Register registers topics whose partition directories are removed once
+// unused, eg, the tables of processors that no longer run on this instance.
+// The topics of the storages built by the builder of the janitor are
+// registered automatically.
+func (j *Janitor) Register(topics ...string) {
+	j.m.Lock()
+	defer j.m.Unlock()
+	for _, topic := range topics {
+		j.topics[topic] = true
+	}
+}
+
+func (j *Janitor) acquire(dir string) {
+	j.m.Lock()
+	defer j.m.Unlock()
+	j.inUse[dir]++
+	delete(j.unused, dir)
+}
+
+func (j *Janitor) release(dir string) {
+	j.m.Lock()
+	defer j.m.Unlock()
+	if j.inUse[dir]--; j.inUse[dir] <= 0 {
+		delete(j.inUse, dir)
+	}
+}
+
+// Run removes unused partition directories every interval until ctx is done.
+func (j *Janitor) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			if _, err := j.clean(now); err != nil {
+				j.log.Printf("storage janitor: %v", err)
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// clean removes the partition directories unused for the grace period and
+// returns their names.
+func (j *Janitor) clean(now time.Time) ([]string, error) {
+	files, err := ioutil.ReadDir(j.path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", j.path, err)
+	}
+
+	j.m.Lock()
+	defer j.m.Unlock()
+
+	var removed []string
+	for _, f := range files {
+		dir := f.Name()
+		if !f.IsDir() || j.inUse[dir] > 0 {
+			continue
+		}
+		if m := partitionDir.FindStringSubmatch(dir); m == nil || !j.topics[m[1]] {
+			continue
+		}
+		since, ok := j.unused[dir]
+		if !ok {
+			j.unused[dir] = now
+			continue
+		}
+		if now.Sub(since) < j.grace {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(j.path, dir)); err != nil {
+			return removed, fmt.Errorf("error removing %s: %v", dir, err)
+		}
+		delete(j.unused, dir)
+		removed = append(removed, dir)
+		j.log.Printf("storage janitor: removed %s, unused since %v", dir, since)
+	}
+	return removed, nil
+}
+
+// janitoredStorage releases its directory when it is closed.
+type janitoredStorage struct {
+	Storage
+	janitor *Janitor
+	dir     string
+	once    sync.Once
+}
+
+func (s *janitoredStorage) Close() error {
+	err := s.Storage.Close()
+	s.once.Do(func() { s.janitor.release(s.dir) })
+	return err
+}
+
+// WriteBatch writes the batch natively if the wrapped storage supports it.
+func (s *janitoredStorage) WriteBatch(b *Batch) error {
+	return WriteBatch(s.Storage, b)
+}
+
+func (s *janitoredStorage) Unwrap() Storage {
+	return s.Storage
+}
+
+func (s *janitoredStorage) GetFunc(key string, fn func(value []byte) error) error {
+	return GetFunc(s.Storage, key, fn)
+}
@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/facebookgo/ensure"
+)
+
+func TestJanitor(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "goka_storage_TestJanitor")
+	ensure.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+	for _, dir := range []string{"topic.0", "topic.1", "other"} {
+		ensure.Nil(t, os.MkdirAll(filepath.Join(tmpdir, dir), os.ModePerm))
+	}
+
+	j := NewJanitor(tmpdir, time.Minute)
+	st, err := j.Builder(MemoryBuilder())("topic", 0)
+	ensure.Nil(t, err)
+
+	now := time.Now()
+	removed, err := j.clean(now)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, len(removed), 0)
+
+	// unused directories are removed after the grace period
+	removed, err = j.clean(now.Add(30 * time.Second))
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, len(removed), 0)
+	removed, err = j.clean(now.Add(time.Minute))
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, removed, []string{"topic.1"})
+
+	// directories of closed storages are removed as well
+	ensure.Nil(t, st.Close())
+	_, err = j.clean(now.Add(2 * time.Minute))
+	ensure.Nil(t, err)
+	removed, err = j.clean(now.Add(3 * time.Minute))
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, removed, []string{"topic.0"})
+
+	_, err = os.Stat(filepath.Join(tmpdir, "other"))
+	ensure.Nil(t, err)
+}
+
+func TestJanitor_topics(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "goka_storage_TestJanitor_topics")
+	ensure.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+	for _, dir := range []string{"topic.1", "topic.1.corrupted-123", "registered.2", "unknown.0", "unknown.0.corrupted-123"} {
+		ensure.Nil(t, os.MkdirAll(filepath.Join(tmpdir, dir), os.ModePerm))
+	}
+
+	j := NewJanitor(tmpdir, time.Minute)
+	st, err := j.Builder(MemoryBuilder())("topic", 0)
+	ensure.Nil(t, err)
+	defer st.Close()
+	j.Register("registered")
+
+	// only the directories of built or registered topics are removed,
+	// including their quarantined copies
+	now := time.Now()
+	_, err = j.clean(now)
+	ensure.Nil(t, err)
+	removed, err := j.clean(now.Add(time.Minute))
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, removed, []string{"registered.2", "topic.1", "topic.1.corrupted-123"})
+
+	for _, dir := range []string{"unknown.0", "unknown.0.corrupted-123"} {
+		_, err = os.Stat(filepath.Join(tmpdir, dir))
+		ensure.Nil(t, err)
+	}
+}
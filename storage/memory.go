@@ -3,6 +3,8 @@ package storage
 import (
 	"bytes"
 	"fmt"
+	"io"
+	"sort"
 	"strings"
 
 	"github.com/syndtr/goleveldb/leveldb/util"
@@ -99,11 +101,51 @@ func (m *memory) Delete(key string) error {
 	return nil
 }
 
+func (m *memory) WriteBatch(b *Batch) error {
+	if err := b.Replay(m.Set, m.Delete); err != nil {
+		return err
+	}
+	if offset, ok := b.Offset(); ok {
+		return m.SetOffset(offset)
+	}
+	return nil
+}
+
+// Stats returns the number of keys and the size of the keys and values.
+func (m *memory) Stats() (*Stats, error) {
+	stats := new(Stats)
+	for k, v := range m.storage {
+		if k == offsetKey {
+			continue
+		}
+		stats.Keys++
+		stats.Bytes += int64(len(k) + len(v))
+	}
+	return stats, nil
+}
+
+// Snapshot writes the keys, values and offset of the storage to w.
+func (m *memory) Snapshot(w io.Writer) error {
+	iter, err := m.Iterator()
+	if err != nil {
+		return err
+	}
+	defer iter.Release()
+	offset, _ := m.GetOffset(noOffset)
+	return writeSnapshot(w, offset, iter)
+}
+
+// Restore loads a snapshot into the storage, which must be empty.
+func (m *memory) Restore(r io.Reader) error {
+	return restoreSnapshot(m, r)
+}
+
 func (m *memory) Iterator() (Iterator, error) {
 	keys := make([]string, 0, len(m.storage))
 	for k := range m.storage {
 		keys = append(keys, k)
 	}
+	sort.Strings(keys)
 
 	return &memiter{-1, keys, m.storage}, nil
 }
@@ -114,10 +156,13 @@ func (m *memory) IteratorWithRange(start, limit []byte) (Iterator, error) {
 		limit = util.BytesPrefix(start).Limit
 	}
 	for k := range m.storage {
-		if bytes.Compare([]byte(k), start) > -1 && bytes.Compare([]byte(k), limit) < 1 {
+		// the limit is exclusive like in leveldb. An empty limit leaves the
+		// range unbounded, eg, for an empty prefix.
+		if bytes.Compare([]byte(k), start) > -1 && (len(limit) == 0 || bytes.Compare([]byte(k), limit) < 0) {
 			keys = append(keys, k)
 		}
 	}
+	sort.Strings(keys)
 
 	return &memiter{-1, keys, m.storage}, nil
 }
@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// MergeFunc returns the result of merging delta into value, the current value
+// of key. The value is nil if the key does not exist.
+type MergeFunc func(key string, value, delta []byte) ([]byte, error)
+
+// Merger is implemented by storages that merge deltas into the values of
+// keys without the caller reading and writing the whole value.
+type Merger interface {
+	// Merge merges delta into the value of key.
+	Merge(key string, delta []byte) error
+}
+
+// MergeAppend is a MergeFunc appending delta to value, eg, for list-like
+// values.
+func MergeAppend(key string, value, delta []byte) ([]byte, error) {
+	merged := make([]byte, 0, len(value)+len(delta))
+	return append(append(merged, value...), delta...), nil
+}
+
+// MergeInt64 is a MergeFunc adding delta to value, both encoded like
+// codec.Int64, eg, for counters.
+func MergeInt64(key string, value, delta []byte) ([]byte, error) {
+	d, err := strconv.ParseInt(string(delta), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid delta of key %s: %v", key, err)
+	}
+	var v int64
+	if value != nil {
+		if v, err = strconv.ParseInt(string(value), 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid value of key %s: %v", key, err)
+		}
+	}
+	return []byte(strconv.FormatInt(v+d, 10)), nil
+}
+
+type mergingStorage struct {
+	Storage
+	merge MergeFunc
+	m     sync.Mutex
+}
+
+// NewMerging wraps st so that it implements Merger by reading the value of
+// the key, merging the delta with merge and writing the result. Concurrent
+// merges are serialized, but a Set concurrent to a Merge of the same key may
+// be overwritten by the Merge.
+func NewMerging(st Storage, merge MergeFunc) Storage {
+	return &mergingStorage{Storage: st, merge: merge}
+}
+
+func (s *mergingStorage) Merge(key string, delta []byte) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	value, err := s.Storage.Get(key)
+	if err != nil {
+		return err
+	}
+	merged, err := s.merge(key, value, delta)
+	if err != nil {
+		return fmt.Errorf("error merging key %s: %v", key, err)
+	}
+	return s.Storage.Set(key, merged)
+}
+
+// WriteBatch writes the batch natively if the wrapped storage supports it.
+func (s *mergingStorage) WriteBatch(b *Batch) error {
+	return WriteBatch(s.Storage, b)
+}
+
+func (s *mergingStorage) Unwrap() Storage {
+	return s.Storage
+}
+
+func (s *mergingStorage) GetFunc(key string, fn func(value []byte) error) error {
+	return GetFunc(s.Storage, key, fn)
+}
@@ -0,0 +1,90 @@
+package storage
+
+import "bytes"
+
+// mergeIterator merges sorted iterators into one iterator that returns the
+// keys of all iterators in ascending order.
+type mergeIterator struct {
+	iters   []Iterator
+	valid   []bool
+	current int
+	started bool
+}
+
+// NewMergeIterator returns an iterator that iterates over the keys of the given
+// iterators in ascending order. Each of the iterators must return its keys in
+// ascending order.
+func NewMergeIterator(iters []Iterator) Iterator {
+	if len(iters) == 0 {
+		return &NullIter{}
+	}
+
+	return &mergeIterator{
+		iters:   iters,
+		valid:   make([]bool, len(iters)),
+		current: -1,
+	}
+}
+
+// pick selects the iterator with the smallest current key.
+func (m *mergeIterator) pick() bool {
+	m.current = -1
+	for i, iter := range m.iters {
+		if !m.valid[i] {
+			continue
+		}
+		if m.current < 0 || bytes.Compare(iter.Key(), m.iters[m.current].Key()) < 0 {
+			m.current = i
+		}
+	}
+	return m.current >= 0
+}
+
+func (m *mergeIterator) Next() bool {
+	if !m.started {
+		m.started = true
+		for i, iter := range m.iters {
+			m.valid[i] = iter.Next()
+		}
+	} else if m.current >= 0 {
+		m.valid[m.current] = m.iters[m.current].Next()
+	}
+	return m.pick()
+}
+
+func (m *mergeIterator) Key() []byte {
+	if m.current < 0 {
+		return nil
+	}
+	return m.iters[m.current].Key()
+}
+
+func (m *mergeIterator) Value() ([]byte, error) {
+	if m.current < 0 {
+		return nil, nil
+	}
+	return m.iters[m.current].Value()
+}
+
+func (m *mergeIterator) Release() {
+	for i := range m.iters {
+		m.iters[i].Release()
+	}
+	m.current = -1
+	m.iters = nil
+	m.valid = nil
+}
+
+// Seek seeks all iterators to key. Like the multi iterator, the merged keys
+// are returned by the following calls to Next.
+func (m *mergeIterator) Seek(key []byte) bool {
+	ok := false
+	for _, iter := range m.iters {
+		if iter.Seek(key) {
+			ok = true
+		}
+	}
+	m.started = false
+	m.current = -1
+	return ok
+}
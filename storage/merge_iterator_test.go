@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/facebookgo/ensure"
+)
+
+func TestMergeIterator(t *testing.T) {
+	var (
+		numStorages = 3
+		numValues   = 4
+		storages    = make([]Storage, numStorages)
+	)
+
+	for i := range storages {
+		storages[i] = NewMemory()
+	}
+
+	// keys are distributed in round robin over the storages
+	for i := 0; i < numStorages*numValues; i++ {
+		key := fmt.Sprintf("key-%02d", i)
+		storages[i%numStorages].Set(key, []byte(fmt.Sprintf("value-%02d", i)))
+	}
+
+	iters := make([]Iterator, len(storages))
+	for i := range storages {
+		iter, err := storages[i].IteratorWithRange([]byte("key-"), nil)
+		ensure.Nil(t, err)
+		iters[i] = iter
+	}
+
+	iter := NewMergeIterator(iters)
+	defer iter.Release()
+	count := 0
+	for iter.Next() {
+		ensure.DeepEqual(t, string(iter.Key()), fmt.Sprintf("key-%02d", count))
+		val, err := iter.Value()
+		ensure.Nil(t, err)
+		ensure.DeepEqual(t, string(val), fmt.Sprintf("value-%02d", count))
+		count++
+	}
+	ensure.DeepEqual(t, count, numStorages*numValues)
+	ensure.True(t, iter.Key() == nil)
+}
+
+func TestMergeIteratorEmpty(t *testing.T) {
+	iter := NewMergeIterator(nil)
+	ensure.False(t, iter.Next())
+
+	iter = NewMergeIterator([]Iterator{&NullIter{}, &NullIter{}})
+	ensure.False(t, iter.Next())
+	ensure.True(t, iter.Key() == nil)
+}
@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/facebookgo/ensure"
+)
+
+func TestMergingStorage(t *testing.T) {
+	st := NewMerging(NewMemory(), MergeInt64)
+	merger, ok := st.(Merger)
+	ensure.True(t, ok)
+	// batches are still written natively and stats are still provided
+	_, ok = st.(Batcher)
+	ensure.True(t, ok)
+	_, ok = Lookup[StatsProvider](st)
+	ensure.True(t, ok)
+
+	ensure.Nil(t, merger.Merge("counter", []byte("2")))
+	ensure.Nil(t, merger.Merge("counter", []byte("-5")))
+	value, err := st.Get("counter")
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, string(value), "-3")
+
+	err = merger.Merge("counter", []byte("x"))
+	ensure.StringContains(t, err.Error(), "invalid delta")
+
+	st = NewMerging(NewMemory(), MergeAppend)
+	ensure.Nil(t, st.(Merger).Merge("list", []byte("a")))
+	ensure.Nil(t, st.(Merger).Merge("list", []byte("b")))
+	value, err = st.Get("list")
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, string(value), "ab")
+}
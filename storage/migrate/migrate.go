@@ -0,0 +1,138 @@
+// Package migrate copies the state of table partitions between storages, eg,
+// to switch a processor from LevelDB to Pebble without recovering its tables
+// from Kafka.
+package migrate
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/lovoo/goka/storage"
+)
+
+const (
+	// batchSize is the number of keys copied at once
+	batchSize = 1000
+
+	// noOffset denotes a storage without offset
+	noOffset = math.MinInt64
+)
+
+// Copy copies the keys, values and offset of src into dst, which must be
+// empty. The offset is written with the last batch of values, so that an
+// interrupted copy leaves dst without offset and the partition is recovered
+// from Kafka. Both storages must be open. Copy marks dst as recovered and
+// returns the number of keys copied.
+func Copy(dst, src storage.Storage) (int, error) {
+	if err := ensureEmpty(dst); err != nil {
+		return 0, err
+	}
+
+	offset, err := src.GetOffset(noOffset)
+	if err != nil {
+		return 0, fmt.Errorf("error reading offset of source: %v", err)
+	}
+	iter, err := src.Iterator()
+	if err != nil {
+		return 0, fmt.Errorf("error opening iterator of source: %v", err)
+	}
+	defer iter.Release()
+
+	var (
+		b = new(storage.Batch)
+		n int
+	)
+	for iter.Next() {
+		value, err := iter.Value()
+		if err != nil {
+			return n, fmt.Errorf("error reading value of key %s: %v", iter.Key(), err)
+		}
+		// iterators may reuse the key and value slices
+		b.Set(string(iter.Key()), append([]byte(nil), value...))
+		if b.Len() >= batchSize {
+			if err := storage.WriteBatch(dst, b); err != nil {
+				return n, fmt.Errorf("error writing batch: %v", err)
+			}
+			n += b.Len()
+			b.Reset()
+		}
+	}
+
+	if offset != noOffset {
+		b.SetOffset(offset)
+	}
+	if err := storage.WriteBatch(dst, b); err != nil {
+		return n, fmt.Errorf("error writing batch: %v", err)
+	}
+	n += b.Len()
+
+	if err := dst.MarkRecovered(); err != nil {
+		return n, fmt.Errorf("error marking destination recovered: %v", err)
+	}
+	return n, nil
+}
+
+func ensureEmpty(st storage.Storage) error {
+	if offset, err := st.GetOffset(noOffset); err != nil {
+		return fmt.Errorf("error reading offset of destination: %v", err)
+	} else if offset != noOffset {
+		return fmt.Errorf("destination has offset %d", offset)
+	}
+	iter, err := st.Iterator()
+	if err != nil {
+		return fmt.Errorf("error opening iterator of destination: %v", err)
+	}
+	defer iter.Release()
+	if iter.Next() {
+		return fmt.Errorf("destination is not empty")
+	}
+	return nil
+}
+
+// Partitions copies the partitions of topic from the storages built by from
+// into the storages built by to. The storages are opened and closed by
+// Partitions, so the processors or views using them must not be running.
+func Partitions(topic string, partitions []int32, to, from storage.Builder) error {
+	for _, partition := range partitions {
+		if err := copyPartition(topic, partition, to, from); err != nil {
+			return fmt.Errorf("error migrating partition %d of %s: %v", partition, topic, err)
+		}
+	}
+	return nil
+}
+
+func copyPartition(topic string, partition int32, to, from storage.Builder) (rerr error) {
+	src, err := open(from, topic, partition)
+	if err != nil {
+		return fmt.Errorf("error opening source: %v", err)
+	}
+	defer func() {
+		if err := src.Close(); err != nil && rerr == nil {
+			rerr = fmt.Errorf("error closing source: %v", err)
+		}
+	}()
+
+	dst, err := open(to, topic, partition)
+	if err != nil {
+		return fmt.Errorf("error opening destination: %v", err)
+	}
+	defer func() {
+		if err := dst.Close(); err != nil && rerr == nil {
+			rerr = fmt.Errorf("error closing destination: %v", err)
+		}
+	}()
+
+	_, err = Copy(dst, src)
+	return err
+}
+
+func open(builder storage.Builder, topic string, partition int32) (storage.Storage, error) {
+	st, err := builder(topic, partition)
+	if err != nil {
+		return nil, err
+	}
+	if err := st.Open(); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
@@ -0,0 +1,64 @@
+package migrate
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/lovoo/goka/storage"
+
+	"github.com/facebookgo/ensure"
+)
+
+func TestCopy(t *testing.T) {
+	src := storage.NewMemory()
+	for i := 0; i < 2*batchSize+1; i++ {
+		ensure.Nil(t, src.Set(fmt.Sprintf("key-%d", i), []byte(fmt.Sprintf("value-%d", i))))
+	}
+	ensure.Nil(t, src.SetOffset(123))
+
+	dst := storage.NewMemory()
+	n, err := Copy(dst, src)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, n, 2*batchSize+1)
+
+	offset, err := dst.GetOffset(-1)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, offset, int64(123))
+	value, err := dst.Get("key-42")
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, string(value), "value-42")
+
+	// the destination must be empty
+	_, err = Copy(dst, src)
+	ensure.StringContains(t, err.Error(), "destination has offset 123")
+}
+
+func TestPartitions(t *testing.T) {
+	var (
+		from = make(map[int32]storage.Storage)
+		to   = make(map[int32]storage.Storage)
+	)
+	builder := func(m map[int32]storage.Storage) storage.Builder {
+		return func(topic string, partition int32) (storage.Storage, error) {
+			if _, ok := m[partition]; !ok {
+				m[partition] = storage.NewMemory()
+			}
+			return m[partition], nil
+		}
+	}
+	for _, p := range []int32{0, 1} {
+		st, _ := builder(from)("topic", p)
+		ensure.Nil(t, st.Set("key", []byte(fmt.Sprint(p))))
+		ensure.Nil(t, st.SetOffset(int64(p)))
+	}
+
+	ensure.Nil(t, Partitions("topic", []int32{0, 1}, builder(to), builder(from)))
+	for _, p := range []int32{0, 1} {
+		value, err := to[p].Get("key")
+		ensure.Nil(t, err)
+		ensure.DeepEqual(t, string(value), fmt.Sprint(p))
+		offset, err := to[p].GetOffset(-1)
+		ensure.Nil(t, err)
+		ensure.DeepEqual(t, offset, int64(p))
+	}
+}
@@ -41,6 +41,11 @@ func (n *Null) Delete(string) error {
 	return nil
 }
 
+// WriteBatch does nothing and doesn't error.
+func (n *Null) WriteBatch(*Batch) error {
+	return nil
+}
+
 // GetOffset returns the default offset given to it.
 func (n *Null) GetOffset(def int64) (int64, error) {
 	return def, nil
@@ -71,6 +76,11 @@ func (n *Null) Close() error {
 	return nil
 }
 
+// Stats returns empty stats.
+func (n *Null) Stats() (*Stats, error) {
+	return new(Stats), nil
+}
+
 // NullIter is an iterator which is immediately exhausted.
 type NullIter struct{}
 
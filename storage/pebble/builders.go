@@ -0,0 +1,41 @@
+package pebble
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/lovoo/goka/storage"
+
+	pebble "github.com/cockroachdb/pebble"
+)
+
+// DefaultBuilder builds a Pebble storage with default configuration. The
+// databases are stored in the given path.
+func DefaultBuilder(path string) storage.Builder {
+	return BuilderWithOptions(path, nil)
+}
+
+// BuilderWithOptions builds Pebble storages with the given options in the
+// given path.
+func BuilderWithOptions(path string, opts *pebble.Options) storage.Builder {
+	return func(topic string, partition int32) (storage.Storage, error) {
+		fp := filepath.Join(path, fmt.Sprintf("%s.%d", topic, partition))
+		db, err := pebble.Open(fp, opts)
+		if err != nil {
+			return nil, fmt.Errorf("error opening pebble: %v", err)
+		}
+		return New(db)
+	}
+}
+
+// SharedBuilder builds the storages of all partitions in a single Pebble
+// database in path (see storage.SharedBuilder).
+func SharedBuilder(path string, opts *pebble.Options) storage.Builder {
+	return storage.SharedBuilder(func() (storage.Storage, error) {
+		db, err := pebble.Open(path, opts)
+		if err != nil {
+			return nil, fmt.Errorf("error opening pebble: %v", err)
+		}
+		return New(db)
+	})
+}
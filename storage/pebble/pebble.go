@@ -0,0 +1,280 @@
+package pebble
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/lovoo/goka/storage"
+
+	pebble "github.com/cockroachdb/pebble"
+)
+
+const (
+	offsetKey = "__offset"
+)
+
+type pebbleStorage struct {
+	db        *pebble.DB
+	recovered bool
+	// writeOpts syncs the writes unless disabled with SetSync
+	writeOpts *pebble.WriteOptions
+}
+
+// New creates a new Storage backed by Pebble. Writes are synced to disk unless
+// disabled with SetSync, eg, by WithFastRecovery.
+func New(db *pebble.DB) (storage.Storage, error) {
+	if db == nil {
+		return nil, errors.New("invalid pebble db")
+	}
+	return &pebbleStorage{db: db, writeOpts: pebble.Sync}, nil
+}
+
+func (s *pebbleStorage) Has(key string) (bool, error) {
+	_, closer, err := s.db.Get([]byte(key))
+	if err == pebble.ErrNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("error checking for existence in pebble (key %s): %v", key, err)
+	}
+	return true, closer.Close()
+}
+
+func (s *pebbleStorage) Get(key string) ([]byte, error) {
+	value, closer, err := s.db.Get([]byte(key))
+	if err == pebble.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error getting from pebble (key %s): %v", key, err)
+	}
+	defer closer.Close()
+
+	// the value is only valid until the closer is closed
+	return append([]byte(nil), value...), nil
+}
+
+// GetFunc passes the value of key to fn without copying it from pebble.
+func (s *pebbleStorage) GetFunc(key string, fn func(value []byte) error) error {
+	value, closer, err := s.db.Get([]byte(key))
+	if err == pebble.ErrNotFound {
+		return fn(nil)
+	} else if err != nil {
+		return fmt.Errorf("error getting from pebble (key %s): %v", key, err)
+	}
+	defer closer.Close()
+	if value == nil {
+		value = []byte{}
+	}
+	return fn(value)
+}
+
+func (s *pebbleStorage) GetOffset(defValue int64) (int64, error) {
+	data, err := s.Get(offsetKey)
+	if err != nil {
+		return 0, err
+	}
+	if data == nil {
+		return defValue, nil
+	}
+
+	value, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("error decoding offset: %v", err)
+	}
+	return value, nil
+}
+
+func (s *pebbleStorage) Set(key string, value []byte) error {
+	if err := s.db.Set([]byte(key), value, s.writeOpts); err != nil {
+		return fmt.Errorf("error setting to pebble (key %s): %v", key, err)
+	}
+	return nil
+}
+
+func (s *pebbleStorage) SetOffset(offset int64) error {
+	return s.Set(offsetKey, []byte(strconv.FormatInt(offset, 10)))
+}
+
+func (s *pebbleStorage) Delete(key string) error {
+	if err := s.db.Delete([]byte(key), s.writeOpts); err != nil {
+		return fmt.Errorf("error deleting from pebble (key %s): %v", key, err)
+	}
+	return nil
+}
+
+// Stats returns the disk space used, the number of open tables and the
+// number of entries in the tables, which approximates the number of keys
+// since the tables also count overwritten and deleted keys. Keys in the
+// memtable are not counted.
+func (s *pebbleStorage) Stats() (*storage.Stats, error) {
+	tables, err := s.db.SSTables()
+	if err != nil {
+		return nil, fmt.Errorf("error reading pebble tables: %v", err)
+	}
+	var keys int64
+	for _, level := range tables {
+		for _, t := range level {
+			if t.Properties != nil {
+				keys += int64(t.Properties.NumEntries)
+			}
+		}
+	}
+	m := s.db.Metrics()
+	return &storage.Stats{
+		Keys:      keys,
+		Bytes:     int64(m.DiskSpaceUsage()),
+		OpenFiles: int(m.TableCache.Count),
+	}, nil
+}
+
+// Merge merges delta into the value of key with the merge operator of the
+// database (see pebble.Options.Merger), which appends by default. The merge is
+// applied natively by Pebble without reading the value.
+func (s *pebbleStorage) Merge(key string, delta []byte) error {
+	if err := s.db.Merge([]byte(key), delta, s.writeOpts); err != nil {
+		return fmt.Errorf("error merging in pebble (key %s): %v", key, err)
+	}
+	return nil
+}
+
+func (s *pebbleStorage) WriteBatch(b *storage.Batch) error {
+	batch := s.db.NewBatch()
+	defer batch.Close()
+	err := b.Replay(
+		func(key string, value []byte) error { return batch.Set([]byte(key), value, nil) },
+		func(key string) error { return batch.Delete([]byte(key), nil) },
+	)
+	if offset, ok := b.Offset(); ok && err == nil {
+		err = batch.Set([]byte(offsetKey), []byte(strconv.FormatInt(offset, 10)), nil)
+	}
+	if err == nil {
+		err = batch.Commit(s.writeOpts)
+	}
+	if err != nil {
+		return fmt.Errorf("error writing batch to pebble: %v", err)
+	}
+	return nil
+}
+
+// Iterator returns an iterator that traverses over a snapshot of the storage.
+func (s *pebbleStorage) Iterator() (storage.Iterator, error) {
+	return s.newIterator(nil), nil
+}
+
+// IteratorWithRange returns an iterator that traverses over a snapshot of the
+// storage in the range [start, limit). If limit is empty, the iterator
+// traverses all keys with prefix start.
+func (s *pebbleStorage) IteratorWithRange(start, limit []byte) (storage.Iterator, error) {
+	if len(limit) == 0 {
+		limit = prefixLimit(start)
+	}
+	return s.newIterator(&pebble.IterOptions{LowerBound: start, UpperBound: limit}), nil
+}
+
+func (s *pebbleStorage) newIterator(opts *pebble.IterOptions) *iterator {
+	snap := s.db.NewSnapshot()
+	return &iterator{
+		iter: snap.NewIter(opts),
+		snap: snap,
+	}
+}
+
+// prefixLimit returns the smallest key greater than all keys with prefix or
+// nil if there is no such key.
+func prefixLimit(prefix []byte) []byte {
+	limit := append([]byte(nil), prefix...)
+	for i := len(limit) - 1; i >= 0; i-- {
+		if limit[i] < 0xff {
+			limit[i]++
+			return limit[:i+1]
+		}
+	}
+	return nil
+}
+
+// SetSync enables or disables syncing the writes. Enabling it flushes the
+// writes made while it was disabled.
+func (s *pebbleStorage) SetSync(sync bool) error {
+	if !sync {
+		s.writeOpts = pebble.NoSync
+		return nil
+	}
+	if s.writeOpts == pebble.NoSync {
+		if err := s.db.Flush(); err != nil {
+			return fmt.Errorf("error flushing pebble: %v", err)
+		}
+	}
+	s.writeOpts = pebble.Sync
+	return nil
+}
+
+func (s *pebbleStorage) MarkRecovered() error {
+	s.recovered = true
+	return nil
+}
+
+func (s *pebbleStorage) Recovered() bool {
+	return s.recovered
+}
+
+func (s *pebbleStorage) Open() error {
+	return nil
+}
+
+func (s *pebbleStorage) Close() error {
+	if err := s.SetSync(true); err != nil {
+		return err
+	}
+	return s.db.Close()
+}
+
+// iterator wraps a pebble iterator, skipping the offset key. Like LevelDB
+// iterators, it is positioned before the first key until Next or Seek is
+// called.
+type iterator struct {
+	iter    *pebble.Iterator
+	snap    *pebble.Snapshot
+	started bool
+}
+
+func (i *iterator) Next() bool {
+	var next bool
+	if !i.started {
+		i.started = true
+		next = i.iter.First()
+	} else {
+		next = i.iter.Next()
+	}
+	if next && string(i.iter.Key()) == offsetKey {
+		next = i.iter.Next()
+	}
+	return next
+}
+
+func (i *iterator) Key() []byte {
+	if !i.started || !i.iter.Valid() {
+		return nil
+	}
+	return i.iter.Key()
+}
+
+func (i *iterator) Value() ([]byte, error) {
+	if !i.started || !i.iter.Valid() {
+		return nil, nil
+	}
+	return i.iter.Value(), nil
+}
+
+func (i *iterator) Release() {
+	i.iter.Close()
+	i.snap.Close()
+}
+
+func (i *iterator) Seek(key []byte) bool {
+	i.started = true
+	next := i.iter.SeekGE(key)
+	if next && string(i.iter.Key()) == offsetKey {
+		next = i.iter.Next()
+	}
+	return next
+}
@@ -0,0 +1,129 @@
+package pebble
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/facebookgo/ensure"
+	"github.com/lovoo/goka/storage"
+
+	pebble "github.com/cockroachdb/pebble"
+)
+
+func TestStorage(t *testing.T) {
+	path, err := ioutil.TempDir("", "goka_pebble_TestStorage")
+	ensure.Nil(t, err)
+	defer os.RemoveAll(path)
+
+	st, err := DefaultBuilder(path)("topic", 0)
+	ensure.Nil(t, err)
+	ensure.Nil(t, st.Open())
+
+	// missing keys
+	value, err := st.Get("key-1")
+	ensure.Nil(t, err)
+	ensure.True(t, value == nil)
+	has, err := st.Has("key-1")
+	ensure.Nil(t, err)
+	ensure.False(t, has)
+
+	ensure.Nil(t, st.Set("key-1", []byte("value-1")))
+	ensure.Nil(t, st.Set("key-2", []byte("value-2")))
+	ensure.Nil(t, st.Set("other", []byte("value-3")))
+	value, err = st.Get("key-1")
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, value, []byte("value-1"))
+	has, err = st.Has("key-1")
+	ensure.Nil(t, err)
+	ensure.True(t, has)
+
+	ensure.Nil(t, st.Delete("other"))
+	has, err = st.Has("other")
+	ensure.Nil(t, err)
+	ensure.False(t, has)
+
+	// offsets
+	offset, err := st.GetOffset(-2)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, offset, int64(-2))
+	ensure.Nil(t, st.SetOffset(42))
+	offset, err = st.GetOffset(-2)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, offset, int64(42))
+
+	// batches write the updates and the offset
+	b := new(storage.Batch)
+	b.Set("key-3", []byte("value-3"))
+	b.Delete("key-2")
+	b.SetOffset(43)
+	ensure.Nil(t, st.(storage.Batcher).WriteBatch(b))
+	offset, err = st.GetOffset(-2)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, offset, int64(43))
+
+	keys := func(iter storage.Iterator, err error) []string {
+		ensure.Nil(t, err)
+		defer iter.Release()
+		var keys []string
+		for iter.Next() {
+			value, err := iter.Value()
+			ensure.Nil(t, err)
+			ensure.DeepEqual(t, string(value), "value-"+strings.TrimPrefix(string(iter.Key()), "key-"))
+			keys = append(keys, string(iter.Key()))
+		}
+		return keys
+	}
+	// iterators skip the offset
+	ensure.DeepEqual(t, keys(st.Iterator()), []string{"key-1", "key-3"})
+	ensure.DeepEqual(t, keys(st.IteratorWithRange([]byte("key-"), nil)), []string{"key-1", "key-3"})
+	ensure.DeepEqual(t, keys(st.IteratorWithRange([]byte("key-1"), []byte("key-3"))), []string{"key-1"})
+
+	iter, err := st.Iterator()
+	ensure.Nil(t, err)
+	ensure.True(t, iter.Seek([]byte("key-2")))
+	ensure.DeepEqual(t, iter.Key(), []byte("key-3"))
+	iter.Release()
+
+	ensure.False(t, st.Recovered())
+	ensure.Nil(t, st.MarkRecovered())
+	ensure.True(t, st.Recovered())
+
+	// syncing can be disabled, eg, while recovering
+	ps := st.(*pebbleStorage)
+	ensure.Nil(t, storage.SetSync(st, false))
+	ensure.True(t, ps.writeOpts == pebble.NoSync)
+	ensure.Nil(t, st.Set("key-4", []byte("value-4")))
+	ensure.Nil(t, storage.SetSync(st, true))
+	ensure.True(t, ps.writeOpts == pebble.Sync)
+
+	ensure.Nil(t, st.Close())
+}
+
+func TestStorage_MergeAndGetFunc(t *testing.T) {
+	path, err := ioutil.TempDir("", "goka_pebble_TestStorage_MergeAndGetFunc")
+	ensure.Nil(t, err)
+	defer os.RemoveAll(path)
+
+	st, err := DefaultBuilder(path)("topic", 0)
+	ensure.Nil(t, err)
+	defer st.Close()
+	ps := st.(*pebbleStorage)
+
+	// the default merger appends
+	ensure.Nil(t, ps.Merge("key", []byte("a")))
+	ensure.Nil(t, ps.Merge("key", []byte("b")))
+	value, err := st.Get("key")
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, value, []byte("ab"))
+
+	ensure.Nil(t, ps.GetFunc("key", func(value []byte) error {
+		ensure.DeepEqual(t, value, []byte("ab"))
+		return nil
+	}))
+	ensure.Nil(t, ps.GetFunc("missing", func(value []byte) error {
+		ensure.True(t, value == nil)
+		return nil
+	}))
+}
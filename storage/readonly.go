@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+// readOnlyCopyAttempts is the number of attempts to copy a LevelDB that is
+// modified while it is copied, eg, by compactions removing tables.
+const readOnlyCopyAttempts = 3
+
+// NewReadOnly creates a Storage reading from a LevelDB opened read-only. The
+// storage is recovered, writes fail with leveldb.ErrReadOnly.
+func NewReadOnly(db *leveldb.DB) Storage {
+	return &storage{
+		store:   db,
+		db:      db,
+		counter: keyCounter{keys: -1, stop: make(chan struct{})},
+	}
+}
+
+// ReadOnlyBuilder builds read-only storages of the LevelDB partitions stored
+// in path, eg, by a processor using DefaultBuilder(path), to inspect or export
+// them with other tools.
+//
+// LevelDB locks its directory even when opened read-only. If the directory is
+// locked by a running processor, the files of the partition are copied into a
+// temporary directory, which is removed when the storage is closed. The
+// storage then contains the state of the partition at the time of the copy.
+func ReadOnlyBuilder(path string) Builder {
+	return func(topic string, partition int32) (Storage, error) {
+		fp := filepath.Join(path, fmt.Sprintf("%s.%d", topic, partition))
+		opts := &opt.Options{ReadOnly: true, ErrorIfMissing: true}
+
+		db, err := leveldb.OpenFile(fp, opts)
+		if err == nil {
+			return NewReadOnly(db), nil
+		} else if _, serr := os.Stat(fp); serr != nil {
+			return nil, fmt.Errorf("error opening leveldb: %v", err)
+		}
+
+		// the directory is probably locked by the owner of the partition
+		for i := 0; i < readOnlyCopyAttempts; i++ {
+			var dir string
+			if dir, err = copyLevelDB(fp); err != nil {
+				continue
+			}
+			if db, err = leveldb.OpenFile(dir, opts); err != nil {
+				os.RemoveAll(dir)
+				continue
+			}
+			return &tempStorage{Storage: NewReadOnly(db), dir: dir}, nil
+		}
+		return nil, fmt.Errorf("error opening copy of leveldb: %v", err)
+	}
+}
+
+// copyLevelDB copies the files of the LevelDB in path into a new temporary
+// directory, omitting the lock and the info log.
+func copyLevelDB(path string) (string, error) {
+	files, err := ioutil.ReadDir(path)
+	if err != nil {
+		return "", err
+	}
+	dir, err := ioutil.TempDir("", "goka-readonly")
+	if err != nil {
+		return "", err
+	}
+	for _, f := range files {
+		if f.IsDir() || f.Name() == "LOCK" || strings.HasPrefix(f.Name(), "LOG") {
+			continue
+		}
+		if err := copyFile(filepath.Join(dir, f.Name()), filepath.Join(path, f.Name())); err != nil {
+			os.RemoveAll(dir)
+			return "", err
+		}
+	}
+	return dir, nil
+}
+
+func copyFile(dst, src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// tempStorage removes the directory of the storage when it is closed.
+type tempStorage struct {
+	Storage
+	dir string
+}
+
+func (s *tempStorage) Close() error {
+	defer os.RemoveAll(s.dir)
+	return s.Storage.Close()
+}
+
+func (s *tempStorage) Unwrap() Storage {
+	return s.Storage
+}
+
+func (s *tempStorage) GetFunc(key string, fn func(value []byte) error) error {
+	return GetFunc(s.Storage, key, fn)
+}
@@ -3,7 +3,9 @@ package redis
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/lovoo/goka/storage"
 
@@ -15,8 +17,9 @@ const (
 )
 
 type redisStorage struct {
-	client *redis.Client
-	hash   string
+	client    *redis.Client
+	hash      string
+	recovered bool
 }
 
 // New creates a new Storage backed by Redis.
@@ -83,45 +86,101 @@ func (s *redisStorage) Delete(key string) error {
 	return s.client.HDel(s.hash, key).Err()
 }
 
-func (s *redisStorage) Iterator() (storage.Iterator, error) {
-	var current uint64
-	var keys []string
-	var err error
+// Stats returns the number of keys in the hash. The memory used by the hash
+// is not reported.
+func (s *redisStorage) Stats() (*storage.Stats, error) {
+	n, err := s.client.HLen(s.hash).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error counting keys of hash %s: %v", s.hash, err)
+	}
+	if has, err := s.client.HExists(s.hash, offsetKey).Result(); err != nil {
+		return nil, fmt.Errorf("error checking offset of hash %s: %v", s.hash, err)
+	} else if has {
+		n--
+	}
+	return &storage.Stats{Keys: n, Bytes: -1}, nil
+}
 
-	keys, current, err = s.client.HScan(s.hash, current, "", 0).Result()
+// Iterator returns an iterator over the keys of the storage in ascending
+// order. The keys are read when creating the iterator, the values when
+// accessing them.
+func (s *redisStorage) Iterator() (storage.Iterator, error) {
+	keys, err := s.scanKeys(func(string) bool { return true })
 	if err != nil {
 		return nil, err
 	}
-	return &redisIterator{
-		current: current,
-		keys:    keys,
-		client:  s.client,
-		hash:    s.hash,
-	}, nil
+	return s.newIterator(keys), nil
 }
 
+// IteratorWithRange returns an iterator over the keys in the range
+// [start, limit) in ascending order. If limit is empty, the iterator traverses
+// all keys with prefix start.
 func (s *redisStorage) IteratorWithRange(start, limit []byte) (storage.Iterator, error) {
-	var current uint64
-	var keys []string
-	var err error
-
-	keys, current, err = s.client.HScan(s.hash, current, string(start), 0).Result()
+	inRange := func(key string) bool {
+		return key >= string(start) && key < string(limit)
+	}
+	if len(limit) == 0 {
+		inRange = func(key string) bool {
+			return strings.HasPrefix(key, string(start))
+		}
+	}
+	keys, err := s.scanKeys(inRange)
 	if err != nil {
 		return nil, err
 	}
+	return s.newIterator(keys), nil
+}
+
+func (s *redisStorage) newIterator(keys []string) *redisIterator {
 	return &redisIterator{
-		current: current,
+		current: -1,
 		keys:    keys,
 		client:  s.client,
 		hash:    s.hash,
-	}, nil
+	}
+}
+
+// scanKeys returns the sorted keys of the hash accepted by filter, excluding
+// the offset key.
+func (s *redisStorage) scanKeys(filter func(key string) bool) ([]string, error) {
+	var (
+		cursor uint64
+		keys   []string
+	)
+	for {
+		fields, next, err := s.client.HScan(s.hash, cursor, "", 0).Result()
+		if err != nil {
+			return nil, fmt.Errorf("error scanning redis: %v", err)
+		}
+		// the scan returns the fields and values of the hash alternately
+		for i := 0; i < len(fields); i += 2 {
+			if fields[i] != offsetKey && filter(fields[i]) {
+				keys = append(keys, fields[i])
+			}
+		}
+		if next == 0 {
+			break
+		}
+		cursor = next
+	}
+
+	// a scan may return a key more than once
+	sort.Strings(keys)
+	unique := keys[:0]
+	for i, key := range keys {
+		if i == 0 || key != keys[i-1] {
+			unique = append(unique, key)
+		}
+	}
+	return unique, nil
 }
 
 func (s *redisStorage) Recovered() bool {
-	return false
+	return s.recovered
 }
 
 func (s *redisStorage) MarkRecovered() error {
+	s.recovered = true
 	return nil
 }
 
@@ -134,19 +193,18 @@ func (s *redisStorage) Close() error {
 }
 
 type redisIterator struct {
-	current uint64
+	current int
 	keys    []string
 	client  *redis.Client
 	hash    string
 }
 
 func (i *redisIterator) exhausted() bool {
-	return uint64(len(i.keys)) <= i.current
+	return i.current < 0 || i.current >= len(i.keys)
 }
 
 func (i *redisIterator) Next() bool {
-	i.current++
-	if string(i.Key()) == offsetKey {
+	if i.current < len(i.keys) {
 		i.current++
 	}
 	return !i.exhausted()
@@ -156,22 +214,26 @@ func (i *redisIterator) Key() []byte {
 	if i.exhausted() {
 		return nil
 	}
-	key := i.keys[i.current]
-	return []byte(key)
+	return []byte(i.keys[i.current])
 }
 
 func (i *redisIterator) Value() ([]byte, error) {
 	if i.exhausted() {
 		return nil, nil
 	}
-	key := i.keys[i.current]
-	return i.client.HGet(i.hash, key).Bytes()
+	value, err := i.client.HGet(i.hash, i.keys[i.current]).Bytes()
+	if err == redis.Nil {
+		// the key was deleted after creating the iterator
+		return nil, nil
+	}
+	return value, err
 }
 
 func (i *redisIterator) Release() {
-	i.current = uint64(len(i.keys))
+	i.current = len(i.keys)
 }
 
 func (i *redisIterator) Seek(key []byte) bool {
+	i.current = sort.SearchStrings(i.keys, string(key))
 	return !i.exhausted()
 }
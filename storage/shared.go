@@ -0,0 +1,313 @@
+package storage
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+// sharedStorage is a storage shared by the storages of several partitions.
+// It is opened with the first and closed with the last partition storage.
+// The shared storage is marked as recovered once all partition storages
+// opened have recovered.
+type sharedStorage struct {
+	m    sync.Mutex
+	open func() (Storage, error)
+	st   Storage
+	refs int
+	// recovering is the number of partitions not recovered yet
+	recovering int
+	recovered  bool
+
+	// mr blocks the accesses of the partitions while the shared storage is
+	// marked as recovered, which changes how it writes, eg, committing the
+	// recovery transaction of LevelDB.
+	mr sync.RWMutex
+}
+
+// acquire opens the shared storage if needed. If the partition is not
+// recovered, the shared storage is marked as recovered only after the
+// partition has recovered or is released, and recovering is true.
+func (s *sharedStorage) acquire(recovered bool) (st Storage, recovering bool, err error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.refs == 0 {
+		st, err := s.open()
+		if err != nil {
+			return nil, false, err
+		}
+		if err := st.Open(); err != nil {
+			return nil, false, err
+		}
+		s.st = st
+	}
+	s.refs++
+	if !recovered && !s.recovered {
+		s.recovering++
+		recovering = true
+	}
+	return s.st, recovering, nil
+}
+
+// partitionRecovered is called when a recovering partition has recovered.
+func (s *sharedStorage) partitionRecovered() error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.recovering--
+	return s.markRecovered()
+}
+
+// markRecovered marks the shared storage as recovered if no partition is
+// recovering anymore. s.m must be held.
+func (s *sharedStorage) markRecovered() error {
+	if s.recovering > 0 || s.recovered {
+		return nil
+	}
+	s.mr.Lock()
+	defer s.mr.Unlock()
+	if err := s.st.MarkRecovered(); err != nil {
+		return err
+	}
+	s.recovered = true
+	return nil
+}
+
+// release closes the shared storage if the last partition is released. If the
+// partition is still recovering, the shared storage may be marked as
+// recovered.
+func (s *sharedStorage) release(recovering bool) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.refs == 0 {
+		return nil
+	}
+	s.refs--
+	if recovering {
+		s.recovering--
+	}
+	if s.refs > 0 {
+		return s.markRecovered()
+	}
+	st := s.st
+	s.st = nil
+	s.recovering = 0
+	s.recovered = false
+	return st.Close()
+}
+
+// SharedBuilder builds the storages of all partitions in a single storage
+// returned by open, eg, to reduce the number of open files of processors with
+// many partitions. The keys of a partition are prefixed with its topic and
+// partition. The shared storage is opened with the first partition storage and
+// closed with the last one. It is marked as recovered once all partition
+// storages opened have recovered.
+func SharedBuilder(open func() (Storage, error)) Builder {
+	shared := &sharedStorage{open: open}
+	return func(topic string, partition int32) (Storage, error) {
+		return &prefixedStorage{
+			shared: shared,
+			prefix: fmt.Sprintf("%s/%d/", topic, partition),
+		}, nil
+	}
+}
+
+// SharedLevelDBBuilder builds the storages of all partitions in a single
+// LevelDB in path (see SharedBuilder).
+func SharedLevelDBBuilder(path string, opts *opt.Options) Builder {
+	return SharedBuilder(func() (Storage, error) {
+		db, err := leveldb.OpenFile(path, opts)
+		if err != nil {
+			return nil, fmt.Errorf("error opening leveldb: %v", err)
+		}
+		return New(db)
+	})
+}
+
+// prefixedStorage stores the keys of a partition with a prefix in a shared
+// storage.
+type prefixedStorage struct {
+	shared    *sharedStorage
+	st        Storage
+	prefix    string
+	recovered bool
+	// recovering is set while the shared storage waits for the partition to
+	// recover
+	recovering bool
+}
+
+func (s *prefixedStorage) key(key string) string {
+	return s.prefix + key
+}
+
+func (s *prefixedStorage) Open() error {
+	if s.st != nil {
+		return nil
+	}
+	st, recovering, err := s.shared.acquire(s.recovered)
+	if err != nil {
+		return fmt.Errorf("error opening shared storage: %v", err)
+	}
+	s.st, s.recovering = st, recovering
+	return nil
+}
+
+func (s *prefixedStorage) Close() error {
+	if s.st == nil {
+		return nil
+	}
+	s.st = nil
+	recovering := s.recovering
+	s.recovering = false
+	return s.shared.release(recovering)
+}
+
+func (s *prefixedStorage) Has(key string) (bool, error) {
+	s.shared.mr.RLock()
+	defer s.shared.mr.RUnlock()
+	return s.st.Has(s.key(key))
+}
+
+func (s *prefixedStorage) Get(key string) ([]byte, error) {
+	s.shared.mr.RLock()
+	defer s.shared.mr.RUnlock()
+	return s.st.Get(s.key(key))
+}
+
+func (s *prefixedStorage) Set(key string, value []byte) error {
+	s.shared.mr.RLock()
+	defer s.shared.mr.RUnlock()
+	return s.st.Set(s.key(key), value)
+}
+
+func (s *prefixedStorage) Delete(key string) error {
+	s.shared.mr.RLock()
+	defer s.shared.mr.RUnlock()
+	return s.st.Delete(s.key(key))
+}
+
+// WriteBatch writes the updates and the offset in a batch of the shared
+// storage.
+func (s *prefixedStorage) WriteBatch(b *Batch) error {
+	prefixed := new(Batch)
+	_ = b.Replay(
+		func(key string, value []byte) error {
+			prefixed.Set(s.key(key), value)
+			return nil
+		},
+		func(key string) error {
+			prefixed.Delete(s.key(key))
+			return nil
+		},
+	)
+	if offset, ok := b.Offset(); ok {
+		prefixed.Set(s.key(offsetKey), []byte(strconv.FormatInt(offset, 10)))
+	}
+	s.shared.mr.RLock()
+	defer s.shared.mr.RUnlock()
+	return WriteBatch(s.st, prefixed)
+}
+
+func (s *prefixedStorage) SetOffset(offset int64) error {
+	return s.Set(offsetKey, []byte(strconv.FormatInt(offset, 10)))
+}
+
+func (s *prefixedStorage) GetOffset(defValue int64) (int64, error) {
+	data, err := s.Get(offsetKey)
+	if err != nil {
+		return 0, err
+	}
+	if data == nil {
+		return defValue, nil
+	}
+	value, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("error decoding offset: %v", err)
+	}
+	return value, nil
+}
+
+func (s *prefixedStorage) Iterator() (Iterator, error) {
+	return s.IteratorWithRange(nil, nil)
+}
+
+// IteratorWithRange returns an iterator over the keys of the partition in the
+// range [start, limit). If limit is empty, the iterator traverses all keys
+// with prefix start.
+func (s *prefixedStorage) IteratorWithRange(start, limit []byte) (Iterator, error) {
+	if len(limit) > 0 {
+		limit = []byte(s.key(string(limit)))
+	}
+	s.shared.mr.RLock()
+	iter, err := s.st.IteratorWithRange([]byte(s.key(string(start))), limit)
+	s.shared.mr.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	return &prefixedIterator{iter: iter, s: s}, nil
+}
+
+// MarkRecovered marks the partition as recovered. The shared storage is
+// marked as recovered once all partitions opened have recovered.
+func (s *prefixedStorage) MarkRecovered() error {
+	s.recovered = true
+	if !s.recovering {
+		return nil
+	}
+	s.recovering = false
+	return s.shared.partitionRecovered()
+}
+
+func (s *prefixedStorage) Recovered() bool {
+	return s.recovered
+}
+
+// Stats returns the stats of the shared storage. The keys of the partition
+// are not counted.
+func (s *prefixedStorage) Stats() (*Stats, error) {
+	stats, err := GetStats(s.st)
+	if err != nil {
+		return nil, err
+	}
+	shared := *stats
+	shared.Keys = -1
+	return &shared, nil
+}
+
+// prefixedIterator strips the prefix from the keys of the wrapped iterator and
+// skips the offset of the partition.
+type prefixedIterator struct {
+	iter Iterator
+	s    *prefixedStorage
+}
+
+func (i *prefixedIterator) Next() bool {
+	for i.iter.Next() {
+		if string(i.iter.Key()) != i.s.key(offsetKey) {
+			return true
+		}
+	}
+	return false
+}
+
+func (i *prefixedIterator) Key() []byte {
+	key := i.iter.Key()
+	if key == nil {
+		return nil
+	}
+	return key[len(i.s.prefix):]
+}
+
+func (i *prefixedIterator) Value() ([]byte, error) {
+	return i.iter.Value()
+}
+
+func (i *prefixedIterator) Release() {
+	i.iter.Release()
+}
+
+func (i *prefixedIterator) Seek(key []byte) bool {
+	return i.iter.Seek([]byte(i.s.key(string(key))))
+}
@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/facebookgo/ensure"
+)
+
+func TestSharedBuilder(t *testing.T) {
+	var (
+		shared Storage
+		opened int
+	)
+	builder := SharedBuilder(func() (Storage, error) {
+		opened++
+		shared = NewMemory()
+		return shared, nil
+	})
+
+	var partitions []Storage
+	for _, p := range []int32{1, 10} {
+		st, err := builder("topic", p)
+		ensure.Nil(t, err)
+		ensure.Nil(t, st.Open())
+		ensure.False(t, st.Recovered())
+		partitions = append(partitions, st)
+
+		b := new(Batch)
+		b.Set("key-a", []byte(fmt.Sprintf("a-%d", p)))
+		b.Set("key-b", []byte(fmt.Sprintf("b-%d", p)))
+		b.SetOffset(int64(p))
+		ensure.Nil(t, WriteBatch(st, b))
+		ensure.Nil(t, st.MarkRecovered())
+	}
+	ensure.DeepEqual(t, opened, 1)
+
+	value, err := shared.Get("topic/10/key-a")
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, string(value), "a-10")
+
+	for i, p := range []int32{1, 10} {
+		st := partitions[i]
+		ensure.True(t, st.Recovered())
+		offset, err := st.GetOffset(-1)
+		ensure.Nil(t, err)
+		ensure.DeepEqual(t, offset, int64(p))
+
+		iter, err := st.Iterator()
+		ensure.Nil(t, err)
+		var keys []string
+		for iter.Next() {
+			value, err := iter.Value()
+			ensure.Nil(t, err)
+			ensure.DeepEqual(t, string(value), fmt.Sprintf("%s-%d", string(iter.Key())[4:], p))
+			keys = append(keys, string(iter.Key()))
+		}
+		iter.Release()
+		ensure.DeepEqual(t, keys, []string{"key-a", "key-b"})
+
+		iter, err = st.IteratorWithRange([]byte("key-b"), nil)
+		ensure.Nil(t, err)
+		ensure.True(t, iter.Next())
+		ensure.DeepEqual(t, string(iter.Key()), "key-b")
+		ensure.False(t, iter.Next())
+		iter.Release()
+	}
+
+	// the shared storage is opened again after all partitions are closed
+	for _, st := range partitions {
+		ensure.Nil(t, st.Close())
+	}
+	st, err := builder("topic", 2)
+	ensure.Nil(t, err)
+	ensure.Nil(t, st.Open())
+	ensure.DeepEqual(t, opened, 2)
+	ensure.Nil(t, st.Close())
+}
+
+// recoveryStorage counts how often it is marked as recovered.
+type recoveryStorage struct {
+	Storage
+	marked int
+}
+
+func (s *recoveryStorage) MarkRecovered() error {
+	s.marked++
+	return s.Storage.MarkRecovered()
+}
+
+func TestSharedBuilder_recovery(t *testing.T) {
+	shared := &recoveryStorage{Storage: NewMemory()}
+	builder := SharedBuilder(func() (Storage, error) { return shared, nil })
+
+	var partitions []Storage
+	for p := int32(0); p < 3; p++ {
+		st, err := builder("topic", p)
+		ensure.Nil(t, err)
+		ensure.Nil(t, st.Open())
+		partitions = append(partitions, st)
+	}
+
+	// the shared storage recovers until all partitions have recovered
+	ensure.Nil(t, partitions[0].MarkRecovered())
+	ensure.True(t, partitions[0].Recovered())
+	ensure.False(t, partitions[1].Recovered())
+	ensure.DeepEqual(t, shared.marked, 0)
+
+	// partitions closed while recovering do not keep it recovering
+	ensure.Nil(t, partitions[2].Close())
+	ensure.DeepEqual(t, shared.marked, 0)
+	ensure.Nil(t, partitions[1].MarkRecovered())
+	ensure.DeepEqual(t, shared.marked, 1)
+
+	// partitions opened later recover in the recovered shared storage
+	st, err := builder("topic", 3)
+	ensure.Nil(t, err)
+	ensure.Nil(t, st.Open())
+	ensure.False(t, st.Recovered())
+	ensure.Nil(t, st.MarkRecovered())
+	ensure.True(t, st.Recovered())
+	ensure.DeepEqual(t, shared.marked, 1)
+
+	ensure.Nil(t, st.Close())
+	ensure.Nil(t, partitions[0].Close())
+	ensure.Nil(t, partitions[1].Close())
+}
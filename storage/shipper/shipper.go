@@ -0,0 +1,230 @@
+// Package shipper uploads snapshots of local storages to an object store and
+// restores partitions from the latest snapshot when they start without local
+// state. After restoring, the partitions only recover the messages written
+// to the table topic after the snapshot, which makes disaster recovery of large
+// tables practical.
+package shipper
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lovoo/goka/logger"
+	"github.com/lovoo/goka/storage"
+)
+
+// noOffset denotes a storage without offset
+const noOffset = math.MinInt64
+
+// Shipper ships snapshots of the storages built by its builder. The storages
+// or a storage they wrap (see storage.Unwrapper) have to implement
+// storage.Snapshotter and support snapshots while they are updated, like the
+// LevelDB storage. Snapshots of wrapped storages hold the values as written by
+// the wrappers, eg, encrypted, and do not include the writes a cache has not
+// flushed yet, so they must be restored into storages with the same wrappers.
+type Shipper struct {
+	store  ObjectStore
+	prefix string
+	keep   int
+	log    logger.Logger
+
+	m        sync.Mutex
+	storages map[string]*shippedStorage
+}
+
+// New creates a shipper storing the snapshots in store below prefix. Only
+// the latest keep snapshots of each partition are kept.
+func New(store ObjectStore, prefix string, keep int) *Shipper {
+	if keep < 1 {
+		keep = 1
+	}
+	return &Shipper{
+		store:    store,
+		prefix:   prefix,
+		keep:     keep,
+		log:      logger.Default(),
+		storages: make(map[string]*shippedStorage),
+	}
+}
+
+// partitionPrefix returns the prefix of the snapshots of a partition.
+func (s *Shipper) partitionPrefix(topic string, partition int32) string {
+	return fmt.Sprintf("%s%s/%d/", s.prefix, topic, partition)
+}
+
+// Builder wraps builder so that the storages are restored from the latest
+// snapshot when they are opened without offset, and are shipped by Run while
+// they are open.
+func (s *Shipper) Builder(builder storage.Builder) storage.Builder {
+	return func(topic string, partition int32) (storage.Storage, error) {
+		st, err := builder(topic, partition)
+		if err != nil {
+			return nil, err
+		}
+		return &shippedStorage{
+			Storage:   st,
+			shipper:   s,
+			topic:     topic,
+			partition: partition,
+		}, nil
+	}
+}
+
+// Run ships snapshots of all open storages every interval until ctx is done.
+func (s *Shipper) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.ShipAll(ctx); err != nil {
+				s.log.Printf("shipper: %v", err)
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// ShipAll ships snapshots of all open storages.
+func (s *Shipper) ShipAll(ctx context.Context) error {
+	s.m.Lock()
+	storages := make([]*shippedStorage, 0, len(s.storages))
+	for _, st := range s.storages {
+		storages = append(storages, st)
+	}
+	s.m.Unlock()
+
+	for _, st := range storages {
+		if err := s.ship(ctx, st); err != nil {
+			return fmt.Errorf("error shipping %s/%d: %v", st.topic, st.partition, err)
+		}
+	}
+	return nil
+}
+
+// ship uploads a snapshot of st and removes old snapshots.
+func (s *Shipper) ship(ctx context.Context, st *shippedStorage) error {
+	snap, ok := storage.Lookup[storage.Snapshotter](st.Storage)
+	if !ok {
+		return fmt.Errorf("storage does not support snapshots")
+	}
+
+	prefix := s.partitionPrefix(st.topic, st.partition)
+	// the zero-padded time orders the snapshots by name
+	name := fmt.Sprintf("%s%020d.snap", prefix, time.Now().UnixNano())
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(snap.Snapshot(pw))
+	}()
+	err := s.store.Put(ctx, name, pr)
+	pr.CloseWithError(err)
+	if err != nil {
+		return fmt.Errorf("error uploading %s: %v", name, err)
+	}
+
+	names, err := s.store.List(ctx, prefix)
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+	for len(names) > s.keep {
+		if err := s.store.Delete(ctx, names[0]); err != nil {
+			return fmt.Errorf("error deleting %s: %v", names[0], err)
+		}
+		names = names[1:]
+	}
+	return nil
+}
+
+// restore loads the latest snapshot into st if it has no offset.
+func (s *Shipper) restore(ctx context.Context, st *shippedStorage) error {
+	if offset, err := st.Storage.GetOffset(noOffset); err != nil {
+		return fmt.Errorf("error reading offset: %v", err)
+	} else if offset != noOffset {
+		return nil
+	}
+	snap, ok := storage.Lookup[storage.Snapshotter](st.Storage)
+	if !ok {
+		return fmt.Errorf("storage does not support snapshots")
+	}
+
+	names, err := s.store.List(ctx, s.partitionPrefix(st.topic, st.partition))
+	if err != nil {
+		return err
+	} else if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+	latest := names[len(names)-1]
+
+	r, err := s.store.Get(ctx, latest)
+	if err != nil {
+		return fmt.Errorf("error downloading %s: %v", latest, err)
+	}
+	defer r.Close()
+	if err := snap.Restore(r); err != nil {
+		return fmt.Errorf("error restoring %s: %v", latest, err)
+	}
+	s.log.Printf("shipper: restored %s/%d from %s", st.topic, st.partition, latest)
+	return nil
+}
+
+func (s *Shipper) register(st *shippedStorage) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.storages[fmt.Sprintf("%s/%d", st.topic, st.partition)] = st
+}
+
+func (s *Shipper) unregister(st *shippedStorage) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	key := fmt.Sprintf("%s/%d", st.topic, st.partition)
+	if s.storages[key] == st {
+		delete(s.storages, key)
+	}
+}
+
+// shippedStorage is restored from the latest snapshot when it is opened
+// without offset and shipped while it is open.
+type shippedStorage struct {
+	storage.Storage
+	shipper   *Shipper
+	topic     string
+	partition int32
+}
+
+func (s *shippedStorage) Open() error {
+	if err := s.Storage.Open(); err != nil {
+		return err
+	}
+	if err := s.shipper.restore(context.Background(), s); err != nil {
+		return fmt.Errorf("error restoring %s/%d from snapshot: %v", s.topic, s.partition, err)
+	}
+	s.shipper.register(s)
+	return nil
+}
+
+func (s *shippedStorage) Close() error {
+	s.shipper.unregister(s)
+	return s.Storage.Close()
+}
+
+// WriteBatch writes the batch natively if the wrapped storage supports it.
+func (s *shippedStorage) WriteBatch(b *storage.Batch) error {
+	return storage.WriteBatch(s.Storage, b)
+}
+
+func (s *shippedStorage) Unwrap() storage.Storage {
+	return s.Storage
+}
+
+func (s *shippedStorage) GetFunc(key string, fn func(value []byte) error) error {
+	return storage.GetFunc(s.Storage, key, fn)
+}
@@ -0,0 +1,88 @@
+package shipper
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/lovoo/goka/storage"
+
+	"github.com/facebookgo/ensure"
+)
+
+func TestShipper(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "goka_shipper_TestShipper")
+	ensure.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	ctx := context.Background()
+	store := NewDirStore(tmpdir)
+	shipper := New(store, "snapshots/", 2)
+	builder := shipper.Builder(storage.MemoryBuilder())
+
+	st, err := builder("topic", 1)
+	ensure.Nil(t, err)
+	ensure.Nil(t, st.Open())
+	for i := 0; i < 3; i++ {
+		ensure.Nil(t, st.Set(fmt.Sprintf("key-%d", i), []byte("value")))
+		ensure.Nil(t, st.SetOffset(int64(i)))
+		ensure.Nil(t, shipper.ShipAll(ctx))
+	}
+
+	// only the latest snapshots are kept
+	names, err := store.List(ctx, "snapshots/topic/1/")
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, len(names), 2)
+	ensure.Nil(t, st.Close())
+
+	// empty storages are restored from the latest snapshot
+	st, err = builder("topic", 1)
+	ensure.Nil(t, err)
+	ensure.Nil(t, st.Open())
+	offset, err := st.GetOffset(-1)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, offset, int64(2))
+	value, err := st.Get("key-2")
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, string(value), "value")
+
+	// partitions without snapshots start empty
+	st, err = builder("topic", 2)
+	ensure.Nil(t, err)
+	ensure.Nil(t, st.Open())
+	offset, err = st.GetOffset(-1)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, offset, int64(-1))
+}
+
+func TestShipper_wrapped(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "goka_shipper_TestShipper_wrapped")
+	ensure.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	ctx := context.Background()
+	store := NewDirStore(tmpdir)
+	shipper := New(store, "snapshots/", 1)
+	key := storage.StaticKey(make([]byte, 32))
+	builder := shipper.Builder(storage.BuilderWithEncryption(storage.BuilderWithTTL(storage.MemoryBuilder(), time.Hour), key))
+
+	// the snapshotter is looked up below the wrappers
+	st, err := builder("topic", 1)
+	ensure.Nil(t, err)
+	ensure.Nil(t, st.Open())
+	ensure.Nil(t, st.Set("key", []byte("value")))
+	ensure.Nil(t, st.SetOffset(1))
+	ensure.Nil(t, shipper.ShipAll(ctx))
+	ensure.Nil(t, st.Close())
+
+	st, err = builder("topic", 1)
+	ensure.Nil(t, err)
+	ensure.Nil(t, st.Open())
+	value, err := st.Get("key")
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, string(value), "value")
+
+}
@@ -0,0 +1,97 @@
+package shipper
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ObjectStore stores the snapshots, eg, in S3 or GCS (see NewS3Store) or in a
+// directory (see NewDirStore). Object names are slash-separated paths.
+type ObjectStore interface {
+	// Put stores the content of r as object name.
+	Put(ctx context.Context, name string, r io.Reader) error
+	// Get returns a reader of object name.
+	Get(ctx context.Context, name string) (io.ReadCloser, error)
+	// List returns the names of the objects starting with prefix.
+	List(ctx context.Context, prefix string) ([]string, error)
+	// Delete removes object name.
+	Delete(ctx context.Context, name string) error
+}
+
+type dirStore struct {
+	path string
+}
+
+// NewDirStore returns an ObjectStore storing the objects as files in path,
+// eg, a network file system or a bucket mounted into the file system.
+func NewDirStore(path string) ObjectStore {
+	return &dirStore{path: path}
+}
+
+func (s *dirStore) file(name string) string {
+	return filepath.Join(s.path, filepath.FromSlash(name))
+}
+
+// Put writes the object into a temporary file first, so that partially
+// written objects are never listed.
+func (s *dirStore) Put(ctx context.Context, name string, r io.Reader) error {
+	fn := s.file(name)
+	if err := os.MkdirAll(filepath.Dir(fn), os.ModePerm); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(fn), ".upload-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), fn)
+}
+
+func (s *dirStore) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	return os.Open(s.file(name))
+}
+
+func (s *dirStore) List(ctx context.Context, prefix string) ([]string, error) {
+	var names []string
+	err := filepath.Walk(s.path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".upload-") {
+			return nil
+		}
+		rel, err := filepath.Rel(s.path, path)
+		if err != nil {
+			return err
+		}
+		if name := filepath.ToSlash(rel); strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing %s: %v", s.path, err)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *dirStore) Delete(ctx context.Context, name string) error {
+	return os.Remove(s.file(name))
+}
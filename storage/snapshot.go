@@ -0,0 +1,185 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Snapshots start with snapshotMagic followed by the format version, the
+// offset record and a sequence of entry records. The snapshot ends with an end
+// record. Integers are encoded as varints, byte slices are prefixed with their
+// length.
+const (
+	snapshotMagic   = "GOKASNAP"
+	snapshotVersion = 1
+
+	snapshotRecordEnd   byte = 0
+	snapshotRecordEntry byte = 1
+
+	// noOffset denotes a storage without offset
+	noOffset = math.MinInt64
+
+	// maxSnapshotFieldSize limits the size of keys and values read from a
+	// snapshot to detect corrupt snapshots before allocating huge buffers
+	maxSnapshotFieldSize = 1 << 30
+
+	// restoreBatchSize is the number of entries restored at once
+	restoreBatchSize = 1000
+)
+
+// Snapshotter is implemented by storages that can dump their state and load
+// it again, eg, to back up a storage or to prepare a standby instance.
+type Snapshotter interface {
+	// Snapshot writes a consistent dump of the keys, values and offset of the
+	// storage to w.
+	Snapshot(w io.Writer) error
+	// Restore loads a dump written by Snapshot into the storage. The storage
+	// must be empty.
+	Restore(r io.Reader) error
+}
+
+// writeSnapshot writes the offset and the entries of iter to w.
+func writeSnapshot(w io.Writer, offset int64, iter Iterator) error {
+	bw := bufio.NewWriter(w)
+	var buf [binary.MaxVarintLen64]byte
+	writeInt := func(v int64) error {
+		n := binary.PutVarint(buf[:], v)
+		_, err := bw.Write(buf[:n])
+		return err
+	}
+	writeBytes := func(b []byte) error {
+		if err := writeInt(int64(len(b))); err != nil {
+			return err
+		}
+		_, err := bw.Write(b)
+		return err
+	}
+
+	if _, err := bw.WriteString(snapshotMagic); err != nil {
+		return err
+	}
+	if err := writeInt(snapshotVersion); err != nil {
+		return err
+	}
+	if err := writeInt(offset); err != nil {
+		return err
+	}
+	for iter.Next() {
+		value, err := iter.Value()
+		if err != nil {
+			return fmt.Errorf("error reading value of key %s: %v", iter.Key(), err)
+		}
+		if err := bw.WriteByte(snapshotRecordEntry); err != nil {
+			return err
+		}
+		if err := writeBytes(iter.Key()); err != nil {
+			return err
+		}
+		if err := writeBytes(value); err != nil {
+			return err
+		}
+	}
+	if err := bw.WriteByte(snapshotRecordEnd); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// readSnapshot reads a snapshot from r, passing its entries in batches to
+// write. It returns the offset of the snapshot, which is noOffset if the
+// snapshotted storage had no offset.
+func readSnapshot(r io.Reader, write func(b *Batch) error) (int64, error) {
+	br := bufio.NewReader(r)
+	readBytes := func() ([]byte, error) {
+		n, err := binary.ReadVarint(br)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 || n > maxSnapshotFieldSize {
+			return nil, fmt.Errorf("invalid field size %d", n)
+		}
+		b := make([]byte, n)
+		_, err = io.ReadFull(br, b)
+		return b, err
+	}
+
+	magic := make([]byte, len(snapshotMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != snapshotMagic {
+		return 0, fmt.Errorf("invalid snapshot: missing header")
+	}
+	version, err := binary.ReadVarint(br)
+	if err != nil {
+		return 0, fmt.Errorf("error reading snapshot: %v", err)
+	} else if version != snapshotVersion {
+		return 0, fmt.Errorf("unsupported snapshot version %d", version)
+	}
+	offset, err := binary.ReadVarint(br)
+	if err != nil {
+		return 0, fmt.Errorf("error reading snapshot: %v", err)
+	}
+
+	batch := new(Batch)
+	for {
+		record, err := br.ReadByte()
+		if err != nil {
+			return 0, fmt.Errorf("error reading snapshot: %v", err)
+		}
+		switch record {
+		case snapshotRecordEnd:
+			if err := write(batch); err != nil {
+				return 0, err
+			}
+			return offset, nil
+		case snapshotRecordEntry:
+			key, err := readBytes()
+			if err != nil {
+				return 0, fmt.Errorf("error reading snapshot: %v", err)
+			}
+			value, err := readBytes()
+			if err != nil {
+				return 0, fmt.Errorf("error reading snapshot: %v", err)
+			}
+			batch.Set(string(key), value)
+			if batch.Len() >= restoreBatchSize {
+				if err := write(batch); err != nil {
+					return 0, err
+				}
+				batch.Reset()
+			}
+		default:
+			return 0, fmt.Errorf("invalid snapshot: unknown record type %d", record)
+		}
+	}
+}
+
+// restoreSnapshot restores the snapshot in r into st, which must be empty.
+func restoreSnapshot(st Storage, r io.Reader) error {
+	if offset, err := st.GetOffset(noOffset); err != nil {
+		return fmt.Errorf("error reading offset: %v", err)
+	} else if offset != noOffset {
+		return fmt.Errorf("cannot restore snapshot into storage with offset %d", offset)
+	}
+	iter, err := st.Iterator()
+	if err != nil {
+		return fmt.Errorf("error opening iterator: %v", err)
+	}
+	empty := !iter.Next()
+	iter.Release()
+	if !empty {
+		return fmt.Errorf("cannot restore snapshot into non-empty storage")
+	}
+
+	offset, err := readSnapshot(r, func(b *Batch) error { return WriteBatch(st, b) })
+	if err != nil {
+		return err
+	}
+	if offset == noOffset {
+		return nil
+	}
+	// the offset is stored last, so that an incomplete restore is recovered
+	// from the topic
+	return st.SetOffset(offset)
+}
@@ -2,9 +2,13 @@ package storage
 
 import (
 	"fmt"
+	"io"
 	"strconv"
+	"sync"
+	"time"
 
 	"github.com/syndtr/goleveldb/leveldb"
+	lerrors "github.com/syndtr/goleveldb/leveldb/errors"
 	ldbiter "github.com/syndtr/goleveldb/leveldb/iterator"
 	"github.com/syndtr/goleveldb/leveldb/opt"
 	"github.com/syndtr/goleveldb/leveldb/util"
@@ -12,6 +16,10 @@ import (
 
 const (
 	offsetKey = "__offset"
+
+	// keyCountInterval is the minimum interval in which LevelDB storages
+	// count their keys
+	keyCountInterval = 5 * time.Minute
 )
 
 // Iterator provides iteration access to the stored values.
@@ -30,6 +38,114 @@ type Iterator interface {
 	Seek(key []byte) bool
 }
 
+// Batch is a group of updates written to a storage at once, optionally with
+// the offset the updates cover.
+type Batch struct {
+	updates []batchUpdate
+
+	offset    int64
+	hasOffset bool
+}
+
+type batchUpdate struct {
+	key    string
+	value  []byte
+	delete bool
+	ts     time.Time
+}
+
+// Set adds setting key to value to the batch.
+func (b *Batch) Set(key string, value []byte) {
+	b.updates = append(b.updates, batchUpdate{key: key, value: value})
+}
+
+// SetWithTimestamp adds setting key to value written at ts to the batch (see
+// TimestampSetter). Storages not using timestamps ignore it.
+func (b *Batch) SetWithTimestamp(key string, value []byte, ts time.Time) {
+	b.updates = append(b.updates, batchUpdate{key: key, value: value, ts: ts})
+}
+
+// Delete adds deleting key to the batch.
+func (b *Batch) Delete(key string) {
+	b.updates = append(b.updates, batchUpdate{key: key, delete: true})
+}
+
+// Len returns the number of updates in the batch.
+func (b *Batch) Len() int {
+	return len(b.updates)
+}
+
+// SetOffset sets the offset written with the updates of the batch. Storages
+// with atomic batches write the offset atomically with the updates, so the
+// stored offset never is ahead of or behind the stored values. Other storages
+// write the offset after the updates.
+func (b *Batch) SetOffset(offset int64) {
+	b.offset = offset
+	b.hasOffset = true
+}
+
+// Offset returns the offset of the batch and whether it is set.
+func (b *Batch) Offset() (int64, bool) {
+	return b.offset, b.hasOffset
+}
+
+// Reset removes all updates and the offset from the batch.
+func (b *Batch) Reset() {
+	b.updates = b.updates[:0]
+	b.hasOffset = false
+}
+
+// Lookup returns the value of key set by the batch. If the key is not updated
+// by the batch, ok is false. If the batch deletes the key, value is nil.
+func (b *Batch) Lookup(key string) (value []byte, ok bool) {
+	for i := len(b.updates) - 1; i >= 0; i-- {
+		if u := b.updates[i]; u.key == key {
+			return u.value, true
+		}
+	}
+	return nil, false
+}
+
+// Replay calls set or del for every update of the batch in order. The offset
+// is not replayed.
+func (b *Batch) Replay(set func(key string, value []byte) error, del func(key string) error) error {
+	for _, u := range b.updates {
+		var err error
+		if u.delete {
+			err = del(u.key)
+		} else {
+			err = set(u.key, u.value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Batcher is implemented by storages that write batches natively, eg,
+// atomically in a single transaction.
+type Batcher interface {
+	// WriteBatch writes all updates of the batch and its offset.
+	WriteBatch(*Batch) error
+}
+
+// WriteBatch writes the updates of b and its offset to st in a single batch if
+// st implements Batcher. Otherwise the updates are written key by key followed
+// by the offset.
+func WriteBatch(st Storage, b *Batch) error {
+	if bt, ok := st.(Batcher); ok {
+		return bt.WriteBatch(b)
+	}
+	if err := b.Replay(st.Set, st.Delete); err != nil {
+		return err
+	}
+	if offset, ok := b.Offset(); ok {
+		return st.SetOffset(offset)
+	}
+	return nil
+}
+
 // Storage abstracts the interface for a persistent local storage
 type Storage interface {
 	Has(string) (bool, error)
@@ -39,6 +155,8 @@ type Storage interface {
 	SetOffset(value int64) error
 	GetOffset(defValue int64) (int64, error)
 	Iterator() (Iterator, error)
+	// IteratorWithRange returns an iterator over the keys in [start, limit).
+	// If limit is empty, it iterates over all keys with the prefix start.
 	IteratorWithRange(start, limit []byte) (Iterator, error)
 	MarkRecovered() error
 	Recovered() bool
@@ -46,12 +164,118 @@ type Storage interface {
 	Close() error
 }
 
+// StatsProvider is implemented by storages that report metrics of their data.
+type StatsProvider interface {
+	// Stats returns metrics of the storage.
+	Stats() (*Stats, error)
+}
+
+// Unwrapper is implemented by storages wrapping another storage. Optional
+// interfaces that do not depend on the stored values, like StatsProvider,
+// Syncer, Snapshotter and Compacter, are looked up along the chain of wrapped
+// storages (see Lookup), so wrappers only implement them to change them.
+// Interfaces reading or writing values, like Batcher or ZeroCopyGetter, are
+// not looked up, since they would bypass the wrapper.
+type Unwrapper interface {
+	// Unwrap returns the wrapped storage.
+	Unwrap() Storage
+}
+
+// Lookup returns the first storage implementing T of st and the storages
+// wrapped by st (see Unwrapper).
+func Lookup[T any](st Storage) (T, bool) {
+	for st != nil {
+		if t, ok := st.(T); ok {
+			return t, true
+		}
+		u, ok := st.(Unwrapper)
+		if !ok {
+			break
+		}
+		st = u.Unwrap()
+	}
+	var zero T
+	return zero, false
+}
+
+// GetStats returns the metrics of st or a storage wrapped by st if it
+// implements StatsProvider. Otherwise the keys and bytes are unknown, ie, -1.
+func GetStats(st Storage) (*Stats, error) {
+	if sp, ok := Lookup[StatsProvider](st); ok {
+		return sp.Stats()
+	}
+	return &Stats{Keys: -1, Bytes: -1}, nil
+}
+
+// Syncer is implemented by storages syncing their writes to disk. Syncing can
+// be disabled while recovering, since the table topic is the source of truth.
+type Syncer interface {
+	// SetSync enables or disables syncing the writes to disk. Enabling it
+	// syncs the writes made while it was disabled.
+	SetSync(sync bool) error
+}
+
+// SetSync enables or disables syncing the writes of st or a storage wrapped by
+// st if it implements Syncer. Other storages are not changed.
+func SetSync(st Storage, sync bool) error {
+	if s, ok := Lookup[Syncer](st); ok {
+		return s.SetSync(sync)
+	}
+	return nil
+}
+
+// Stats are metrics of a storage. Metrics a storage cannot determine without
+// scanning its data are -1.
+type Stats struct {
+	Keys      int64 // number of keys, excluding the offset
+	Bytes     int64 // size of the data, on disk for persistent storages
+	OpenFiles int
+}
+
+// Compacter is implemented by storages that allow to control their
+// compactions, eg, to compact off-peak and monitor the write amplification.
+type Compacter interface {
+	// Compact compacts the whole storage.
+	Compact() error
+	// CompactionStats returns the compaction statistics of the storage.
+	CompactionStats() (*CompactionStats, error)
+}
+
+// CompactionStats are the statistics of the compactions of a storage since it
+// was opened. The per-level slices are indexed by level.
+type CompactionStats struct {
+	LevelSizes  []int64 // bytes stored in each level
+	LevelTables []int   // number of tables in each level
+	LevelRead   []int64 // bytes read by compactions into each level
+	LevelWrite  []int64 // bytes written by compactions into each level
+	LevelTime   []time.Duration
+
+	// WriteDelays counts the writes delayed because compactions fell behind,
+	// WriteDelayTime is the total time of the delays.
+	WriteDelays    int
+	WriteDelayTime time.Duration
+}
+
+// WriteAmplification returns the ratio of the bytes written by compactions to
+// the bytes flushed into the first level, ie, how often data is rewritten.
+func (s *CompactionStats) WriteAmplification() float64 {
+	if len(s.LevelWrite) == 0 || s.LevelWrite[0] == 0 {
+		return 0
+	}
+	var total int64
+	for _, w := range s.LevelWrite {
+		total += w
+	}
+	return float64(total) / float64(s.LevelWrite[0])
+}
+
 // store is the common interface between a transaction and db instance
 type store interface {
 	Has([]byte, *opt.ReadOptions) (bool, error)
 	Get([]byte, *opt.ReadOptions) ([]byte, error)
 	Put([]byte, []byte, *opt.WriteOptions) error
 	Delete([]byte, *opt.WriteOptions) error
+	Write(*leveldb.Batch, *opt.WriteOptions) error
 	NewIterator(*util.Range, *opt.ReadOptions) ldbiter.Iterator
 }
 
@@ -61,8 +285,25 @@ type storage struct {
 	db    *leveldb.DB
 	// tx is the transaction used for recovery
 	tx *leveldb.Transaction
+	// path is the directory of the LevelDB if opened by a builder. It is
+	// marked as corrupted when reads detect corruption.
+	path string
 
 	currentOffset int64
+
+	// counter counts the keys in the background, since LevelDB does not keep
+	// track of its keys
+	counter keyCounter
+}
+
+// keyCounter caches the number of keys of a LevelDB.
+type keyCounter struct {
+	m         sync.Mutex
+	keys      int64
+	countedAt time.Time
+	counting  bool
+	stop      chan struct{}
+	done      sync.WaitGroup
 }
 
 // New creates a new Storage backed by LevelDB.
@@ -73,9 +314,10 @@ func New(db *leveldb.DB) (Storage, error) {
 	}
 
 	return &storage{
-		store: tx,
-		db:    db,
-		tx:    tx,
+		store:   tx,
+		db:      db,
+		tx:      tx,
+		counter: keyCounter{keys: -1, stop: make(chan struct{})},
 	}, nil
 }
 
@@ -112,12 +354,25 @@ func (s *storage) IteratorWithRange(start, limit []byte) (Iterator, error) {
 
 }
 
+// checkCorrupted marks the LevelDB as corrupted if err reports corruption,
+// so that the next builder quarantines it (see openLevelDB).
+func (s *storage) checkCorrupted(err error) {
+	if s.path != "" && lerrors.IsCorrupted(err) {
+		markCorrupted(s.path)
+	}
+}
+
 func (s *storage) Has(key string) (bool, error) {
-	return s.store.Has([]byte(key), nil)
+	has, err := s.store.Has([]byte(key), nil)
+	if err != nil {
+		s.checkCorrupted(err)
+	}
+	return has, err
 }
 
 func (s *storage) Get(key string) ([]byte, error) {
 	if has, err := s.store.Has([]byte(key), nil); err != nil {
+		s.checkCorrupted(err)
 		return nil, fmt.Errorf("error checking for existence in leveldb (key %s): %v", key, err)
 	} else if !has {
 		return nil, nil
@@ -127,11 +382,34 @@ func (s *storage) Get(key string) ([]byte, error) {
 	if err == leveldb.ErrNotFound {
 		return nil, nil
 	} else if err != nil {
+		s.checkCorrupted(err)
 		return nil, fmt.Errorf("error getting from leveldb (key %s): %v", key, err)
 	}
 	return value, nil
 }
 
+// GetFunc passes the value of key to fn without copying it from LevelDB's
+// block buffers.
+func (s *storage) GetFunc(key string, fn func(value []byte) error) error {
+	k := []byte(key)
+	iter := s.store.NewIterator(&util.Range{Start: k, Limit: append(k, 0)}, nil)
+	defer iter.Release()
+
+	var value []byte
+	if iter.Next() {
+		value = iter.Value()
+		if value == nil {
+			// distinguish empty values from missing keys
+			value = []byte{}
+		}
+	}
+	if err := iter.Error(); err != nil {
+		s.checkCorrupted(err)
+		return fmt.Errorf("error getting from leveldb (key %s): %v", key, err)
+	}
+	return fn(value)
+}
+
 func (s *storage) GetOffset(defValue int64) (int64, error) {
 	data, err := s.Get(offsetKey)
 	if err != nil {
@@ -157,6 +435,147 @@ func (s *storage) Set(key string, value []byte) error {
 	return nil
 }
 
+func (s *storage) WriteBatch(b *Batch) error {
+	batch := new(leveldb.Batch)
+	for _, u := range b.updates {
+		if u.delete {
+			batch.Delete([]byte(u.key))
+		} else {
+			batch.Put([]byte(u.key), u.value)
+		}
+	}
+	offset, hasOffset := b.Offset()
+	if hasOffset {
+		batch.Put([]byte(offsetKey), []byte(strconv.FormatInt(offset, 10)))
+	}
+	if err := s.store.Write(batch, nil); err != nil {
+		return fmt.Errorf("error writing batch to leveldb: %v", err)
+	}
+	if hasOffset && offset > s.currentOffset {
+		s.currentOffset = offset
+	}
+	return nil
+}
+
+// Snapshot writes the keys, values and offset of a LevelDB snapshot to w.
+// Updates of a recovery in progress are not included.
+func (s *storage) Snapshot(w io.Writer) error {
+	snap, err := s.db.GetSnapshot()
+	if err != nil {
+		return fmt.Errorf("error getting leveldb snapshot: %v", err)
+	}
+	defer snap.Release()
+
+	offset := int64(noOffset)
+	data, err := snap.Get([]byte(offsetKey), nil)
+	if err != nil && err != leveldb.ErrNotFound {
+		return fmt.Errorf("error reading offset: %v", err)
+	} else if err == nil {
+		if offset, err = strconv.ParseInt(string(data), 10, 64); err != nil {
+			return fmt.Errorf("error decoding offset: %v", err)
+		}
+	}
+
+	iter := &iterator{iter: snap.NewIterator(nil, nil), snap: snap}
+	defer iter.iter.Release()
+	return writeSnapshot(w, offset, iter)
+}
+
+// Restore loads a snapshot into the storage, which must be empty.
+func (s *storage) Restore(r io.Reader) error {
+	return restoreSnapshot(s, r)
+}
+
+// Compact compacts the whole LevelDB. Compacting is not possible while the
+// storage is recovering.
+func (s *storage) Compact() error {
+	if !s.Recovered() {
+		return fmt.Errorf("cannot compact leveldb while recovering")
+	}
+	if err := s.db.CompactRange(util.Range{}); err != nil {
+		return fmt.Errorf("error compacting leveldb: %v", err)
+	}
+	return nil
+}
+
+// CompactionStats returns the compaction statistics of LevelDB.
+func (s *storage) CompactionStats() (*CompactionStats, error) {
+	var dbs leveldb.DBStats
+	if err := s.db.Stats(&dbs); err != nil {
+		return nil, fmt.Errorf("error reading leveldb stats: %v", err)
+	}
+	return &CompactionStats{
+		LevelSizes:     dbs.LevelSizes,
+		LevelTables:    dbs.LevelTablesCounts,
+		LevelRead:      dbs.LevelRead,
+		LevelWrite:     dbs.LevelWrite,
+		LevelTime:      dbs.LevelDurations,
+		WriteDelays:    int(dbs.WriteDelayCount),
+		WriteDelayTime: dbs.WriteDelayDuration,
+	}, nil
+}
+
+// Stats returns the size of the tables, the number of open tables and the
+// number of keys. The keys are counted in the background at most every
+// keyCountInterval, so the number is approximate and -1 until the first count
+// has finished.
+func (s *storage) Stats() (*Stats, error) {
+	var dbs leveldb.DBStats
+	if err := s.db.Stats(&dbs); err != nil {
+		return nil, fmt.Errorf("error reading leveldb stats: %v", err)
+	}
+	return &Stats{
+		Keys:      s.keyCount(),
+		Bytes:     dbs.LevelSizes.Sum(),
+		OpenFiles: dbs.OpenedTablesCount,
+	}, nil
+}
+
+// keyCount returns the last number of keys counted and starts counting again
+// if the count is outdated.
+func (s *storage) keyCount() int64 {
+	c := &s.counter
+	c.m.Lock()
+	defer c.m.Unlock()
+	if !c.counting && time.Since(c.countedAt) >= keyCountInterval {
+		c.counting = true
+		c.done.Add(1)
+		go s.countKeys()
+	}
+	return c.keys
+}
+
+// countKeys counts the keys written to the database, excluding the updates
+// of a recovery in progress.
+func (s *storage) countKeys() {
+	c := &s.counter
+	defer c.done.Done()
+
+	iter := s.db.NewIterator(nil, nil)
+	var keys int64
+	for iter.Next() {
+		select {
+		case <-c.stop:
+			iter.Release()
+			return
+		default:
+		}
+		if string(iter.Key()) != offsetKey {
+			keys++
+		}
+	}
+	err := iter.Error()
+	iter.Release()
+
+	c.m.Lock()
+	defer c.m.Unlock()
+	if err == nil {
+		c.keys = keys
+	}
+	c.countedAt = time.Now()
+	c.counting = false
+}
+
 func (s *storage) SetOffset(offset int64) error {
 	if offset > s.currentOffset {
 		s.currentOffset = offset
@@ -191,6 +610,12 @@ func (s *storage) Open() error {
 }
 
 func (s *storage) Close() error {
+	if s.counter.stop != nil {
+		close(s.counter.stop)
+		s.counter.done.Wait()
+		s.counter.stop = nil
+	}
+
 	if s.store == s.tx {
 		if err := s.tx.Commit(); err != nil {
 			return fmt.Errorf("error closing transaction: %v", err)
@@ -1,12 +1,21 @@
 package storage
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"sort"
 	"testing"
+	"time"
+
+	"github.com/lovoo/goka/logger"
 
 	"github.com/syndtr/goleveldb/leveldb"
+	lerrors "github.com/syndtr/goleveldb/leveldb/errors"
+	"github.com/syndtr/goleveldb/leveldb/opt"
 
 	"github.com/facebookgo/ensure"
 )
@@ -86,6 +95,14 @@ func TestMemIter(t *testing.T) {
 	ensure.True(t, iter.Next(), "next should return true after a IteratorWithRange")
 	ensure.DeepEqual(t, iter.Key(), k, "the first matching key in IteratorWithRange is not corresponding to the value")
 
+	// an empty range returns all keys
+	iter, err = storage.IteratorWithRange(nil, nil)
+	ensure.Nil(t, err)
+	count := 0
+	for iter.Next() {
+		count++
+	}
+	ensure.DeepEqual(t, count, len(kv))
 }
 
 func TestGetHas(t *testing.T) {
@@ -182,3 +199,354 @@ func TestSetGet(t *testing.T) {
 	recoveredValue := string(value)
 	ensure.DeepEqual(t, recoveredValue, "example-message")
 }
+
+func TestWriteBatch(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "goka_storage_TestWriteBatch")
+	ensure.Nil(t, err)
+	db, err := leveldb.OpenFile(tmpdir, nil)
+	ensure.Nil(t, err)
+	ldb, err := New(db)
+	ensure.Nil(t, err)
+
+	// the last storage hides the native batches of memory, so the updates
+	// are written key by key
+	for _, st := range []Storage{NewMemory(), ldb, struct{ Storage }{NewMemory()}} {
+		ensure.Nil(t, st.Set("key-1", []byte("old")))
+
+		b := new(Batch)
+		b.Set("key-1", []byte("value-1"))
+		b.Set("key-2", []byte("value-2"))
+		b.Delete("key-2")
+		b.Set("key-3", []byte("value-3"))
+		ensure.DeepEqual(t, b.Len(), 4)
+
+		value, ok := b.Lookup("key-1")
+		ensure.True(t, ok)
+		ensure.DeepEqual(t, value, []byte("value-1"))
+		value, ok = b.Lookup("key-2")
+		ensure.True(t, ok)
+		ensure.True(t, value == nil)
+		_, ok = b.Lookup("key-4")
+		ensure.False(t, ok)
+
+		ensure.Nil(t, WriteBatch(st, b))
+
+		value, err = st.Get("key-1")
+		ensure.Nil(t, err)
+		ensure.DeepEqual(t, value, []byte("value-1"))
+		has, err := st.Has("key-2")
+		ensure.Nil(t, err)
+		ensure.False(t, has)
+		value, err = st.Get("key-3")
+		ensure.Nil(t, err)
+		ensure.DeepEqual(t, value, []byte("value-3"))
+
+		// the offset is written with the updates
+		b.Reset()
+		ensure.DeepEqual(t, b.Len(), 0)
+		_, ok = b.Offset()
+		ensure.False(t, ok)
+		b.Set("key-4", []byte("value-4"))
+		b.SetOffset(42)
+		ensure.Nil(t, WriteBatch(st, b))
+		offset, err := st.GetOffset(-1)
+		ensure.Nil(t, err)
+		ensure.DeepEqual(t, offset, int64(42))
+
+		b.Reset()
+		ensure.DeepEqual(t, b.Len(), 0)
+	}
+}
+
+func TestIteratorWithRange(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "goka_storage_TestIteratorWithRange")
+	ensure.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+	db, err := leveldb.OpenFile(tmpdir, nil)
+	ensure.Nil(t, err)
+	ldb, err := New(db)
+	ensure.Nil(t, err)
+	defer ldb.Close()
+
+	keys := func(st Storage, start, limit string) []string {
+		iter, err := st.IteratorWithRange([]byte(start), []byte(limit))
+		ensure.Nil(t, err)
+		defer iter.Release()
+		var keys []string
+		for iter.Next() {
+			keys = append(keys, string(iter.Key()))
+		}
+		return keys
+	}
+
+	for _, st := range []Storage{NewMemory(), ldb} {
+		for _, key := range []string{"a", "b", "b1", "c", "d"} {
+			ensure.Nil(t, st.Set(key, []byte(key)))
+		}
+
+		// the limit is exclusive in all storages
+		ensure.DeepEqual(t, keys(st, "b", "c"), []string{"b", "b1"})
+		ensure.DeepEqual(t, keys(st, "a", "d"), []string{"a", "b", "b1", "c"})
+		// an empty limit iterates over the prefix
+		ensure.DeepEqual(t, keys(st, "b", ""), []string{"b", "b1"})
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	newLevelDB := func() Storage {
+		tmpdir, err := ioutil.TempDir("", "goka_storage_TestSnapshotRestore")
+		ensure.Nil(t, err)
+		db, err := leveldb.OpenFile(tmpdir, nil)
+		ensure.Nil(t, err)
+		st, err := New(db)
+		ensure.Nil(t, err)
+		ensure.Nil(t, st.MarkRecovered())
+		return st
+	}
+
+	for _, newStorage := range []func() Storage{NewMemory, newLevelDB} {
+		st := newStorage()
+		ensure.Nil(t, st.Set("key-1", []byte("value-1")))
+		ensure.Nil(t, st.Set("key-2", []byte("value-2")))
+		ensure.Nil(t, st.SetOffset(42))
+
+		var buf bytes.Buffer
+		ensure.Nil(t, st.(Snapshotter).Snapshot(&buf))
+		snapshot := buf.Bytes()
+
+		restored := newStorage()
+		ensure.Nil(t, restored.(Snapshotter).Restore(bytes.NewReader(snapshot)))
+		offset, err := restored.GetOffset(-1)
+		ensure.Nil(t, err)
+		ensure.DeepEqual(t, offset, int64(42))
+		for _, key := range []string{"key-1", "key-2"} {
+			value, err := restored.Get(key)
+			ensure.Nil(t, err)
+			ensure.DeepEqual(t, string(value), "value"+key[3:])
+		}
+
+		// storages with data cannot be restored
+		err = st.(Snapshotter).Restore(bytes.NewReader(snapshot))
+		ensure.StringContains(t, err.Error(), "cannot restore")
+
+		err = newStorage().(Snapshotter).Restore(bytes.NewReader([]byte("invalid")))
+		ensure.StringContains(t, err.Error(), "invalid snapshot")
+	}
+}
+
+func TestCompactionStats_WriteAmplification(t *testing.T) {
+	s := &CompactionStats{}
+	ensure.DeepEqual(t, s.WriteAmplification(), float64(0))
+
+	s.LevelWrite = []int64{100, 150, 50}
+	ensure.DeepEqual(t, s.WriteAmplification(), float64(3))
+}
+
+func TestCompact(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "goka_storage_TestCompact")
+	ensure.Nil(t, err)
+	db, err := leveldb.OpenFile(tmpdir, nil)
+	ensure.Nil(t, err)
+	st, err := New(db)
+	ensure.Nil(t, err)
+
+	err = st.(Compacter).Compact()
+	ensure.StringContains(t, err.Error(), "recovering")
+
+	ensure.Nil(t, st.MarkRecovered())
+	ensure.Nil(t, st.(Compacter).Compact())
+	_, err = st.(Compacter).CompactionStats()
+	ensure.Nil(t, err)
+
+	// wrappers are unwrapped to find the compacter
+	c, ok := Lookup[Compacter](NewCached(NewTTL(NewEncrypted(st, StaticKey(make([]byte, 32))), time.Hour), CacheOptions{}))
+	ensure.True(t, ok)
+	ensure.Nil(t, c.Compact())
+	_, ok = Lookup[Compacter](NewTTL(NewMemory(), time.Hour))
+	ensure.False(t, ok)
+}
+
+func TestReadOnlyBuilder(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "goka_storage_TestReadOnlyBuilder")
+	ensure.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	_, err = ReadOnlyBuilder(tmpdir)("topic", 0)
+	ensure.NotNil(t, err)
+
+	st, err := DefaultBuilder(tmpdir)("topic", 0)
+	ensure.Nil(t, err)
+	ensure.Nil(t, st.Set("key", []byte("value")))
+	ensure.Nil(t, st.SetOffset(7))
+	ensure.Nil(t, st.MarkRecovered())
+
+	ro, err := ReadOnlyBuilder(tmpdir)("topic", 0)
+	ensure.Nil(t, err)
+	ensure.True(t, ro.Recovered())
+	value, err := ro.Get("key")
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, value, []byte("value"))
+	offset, err := ro.GetOffset(-1)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, offset, int64(7))
+
+	err = ro.Set("key", []byte("other"))
+	ensure.StringContains(t, err.Error(), "read-only")
+	ensure.Nil(t, ro.Close())
+	ensure.Nil(t, st.Close())
+}
+
+func TestBuilder_quarantine(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "goka_storage_TestBuilder_quarantine")
+	ensure.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	defer func(open func(string, *opt.Options) (*leveldb.DB, error)) { openFile = open }(openFile)
+	var opened int
+	openFile = func(path string, o *opt.Options) (*leveldb.DB, error) {
+		if opened++; opened == 1 {
+			return nil, &lerrors.ErrCorrupted{Err: fmt.Errorf("checksum mismatch")}
+		}
+		return leveldb.OpenFile(path, o)
+	}
+
+	fp := filepath.Join(tmpdir, "topic.0")
+	ensure.Nil(t, os.MkdirAll(fp, os.ModePerm))
+
+	// corrupted databases are moved aside
+	st, err := DefaultBuilder(tmpdir)("topic", 0)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, opened, 2)
+	moved, err := filepath.Glob(fp + ".corrupted-*")
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, len(moved), 1)
+	first := moved[0]
+
+	// corruption detected by reads is handled by the next builder
+	ensure.Nil(t, os.MkdirAll(fp, os.ModePerm))
+	st.(*storage).checkCorrupted(&lerrors.ErrCorrupted{Err: fmt.Errorf("checksum mismatch")})
+	_, err = os.Stat(filepath.Join(fp, corruptedMarker))
+	ensure.Nil(t, err)
+
+	_, err = DefaultBuilder(tmpdir)("topic", 0)
+	ensure.Nil(t, err)
+
+	// only the latest quarantined copy is kept
+	moved, err = filepath.Glob(fp + ".corrupted-*")
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, len(moved), 1)
+	ensure.True(t, moved[0] != first)
+}
+
+func TestContextBuilder_canceled(t *testing.T) {
+	defer func(open func(string, *opt.Options) (*leveldb.DB, error)) { openFile = open }(openFile)
+	openFile = func(path string, o *opt.Options) (*leveldb.DB, error) {
+		t.Fatalf("canceled builder opened %s", path)
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := ContextBuilderWithOptions("/tmp/goka", nil)(ctx, logger.Default(), "topic", 0)
+	ensure.DeepEqual(t, err, context.Canceled)
+}
+
+func TestStats_keyCount(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "goka_storage_TestStats_keyCount")
+	ensure.Nil(t, err)
+	db, err := leveldb.OpenFile(tmpdir, nil)
+	ensure.Nil(t, err)
+	st, err := New(db)
+	ensure.Nil(t, err)
+	ensure.Nil(t, st.MarkRecovered())
+	for i := 0; i < 10; i++ {
+		ensure.Nil(t, st.Set(fmt.Sprintf("key-%d", i), []byte("value")))
+	}
+	ensure.Nil(t, st.SetOffset(10))
+
+	// the keys are counted in the background
+	stats, err := GetStats(st)
+	ensure.Nil(t, err)
+	for deadline := time.Now().Add(time.Second); stats.Keys == -1 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+		stats, err = GetStats(st)
+		ensure.Nil(t, err)
+	}
+	ensure.DeepEqual(t, stats.Keys, int64(10))
+	ensure.Nil(t, st.Close())
+}
+
+type syncStorage struct {
+	Storage
+	sync bool
+}
+
+func (s *syncStorage) SetSync(sync bool) error {
+	s.sync = sync
+	return nil
+}
+
+func TestSetSync(t *testing.T) {
+	// storages not implementing Syncer are not changed
+	ensure.Nil(t, SetSync(NewMemory(), false))
+
+	// wrappers are unwrapped to find the syncer
+	st := &syncStorage{Storage: NewMemory(), sync: true}
+	compressed, err := NewCompressed(st, CompressionSnappy)
+	ensure.Nil(t, err)
+	wrapped := NewCached(NewTombstoning(NewTTL(compressed, time.Hour), TombstoneNever), CacheOptions{})
+	ensure.Nil(t, SetSync(wrapped, false))
+	ensure.False(t, st.sync)
+	ensure.Nil(t, SetSync(wrapped, true))
+	ensure.True(t, st.sync)
+}
+
+func TestGetFunc(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "goka_storage_TestGetFunc")
+	ensure.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+	db, err := leveldb.OpenFile(tmpdir, nil)
+	ensure.Nil(t, err)
+	st, err := New(db)
+	ensure.Nil(t, err)
+	defer st.Close()
+
+	ensure.Nil(t, st.Set("key", []byte("value")))
+	ensure.Nil(t, st.Set("key0", []byte("other")))
+	ensure.Nil(t, st.Set("empty", []byte{}))
+
+	for _, s := range []Storage{st, NewMemory()} {
+		if s != st {
+			ensure.Nil(t, s.Set("key", []byte("value")))
+			ensure.Nil(t, s.Set("empty", []byte{}))
+		}
+		for key, expected := range map[string][]byte{
+			"key":     []byte("value"),
+			"empty":   {},
+			"missing": nil,
+		} {
+			ensure.Nil(t, GetFunc(s, key, func(value []byte) error {
+				ensure.DeepEqual(t, value, expected, key)
+				return nil
+			}))
+		}
+	}
+}
+
+func TestGetFunc_wrapped(t *testing.T) {
+	st := NewMemory()
+	ensure.Nil(t, st.Set("key", []byte("value")))
+
+	// wrappers leaving the values unchanged read without copying, the others
+	// decode the values of Get
+	_, ok := NewTombstoning(NewMerging(st, MergeAppend), TombstoneNever).(ZeroCopyGetter)
+	ensure.True(t, ok)
+	_, ok = NewTTL(st, time.Hour).(ZeroCopyGetter)
+	ensure.False(t, ok)
+
+	wrapped := NewHooked(st, "topic", 0, NewHooks())
+	ensure.Nil(t, GetFunc(wrapped, "key", func(value []byte) error {
+		ensure.DeepEqual(t, value, []byte("value"))
+		return nil
+	}))
+}
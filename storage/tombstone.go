@@ -0,0 +1,108 @@
+package storage
+
+import "fmt"
+
+// TombstonePolicy defines which values delete their keys. Codecs and
+// producers disagree whether empty values are tombstones, so the policy has
+// to match the table topic.
+type TombstonePolicy int
+
+const (
+	// TombstoneNil deletes keys set to nil and stores empty values. This is
+	// the behavior of DefaultUpdate and of Kafka's log compaction.
+	TombstoneNil TombstonePolicy = iota
+	// TombstoneEmpty deletes keys set to nil or to empty values.
+	TombstoneEmpty
+	// TombstoneNever deletes no keys on sets, nil values are stored as empty
+	// values. Keys are deleted by Delete only.
+	TombstoneNever
+)
+
+func (p TombstonePolicy) String() string {
+	switch p {
+	case TombstoneNil:
+		return "nil"
+	case TombstoneEmpty:
+		return "empty"
+	case TombstoneNever:
+		return "never"
+	}
+	return fmt.Sprintf("tombstone(%d)", int(p))
+}
+
+// IsTombstone returns whether value deletes its key.
+func (p TombstonePolicy) IsTombstone(value []byte) bool {
+	switch p {
+	case TombstoneNil:
+		return value == nil
+	case TombstoneEmpty:
+		return len(value) == 0
+	}
+	return false
+}
+
+type tombstoneStorage struct {
+	Storage
+	policy TombstonePolicy
+}
+
+// NewTombstoning wraps st so that setting a tombstone value as defined by
+// policy deletes the key instead of storing the value. Without the wrapper,
+// storages store nil as empty value.
+func NewTombstoning(st Storage, policy TombstonePolicy) Storage {
+	return &tombstoneStorage{Storage: st, policy: policy}
+}
+
+// BuilderWithTombstones wraps the storages built by builder with
+// NewTombstoning.
+func BuilderWithTombstones(builder Builder, policy TombstonePolicy) Builder {
+	return func(topic string, partition int32) (Storage, error) {
+		st, err := builder(topic, partition)
+		if err != nil {
+			return nil, err
+		}
+		return NewTombstoning(st, policy), nil
+	}
+}
+
+func (s *tombstoneStorage) Set(key string, value []byte) error {
+	if s.policy.IsTombstone(value) {
+		return s.Storage.Delete(key)
+	}
+	if value == nil {
+		value = []byte{}
+	}
+	return s.Storage.Set(key, value)
+}
+
+func (s *tombstoneStorage) WriteBatch(b *Batch) error {
+	batch := new(Batch)
+	_ = b.Replay(
+		func(key string, value []byte) error {
+			if s.policy.IsTombstone(value) {
+				batch.Delete(key)
+			} else if value == nil {
+				batch.Set(key, []byte{})
+			} else {
+				batch.Set(key, value)
+			}
+			return nil
+		},
+		func(key string) error {
+			batch.Delete(key)
+			return nil
+		},
+	)
+	if offset, ok := b.Offset(); ok {
+		batch.SetOffset(offset)
+	}
+	return WriteBatch(s.Storage, batch)
+}
+
+func (s *tombstoneStorage) Unwrap() Storage {
+	return s.Storage
+}
+
+func (s *tombstoneStorage) GetFunc(key string, fn func(value []byte) error) error {
+	return GetFunc(s.Storage, key, fn)
+}
@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/facebookgo/ensure"
+)
+
+func TestTombstoneStorage(t *testing.T) {
+	for _, tc := range []struct {
+		policy    TombstonePolicy
+		nilKept   bool
+		emptyKept bool
+	}{
+		{TombstoneNil, false, true},
+		{TombstoneEmpty, false, false},
+		{TombstoneNever, true, true},
+	} {
+		st := NewTombstoning(NewMemory(), tc.policy)
+		for _, key := range []string{"nil", "empty", "batched-nil", "batched-empty"} {
+			ensure.Nil(t, st.Set(key, []byte("value")))
+		}
+		ensure.Nil(t, st.Set("nil", nil))
+		ensure.Nil(t, st.Set("empty", []byte{}))
+		b := new(Batch)
+		b.Set("batched-nil", nil)
+		b.Set("batched-empty", []byte{})
+		ensure.Nil(t, WriteBatch(st, b))
+
+		for key, kept := range map[string]bool{
+			"nil":           tc.nilKept,
+			"batched-nil":   tc.nilKept,
+			"empty":         tc.emptyKept,
+			"batched-empty": tc.emptyKept,
+		} {
+			has, err := st.Has(key)
+			ensure.Nil(t, err)
+			ensure.True(t, has == kept, tc.policy, key)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// ttlHeaderSize is the size of the expiry time stored in front of the values.
+const ttlHeaderSize = 8
+
+// TimestampSetter is implemented by storages that use the time entries were
+// written, eg, to expire them after a TTL.
+type TimestampSetter interface {
+	// SetWithTimestamp sets key to value written at ts.
+	SetWithTimestamp(key string, value []byte, ts time.Time) error
+}
+
+// SetWithTimestamp sets key to value written at ts if st implements
+// TimestampSetter. Otherwise it sets key to value with Set.
+func SetWithTimestamp(st Storage, key string, value []byte, ts time.Time) error {
+	if tss, ok := st.(TimestampSetter); ok {
+		return tss.SetWithTimestamp(key, value, ts)
+	}
+	return st.Set(key, value)
+}
+
+// TTLStorage is a storage whose entries expire. Expired entries are not
+// returned anymore and are removed when the storage is purged. Entries set
+// with a timestamp, eg, the timestamp of the message they are recovered from,
+// expire after the TTL counted from the timestamp, so recovering a storage
+// does not extend the lifetime of its entries.
+type TTLStorage interface {
+	TimestampSetter
+	Storage
+	// SetWithTTL sets key to value, expiring after ttl instead of the default
+	// TTL of the storage. A ttl of zero never expires.
+	SetWithTTL(key string, value []byte, ttl time.Duration) error
+	// Purge removes all expired entries and returns how many were removed.
+	Purge() (int, error)
+}
+
+type ttlStorage struct {
+	Storage
+	ttl time.Duration
+	now func() time.Time
+}
+
+// NewTTL wraps st so that the entries set expire after ttl. The expiry time is
+// stored in front of the values in st, so st must not contain entries written
+// without the wrapper. A ttl of zero never expires.
+func NewTTL(st Storage, ttl time.Duration) TTLStorage {
+	return &ttlStorage{Storage: st, ttl: ttl, now: time.Now}
+}
+
+// BuilderWithTTL wraps the storages built by builder with NewTTL.
+func BuilderWithTTL(builder Builder, ttl time.Duration) Builder {
+	return func(topic string, partition int32) (Storage, error) {
+		st, err := builder(topic, partition)
+		if err != nil {
+			return nil, err
+		}
+		return NewTTL(st, ttl), nil
+	}
+}
+
+// encode prefixes value with its expiry time in unix nanoseconds, zero
+// meaning no expiry. The ttl is counted from written or from now if written is
+// zero.
+func (s *ttlStorage) encode(value []byte, written time.Time, ttl time.Duration) []byte {
+	var expiry int64
+	if ttl > 0 {
+		if written.IsZero() {
+			written = s.now()
+		}
+		expiry = written.Add(ttl).UnixNano()
+	}
+	data := make([]byte, ttlHeaderSize+len(value))
+	binary.BigEndian.PutUint64(data, uint64(expiry))
+	copy(data[ttlHeaderSize:], value)
+	return data
+}
+
+// decode returns the value of data and whether it has expired.
+func (s *ttlStorage) decode(data []byte) ([]byte, bool, error) {
+	if len(data) < ttlHeaderSize {
+		return nil, false, fmt.Errorf("invalid ttl entry of size %d", len(data))
+	}
+	expiry := int64(binary.BigEndian.Uint64(data))
+	expired := expiry != 0 && s.now().UnixNano() >= expiry
+	return data[ttlHeaderSize:], expired, nil
+}
+
+func (s *ttlStorage) Has(key string) (bool, error) {
+	value, err := s.Get(key)
+	return value != nil, err
+}
+
+// Get returns the value of key or nil if the key does not exist or has
+// expired.
+func (s *ttlStorage) Get(key string) ([]byte, error) {
+	data, err := s.Storage.Get(key)
+	if err != nil || data == nil {
+		return nil, err
+	}
+	value, expired, err := s.decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding key %s: %v", key, err)
+	}
+	if expired {
+		return nil, nil
+	}
+	return value, nil
+}
+
+func (s *ttlStorage) Set(key string, value []byte) error {
+	return s.SetWithTTL(key, value, s.ttl)
+}
+
+func (s *ttlStorage) SetWithTTL(key string, value []byte, ttl time.Duration) error {
+	return s.Storage.Set(key, s.encode(value, time.Time{}, ttl))
+}
+
+// SetWithTimestamp sets key to value expiring after the TTL of the storage
+// counted from ts.
+func (s *ttlStorage) SetWithTimestamp(key string, value []byte, ts time.Time) error {
+	return s.Storage.Set(key, s.encode(value, ts, s.ttl))
+}
+
+// WriteBatch writes the updates of the batch expiring after the TTL of the
+// storage, counted from their timestamps if set with one.
+func (s *ttlStorage) WriteBatch(b *Batch) error {
+	encoded := new(Batch)
+	for _, u := range b.updates {
+		if u.delete {
+			encoded.Delete(u.key)
+		} else {
+			encoded.Set(u.key, s.encode(u.value, u.ts, s.ttl))
+		}
+	}
+	if offset, ok := b.Offset(); ok {
+		encoded.SetOffset(offset)
+	}
+	return WriteBatch(s.Storage, encoded)
+}
+
+func (s *ttlStorage) Unwrap() Storage {
+	return s.Storage
+}
+
+func (s *ttlStorage) Iterator() (Iterator, error) {
+	iter, err := s.Storage.Iterator()
+	if err != nil {
+		return nil, err
+	}
+	return &ttlIterator{iter: iter, s: s}, nil
+}
+
+func (s *ttlStorage) IteratorWithRange(start, limit []byte) (Iterator, error) {
+	iter, err := s.Storage.IteratorWithRange(start, limit)
+	if err != nil {
+		return nil, err
+	}
+	return &ttlIterator{iter: iter, s: s}, nil
+}
+
+func (s *ttlStorage) Purge() (int, error) {
+	iter, err := s.Storage.Iterator()
+	if err != nil {
+		return 0, err
+	}
+	var expired []string
+	for iter.Next() {
+		data, err := iter.Value()
+		if err != nil {
+			iter.Release()
+			return 0, err
+		}
+		if _, exp, err := s.decode(data); err == nil && exp {
+			expired = append(expired, string(iter.Key()))
+		}
+	}
+	iter.Release()
+
+	for i, key := range expired {
+		if err := s.Storage.Delete(key); err != nil {
+			return i, fmt.Errorf("error deleting expired key %s: %v", key, err)
+		}
+	}
+	return len(expired), nil
+}
+
+// ttlIterator skips the expired entries of the wrapped iterator.
+type ttlIterator struct {
+	iter  Iterator
+	s     *ttlStorage
+	value []byte
+	err   error
+}
+
+// skip advances the wrapped iterator to the next entry that has not expired.
+func (i *ttlIterator) skip(valid bool) bool {
+	for ; valid; valid = i.iter.Next() {
+		data, err := i.iter.Value()
+		if err != nil {
+			i.value, i.err = nil, err
+			return true
+		}
+		value, expired, err := i.s.decode(data)
+		if err != nil {
+			i.value, i.err = nil, fmt.Errorf("error decoding key %s: %v", i.iter.Key(), err)
+			return true
+		}
+		if !expired {
+			i.value, i.err = value, nil
+			return true
+		}
+	}
+	i.value, i.err = nil, nil
+	return false
+}
+
+func (i *ttlIterator) Next() bool {
+	return i.skip(i.iter.Next())
+}
+
+func (i *ttlIterator) Key() []byte {
+	return i.iter.Key()
+}
+
+func (i *ttlIterator) Value() ([]byte, error) {
+	return i.value, i.err
+}
+
+func (i *ttlIterator) Release() {
+	i.iter.Release()
+}
+
+func (i *ttlIterator) Seek(key []byte) bool {
+	return i.skip(i.iter.Seek(key))
+}
@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/facebookgo/ensure"
+)
+
+func TestTTLStorage(t *testing.T) {
+	now := time.Unix(1000, 0)
+	st := NewTTL(NewMemory(), time.Minute)
+	st.(*ttlStorage).now = func() time.Time { return now }
+
+	ensure.Nil(t, st.Set("key-1", []byte("value-1")))
+	ensure.Nil(t, st.SetWithTTL("key-2", []byte("value-2"), time.Hour))
+	ensure.Nil(t, st.SetWithTTL("key-3", []byte("value-3"), 0))
+	b := new(Batch)
+	b.Set("key-4", []byte("value-4"))
+	ensure.Nil(t, WriteBatch(st, b))
+
+	value, err := st.Get("key-1")
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, value, []byte("value-1"))
+
+	// key-1 and key-4 expire
+	now = now.Add(2 * time.Minute)
+	has, err := st.Has("key-1")
+	ensure.Nil(t, err)
+	ensure.False(t, has)
+	value, err = st.Get("key-2")
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, value, []byte("value-2"))
+
+	iter, err := st.Iterator()
+	ensure.Nil(t, err)
+	var keys []string
+	for iter.Next() {
+		value, err := iter.Value()
+		ensure.Nil(t, err)
+		ensure.DeepEqual(t, string(value), "value"+string(iter.Key())[3:])
+		keys = append(keys, string(iter.Key()))
+	}
+	iter.Release()
+	ensure.DeepEqual(t, keys, []string{"key-2", "key-3"})
+
+	n, err := st.Purge()
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, n, 2)
+	n, err = st.Purge()
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, n, 0)
+
+	// entries without ttl never expire
+	now = now.Add(24 * time.Hour)
+	value, err = st.Get("key-3")
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, value, []byte("value-3"))
+}
+
+func TestTTLStorage_timestamp(t *testing.T) {
+	now := time.Unix(1000, 0)
+	st := NewTTL(NewMemory(), time.Minute)
+	st.(*ttlStorage).now = func() time.Time { return now }
+
+	// entries expire after the ttl counted from their timestamps
+	ensure.Nil(t, st.SetWithTimestamp("key-1", []byte("value-1"), now.Add(-2*time.Minute)))
+	ensure.Nil(t, st.SetWithTimestamp("key-2", []byte("value-2"), now.Add(-30*time.Second)))
+	b := new(Batch)
+	b.SetWithTimestamp("key-3", []byte("value-3"), now.Add(-2*time.Minute))
+	b.SetWithTimestamp("key-4", []byte("value-4"), now.Add(-30*time.Second))
+	b.Set("key-5", []byte("value-5"))
+	ensure.Nil(t, WriteBatch(st, b))
+
+	for _, key := range []string{"key-1", "key-3"} {
+		has, err := st.Has(key)
+		ensure.Nil(t, err)
+		ensure.False(t, has)
+	}
+	for _, key := range []string{"key-2", "key-4", "key-5"} {
+		has, err := st.Has(key)
+		ensure.Nil(t, err)
+		ensure.True(t, has)
+	}
+
+	now = now.Add(45 * time.Second)
+	for _, key := range []string{"key-2", "key-4"} {
+		has, err := st.Has(key)
+		ensure.Nil(t, err)
+		ensure.False(t, has)
+	}
+	has, err := st.Has("key-5")
+	ensure.Nil(t, err)
+	ensure.True(t, has)
+
+	// storages without timestamps ignore them
+	mem := NewMemory()
+	ensure.Nil(t, SetWithTimestamp(mem, "key", []byte("value"), now))
+	value, err := mem.Get("key")
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, value, []byte("value"))
+}
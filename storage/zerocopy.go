@@ -0,0 +1,25 @@
+package storage
+
+// ZeroCopyGetter is implemented by storages that can pass values to the
+// caller without copying them, eg, directly from the block cache. This saves
+// allocations for large values that are only read, eg, to be decoded or
+// written to a response.
+type ZeroCopyGetter interface {
+	// GetFunc calls fn with the value of key, nil if the key does not exist.
+	// The value is only valid during fn and must not be modified.
+	GetFunc(key string, fn func(value []byte) error) error
+}
+
+// GetFunc calls fn with the value of key in st without copying the value if
+// st implements ZeroCopyGetter. Otherwise it calls fn with the result of Get.
+// The value is only valid during fn and must not be modified.
+func GetFunc(st Storage, key string, fn func(value []byte) error) error {
+	if zc, ok := st.(ZeroCopyGetter); ok {
+		return zc.GetFunc(key, fn)
+	}
+	value, err := st.Get(key)
+	if err != nil {
+		return err
+	}
+	return fn(value)
+}
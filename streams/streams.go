@@ -0,0 +1,108 @@
+// Package streams provides ready-made group graphs for common stateless
+// topic-to-topic transformations.
+//
+// The group graphs can be passed directly to goka.NewProcessor:
+//
+//	p, err := goka.NewProcessor(brokers,
+//	  streams.Filter("filter-group", "input", "output", new(codec.String),
+//	    func(key string, value interface{}) bool {
+//	      return value.(string) != ""
+//	    }),
+//	)
+package streams
+
+import (
+	"fmt"
+
+	"github.com/lovoo/goka"
+)
+
+// KeyValue is a message to be emitted by a FlatMapper.
+type KeyValue struct {
+	Key   string
+	Value interface{}
+}
+
+// Predicate decides whether a message should be forwarded.
+type Predicate func(key string, value interface{}) bool
+
+// Mapper transforms a message into another message.
+type Mapper func(key string, value interface{}) (string, interface{})
+
+// FlatMapper transforms a message into zero or more messages.
+type FlatMapper func(key string, value interface{}) []KeyValue
+
+// Route is an output of Branch. Messages matching Predicate are emitted into
+// Output encoded with Codec.
+type Route struct {
+	Output    goka.Stream
+	Codec     goka.Codec
+	Predicate Predicate
+}
+
+// Filter defines a group that forwards the messages of input matching pred
+// into output. Input and output share the same codec.
+func Filter(group goka.Group, input, output goka.Stream, c goka.Codec, pred Predicate) *goka.GroupGraph {
+	return goka.DefineGroup(group,
+		goka.Input(input, c, func(ctx goka.Context, msg interface{}) {
+			if pred(ctx.Key(), msg) {
+				ctx.Emit(output, ctx.Key(), msg)
+			}
+		}),
+		goka.Output(output, c),
+	)
+}
+
+// Map defines a group that transforms every message of input with fn and
+// emits the result into output.
+func Map(group goka.Group, input goka.Stream, inCodec goka.Codec, output goka.Stream, outCodec goka.Codec, fn Mapper) *goka.GroupGraph {
+	return goka.DefineGroup(group,
+		goka.Input(input, inCodec, func(ctx goka.Context, msg interface{}) {
+			key, value := fn(ctx.Key(), msg)
+			ctx.Emit(output, key, value)
+		}),
+		goka.Output(output, outCodec),
+	)
+}
+
+// FlatMap defines a group that transforms every message of input with fn
+// into zero or more messages and emits them into output.
+func FlatMap(group goka.Group, input goka.Stream, inCodec goka.Codec, output goka.Stream, outCodec goka.Codec, fn FlatMapper) *goka.GroupGraph {
+	return goka.DefineGroup(group,
+		goka.Input(input, inCodec, func(ctx goka.Context, msg interface{}) {
+			for _, kv := range fn(ctx.Key(), msg) {
+				ctx.Emit(output, kv.Key, kv.Value)
+			}
+		}),
+		goka.Output(output, outCodec),
+	)
+}
+
+// Branch defines a group that emits every message of input into the output
+// of the first route whose predicate matches. Messages matching no route are
+// dropped. Branch panics if two routes share an output, combine their
+// predicates instead. The routes are passed to goka.Branch, so the codecs of
+// the routes must be of the same type as c.
+func Branch(group goka.Group, input goka.Stream, c goka.Codec, routes ...Route) *goka.GroupGraph {
+	var (
+		outputs []goka.Edge
+		seen    = make(map[goka.Stream]bool)
+	)
+	for _, r := range routes {
+		if seen[r.Output] {
+			panic(fmt.Errorf("Branch %s: output %s is routed twice", input, r.Output))
+		}
+		seen[r.Output] = true
+		outputs = append(outputs, goka.Output(r.Output, r.Codec))
+	}
+	return goka.DefineGroup(group,
+		goka.Branch(input, c, func(ctx goka.Context, msg interface{}) goka.Stream {
+			for _, r := range routes {
+				if r.Predicate(ctx.Key(), msg) {
+					return r.Output
+				}
+			}
+			return ""
+		}, outputs...),
+	)
+}
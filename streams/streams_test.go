@@ -0,0 +1,120 @@
+package streams
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/lovoo/goka"
+	"github.com/lovoo/goka/codec"
+	"github.com/lovoo/goka/tester"
+
+	"github.com/facebookgo/ensure"
+)
+
+func runGraph(t *testing.T, gg *goka.GroupGraph) *tester.Tester {
+	gkt := tester.New(t)
+	proc, err := goka.NewProcessor([]string{}, gg, goka.WithTester(gkt))
+	ensure.Nil(t, err)
+	go proc.Run(context.Background())
+	return gkt
+}
+
+func TestFilter(t *testing.T) {
+	gkt := runGraph(t, Filter("group", "input", "output", new(codec.String),
+		func(key string, value interface{}) bool {
+			return value.(string) != "drop"
+		}),
+	)
+	mt := gkt.NewQueueTracker("output")
+
+	gkt.Consume("input", "a", "keep")
+	gkt.Consume("input", "b", "drop")
+
+	key, value, ok := mt.Next()
+	ensure.True(t, ok)
+	ensure.DeepEqual(t, key, "a")
+	ensure.DeepEqual(t, value, "keep")
+	_, _, ok = mt.Next()
+	ensure.False(t, ok)
+}
+
+func TestMap(t *testing.T) {
+	gkt := runGraph(t, Map("group", "input", new(codec.String), "output", new(codec.String),
+		func(key string, value interface{}) (string, interface{}) {
+			return strings.ToUpper(key), strings.ToUpper(value.(string))
+		}),
+	)
+	mt := gkt.NewQueueTracker("output")
+
+	gkt.Consume("input", "a", "value")
+
+	key, value, ok := mt.Next()
+	ensure.True(t, ok)
+	ensure.DeepEqual(t, key, "A")
+	ensure.DeepEqual(t, value, "VALUE")
+}
+
+func TestFlatMap(t *testing.T) {
+	gkt := runGraph(t, FlatMap("group", "input", new(codec.String), "output", new(codec.String),
+		func(key string, value interface{}) []KeyValue {
+			var kvs []KeyValue
+			for _, word := range strings.Fields(value.(string)) {
+				kvs = append(kvs, KeyValue{Key: word, Value: key})
+			}
+			return kvs
+		}),
+	)
+	mt := gkt.NewQueueTracker("output")
+
+	gkt.Consume("input", "a", "hello world")
+
+	key, value, ok := mt.Next()
+	ensure.True(t, ok)
+	ensure.DeepEqual(t, key, "hello")
+	ensure.DeepEqual(t, value, "a")
+	key, value, ok = mt.Next()
+	ensure.True(t, ok)
+	ensure.DeepEqual(t, key, "world")
+	ensure.DeepEqual(t, value, "a")
+}
+
+func TestBranch(t *testing.T) {
+	gkt := runGraph(t, Branch("group", "input", new(codec.String),
+		Route{Output: "short", Codec: new(codec.String), Predicate: func(key string, value interface{}) bool {
+			return len(value.(string)) < 5
+		}},
+		Route{Output: "long", Codec: new(codec.String), Predicate: func(key string, value interface{}) bool {
+			return true
+		}},
+	))
+	short := gkt.NewQueueTracker("short")
+	long := gkt.NewQueueTracker("long")
+
+	gkt.Consume("input", "a", "abc")
+	gkt.Consume("input", "b", "abcdefg")
+
+	key, _, ok := short.Next()
+	ensure.True(t, ok)
+	ensure.DeepEqual(t, key, "a")
+	key, _, ok = long.Next()
+	ensure.True(t, ok)
+	ensure.DeepEqual(t, key, "b")
+}
+
+func TestBranch_sharedOutput(t *testing.T) {
+	defer func() {
+		err, ok := recover().(error)
+		ensure.True(t, ok)
+		ensure.StringContains(t, err.Error(), "output valid is routed twice")
+	}()
+	Branch("group", "input", new(codec.String),
+		Route{Output: "valid", Codec: new(codec.String), Predicate: func(key string, value interface{}) bool {
+			return strings.HasPrefix(value.(string), "a")
+		}},
+		Route{Output: "valid", Codec: new(codec.String), Predicate: func(key string, value interface{}) bool {
+			return strings.HasPrefix(value.(string), "b")
+		}},
+	)
+	t.Fatalf("Branch accepted two routes to the same output")
+}
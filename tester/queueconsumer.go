@@ -30,13 +30,50 @@ const (
 type queueConsumer struct {
 	queue           *queue
 	nextOffset      int64
-	waitEventBuffer sync.WaitGroup
+	waitEventBuffer pendingEvents
 	state           *Signal
 	eventBuffer     chan kafka.Event
 	events          chan kafka.Event
 	consumer        *consumer
 }
 
+// pendingEvents counts the events in the buffer that are not processed yet.
+// Unlike a sync.WaitGroup it may be incremented while waiting, which happens
+// when the consumer catches up again before the last wait was abandoned.
+type pendingEvents struct {
+	m    sync.Mutex
+	cond *sync.Cond
+	n    int
+}
+
+func (p *pendingEvents) Add(delta int) {
+	p.m.Lock()
+	defer p.m.Unlock()
+	p.n += delta
+	if p.n < 0 {
+		panic("tester: negative pending events")
+	}
+	if p.n == 0 && p.cond != nil {
+		p.cond.Broadcast()
+	}
+}
+
+func (p *pendingEvents) Done() {
+	p.Add(-1)
+}
+
+// Wait blocks until all events are processed.
+func (p *pendingEvents) Wait() {
+	p.m.Lock()
+	defer p.m.Unlock()
+	if p.cond == nil {
+		p.cond = sync.NewCond(&p.m)
+	}
+	for p.n > 0 {
+		p.cond.Wait()
+	}
+}
+
 func newQueueConsumer(topic string, queue *queue) *queueConsumer {
 	qc := &queueConsumer{
 		queue:       queue,
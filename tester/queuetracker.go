@@ -47,8 +47,8 @@ func (mt *QueueTracker) NextRaw() (string, []byte, bool) {
 	return msg.key, msg.value, true
 }
 
-// Seek moves the index pointer of the queue tracker to passed offset
-func (mt *QueueTracker) Seek(offset int64) {
+// SeekOffset moves the index pointer of the queue tracker to passed offset
+func (mt *QueueTracker) SeekOffset(offset int64) {
 	mt.nextOffset = offset
 }
 
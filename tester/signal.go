@@ -51,11 +51,13 @@ func (s *Signal) SetState(state State) *Signal {
 
 // IsState returns if the signal is in the requested state
 func (s *Signal) IsState(state State) bool {
-	return s.state == state
+	return s.State() == state
 }
 
 // State returns the current state
 func (s *Signal) State() State {
+	s.Lock()
+	defer s.Unlock()
 	return s.state
 }
 
@@ -66,7 +68,7 @@ func (s *Signal) WaitForState(state State) chan struct{} {
 	defer s.Unlock()
 	cb := make(chan struct{})
 
-	if s.IsState(state) {
+	if s.state == state {
 		close(cb)
 	} else {
 		s.waitChans[state] = append(s.waitChans[state], cb)
@@ -51,6 +51,7 @@ type Tester struct {
 	topicMgrMock *topicMgrMock
 	emitHandler  EmitHandler
 	storages     map[string]storage.Storage
+	mStorages    sync.RWMutex
 
 	codecs      map[string]goka.Codec
 	topicQueues map[string]*queue
@@ -77,7 +78,7 @@ func (km *Tester) NewQueueTracker(topic string) *QueueTracker {
 	mt := newQueueTracker(km, km.t, topic)
 	km.mQueues.RLock()
 	defer km.mQueues.RUnlock()
-	mt.Seek(mt.Hwm())
+	mt.SeekOffset(mt.Hwm())
 	return mt
 }
 
@@ -171,6 +172,11 @@ func (km *Tester) RegisterGroupGraph(gg *goka.GroupGraph) {
 		km.registerCodec(loop.Topic(), loop.Codec())
 	}
 
+	for _, rekey := range gg.RekeyStreams() {
+		km.getOrCreateQueue(rekey.Topic()).expectGroupConsumer()
+		km.registerCodec(rekey.Topic(), rekey.Codec())
+	}
+
 	for _, lookup := range gg.LookupTables() {
 		km.getOrCreateQueue(lookup.Topic()).expectSimpleConsumer()
 		km.registerCodec(lookup.Topic(), lookup.Codec())
@@ -212,6 +218,8 @@ func (km *Tester) ProducerBuilder() kafka.ProducerBuilder {
 // to a processor
 func (km *Tester) StorageBuilder() storage.Builder {
 	return func(topic string, partition int32) (storage.Storage, error) {
+		km.mStorages.Lock()
+		defer km.mStorages.Unlock()
 		if st, exists := km.storages[topic]; exists {
 			return st, nil
 		}
@@ -221,6 +229,13 @@ func (km *Tester) StorageBuilder() storage.Builder {
 	}
 }
 
+func (km *Tester) storageForTopic(topic string) (storage.Storage, bool) {
+	km.mStorages.RLock()
+	defer km.mStorages.RUnlock()
+	st, exists := km.storages[topic]
+	return st, exists
+}
+
 func (km *Tester) waitForConsumers() {
 
 	logger.Printf("waiting for consumers")
@@ -304,7 +319,7 @@ func (km *Tester) TableValue(table goka.Table, key string) interface{} {
 	km.waitStartup()
 
 	topic := string(table)
-	st, exists := km.storages[topic]
+	st, exists := km.storageForTopic(topic)
 	if !exists {
 		panic(fmt.Errorf("topic %s does not exist", topic))
 	}
@@ -329,7 +344,7 @@ func (km *Tester) SetTableValue(table goka.Table, key string, value interface{})
 	logger.Printf("setting value is not implemented yet.")
 
 	topic := string(table)
-	st, exists := km.storages[topic]
+	st, exists := km.storageForTopic(topic)
 	if !exists {
 		panic(fmt.Errorf("storage for topic %s does not exist", topic))
 	}
@@ -351,6 +366,8 @@ func (km *Tester) ReplaceEmitHandler(emitter EmitHandler) {
 
 // ClearValues resets all table values
 func (km *Tester) ClearValues() {
+	km.mStorages.RLock()
+	defer km.mStorages.RUnlock()
 	for topic, st := range km.storages {
 		logger.Printf("clearing all values from storage for topic %s", topic)
 		it, _ := st.Iterator()
@@ -379,6 +396,29 @@ func (tm *topicMgrMock) EnsureTopicExists(topic string, npar, rfactor int, confi
 	return nil
 }
 
+// EnsurePartitions checks that a topic has npar partitions, or increases them if possible
+func (tm *topicMgrMock) EnsurePartitions(topic string, npar int) error {
+	return nil
+}
+
+// CheckTable checks that a table topic matches its configuration.
+// No action required in the mock.
+func (tm *topicMgrMock) CheckTable(topic string, npar int) error {
+	return nil
+}
+
+// CheckStream checks that a stream topic matches its configuration.
+// No action required in the mock.
+func (tm *topicMgrMock) CheckStream(topic string, npar int) error {
+	return nil
+}
+
+// DeleteTopic deletes a topic.
+// No action required in the mock.
+func (tm *topicMgrMock) DeleteTopic(topic string) error {
+	return nil
+}
+
 // Partitions returns the number of partitions of a topic, that are assigned to the running
 // instance, i.e. it doesn't represent all partitions of a topic.
 func (tm *topicMgrMock) Partitions(topic string) ([]int32, error) {
@@ -414,6 +454,12 @@ func (p *producerMock) Emit(topic string, key string, value []byte) *kafka.Promi
 	return p.emitter(topic, key, value)
 }
 
+// EmitMessage emits a message like Emit. The headers and the partition of the
+// message are dropped.
+func (p *producerMock) EmitMessage(msg *kafka.ProducerMessage) *kafka.Promise {
+	return p.emitter(msg.Topic, msg.Key, msg.Value)
+}
+
 // Close closes the producer mock
 // No action required in the mock.
 func (p *producerMock) Close() error {
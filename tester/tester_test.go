@@ -91,7 +91,7 @@ func Test_SimplePersist(t *testing.T) {
 	)
 	go func() {
 		err := proc.Run(context.Background())
-		t.Fatalf("Processor run errors: %v", err)
+		t.Errorf("Processor run errors: %v", err)
 	}()
 
 	for i := 0; i < 100; i++ {
@@ -117,7 +117,7 @@ func Test_Persist_InitialState(t *testing.T) {
 
 	go func() {
 		err := proc.Run(context.Background())
-		t.Fatalf("Processor run errors: %v", err)
+		t.Errorf("Processor run errors: %v", err)
 	}()
 
 	gkt.SetTableValue("group-table", "existing", int64(150))
@@ -212,6 +212,60 @@ func Test_Loop(t *testing.T) {
 	}
 }
 
+func Test_ReKey(t *testing.T) {
+	gkt := New(t)
+
+	// counts the messages of input by their value
+	proc, _ := goka.NewProcessor([]string{}, goka.DefineGroup("rekeytest",
+		goka.ReKey("input", new(codec.String), func(ctx goka.Context, msg interface{}) string {
+			return msg.(string)
+		}, increment),
+		goka.Persist(new(codec.Int64)),
+	),
+		goka.WithTester(gkt),
+	)
+	runProcOrFail(proc)
+
+	gkt.Consume("input", "a", "user")
+	gkt.Consume("input", "b", "user")
+	if gkt.TableValue("rekeytest-table", "user").(int64) != 2 {
+		t.Fatalf("rekey failed")
+	}
+}
+
+func Test_VisitAll(t *testing.T) {
+	gkt := New(t)
+
+	proc, _ := goka.NewProcessor([]string{}, goka.DefineGroup("visittest",
+		goka.Input("input", new(codec.Int64), func(ctx goka.Context, msg interface{}) {
+			ctx.SetValue(msg)
+		}),
+		goka.Visitor("reset", func(ctx goka.Context, msg interface{}) {
+			ctx.SetValue(msg)
+		}),
+		goka.Persist(new(codec.Int64)),
+	),
+		goka.WithTester(gkt),
+	)
+	runProcOrFail(proc)
+
+	gkt.Consume("input", "a", int64(1))
+	gkt.Consume("input", "b", int64(2))
+
+	if err := proc.VisitAll(context.Background(), "reset", int64(0)); err != nil {
+		t.Fatalf("error visiting: %v", err)
+	}
+	for _, key := range []string{"a", "b"} {
+		if gkt.TableValue("visittest-table", key).(int64) != 0 {
+			t.Fatalf("key %s not visited", key)
+		}
+	}
+
+	if err := proc.VisitAll(context.Background(), "unknown", nil); err == nil {
+		t.Fatalf("visiting with unknown visitor should fail")
+	}
+}
+
 func Test_Lookup(t *testing.T) {
 
 	gkt := New(t)
@@ -0,0 +1,5 @@
+module github.com/bsm/sarama-cluster
+
+go 1.18
+
+require github.com/Shopify/sarama v1.38.1
@@ -0,0 +1,67 @@
+// Package typed provides type-safe accessors for goka.Context using type
+// parameters. Instead of casting interface{} values in every callback, the
+// expected type is given once at the call site:
+//
+//	func process(ctx goka.Context, msg interface{}) {
+//		count := typed.Value[int64](ctx)
+//		typed.SetValue(ctx, count+1)
+//		user := typed.Join[*User](ctx, "users-table")
+//	}
+//
+// If a value has an unexpected type, the accessors fail the context, which
+// stops the processor.
+package typed
+
+import (
+	"fmt"
+
+	"github.com/lovoo/goka"
+)
+
+// Value returns the value of the key in the group table. If the key has no
+// value, the zero value of T is returned.
+func Value[T any](ctx goka.Context) T {
+	return cast[T](ctx, ctx.Value(), "group table")
+}
+
+// SetValue updates the value of the key in the group table.
+func SetValue[T any](ctx goka.Context, value T) {
+	ctx.SetValue(value)
+}
+
+// Join returns the value of the key in the copartitioned table. If the key
+// has no value, the zero value of T is returned.
+func Join[T any](ctx goka.Context, table goka.Table) T {
+	return cast[T](ctx, ctx.Join(table), string(table))
+}
+
+// Lookup returns the value of key in the view of table. If the key has no
+// value, the zero value of T is returned.
+func Lookup[T any](ctx goka.Context, table goka.Table, key string) T {
+	return cast[T](ctx, ctx.Lookup(table, key), string(table))
+}
+
+// Emit asynchronously writes a message into a topic.
+func Emit[T any](ctx goka.Context, topic goka.Stream, key string, value T) {
+	ctx.Emit(topic, key, value)
+}
+
+// Callback converts a callback receiving messages of type M into a
+// goka.ProcessCallback. Messages of another type fail the context.
+func Callback[M any](cb func(ctx goka.Context, msg M)) goka.ProcessCallback {
+	return func(ctx goka.Context, msg interface{}) {
+		cb(ctx, cast[M](ctx, msg, string(ctx.Topic())))
+	}
+}
+
+func cast[T any](ctx goka.Context, value interface{}, source string) T {
+	var zero T
+	if value == nil {
+		return zero
+	}
+	v, ok := value.(T)
+	if !ok {
+		ctx.Fail(fmt.Errorf("value of %s has type %T instead of %T", source, value, zero))
+	}
+	return v
+}
@@ -0,0 +1,51 @@
+package typed
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lovoo/goka"
+	"github.com/lovoo/goka/codec"
+	"github.com/lovoo/goka/tester"
+
+	"github.com/facebookgo/ensure"
+)
+
+func TestTyped(t *testing.T) {
+	gkt := tester.New(t)
+
+	var failed error
+	gg := goka.DefineGroup("group",
+		goka.Input("input", new(codec.String), Callback(func(ctx goka.Context, msg string) {
+			defer func() {
+				if r := recover(); r != nil {
+					failed = r.(error)
+				}
+			}()
+			if msg == "bad" {
+				Value[string](ctx)
+				return
+			}
+			SetValue(ctx, Value[int64](ctx)+1)
+			Emit(ctx, "output", ctx.Key(), msg)
+		})),
+		goka.Output("output", new(codec.String)),
+		goka.Persist(new(codec.Int64)),
+	)
+	proc, err := goka.NewProcessor([]string{}, gg, goka.WithTester(gkt))
+	ensure.Nil(t, err)
+	go proc.Run(context.Background())
+
+	mt := gkt.NewQueueTracker("output")
+	gkt.Consume("input", "key", "a")
+	gkt.Consume("input", "key", "b")
+
+	ensure.DeepEqual(t, gkt.TableValue("group-table", "key"), int64(2))
+	_, value, ok := mt.Next()
+	ensure.True(t, ok)
+	ensure.DeepEqual(t, value, "a")
+
+	gkt.Consume("input", "key", "bad")
+	ensure.NotNil(t, failed)
+	ensure.StringContains(t, failed.Error(), "has type int64 instead of string")
+}
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"log"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/lovoo/goka/kafka"
 	"github.com/lovoo/goka/logger"
@@ -13,6 +15,10 @@ import (
 	"github.com/lovoo/goka/storage"
 )
 
+// viewRecoveryPollInterval is the interval in which WaitRecovered checks
+// whether the view has recovered.
+const viewRecoveryPollInterval = 100 * time.Millisecond
+
 // Getter functions return a value for a key or an error. If no value exists for the key, nil is returned without errors.
 type Getter func(string) (interface{}, error)
 
@@ -24,6 +30,13 @@ type View struct {
 	partitions []*partition
 	consumer   kafka.Consumer
 	terminated bool
+	watchers   watchers
+	cache      *valueCache
+	lazy       *lazyPartitions
+	limiter    *rateLimiter
+
+	// snapshotMu blocks updates of the partitions while a snapshot is taken
+	snapshotMu sync.RWMutex
 }
 
 // NewView creates a new View object from a group.
@@ -32,7 +45,6 @@ func NewView(brokers []string, topic Table, codec Codec, options ...ViewOption)
 		// default options comes first
 		[]ViewOption{
 			WithViewLogger(logger.Default()),
-			WithViewCallback(DefaultUpdate),
 			WithViewPartitionChannelSize(defaultPartitionChannelSize),
 			WithViewStorageBuilder(storage.DefaultBuilder(DefaultViewStoragePath())),
 		},
@@ -49,12 +61,26 @@ func NewView(brokers []string, topic Table, codec Codec, options ...ViewOption)
 	}
 
 	opts.tableCodec = codec
+	if opts.projection != nil {
+		// the view stores the projected values
+		opts.topicCodec = codec
+		opts.tableCodec = opts.projectionCodec
+	}
 
 	v := &View{
 		brokers: brokers,
 		topic:   string(topic),
 		opts:    opts,
 	}
+	if opts.cacheSize > 0 {
+		v.cache = newValueCache(opts.cacheSize, opts.cacheTTL)
+	}
+	if opts.lazy {
+		v.lazy = new(lazyPartitions)
+	}
+	if opts.recoveryRate > 0 {
+		v.limiter = newRateLimiter(opts.recoveryRate)
+	}
 
 	if err = v.createPartitions(brokers); err != nil {
 		return nil, err
@@ -75,11 +101,31 @@ func (v *View) createPartitions(brokers []string) (rerr error) {
 		}
 	}()
 
+	if v.opts.createPartitions > 0 {
+		if err = tm.EnsureTableExists(v.topic, v.opts.createPartitions); err != nil {
+			return fmt.Errorf("Error creating table topic %s: %v", v.topic, err)
+		}
+	}
+
 	partitions, err := tm.Partitions(v.topic)
 	if err != nil {
 		return fmt.Errorf("Error getting partitions for topic %s: %v", v.topic, err)
 	}
 
+	if v.opts.checkTopics {
+		tc, ok := tm.(kafka.TopicChecker)
+		if !ok {
+			return fmt.Errorf("topic manager cannot check topics")
+		}
+		npar := v.opts.createPartitions
+		if npar <= 0 {
+			npar = len(partitions)
+		}
+		if err = tc.CheckTable(v.topic, npar); err != nil {
+			return err
+		}
+	}
+
 	// check assumption that partitions are gap-less
 	for i, p := range partitions {
 		if i != int(p) {
@@ -87,19 +133,53 @@ func (v *View) createPartitions(brokers []string) (rerr error) {
 		}
 	}
 
+	for p := range v.opts.partitions {
+		if int(p) >= len(partitions) || p < 0 {
+			return fmt.Errorf("Partition %d does not exist in topic %s", p, v.topic)
+		}
+	}
+
 	v.opts.log.Printf("Table %s has %d partitions", v.topic, len(partitions))
 	for _, p := range partitions {
-		st, err := v.opts.builders.storage(v.topic, p)
+		if len(v.opts.partitions) > 0 && !v.opts.partitions[p] {
+			// partition not materialized by this view
+			v.partitions = append(v.partitions, nil)
+			continue
+		}
+		st, err := v.opts.builders.storage(context.Background(), v.opts.log, v.topic, p)
 		if err != nil {
 			// TODO(diogo): gracefully terminate all partitions
 			return fmt.Errorf("Error creating local storage for partition %d: %v", p, err)
 		}
+		if len(v.opts.indexes) > 0 {
+			ist, err := v.opts.builders.storage(context.Background(), v.opts.log, v.topic+indexTopicSuffix, p)
+			if err != nil {
+				return fmt.Errorf("Error creating index storage for partition %d: %v", p, err)
+			}
+			st = &indexedStorage{
+				Storage: st,
+				index:   ist,
+				codec:   v.opts.tableCodec,
+				indexes: v.opts.indexes,
+			}
+		}
 
 		po := newPartition(v.opts.log, v.topic, nil,
-			&storageProxy{Storage: st, partition: p, update: v.opts.updateCallback},
+			&storageProxy{Storage: st, partition: p, update: v.update, batchSize: v.opts.recoveryBatchSize, noSync: v.opts.recoveryNoSync, batchMu: v.snapshotMu.RLocker()},
 			&proxy{p, nil},
 			v.opts.partitionChannelSize,
 		)
+		po.limiter = v.limiter
+		po.tail = v.opts.tail
+		if len(v.opts.observers) > 0 {
+			po.stored = v.observe
+		}
+		if cb := v.opts.progress; cb != nil {
+			pid := p
+			po.progress = func(offset, hwm int64, recovered bool) {
+				cb(pid, offset, hwm, recovered)
+			}
+		}
 		v.partitions = append(v.partitions, po)
 	}
 
@@ -116,12 +196,19 @@ func (v *View) reinit() error {
 	if err != nil {
 		return fmt.Errorf("view: cannot create Kafka consumer: %v", err)
 	}
-	v.consumer = consumer
+	v.connect(consumer)
+	return nil
+}
 
+// connect makes the partitions of the view consume from consumer.
+func (v *View) connect(consumer kafka.Consumer) {
+	v.consumer = consumer
 	for i, p := range v.partitions {
+		if p == nil {
+			continue
+		}
 		p.reinit(&proxy{int32(i), v.consumer})
 	}
-	return nil
 }
 
 // Run starts consuming the view's topic.
@@ -129,48 +216,126 @@ func (v *View) Run(ctx context.Context) error {
 	v.opts.log.Printf("view: starting")
 	defer v.opts.log.Printf("view: stopped")
 
+	errs := v.runOnce(ctx)
+	for v.opts.reconnectBackoff > 0 && errs.transient {
+		v.opts.log.Printf("view: reconnecting in %v after error: %v", v.opts.reconnectBackoff, errs.NilOrError())
+		select {
+		case <-time.After(v.opts.reconnectBackoff):
+		case <-ctx.Done():
+			errs = &viewErrors{}
+			continue
+		}
+		errs = v.runOnce(ctx)
+	}
+
+	if !v.opts.restartable {
+		v.terminated = true
+		errs.Merge(v.close())
+	}
+
+	return errs.NilOrError()
+}
+
+// viewErrors collects the errors of a run of the view. transient is set if
+// the run failed because of the Kafka consumer.
+type viewErrors struct {
+	multierr.Errors
+	transient bool
+}
+
+func (v *View) runOnce(ctx context.Context) *viewErrors {
+	errs := new(viewErrors)
 	if err := v.reinit(); err != nil {
-		return err
+		_ = errs.Collect(err)
+		errs.transient = !v.terminated
+		return errs
 	}
 
+	var consumerFailed, partitionFailed int32
 	errg, ctx := multierr.NewErrGroup(ctx)
-	errg.Go(func() error { return v.run(ctx) })
+	errg.Go(func() error {
+		err := v.run(ctx)
+		if err != nil {
+			atomic.StoreInt32(&consumerFailed, 1)
+		}
+		return err
+	})
 
-	for id, p := range v.partitions {
-		pid, par := int32(id), p
-		errg.Go(func() error {
+	v.startPartitions(ctx, errg, &partitionFailed)
+
+	// wait for partition goroutines and shutdown
+	errs.Merge(errg.Wait())
+	if v.lazy != nil {
+		v.lazy.stop()
+	}
+
+	log.Println("view: closing consumer")
+	if err := v.consumer.Close(); err != nil {
+		_ = errs.Collect(fmt.Errorf("view: failed closing consumer: %v", err))
+	}
+
+	// errors of the partitions are not transient
+	errs.transient = consumerFailed == 1 && partitionFailed == 0
+	return errs
+}
+
+// startPartitions starts the goroutines of the partitions of the view in errg.
+// failed is set if a partition fails.
+func (v *View) startPartitions(ctx context.Context, errg *multierr.ErrGroup, failed *int32) {
+	startPartition := func(pid int32) {
+		par := v.partitions[pid]
+		errg.Go(func() (err error) {
 			v.opts.log.Printf("view: partition %d started", pid)
 			defer v.opts.log.Printf("view: partition %d stopped", pid)
-			if err := par.st.Open(); err != nil {
+			defer func() {
+				if err != nil {
+					atomic.StoreInt32(failed, 1)
+				}
+			}()
+			if err = par.st.Open(); err != nil {
 				return fmt.Errorf("view: error opening storage partition %d: %v", pid, err)
 			}
-			if err := par.startCatchup(ctx); err != nil {
+			if err = par.startCatchup(ctx); err != nil {
 				return fmt.Errorf("view: error running partition %d: %v", pid, err)
 			}
 			return nil
 		})
 	}
 
-	// wait for partition goroutines and shutdown
-	errs := errg.Wait()
-
-	log.Println("view: closing consumer")
-	if err := v.consumer.Close(); err != nil {
-		_ = errs.Collect(fmt.Errorf("view: failed closing consumer: %v", err))
-	}
-
-	if !v.opts.restartable {
-		v.terminated = true
-		errs = errs.Merge(v.close())
+	if v.lazy != nil {
+		// only start the partitions accessed so far, the others are started
+		// once they are accessed
+		active, requests := v.lazy.start(len(v.partitions))
+		for _, pid := range active {
+			startPartition(pid)
+		}
+		errg.Go(func() error {
+			for {
+				select {
+				case pid := <-requests:
+					startPartition(pid)
+				case <-ctx.Done():
+					return nil
+				}
+			}
+		})
+	} else {
+		for id, p := range v.partitions {
+			if p == nil {
+				continue
+			}
+			startPartition(int32(id))
+		}
 	}
-
-	return errs.NilOrError()
 }
 
 // close closes all storage partitions
 func (v *View) close() *multierr.Errors {
 	errs := new(multierr.Errors)
 	for _, p := range v.partitions {
+		if p == nil {
+			continue
+		}
 		_ = errs.Collect(p.st.Close())
 	}
 	v.partitions = nil
@@ -223,6 +388,14 @@ func (v *View) find(key string) (storage.Storage, error) {
 	if err != nil {
 		return nil, err
 	}
+	if v.partitions[h] == nil {
+		return nil, fmt.Errorf("partition %d of key %s is not materialized by the view", h, key)
+	}
+	if v.lazy != nil {
+		if err := v.recoverLazily(h, v.opts.lazyTimeout); err != nil {
+			return nil, err
+		}
+	}
 	return v.partitions[h].st, nil
 }
 
@@ -240,6 +413,21 @@ func (v *View) Get(key string) (interface{}, error) {
 	if err != nil {
 		return nil, err
 	}
+	return v.get(s, key)
+}
+
+// get returns the decoded value of key in the storage of its partition.
+func (v *View) get(s storage.Storage, key string) (interface{}, error) {
+	var generation uint64
+	if v.cache != nil {
+		var (
+			value  interface{}
+			cached bool
+		)
+		if value, cached, generation = v.cache.get(key); cached {
+			return value, nil
+		}
+	}
 
 	// get key and return
 	data, err := s.Get(key)
@@ -255,11 +443,66 @@ func (v *View) Get(key string) (interface{}, error) {
 		return nil, fmt.Errorf("error decoding value (key %s): %v", key, err)
 	}
 
+	if v.cache != nil {
+		v.cache.add(key, value, generation)
+	}
+
 	// if the key does not exist the return value is nil
 	return value, nil
 }
 
-// Has checks whether a value for passed key exists in the view.
+// GetFunc calls fn with the encoded value of key, nil if the key does not
+// exist. The value is only valid during fn and must not be modified. Storages
+// implementing storage.ZeroCopyGetter, like LevelDB and pebble, pass the value
+// without copying it, which reduces the allocations of views serving large
+// values. GetFunc bypasses the cache of WithViewCache.
+func (v *View) GetFunc(key string, fn func(data []byte) error) error {
+	s, err := v.find(key)
+	if err != nil {
+		return err
+	}
+	return storage.GetFunc(s, key, fn)
+}
+
+// GetWithStaleness returns the value for the key like Get, but can be used
+// while the view is still recovering. stale is true if the partition of the
+// key has not caught up with the table topic yet, so the value may be outdated
+// or missing. With WithViewLazyRecovery, it starts recovering the partition
+// but does not wait for it.
+func (v *View) GetWithStaleness(key string) (value interface{}, stale bool, err error) {
+	h, err := v.hash(key)
+	if err != nil {
+		return nil, false, err
+	}
+	p := v.partitions[h]
+	if p == nil {
+		return nil, false, fmt.Errorf("partition %d of key %s is not materialized by the view", h, key)
+	}
+	if p.recovered() {
+		value, err = v.Get(key)
+		return value, false, err
+	}
+
+	if v.lazy != nil {
+		if _, err := v.lazy.activate(h); err != nil {
+			return nil, true, fmt.Errorf("cannot recover partition %d: %v", h, err)
+		}
+	}
+	value, err = v.get(p.st, key)
+	return value, true, err
+}
+
+// PartitionRecovered returns true if the partition has caught up with the
+// table topic. Partitions not materialized by the view are never recovered.
+func (v *View) PartitionRecovered(partition int32) bool {
+	if partition < 0 || int(partition) >= len(v.partitions) || v.partitions[partition] == nil {
+		return false
+	}
+	return v.partitions[partition].recovered()
+}
+
+// Has checks whether a value for passed key exists in the view. Unlike Get, it
+// does not read or decode the value, so it is cheap for large values.
 func (v *View) Has(key string) (bool, error) {
 	// find partition where key is located
 	s, err := v.find(key)
@@ -274,6 +517,9 @@ func (v *View) Has(key string) (bool, error) {
 func (v *View) Iterator() (Iterator, error) {
 	iters := make([]storage.Iterator, 0, len(v.partitions))
 	for i := range v.partitions {
+		if v.partitions[i] == nil {
+			continue
+		}
 		iter, err := v.partitions[i].st.Iterator()
 		if err != nil {
 			// release already opened iterators
@@ -287,16 +533,16 @@ func (v *View) Iterator() (Iterator, error) {
 		iters = append(iters, iter)
 	}
 
-	return &iterator{
-		iter:  storage.NewMultiIterator(iters),
-		codec: v.opts.tableCodec,
-	}, nil
+	return NewIterator(storage.NewMultiIterator(iters), v.opts.tableCodec), nil
 }
 
 // IteratorWithRange returns an iterator that iterates over the state of the View. This iterator is build using the range.
 func (v *View) IteratorWithRange(start, limit string) (Iterator, error) {
 	iters := make([]storage.Iterator, 0, len(v.partitions))
 	for i := range v.partitions {
+		if v.partitions[i] == nil {
+			continue
+		}
 		iter, err := v.partitions[i].st.IteratorWithRange([]byte(start), []byte(limit))
 		if err != nil {
 			// release already opened iterators
@@ -310,10 +556,75 @@ func (v *View) IteratorWithRange(start, limit string) (Iterator, error) {
 		iters = append(iters, iter)
 	}
 
-	return &iterator{
-		iter:  storage.NewMultiIterator(iters),
-		codec: v.opts.tableCodec,
-	}, nil
+	return NewIterator(storage.NewMultiIterator(iters), v.opts.tableCodec), nil
+}
+
+// Snapshot returns an iterator over a consistent point-in-time state of all
+// partitions of the view. The updates of all partitions, including the batches
+// written while recovering, are paused while the iterators of the partitions
+// are created, so no update is applied in between.
+// The iterators of the default LevelDB storage read from a snapshot of the
+// storage, so updates applied after Snapshot returns are not visible either.
+// The iterator has to be released to free the snapshot.
+func (v *View) Snapshot() (Iterator, error) {
+	v.snapshotMu.Lock()
+	defer v.snapshotMu.Unlock()
+	return v.Iterator()
+}
+
+// SortedIterator returns an iterator over all keys of the View in ascending
+// order, merging the iterators of the partitions.
+func (v *View) SortedIterator() (Iterator, error) {
+	return v.sortedIterator(nil, nil)
+}
+
+// SortedIteratorFrom returns an iterator over all keys of the View not less
+// than start in ascending order. Paginated listings can continue a page at
+// the key following the last key of the previous page.
+func (v *View) SortedIteratorFrom(start string) (Iterator, error) {
+	iter, err := v.sortedIterator(nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &fromIterator{Iterator: iter, start: start}, nil
+}
+
+// IteratePrefix returns an iterator over all keys of the View starting with
+// prefix. The keys of all partitions are returned in ascending order.
+func (v *View) IteratePrefix(prefix string) (Iterator, error) {
+	return v.sortedIterator([]byte(prefix), nil)
+}
+
+// IterateRange returns an iterator over all keys of the View in the range
+// [from, to). The keys of all partitions are returned in ascending order.
+func (v *View) IterateRange(from, to string) (Iterator, error) {
+	if to == "" {
+		return nil, fmt.Errorf("invalid range: upper bound must not be empty")
+	}
+	return v.sortedIterator([]byte(from), []byte(to))
+}
+
+// sortedIterator merges the range iterators of all partitions by key.
+func (v *View) sortedIterator(start, limit []byte) (Iterator, error) {
+	iters := make([]storage.Iterator, 0, len(v.partitions))
+	for i := range v.partitions {
+		if v.partitions[i] == nil {
+			continue
+		}
+		iter, err := v.partitions[i].st.IteratorWithRange(start, limit)
+		if err != nil {
+			// release already opened iterators
+			for i := range iters {
+				iters[i].Release()
+			}
+
+			return nil, fmt.Errorf("error opening partition iterator: %v", err)
+		}
+
+		iters = append(iters, iter)
+	}
+
+	return NewIterator(storage.NewMergeIterator(iters), v.opts.tableCodec), nil
 }
 
 // Evict removes the given key only from the local cache. In order to delete a
@@ -324,6 +635,11 @@ func (v *View) Evict(key string) error {
 		return err
 	}
 
+	v.snapshotMu.RLock()
+	defer v.snapshotMu.RUnlock()
+	if v.cache != nil {
+		defer v.cache.invalidate(key)
+	}
 	return s.Delete(key)
 }
 
@@ -331,39 +647,8 @@ func (v *View) run(ctx context.Context) error {
 	for {
 		select {
 		case ev := <-v.consumer.Events():
-			switch ev := ev.(type) {
-			case *kafka.Message:
-				partition := v.partitions[int(ev.Partition)]
-				select {
-				case partition.ch <- ev:
-				case <-ctx.Done():
-					return nil
-				}
-			case *kafka.BOF:
-				partition := v.partitions[int(ev.Partition)]
-				select {
-				case partition.ch <- ev:
-				case <-ctx.Done():
-					return nil
-				}
-			case *kafka.EOF:
-				partition := v.partitions[int(ev.Partition)]
-				select {
-				case partition.ch <- ev:
-				case <-ctx.Done():
-					return nil
-				}
-			case *kafka.NOP:
-				partition := v.partitions[int(ev.Partition)]
-				select {
-				case partition.ch <- ev:
-				case <-ctx.Done():
-					return nil
-				}
-			case *kafka.Error:
-				return fmt.Errorf("view: error from kafka consumer: %v", ev)
-			default:
-				return fmt.Errorf("view: cannot handle %T = %v", ev, ev)
+			if err := v.deliver(ctx, ev); err != nil {
+				return err
 			}
 		case <-ctx.Done():
 			return nil
@@ -371,9 +656,54 @@ func (v *View) run(ctx context.Context) error {
 	}
 }
 
+// deliver passes an event of the consumer to its partition.
+func (v *View) deliver(ctx context.Context, ev kafka.Event) error {
+	var partition *partition
+	switch ev := ev.(type) {
+	case *kafka.Message:
+		partition = v.partitions[int(ev.Partition)]
+	case *kafka.BOF:
+		partition = v.partitions[int(ev.Partition)]
+	case *kafka.EOF:
+		partition = v.partitions[int(ev.Partition)]
+	case *kafka.NOP:
+		partition = v.partitions[int(ev.Partition)]
+	case *kafka.Error:
+		return fmt.Errorf("view: error from kafka consumer: %v", ev)
+	default:
+		return fmt.Errorf("view: cannot handle %T = %v", ev, ev)
+	}
+
+	select {
+	case partition.ch <- ev:
+	case <-ctx.Done():
+	}
+	return nil
+}
+
+// observe notifies the observers of the view of a stored message.
+func (v *View) observe(msg *kafka.Message) {
+	info := &ViewUpdateInfo{
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Key:       msg.Key,
+		Offset:    msg.Offset,
+	}
+	if !msg.Timestamp.IsZero() {
+		info.Latency = time.Since(msg.Timestamp)
+	}
+	for _, o := range v.opts.observers {
+		o.OnUpdate(info)
+	}
+}
+
 // Recovered returns true when the view has caught up with events from kafka.
+// A lazy view only considers the partitions accessed so far.
 func (v *View) Recovered() bool {
-	for _, p := range v.partitions {
+	for i, p := range v.partitions {
+		if p == nil || (v.lazy != nil && !v.lazy.isActive(int32(i))) {
+			continue
+		}
 		if !p.recovered() {
 			return false
 		}
@@ -382,6 +712,21 @@ func (v *View) Recovered() bool {
 	return true
 }
 
+// WaitRecovered blocks until the view has recovered or ctx is done, in which
+// case the error of ctx is returned.
+func (v *View) WaitRecovered(ctx context.Context) error {
+	ticker := time.NewTicker(viewRecoveryPollInterval)
+	defer ticker.Stop()
+	for !v.Recovered() {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
 // Stats returns a set of performance metrics of the view.
 func (v *View) Stats() *ViewStats {
 	return v.statsWithContext(context.Background())
@@ -394,8 +739,11 @@ func (v *View) statsWithContext(ctx context.Context) *ViewStats {
 		stats = newViewStats()
 	)
 
-	wg.Add(len(v.partitions))
 	for i, p := range v.partitions {
+		if p == nil {
+			continue
+		}
+		wg.Add(1)
 		go func(pid int32, par *partition) {
 			s := par.fetchStats(ctx)
 			m.Lock()
@@ -0,0 +1,295 @@
+package goka
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/lovoo/goka/kafka"
+	"github.com/lovoo/goka/storage"
+)
+
+// Backups start with backupMagic followed by the format version, the topic of
+// the view and a sequence of records. A partition record holds the partition
+// number and the offset of the partition at the time of the backup and is
+// followed by the entry records of the partition. The backup ends with an end
+// record. Integers are encoded as varints, strings and byte slices are
+// prefixed with their length.
+const (
+	backupMagic   = "GOKAVIEW"
+	backupVersion = 1
+
+	backupRecordEnd       byte = 0
+	backupRecordPartition byte = 1
+	backupRecordEntry     byte = 2
+)
+
+// maxBackupFieldSize limits the size of keys and values read from a backup to
+// detect corrupt backups before allocating huge buffers.
+const maxBackupFieldSize = 1 << 30
+
+type backupWriter struct {
+	w   *bufio.Writer
+	buf [binary.MaxVarintLen64]byte
+}
+
+func (bw *backupWriter) byte(b byte) error {
+	return bw.w.WriteByte(b)
+}
+
+func (bw *backupWriter) int(v int64) error {
+	n := binary.PutVarint(bw.buf[:], v)
+	_, err := bw.w.Write(bw.buf[:n])
+	return err
+}
+
+func (bw *backupWriter) bytes(b []byte) error {
+	if err := bw.int(int64(len(b))); err != nil {
+		return err
+	}
+	_, err := bw.w.Write(b)
+	return err
+}
+
+type backupReader struct {
+	r *bufio.Reader
+}
+
+func (br *backupReader) byte() (byte, error) {
+	return br.r.ReadByte()
+}
+
+func (br *backupReader) int() (int64, error) {
+	return binary.ReadVarint(br.r)
+}
+
+func (br *backupReader) bytes() ([]byte, error) {
+	n, err := br.int()
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 || n > maxBackupFieldSize {
+		return nil, fmt.Errorf("invalid field size %d", n)
+	}
+	b := make([]byte, n)
+	_, err = io.ReadFull(br.r, b)
+	return b, err
+}
+
+// Backup writes a dump of the keys and values of all partitions of the view to
+// w, including the offset of every partition. The dump is a consistent
+// point-in-time state of the view (see Snapshot). The values are written as
+// read through the storage wrappers, ie, encoded by the codec of the view but
+// decrypted, decompressed and without TTL, so backups can be restored into
+// storages with other wrappers. The TTL of restored entries counts from the
+// restore.
+func (v *View) Backup(w io.Writer) error {
+	type partitionState struct {
+		partition int32
+		offset    int64
+		iter      storage.Iterator
+	}
+
+	// read the offsets and open the iterators while no updates are applied
+	v.snapshotMu.Lock()
+	var (
+		states []*partitionState
+		err    error
+	)
+	for i, p := range v.partitions {
+		if p == nil {
+			continue
+		}
+		s := &partitionState{partition: int32(i)}
+		if s.offset, err = p.st.GetOffset(kafka.OffsetOldest); err != nil {
+			err = fmt.Errorf("error reading offset of partition %d: %v", i, err)
+			break
+		}
+		if s.iter, err = p.st.Iterator(); err != nil {
+			err = fmt.Errorf("error opening iterator of partition %d: %v", i, err)
+			break
+		}
+		states = append(states, s)
+	}
+	v.snapshotMu.Unlock()
+
+	defer func() {
+		for _, s := range states {
+			s.iter.Release()
+		}
+	}()
+	if err != nil {
+		return err
+	}
+
+	bw := &backupWriter{w: bufio.NewWriter(w)}
+	if _, err := bw.w.WriteString(backupMagic); err != nil {
+		return fmt.Errorf("error writing backup: %v", err)
+	}
+	if err := bw.int(backupVersion); err != nil {
+		return fmt.Errorf("error writing backup: %v", err)
+	}
+	if err := bw.bytes([]byte(v.topic)); err != nil {
+		return fmt.Errorf("error writing backup: %v", err)
+	}
+
+	for _, s := range states {
+		if err := v.backupPartition(bw, s.partition, s.offset, s.iter); err != nil {
+			return fmt.Errorf("error writing backup of partition %d: %v", s.partition, err)
+		}
+	}
+
+	if err := bw.byte(backupRecordEnd); err != nil {
+		return fmt.Errorf("error writing backup: %v", err)
+	}
+	if err := bw.w.Flush(); err != nil {
+		return fmt.Errorf("error writing backup: %v", err)
+	}
+	return nil
+}
+
+func (v *View) backupPartition(bw *backupWriter, partition int32, offset int64, iter storage.Iterator) error {
+	if err := bw.byte(backupRecordPartition); err != nil {
+		return err
+	}
+	if err := bw.int(int64(partition)); err != nil {
+		return err
+	}
+	if err := bw.int(offset); err != nil {
+		return err
+	}
+
+	for iter.Next() {
+		value, err := iter.Value()
+		if err != nil {
+			return fmt.Errorf("error reading value of key %s: %v", iter.Key(), err)
+		}
+		if err := bw.byte(backupRecordEntry); err != nil {
+			return err
+		}
+		if err := bw.bytes(iter.Key()); err != nil {
+			return err
+		}
+		if err := bw.bytes(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Restore loads a backup written by Backup into the local storage of the view.
+// The offsets of the backup are stored along with the values, so the view
+// only consumes the updates of the table topic written after the backup when
+// it is run. Restore must be called before Run and only on partitions whose
+// storage is empty. Partitions of the backup not materialized by the view are
+// skipped.
+func (v *View) Restore(r io.Reader) error {
+	br := &backupReader{r: bufio.NewReader(r)}
+
+	magic := make([]byte, len(backupMagic))
+	if _, err := io.ReadFull(br.r, magic); err != nil || string(magic) != backupMagic {
+		return fmt.Errorf("invalid backup: missing header")
+	}
+	version, err := br.int()
+	if err != nil {
+		return fmt.Errorf("error reading backup: %v", err)
+	} else if version != backupVersion {
+		return fmt.Errorf("unsupported backup version %d", version)
+	}
+	topic, err := br.bytes()
+	if err != nil {
+		return fmt.Errorf("error reading backup: %v", err)
+	} else if string(topic) != v.topic {
+		return fmt.Errorf("backup of topic %s cannot be restored into view of %s", topic, v.topic)
+	}
+
+	var (
+		st     storage.Storage
+		offset int64
+	)
+	// finish stores the offset of the partition once all its entries are
+	// restored, so that an incomplete restore is recovered from the table topic
+	finish := func() error {
+		if st == nil {
+			return nil
+		}
+		if err := st.SetOffset(offset); err != nil {
+			return fmt.Errorf("error restoring offset: %v", err)
+		}
+		return nil
+	}
+
+	for {
+		record, err := br.byte()
+		if err != nil {
+			return fmt.Errorf("error reading backup: %v", err)
+		}
+
+		switch record {
+		case backupRecordEnd:
+			return finish()
+
+		case backupRecordPartition:
+			if err := finish(); err != nil {
+				return err
+			}
+			if st, offset, err = v.restorePartition(br); err != nil {
+				return err
+			}
+
+		case backupRecordEntry:
+			key, err := br.bytes()
+			if err != nil {
+				return fmt.Errorf("error reading backup: %v", err)
+			}
+			value, err := br.bytes()
+			if err != nil {
+				return fmt.Errorf("error reading backup: %v", err)
+			}
+			if st == nil {
+				// partition not materialized by the view
+				continue
+			}
+			if err := st.Set(string(key), value); err != nil {
+				return fmt.Errorf("error restoring key %s: %v", key, err)
+			}
+
+		default:
+			return fmt.Errorf("invalid backup: unknown record type %d", record)
+		}
+	}
+}
+
+// restorePartition reads a partition record and opens the storage of the
+// partition. It returns a nil storage if the view does not materialize the
+// partition.
+func (v *View) restorePartition(br *backupReader) (storage.Storage, int64, error) {
+	partition, err := br.int()
+	if err != nil {
+		return nil, 0, fmt.Errorf("error reading backup: %v", err)
+	}
+	offset, err := br.int()
+	if err != nil {
+		return nil, 0, fmt.Errorf("error reading backup: %v", err)
+	}
+
+	if partition < 0 || int(partition) >= len(v.partitions) {
+		return nil, 0, fmt.Errorf("partition %d of backup does not exist in topic %s", partition, v.topic)
+	}
+	p := v.partitions[partition]
+	if p == nil {
+		return nil, 0, nil
+	}
+
+	if err := p.st.Open(); err != nil {
+		return nil, 0, fmt.Errorf("error opening storage of partition %d: %v", partition, err)
+	}
+	local, err := p.st.GetOffset(kafka.OffsetOldest)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error reading offset of partition %d: %v", partition, err)
+	} else if local != kafka.OffsetOldest {
+		return nil, 0, fmt.Errorf("storage of partition %d is not empty", partition)
+	}
+	return p.st, offset, nil
+}
@@ -0,0 +1,91 @@
+package goka
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// valueCache is a size- and TTL-bounded LRU cache of decoded values of a view.
+type valueCache struct {
+	m     sync.Mutex
+	size  int
+	ttl   time.Duration
+	order *list.List
+	items map[string]*list.Element
+
+	// generation is increased on every invalidation, so that values read
+	// before an update are not added to the cache after the update.
+	generation uint64
+}
+
+type cacheEntry struct {
+	key     string
+	value   interface{}
+	expires time.Time
+}
+
+func newValueCache(size int, ttl time.Duration) *valueCache {
+	return &valueCache{
+		size:  size,
+		ttl:   ttl,
+		order: list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// get returns the cached value of key and the current generation of the
+// cache, which has to be passed to add.
+func (c *valueCache) get(key string) (interface{}, bool, uint64) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false, c.generation
+	}
+	entry := el.Value.(*cacheEntry)
+	if c.ttl > 0 && time.Now().After(entry.expires) {
+		c.order.Remove(el)
+		delete(c.items, key)
+		return nil, false, c.generation
+	}
+	c.order.MoveToFront(el)
+	return entry.value, true, c.generation
+}
+
+// add adds the value of key unless the cache was invalidated since
+// generation was returned by get.
+func (c *valueCache) add(key string, value interface{}, generation uint64) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+	if el, ok := c.items[key]; ok {
+		c.order.Remove(el)
+	}
+	c.items[key] = c.order.PushFront(&cacheEntry{
+		key:     key,
+		value:   value,
+		expires: time.Now().Add(c.ttl),
+	})
+	for c.order.Len() > c.size {
+		el := c.order.Back()
+		c.order.Remove(el)
+		delete(c.items, el.Value.(*cacheEntry).key)
+	}
+}
+
+// invalidate removes key from the cache.
+func (c *valueCache) invalidate(key string) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.generation++
+	if el, ok := c.items[key]; ok {
+		c.order.Remove(el)
+		delete(c.items, key)
+	}
+}
@@ -0,0 +1,86 @@
+package goka
+
+import (
+	"hash"
+	"testing"
+	"time"
+
+	"github.com/facebookgo/ensure"
+	"github.com/golang/mock/gomock"
+	"github.com/lovoo/goka/codec"
+	"github.com/lovoo/goka/mock"
+)
+
+func TestValueCache(t *testing.T) {
+	c := newValueCache(2, time.Hour)
+
+	_, ok, gen := c.get("a")
+	ensure.False(t, ok)
+	c.add("a", 1, gen)
+	c.add("b", 2, gen)
+
+	val, ok, _ := c.get("a")
+	ensure.True(t, ok)
+	ensure.DeepEqual(t, val, 1)
+
+	// b is least recently used and is evicted
+	c.add("c", 3, gen)
+	_, ok, _ = c.get("b")
+	ensure.False(t, ok)
+	_, ok, _ = c.get("c")
+	ensure.True(t, ok)
+
+	// values read before an invalidation are not added
+	_, _, gen = c.get("d")
+	c.invalidate("a")
+	c.add("d", 4, gen)
+	_, ok, _ = c.get("d")
+	ensure.False(t, ok)
+	_, ok, _ = c.get("a")
+	ensure.False(t, ok)
+}
+
+func TestValueCache_ttl(t *testing.T) {
+	c := newValueCache(10, time.Millisecond)
+	_, _, gen := c.get("a")
+	c.add("a", 1, gen)
+	time.Sleep(5 * time.Millisecond)
+	_, ok, _ := c.get("a")
+	ensure.False(t, ok)
+}
+
+func TestView_GetCached(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	st := mock.NewMockStorage(ctrl)
+	v := &View{
+		opts: &voptions{
+			hasher: func() hash.Hash32 {
+				return NewConstHasher(0)
+			},
+			tableCodec:     new(codec.String),
+			updateCallback: DefaultUpdate,
+		},
+		cache: newValueCache(10, time.Hour),
+	}
+	v.partitions = []*partition{
+		{st: &storageProxy{partition: 0, Storage: st, update: v.update}},
+	}
+
+	// storage is read only once
+	st.EXPECT().Get("key").Return([]byte("value"), nil)
+	for i := 0; i < 3; i++ {
+		val, err := v.Get("key")
+		ensure.Nil(t, err)
+		ensure.DeepEqual(t, val, "value")
+	}
+
+	// updates invalidate the cache
+	st.EXPECT().Set("key", []byte("new-value"))
+	ensure.Nil(t, v.partitions[0].st.Update("key", []byte("new-value")))
+	st.EXPECT().Get("key").Return([]byte("new-value"), nil)
+	val, err := v.Get("key")
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, val, "new-value")
+}
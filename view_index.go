@@ -0,0 +1,334 @@
+package goka
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/lovoo/goka/multierr"
+	"github.com/lovoo/goka/storage"
+)
+
+const (
+	indexTopicSuffix = "-index"
+	indexSeparator   = "\x00"
+
+	// indexRebuildBatchSize is the number of index entries written at once
+	// while an index is rebuilt
+	indexRebuildBatchSize = 1000
+)
+
+// IndexFunc returns the attribute values under which a table entry is
+// indexed. The value is decoded with the codec of the view. An entry may have
+// any number of index values, including none.
+type IndexFunc func(key string, value interface{}) []string
+
+type viewIndex struct {
+	name string
+	fn   IndexFunc
+}
+
+// indexedStorage is the storage of a view partition whose secondary indexes
+// are updated whenever a key is set or deleted. The index entries are kept in
+// a separate storage without offset, so they cannot be written atomically with
+// the table. The index is therefore disposable and rebuilt from the table
+// whenever the storage is opened, which also indexes the entries written
+// before an index was added.
+type indexedStorage struct {
+	storage.Storage
+	index   storage.Storage
+	codec   Codec
+	indexes []viewIndex
+}
+
+// indexKey returns the key of the index entry of key for value. The value is
+// prefixed with its length, so that values containing the separator do not
+// collide with other values.
+func indexKey(name, value, key string) string {
+	return indexPrefix(name, value) + key
+}
+
+func indexPrefix(name, value string) string {
+	return name + indexSeparator + strconv.Itoa(len(value)) + indexSeparator + value + indexSeparator
+}
+
+// entries returns the index keys of the value stored for key.
+func (s *indexedStorage) entries(key string, data []byte) (map[string]bool, error) {
+	entries := make(map[string]bool)
+	if data == nil {
+		return entries, nil
+	}
+	value, err := s.codec.Decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding value for index (key %s): %v", key, err)
+	}
+	for _, idx := range s.indexes {
+		for _, v := range idx.fn(key, value) {
+			entries[indexKey(idx.name, v, key)] = true
+		}
+	}
+	return entries, nil
+}
+
+// reindex replaces the index entries of the old value of key with the ones of
+// the new value.
+func (s *indexedStorage) reindex(key string, update func() error) error {
+	old, err := s.Storage.Get(key)
+	if err != nil {
+		return err
+	}
+
+	if err = update(); err != nil {
+		return err
+	}
+
+	cur, err := s.Storage.Get(key)
+	if err != nil {
+		return err
+	}
+
+	b := new(storage.Batch)
+	if err := s.diff(b, key, old, cur); err != nil {
+		return err
+	}
+	if err := b.Replay(s.index.Set, s.index.Delete); err != nil {
+		return fmt.Errorf("error updating index entries: %v", err)
+	}
+	return nil
+}
+
+// diff adds the updates of the index entries of key changing from value old
+// to cur to b.
+func (s *indexedStorage) diff(b *storage.Batch, key string, old, cur []byte) error {
+	oldEntries, err := s.entries(key, old)
+	if err != nil {
+		return err
+	}
+	entries, err := s.entries(key, cur)
+	if err != nil {
+		return err
+	}
+	for e := range oldEntries {
+		if !entries[e] {
+			b.Delete(e)
+		}
+	}
+	for e := range entries {
+		if !oldEntries[e] {
+			b.Set(e, []byte{})
+		}
+	}
+	return nil
+}
+
+func (s *indexedStorage) Set(key string, value []byte) error {
+	return s.reindex(key, func() error { return s.Storage.Set(key, value) })
+}
+
+func (s *indexedStorage) Delete(key string) error {
+	return s.reindex(key, func() error { return s.Storage.Delete(key) })
+}
+
+// WriteBatch writes the updates and the offset of b in a single batch and the
+// resulting updates of the index entries in another batch of the index.
+func (s *indexedStorage) WriteBatch(b *storage.Batch) error {
+	var (
+		index   = new(storage.Batch)
+		written = new(storage.Batch)
+	)
+	update := func(key string, value []byte) error {
+		// earlier updates of the batch are not written yet
+		old, ok := written.Lookup(key)
+		if !ok {
+			var err error
+			if old, err = s.Storage.Get(key); err != nil {
+				return err
+			}
+		}
+		if value == nil {
+			written.Delete(key)
+		} else {
+			written.Set(key, value)
+		}
+		return s.diff(index, key, old, value)
+	}
+	err := b.Replay(update, func(key string) error { return update(key, nil) })
+	if err != nil {
+		return err
+	}
+
+	if err := storage.WriteBatch(s.Storage, b); err != nil {
+		return err
+	}
+	if err := storage.WriteBatch(s.index, index); err != nil {
+		return fmt.Errorf("error updating index entries: %v", err)
+	}
+	return nil
+}
+
+func (s *indexedStorage) Unwrap() storage.Storage {
+	return s.Storage
+}
+
+func (s *indexedStorage) GetFunc(key string, fn func(value []byte) error) error {
+	return storage.GetFunc(s.Storage, key, fn)
+}
+
+func (s *indexedStorage) MarkRecovered() error {
+	if err := s.index.MarkRecovered(); err != nil {
+		return err
+	}
+	return s.Storage.MarkRecovered()
+}
+
+func (s *indexedStorage) Open() error {
+	if err := s.index.Open(); err != nil {
+		return err
+	}
+	if err := s.Storage.Open(); err != nil {
+		return err
+	}
+	if err := s.rebuild(); err != nil {
+		return fmt.Errorf("error rebuilding index: %v", err)
+	}
+	return nil
+}
+
+// rebuild removes all index entries and indexes the entries of the table
+// again.
+func (s *indexedStorage) rebuild() error {
+	b := new(storage.Batch)
+	write := func(all bool) error {
+		if b.Len() == 0 || (!all && b.Len() < indexRebuildBatchSize) {
+			return nil
+		}
+		err := storage.WriteBatch(s.index, b)
+		b.Reset()
+		return err
+	}
+
+	iter, err := s.index.Iterator()
+	if err != nil {
+		return err
+	}
+	for iter.Next() {
+		b.Delete(string(iter.Key()))
+		if err = write(false); err != nil {
+			break
+		}
+	}
+	iter.Release()
+	if err != nil {
+		return err
+	}
+
+	if iter, err = s.Storage.Iterator(); err != nil {
+		return err
+	}
+	defer iter.Release()
+	for iter.Next() {
+		value, err := iter.Value()
+		if err != nil {
+			return err
+		}
+		if err := s.diff(b, string(iter.Key()), nil, value); err != nil {
+			return err
+		}
+		if err := write(false); err != nil {
+			return err
+		}
+	}
+	return write(true)
+}
+
+func (s *indexedStorage) Close() error {
+	var errs multierr.Errors
+	_ = errs.Collect(s.Storage.Close())
+	_ = errs.Collect(s.index.Close())
+	return errs.NilOrError()
+}
+
+// IndexIterator returns an iterator over the entries of the view whose index
+// values of the index name contain value. The index has to be registered with
+// WithViewIndex.
+func (v *View) IndexIterator(name, value string) (Iterator, error) {
+	if !v.hasIndex(name) {
+		return nil, fmt.Errorf("view has no index %s", name)
+	}
+
+	var (
+		prefix = indexPrefix(name, value)
+		limit  = prefix[:len(prefix)-1] + "\x01"
+		iters  = make([]storage.Iterator, 0, len(v.partitions))
+	)
+	for i := range v.partitions {
+		if v.partitions[i] == nil {
+			continue
+		}
+		st, ok := v.partitions[i].st.Storage.(*indexedStorage)
+		if !ok {
+			return nil, fmt.Errorf("partition %d has no index storage", i)
+		}
+		iter, err := st.index.IteratorWithRange([]byte(prefix), []byte(limit))
+		if err != nil {
+			// release already opened iterators
+			for i := range iters {
+				iters[i].Release()
+			}
+
+			return nil, fmt.Errorf("error opening partition index iterator: %v", err)
+		}
+
+		iters = append(iters, iter)
+	}
+
+	return &indexIterator{
+		iter:   storage.NewMultiIterator(iters),
+		prefix: prefix,
+		view:   v,
+	}, nil
+}
+
+func (v *View) hasIndex(name string) bool {
+	for _, idx := range v.opts.indexes {
+		if idx.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// indexIterator iterates over the index entries of one index value and
+// returns the keys and values of the table.
+type indexIterator struct {
+	iter   storage.Iterator
+	prefix string
+	view   *View
+}
+
+// Next advances the iterator to the next key.
+func (i *indexIterator) Next() bool {
+	return i.iter.Next()
+}
+
+// Key returns the current key.
+func (i *indexIterator) Key() string {
+	key := i.iter.Key()
+	if key == nil {
+		return ""
+	}
+	return string(key)[len(i.prefix):]
+}
+
+// Value returns the current value of the key in the view.
+func (i *indexIterator) Value() (interface{}, error) {
+	return i.view.Get(i.Key())
+}
+
+// Release releases the iterator. The iterator is not usable anymore after calling Release.
+func (i *indexIterator) Release() {
+	i.iter.Release()
+}
+
+func (i *indexIterator) Seek(key string) bool {
+	return i.iter.Seek([]byte(i.prefix + key))
+}
@@ -0,0 +1,105 @@
+package goka
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// lazyPollInterval is the interval in which lookups check whether a lazily
+// recovered partition has caught up.
+const lazyPollInterval = 10 * time.Millisecond
+
+// lazyPartitions keeps track of the partitions of a lazy view that were
+// accessed and hands them to the running view for recovery.
+type lazyPartitions struct {
+	m      sync.Mutex
+	active map[int32]bool
+
+	// requests and done are set while the view is running
+	requests chan int32
+	done     chan struct{}
+}
+
+// start prepares a run of the view. It returns the partitions accessed so far
+// and the channel receiving the partitions accessed during the run.
+func (l *lazyPartitions) start(numPartitions int) ([]int32, <-chan int32) {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	// every partition is requested at most once per run
+	l.requests = make(chan int32, numPartitions)
+	l.done = make(chan struct{})
+
+	var active []int32
+	for pid := range l.active {
+		active = append(active, pid)
+	}
+	return active, l.requests
+}
+
+// stop ends a run of the view and releases lookups waiting for partitions.
+func (l *lazyPartitions) stop() {
+	l.m.Lock()
+	defer l.m.Unlock()
+	if l.done != nil {
+		close(l.done)
+	}
+	l.requests = nil
+	l.done = nil
+}
+
+// activate requests the recovery of the partition unless it was requested
+// before. It returns a channel closed when the run stops.
+func (l *lazyPartitions) activate(partition int32) (<-chan struct{}, error) {
+	l.m.Lock()
+	defer l.m.Unlock()
+	if l.requests == nil {
+		return nil, fmt.Errorf("view is not running")
+	}
+	if !l.active[partition] {
+		if l.active == nil {
+			l.active = make(map[int32]bool)
+		}
+		l.active[partition] = true
+		l.requests <- partition
+	}
+	return l.done, nil
+}
+
+func (l *lazyPartitions) isActive(partition int32) bool {
+	l.m.Lock()
+	defer l.m.Unlock()
+	return l.active[partition]
+}
+
+// recoverLazily makes sure the partition of a lazy view is recovered, starting
+// its recovery if it was not accessed before. It waits at most timeout for the
+// partition to recover.
+func (v *View) recoverLazily(partition int32, timeout time.Duration) error {
+	p := v.partitions[partition]
+	if p.recovered() {
+		return nil
+	}
+
+	done, err := v.lazy.activate(partition)
+	if err != nil {
+		return fmt.Errorf("cannot recover partition %d: %v", partition, err)
+	}
+
+	var (
+		ticker   = time.NewTicker(lazyPollInterval)
+		deadline = time.After(timeout)
+	)
+	defer ticker.Stop()
+	for !p.recovered() {
+		select {
+		case <-ticker.C:
+		case <-deadline:
+			return fmt.Errorf("partition %d did not recover within %v", partition, timeout)
+		case <-done:
+			return fmt.Errorf("cannot recover partition %d: view stopped", partition)
+		}
+	}
+	return nil
+}
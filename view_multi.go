@@ -0,0 +1,184 @@
+package goka
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lovoo/goka/kafka"
+	"github.com/lovoo/goka/multierr"
+)
+
+// MultiView materializes several tables sharing a codec and the view options
+// with a single Kafka consumer and a single Run loop.
+type MultiView struct {
+	brokers    []string
+	opts       *voptions
+	views      map[string]*View
+	tables     []Table
+	terminated bool
+}
+
+// NewMultiView creates a view of all tables. The options apply to the views of
+// every table, eg, the storage builder creates the storages of all tables. The
+// auto-reconnect option is not supported by multi-table views.
+func NewMultiView(brokers []string, tables []Table, codec Codec, options ...ViewOption) (*MultiView, error) {
+	if len(tables) == 0 {
+		return nil, fmt.Errorf("multi-view requires at least one table")
+	}
+
+	mv := &MultiView{
+		brokers: brokers,
+		views:   make(map[string]*View),
+	}
+	for _, table := range tables {
+		if _, exists := mv.views[string(table)]; exists {
+			return nil, fmt.Errorf("table %s added twice", table)
+		}
+		v, err := NewView(brokers, table, codec, options...)
+		if err != nil {
+			return nil, fmt.Errorf("error creating view of table %s: %v", table, err)
+		}
+		if v.opts.reconnectBackoff > 0 {
+			return nil, fmt.Errorf("multi-view does not support auto-reconnect")
+		}
+		mv.views[string(table)] = v
+		mv.tables = append(mv.tables, table)
+	}
+	// all views share the same options
+	mv.opts = mv.views[string(tables[0])].opts
+	return mv, nil
+}
+
+// View returns the view of table or nil if the table is not part of the
+// multi-view. The returned view is run by the multi-view and must not be run
+// on its own.
+func (mv *MultiView) View(table Table) *View {
+	return mv.views[string(table)]
+}
+
+// Get returns the value of key in table.
+func (mv *MultiView) Get(table Table, key string) (interface{}, error) {
+	v := mv.View(table)
+	if v == nil {
+		return nil, fmt.Errorf("table %s is not part of the multi-view", table)
+	}
+	return v.Get(key)
+}
+
+// Recovered returns true when the views of all tables have caught up with
+// their table topics.
+func (mv *MultiView) Recovered() bool {
+	for _, v := range mv.views {
+		if !v.Recovered() {
+			return false
+		}
+	}
+	return true
+}
+
+// Run starts consuming the topics of all tables with a single consumer. It
+// returns when ctx is done or any of the views fails.
+func (mv *MultiView) Run(ctx context.Context) error {
+	mv.opts.log.Printf("multi-view: starting")
+	defer mv.opts.log.Printf("multi-view: stopped")
+
+	errs := mv.runOnce(ctx)
+	if !mv.opts.restartable {
+		mv.terminated = true
+		errs.Merge(mv.close())
+	}
+	return errs.NilOrError()
+}
+
+func (mv *MultiView) runOnce(ctx context.Context) *multierr.Errors {
+	errs := new(multierr.Errors)
+	if mv.terminated {
+		_ = errs.Collect(fmt.Errorf("multi-view: cannot reinitialize terminated view"))
+		return errs
+	}
+
+	consumer, err := mv.opts.builders.consumer(mv.brokers, "goka-view", mv.opts.clientID)
+	if err != nil {
+		_ = errs.Collect(fmt.Errorf("multi-view: cannot create Kafka consumer: %v", err))
+		return errs
+	}
+	for _, v := range mv.views {
+		v.connect(consumer)
+	}
+
+	// the multi-view does not reconnect, so failed partitions need not be
+	// told apart from consumer errors
+	var failed int32
+	errg, ctx := multierr.NewErrGroup(ctx)
+	errg.Go(func() error {
+		return mv.run(ctx, consumer)
+	})
+	for _, table := range mv.tables {
+		mv.views[string(table)].startPartitions(ctx, errg, &failed)
+	}
+
+	errs.Merge(errg.Wait())
+	for _, v := range mv.views {
+		if v.lazy != nil {
+			v.lazy.stop()
+		}
+	}
+
+	if err := consumer.Close(); err != nil {
+		_ = errs.Collect(fmt.Errorf("multi-view: failed closing consumer: %v", err))
+	}
+	return errs
+}
+
+// run passes the events of the consumer to the views of their topics.
+func (mv *MultiView) run(ctx context.Context, consumer kafka.Consumer) error {
+	for {
+		select {
+		case ev := <-consumer.Events():
+			var topic string
+			switch ev := ev.(type) {
+			case *kafka.Message:
+				topic = ev.Topic
+			case *kafka.BOF:
+				topic = ev.Topic
+			case *kafka.EOF:
+				topic = ev.Topic
+			case *kafka.NOP:
+				topic = ev.Topic
+			}
+
+			v, ok := mv.views[topic]
+			if !ok && topic != "" {
+				return fmt.Errorf("multi-view: received event of unknown topic %s", topic)
+			} else if !ok {
+				// errors and unknown events are handled by any of the views
+				v = mv.views[string(mv.tables[0])]
+			}
+			if err := v.deliver(ctx, ev); err != nil {
+				return fmt.Errorf("multi-view: %v", err)
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// close closes the storages of all views.
+func (mv *MultiView) close() *multierr.Errors {
+	errs := new(multierr.Errors)
+	for _, v := range mv.views {
+		v.terminated = true
+		errs.Merge(v.close())
+	}
+	return errs
+}
+
+// Terminate closes the storages of all views. It must be called only if the
+// views are restartable (see WithViewRestartable() option).
+func (mv *MultiView) Terminate() error {
+	if !mv.opts.restartable || mv.terminated {
+		return nil
+	}
+	mv.terminated = true
+	return mv.close().NilOrError()
+}
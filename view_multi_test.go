@@ -0,0 +1,81 @@
+package goka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lovoo/goka/codec"
+	"github.com/lovoo/goka/kafka"
+	"github.com/lovoo/goka/mock"
+	"github.com/lovoo/goka/storage"
+
+	"github.com/facebookgo/ensure"
+	"github.com/golang/mock/gomock"
+)
+
+func TestMultiView(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var (
+		consumer    = mock.NewMockConsumer(ctrl)
+		tm          = mock.NewMockTopicManager(ctrl)
+		events      = make(chan kafka.Event)
+		final       = make(chan bool)
+		ctx, cancel = context.WithCancel(context.Background())
+		tables      = []Table{"table-a", "table-b"}
+	)
+
+	for _, table := range tables {
+		tm.EXPECT().Partitions(string(table)).Return([]int32{0}, nil)
+	}
+	tm.EXPECT().Close().Times(2)
+
+	mv, err := NewMultiView(nil, tables, new(codec.String),
+		WithViewStorageBuilder(storage.MemoryBuilder()),
+		WithViewTopicManagerBuilder(func(brokers []string) (kafka.TopicManager, error) { return tm, nil }),
+		WithViewConsumerBuilder(func(brokers []string, topic, id string) (kafka.Consumer, error) { return consumer, nil }),
+	)
+	ensure.Nil(t, err)
+	ensure.True(t, mv.View("table-a") != nil)
+	ensure.True(t, mv.View("table-c") == nil)
+
+	// both tables are consumed with the same consumer
+	consumer.EXPECT().Events().Return(events).AnyTimes()
+	for _, table := range tables {
+		topic := string(table)
+		consumer.EXPECT().AddPartition(topic, int32(0), int64(-2)).Do(func(string, int32, int64) {
+			go func() {
+				events <- &kafka.BOF{Topic: topic, Partition: 0, Offset: 0, Hwm: 1}
+				events <- &kafka.Message{Topic: topic, Partition: 0, Key: "key", Value: []byte(topic), Offset: 0}
+			}()
+		})
+		consumer.EXPECT().AddPartition(topic, int32(0), int64(1))
+		consumer.EXPECT().RemovePartition(topic, int32(0)).Times(2)
+	}
+	consumer.EXPECT().Close()
+
+	go func() {
+		err := mv.Run(ctx)
+		ensure.Nil(t, err)
+		close(final)
+	}()
+
+	err = doTimed(t, func() {
+		for !mv.Recovered() {
+			time.Sleep(time.Millisecond)
+		}
+		for _, table := range tables {
+			val, err := mv.Get(table, "key")
+			ensure.Nil(t, err)
+			ensure.DeepEqual(t, val, string(table))
+		}
+		_, err = mv.Get("table-c", "key")
+		ensure.NotNil(t, err)
+
+		cancel()
+		<-final
+	})
+	ensure.Nil(t, err)
+}
@@ -1,9 +1,15 @@
 package goka
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"hash"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -67,7 +73,7 @@ func createTestView(t *testing.T, consumer kafka.Consumer, sb storage.Builder, t
 		},
 		hasher: DefaultHasher(),
 	}
-	opts.builders.storage = sb
+	opts.builders.storage = storage.AdaptBuilder(sb)
 	opts.builders.topicmgr = func(brokers []string) (kafka.TopicManager, error) {
 		return tm, nil
 	}
@@ -119,6 +125,41 @@ func TestView_createPartitions(t *testing.T) {
 	err = v.createPartitions(nil)
 	ensure.NotNil(t, err)
 
+	// create missing table topic
+	tm.EXPECT().EnsureTableExists(tableName(group), 2).Return(nil)
+	tm.EXPECT().Partitions(tableName(group)).Return([]int32{0, 1}, nil)
+	tm.EXPECT().Close()
+	v = createTestView(t, consumer, storage.MemoryBuilder(), tm)
+	WithViewAutoCreateTable(2)(v.opts)
+	err = v.createPartitions(nil)
+	ensure.Nil(t, err)
+
+	tm.EXPECT().EnsureTableExists(tableName(group), 2).Return(errors.New("some error"))
+	tm.EXPECT().Close()
+	v = createTestView(t, consumer, storage.MemoryBuilder(), tm)
+	WithViewAutoCreateTable(2)(v.opts)
+	err = v.createPartitions(nil)
+	ensure.NotNil(t, err)
+
+	// check table topic
+	tc := mock.NewMockTopicChecker(ctrl)
+	ctm := &checkingTopicManager{tm, tc}
+	tm.EXPECT().Partitions(tableName(group)).Return([]int32{0, 1}, nil)
+	tc.EXPECT().CheckTable(tableName(group), 2).Return(errors.New("some error"))
+	tm.EXPECT().Close()
+	v = createTestView(t, consumer, storage.MemoryBuilder(), ctm)
+	WithViewTopicCheck()(v.opts)
+	err = v.createPartitions(nil)
+	ensure.NotNil(t, err)
+
+	// topic manager cannot check topics
+	tm.EXPECT().Partitions(tableName(group)).Return([]int32{0, 1}, nil)
+	tm.EXPECT().Close()
+	v = createTestView(t, consumer, storage.MemoryBuilder(), tm)
+	WithViewTopicCheck()(v.opts)
+	err = v.createPartitions(nil)
+	ensure.NotNil(t, err)
+	ensure.StringContains(t, err.Error(), "cannot check topics")
 }
 
 func TestView_HasGet(t *testing.T) {
@@ -140,6 +181,7 @@ func TestView_HasGet(t *testing.T) {
 		tm.EXPECT().Close(),
 		st.EXPECT().Has("item1").Return(false, nil),
 		st.EXPECT().Get("item1").Return([]byte("item1-value"), nil),
+		st.EXPECT().Get("item1").Return([]byte("item1-value"), nil),
 	)
 
 	err := v.createPartitions(nil)
@@ -152,6 +194,13 @@ func TestView_HasGet(t *testing.T) {
 	value, err := v.Get("item1")
 	ensure.Nil(t, err)
 	ensure.DeepEqual(t, value.(string), "item1-value")
+
+	// storages without zero-copy reads fall back to Get
+	err = v.GetFunc("item1", func(data []byte) error {
+		ensure.DeepEqual(t, string(data), "item1-value")
+		return nil
+	})
+	ensure.Nil(t, err)
 }
 
 func TestView_StartStop(t *testing.T) {
@@ -414,6 +463,69 @@ func TestView_Restart(t *testing.T) {
 	ensure.Nil(t, err)
 }
 
+func TestView_AutoReconnect(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var (
+		st = mock.NewMockStorage(ctrl)
+		sb = func(topic string, partition int32) (storage.Storage, error) {
+			return st, nil
+		}
+		consumer1   = mock.NewMockConsumer(ctrl)
+		consumer2   = mock.NewMockConsumer(ctrl)
+		consumers   = []kafka.Consumer{consumer1, consumer2}
+		tm          = mock.NewMockTopicManager(ctrl)
+		v           = createTestView(t, nil, sb, tm)
+		ch1         = make(chan kafka.Event)
+		ch2         = make(chan kafka.Event)
+		running     = make(chan bool)
+		final       = make(chan bool)
+		ctx, cancel = context.WithCancel(context.Background())
+		offset      = int64(123)
+	)
+	v.opts.reconnectBackoff = time.Millisecond
+	v.opts.builders.consumer = func(brokers []string, topic, id string) (kafka.Consumer, error) {
+		c := consumers[0]
+		consumers = consumers[1:]
+		return c, nil
+	}
+
+	tm.EXPECT().Partitions(tableName(group)).Return([]int32{0}, nil)
+	tm.EXPECT().Close()
+	err := v.createPartitions(nil)
+	ensure.Nil(t, err)
+
+	// first connection fails with a consumer error
+	st.EXPECT().Open()
+	st.EXPECT().GetOffset(int64(-2)).Return(offset, nil).Times(2)
+	consumer1.EXPECT().Events().Return(ch1).AnyTimes()
+	consumer1.EXPECT().AddPartition(tableName(group), int32(0), offset)
+	consumer1.EXPECT().RemovePartition(tableName(group), int32(0))
+	consumer1.EXPECT().Close()
+
+	// second connection runs until the context is done
+	consumer2.EXPECT().Events().Return(ch2).AnyTimes()
+	consumer2.EXPECT().AddPartition(tableName(group), int32(0), offset).Do(func(string, int32, int64) { close(running) })
+	consumer2.EXPECT().RemovePartition(tableName(group), int32(0))
+	consumer2.EXPECT().Close()
+	st.EXPECT().Close()
+
+	go func() {
+		err := v.Run(ctx)
+		ensure.Nil(t, err)
+		close(final)
+	}()
+
+	ch1 <- &kafka.Error{Err: errors.New("connection lost")}
+	err = doTimed(t, func() {
+		<-running
+		cancel()
+		<-final
+	})
+	ensure.Nil(t, err)
+}
+
 func TestView_GetErrors(t *testing.T) {
 	v := &View{opts: &voptions{hasher: DefaultHasher()}}
 	_, err := v.Get("hey")
@@ -472,7 +584,8 @@ func TestNewView(t *testing.T) {
 	)
 	v, err := NewView(nil, GroupTable(group), new(codec.Bytes),
 		WithViewConsumerBuilder(createConsumerBuilder(consumer)),
-		WithViewTopicManagerBuilder(createTopicManagerBuilder(tm)))
+		WithViewTopicManagerBuilder(createTopicManagerBuilder(tm)),
+		WithViewStorageBuilder(storage.MemoryBuilder()))
 	ensure.Nil(t, err)
 	ensure.DeepEqual(t, v.topic, tableName(group))
 	ensure.DeepEqual(t, v.consumer, nil) // is set first upon start
@@ -511,6 +624,411 @@ func TestView_Evict(t *testing.T) {
 	ensure.Nil(t, vinf)
 }
 
+func TestView_Index(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var (
+		consumer = mock.NewMockConsumer(ctrl)
+		tm       = mock.NewMockTopicManager(ctrl)
+		v        = createTestView(t, consumer, storage.MemoryBuilder(), tm)
+	)
+	// index values by their country prefix, eg, "de:berlin"
+	v.opts.indexes = []viewIndex{{name: "country", fn: func(key string, value interface{}) []string {
+		return []string{strings.SplitN(value.(string), ":", 2)[0]}
+	}}}
+
+	tm.EXPECT().Partitions(tableName(group)).Return([]int32{0}, nil)
+	tm.EXPECT().Close()
+	err := v.createPartitions(nil)
+	ensure.Nil(t, err)
+
+	st := v.partitions[0].st
+	ensure.Nil(t, st.Update("alice", []byte("de:berlin")))
+	ensure.Nil(t, st.Update("bob", []byte("fr:paris")))
+	ensure.Nil(t, st.Update("carol", []byte("de:hamburg")))
+	// bob moves and alice leaves
+	ensure.Nil(t, st.Update("bob", []byte("de:munich")))
+	ensure.Nil(t, st.Update("alice", nil))
+
+	lookup := func(country string) map[string]interface{} {
+		it, err := v.IndexIterator("country", country)
+		ensure.Nil(t, err)
+		defer it.Release()
+		found := make(map[string]interface{})
+		for it.Next() {
+			val, err := it.Value()
+			ensure.Nil(t, err)
+			found[it.Key()] = val
+		}
+		return found
+	}
+	ensure.DeepEqual(t, lookup("de"), map[string]interface{}{
+		"bob":   "de:munich",
+		"carol": "de:hamburg",
+	})
+	ensure.DeepEqual(t, lookup("fr"), map[string]interface{}{})
+
+	_, err = v.IndexIterator("city", "berlin")
+	ensure.NotNil(t, err)
+}
+
+func TestView_IndexSeparator(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var (
+		consumer = mock.NewMockConsumer(ctrl)
+		tm       = mock.NewMockTopicManager(ctrl)
+		v        = createTestView(t, consumer, storage.MemoryBuilder(), tm)
+	)
+	// index values by the whole value, which may contain the separator
+	v.opts.indexes = []viewIndex{{name: "value", fn: func(key string, value interface{}) []string {
+		return []string{value.(string)}
+	}}}
+
+	tm.EXPECT().Partitions(tableName(group)).Return([]int32{0}, nil)
+	tm.EXPECT().Close()
+	ensure.Nil(t, v.createPartitions(nil))
+
+	st := v.partitions[0].st
+	ensure.Nil(t, st.Update("alice", []byte("de")))
+	ensure.Nil(t, st.Update("bob", []byte("de\x00x")))
+
+	lookup := func(value string) []string {
+		it, err := v.IndexIterator("value", value)
+		ensure.Nil(t, err)
+		defer it.Release()
+		var keys []string
+		for it.Next() {
+			keys = append(keys, it.Key())
+		}
+		return keys
+	}
+	ensure.DeepEqual(t, lookup("de"), []string{"alice"})
+	ensure.DeepEqual(t, lookup("de\x00x"), []string{"bob"})
+}
+
+func TestIndexedStorage_WriteBatch(t *testing.T) {
+	var (
+		index = storage.NewMemory()
+		st    = &indexedStorage{
+			Storage: storage.NewMemory(),
+			index:   index,
+			codec:   new(codec.String),
+			indexes: []viewIndex{{name: "value", fn: func(key string, value interface{}) []string {
+				return []string{value.(string)}
+			}}},
+		}
+	)
+	ensure.Nil(t, st.Set("alice", []byte("a")))
+
+	// later updates of a key in the batch replace the index entries of the
+	// earlier ones
+	b := new(storage.Batch)
+	b.Set("alice", []byte("b"))
+	b.Set("bob", []byte("b"))
+	b.Set("alice", []byte("c"))
+	b.Delete("bob")
+	b.Set("carol", []byte("c"))
+	b.SetOffset(42)
+	ensure.Nil(t, storage.WriteBatch(st, b))
+
+	offset, err := st.GetOffset(0)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, offset, int64(42))
+
+	it, err := index.Iterator()
+	ensure.Nil(t, err)
+	defer it.Release()
+	var entries []string
+	for it.Next() {
+		entries = append(entries, string(it.Key()))
+	}
+	ensure.DeepEqual(t, entries, []string{
+		indexKey("value", "c", "alice"),
+		indexKey("value", "c", "carol"),
+	})
+}
+
+func TestIndexedStorage_rebuild(t *testing.T) {
+	var (
+		table = storage.NewMemory()
+		index = storage.NewMemory()
+		st    = &indexedStorage{
+			Storage: table,
+			index:   index,
+			codec:   new(codec.String),
+			indexes: []viewIndex{{name: "value", fn: func(key string, value interface{}) []string {
+				return []string{value.(string)}
+			}}},
+		}
+	)
+	// the table was written without the index and the index holds stale
+	// entries, eg, after a crash before the index batch was written
+	ensure.Nil(t, table.Set("alice", []byte("a")))
+	ensure.Nil(t, table.Set("bob", []byte("b")))
+	ensure.Nil(t, index.Set(indexKey("value", "x", "alice"), []byte{}))
+
+	ensure.Nil(t, st.Open())
+	it, err := index.Iterator()
+	ensure.Nil(t, err)
+	defer it.Release()
+	var entries []string
+	for it.Next() {
+		entries = append(entries, string(it.Key()))
+	}
+	ensure.DeepEqual(t, entries, []string{
+		indexKey("value", "a", "alice"),
+		indexKey("value", "b", "bob"),
+	})
+}
+
+func TestView_IteratePrefixRange(t *testing.T) {
+	var (
+		numPartitions = 3
+		v             = &View{opts: &voptions{tableCodec: new(codec.String)}}
+	)
+	for i := 0; i < numPartitions; i++ {
+		v.partitions = append(v.partitions, &partition{
+			st: &storageProxy{partition: int32(i), Storage: storage.NewMemory()},
+		})
+	}
+	// distribute the keys over the partitions
+	for i, key := range []string{"user:1:a", "user:1:b", "user:2:a", "user:1:c", "group:1", "user:10:a"} {
+		ensure.Nil(t, v.partitions[i%numPartitions].st.Set(key, []byte(key)))
+	}
+
+	keys := func(it Iterator, err error) []string {
+		ensure.Nil(t, err)
+		defer it.Release()
+		var keys []string
+		for it.Next() {
+			val, err := it.Value()
+			ensure.Nil(t, err)
+			ensure.DeepEqual(t, val, it.Key())
+			keys = append(keys, it.Key())
+		}
+		return keys
+	}
+
+	ensure.DeepEqual(t, keys(v.IteratePrefix("user:1:")), []string{"user:1:a", "user:1:b", "user:1:c"})
+	ensure.DeepEqual(t, keys(v.IterateRange("user:1:b", "user:2:")), []string{"user:1:b", "user:1:c"})
+
+	_, err := v.IterateRange("user:", "")
+	ensure.NotNil(t, err)
+
+	ensure.DeepEqual(t, keys(v.SortedIterator()), []string{"group:1", "user:10:a", "user:1:a", "user:1:b", "user:1:c", "user:2:a"})
+
+	// continue a listing at a key
+	ensure.DeepEqual(t, keys(v.SortedIteratorFrom("user:1:b")), []string{"user:1:b", "user:1:c", "user:2:a"})
+	ensure.DeepEqual(t, keys(v.SortedIteratorFrom("user:1:bb")), []string{"user:1:c", "user:2:a"})
+	ensure.DeepEqual(t, keys(v.SortedIteratorFrom("zzz")), []string(nil))
+}
+
+func TestView_Watch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var (
+		consumer    = mock.NewMockConsumer(ctrl)
+		tm          = mock.NewMockTopicManager(ctrl)
+		v           = createTestView(t, consumer, storage.MemoryBuilder(), tm)
+		ctx, cancel = context.WithCancel(context.Background())
+	)
+	defer cancel()
+
+	tm.EXPECT().Partitions(tableName(group)).Return([]int32{0}, nil)
+	tm.EXPECT().Close()
+	err := v.createPartitions(nil)
+	ensure.Nil(t, err)
+
+	keyUpdates := v.Watch(ctx, "user:1")
+	prefixUpdates := v.WatchPrefix(ctx, "user:")
+
+	st := v.partitions[0].st
+	ensure.Nil(t, st.Update("user:1", []byte("a")))
+	ensure.Nil(t, st.Update("user:2", []byte("b")))
+	ensure.Nil(t, st.Update("group:1", []byte("c")))
+	ensure.Nil(t, st.Update("user:1", nil))
+
+	ensure.DeepEqual(t, *<-keyUpdates, ViewUpdate{Key: "user:1", Value: "a"})
+	ensure.DeepEqual(t, *<-keyUpdates, ViewUpdate{Key: "user:1"})
+	ensure.DeepEqual(t, *<-prefixUpdates, ViewUpdate{Key: "user:1", Value: "a"})
+	ensure.DeepEqual(t, *<-prefixUpdates, ViewUpdate{Key: "user:2", Value: "b"})
+	ensure.DeepEqual(t, *<-prefixUpdates, ViewUpdate{Key: "user:1"})
+	ensure.DeepEqual(t, recoveredMessages, 4)
+
+	// channels are closed once the context is done
+	cancel()
+	err = doTimed(t, func() {
+		for range keyUpdates {
+		}
+		for range prefixUpdates {
+		}
+	})
+	ensure.Nil(t, err)
+}
+
+func TestView_WatchFullBuffer(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var (
+		consumer    = mock.NewMockConsumer(ctrl)
+		tm          = mock.NewMockTopicManager(ctrl)
+		v           = createTestView(t, consumer, storage.MemoryBuilder(), tm)
+		ctx, cancel = context.WithCancel(context.Background())
+	)
+	defer cancel()
+
+	tm.EXPECT().Partitions(tableName(group)).Return([]int32{0}, nil)
+	tm.EXPECT().Close()
+	ensure.Nil(t, v.createPartitions(nil))
+
+	updates := v.Watch(ctx, "key")
+
+	// a watcher not reading its updates does not block the partition
+	st := v.partitions[0].st
+	err := doTimed(t, func() {
+		for i := 0; i < defaultWatchBufferSize+10; i++ {
+			ensure.Nil(t, st.Update("key", []byte(fmt.Sprint(i))))
+		}
+	})
+	ensure.Nil(t, err)
+
+	// but is disconnected after the buffered updates
+	var received int
+	err = doTimed(t, func() {
+		for range updates {
+			received++
+		}
+	})
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, received, defaultWatchBufferSize)
+}
+
+func TestView_Partitions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var (
+		consumer = mock.NewMockConsumer(ctrl)
+		tm       = mock.NewMockTopicManager(ctrl)
+		v        = createTestView(t, consumer, storage.MemoryBuilder(), tm)
+	)
+	v.opts.hasher = func() hash.Hash32 { return NewConstHasher(1) }
+	WithViewPartitions(1, 2)(v.opts)
+
+	tm.EXPECT().Partitions(tableName(group)).Return([]int32{0, 1, 2}, nil)
+	tm.EXPECT().Close()
+	err := v.createPartitions(nil)
+	ensure.Nil(t, err)
+	ensure.True(t, v.partitions[0] == nil)
+	ensure.True(t, v.partitions[1] != nil)
+	ensure.True(t, v.partitions[2] != nil)
+
+	// keys of materialized partitions can be read
+	ensure.Nil(t, v.partitions[1].st.Set("key", []byte("value")))
+	val, err := v.Get("key")
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, val, "value")
+
+	it, err := v.Iterator()
+	ensure.Nil(t, err)
+	ensure.True(t, it.Next())
+	ensure.DeepEqual(t, it.Key(), "key")
+	ensure.False(t, it.Next())
+	it.Release()
+
+	// keys of other partitions cannot
+	v.opts.hasher = func() hash.Hash32 { return NewConstHasher(0) }
+	_, err = v.Get("key")
+	ensure.NotNil(t, err)
+
+	// selected partitions must exist
+	v = createTestView(t, consumer, storage.MemoryBuilder(), tm)
+	WithViewPartitions(3)(v.opts)
+	tm.EXPECT().Partitions(tableName(group)).Return([]int32{0, 1, 2}, nil)
+	tm.EXPECT().Close()
+	err = v.createPartitions(nil)
+	ensure.NotNil(t, err)
+}
+
+func TestView_GetWithStaleness(t *testing.T) {
+	var (
+		st1 = storage.NewMemory()
+		v   = &View{
+			partitions: []*partition{
+				{st: &storageProxy{partition: 0, Storage: storage.NewMemory()}},
+				{st: &storageProxy{partition: 1, Storage: st1}},
+			},
+			opts: &voptions{
+				hasher: func() hash.Hash32 {
+					return NewConstHasher(1)
+				},
+				tableCodec: new(codec.String),
+			},
+		}
+	)
+	ensure.Nil(t, st1.Set("key", []byte("value")))
+
+	val, stale, err := v.GetWithStaleness("key")
+	ensure.Nil(t, err)
+	ensure.True(t, stale)
+	ensure.DeepEqual(t, val, "value")
+	ensure.False(t, v.PartitionRecovered(1))
+
+	// partition 1 caught up while partition 0 is still recovering
+	v.partitions[1].recoveredFlag = 1
+	val, stale, err = v.GetWithStaleness("key")
+	ensure.Nil(t, err)
+	ensure.False(t, stale)
+	ensure.DeepEqual(t, val, "value")
+	ensure.True(t, v.PartitionRecovered(1))
+	ensure.False(t, v.PartitionRecovered(0))
+	ensure.False(t, v.Recovered())
+}
+
+func TestView_Snapshot(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "goka_TestView_Snapshot")
+	ensure.Nil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	v := &View{opts: &voptions{
+		tableCodec:     new(codec.String),
+		updateCallback: DefaultUpdate,
+	}}
+	for i := int32(0); i < 2; i++ {
+		st, err := storage.DefaultBuilder(tmpdir)("table", i)
+		ensure.Nil(t, err)
+		ensure.Nil(t, st.MarkRecovered())
+		defer st.Close()
+		v.partitions = append(v.partitions, &partition{
+			st: &storageProxy{partition: i, Storage: st, update: v.update},
+		})
+	}
+
+	ensure.Nil(t, v.partitions[0].st.Update("a", []byte("a1")))
+	ensure.Nil(t, v.partitions[1].st.Update("b", []byte("b1")))
+
+	it, err := v.Snapshot()
+	ensure.Nil(t, err)
+	defer it.Release()
+
+	// updates after the snapshot are not visible
+	ensure.Nil(t, v.partitions[0].st.Update("a", []byte("a2")))
+	ensure.Nil(t, v.partitions[1].st.Update("c", []byte("c1")))
+
+	values := make(map[string]interface{})
+	for it.Next() {
+		val, err := it.Value()
+		ensure.Nil(t, err)
+		values[it.Key()] = val
+	}
+	ensure.DeepEqual(t, values, map[string]interface{}{"a": "a1", "b": "b1"})
+}
+
 func doTimed(t *testing.T, do func()) error {
 	ch := make(chan bool)
 	go func() {
@@ -541,3 +1059,362 @@ func ExampleView_simple() {
 		panic(err)
 	}
 }
+
+func TestView_Lazy(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var (
+		consumer    = mock.NewMockConsumer(ctrl)
+		tm          = mock.NewMockTopicManager(ctrl)
+		v           = createTestView(t, consumer, storage.MemoryBuilder(), tm)
+		events      = make(chan kafka.Event)
+		final       = make(chan bool)
+		ctx, cancel = context.WithCancel(context.Background())
+	)
+	v.opts.hasher = func() hash.Hash32 { return NewConstHasher(1) }
+	v.lazy = new(lazyPartitions)
+
+	tm.EXPECT().Partitions(tableName(group)).Return([]int32{0, 1}, nil)
+	tm.EXPECT().Close()
+	err := v.createPartitions(nil)
+	ensure.Nil(t, err)
+
+	// lookups fail while the view is not running
+	_, err = v.Get("key")
+	ensure.NotNil(t, err)
+
+	// only partition 1 is ever added to the consumer
+	consumer.EXPECT().Events().Return(events).AnyTimes()
+	consumer.EXPECT().AddPartition(tableName(group), int32(1), int64(-2)).Do(func(string, int32, int64) {
+		go func() {
+			events <- &kafka.BOF{Topic: tableName(group), Partition: 1, Offset: 0, Hwm: 1}
+			events <- &kafka.Message{Topic: tableName(group), Partition: 1, Key: "key", Value: []byte("value"), Offset: 0}
+		}()
+	})
+	consumer.EXPECT().AddPartition(tableName(group), int32(1), int64(1))
+	consumer.EXPECT().RemovePartition(tableName(group), int32(1)).Times(2)
+	consumer.EXPECT().Close()
+
+	go func() {
+		err := v.Run(ctx)
+		ensure.Nil(t, err)
+		close(final)
+	}()
+
+	// nothing is recovered upfront
+	ensure.True(t, v.Recovered())
+	ensure.False(t, v.PartitionRecovered(1))
+
+	err = doTimed(t, func() {
+		var val interface{}
+		// retry until the view is running
+		for val, err = v.Get("key"); err != nil; val, err = v.Get("key") {
+			time.Sleep(time.Millisecond)
+		}
+		ensure.DeepEqual(t, val, "value")
+		ensure.True(t, v.PartitionRecovered(1))
+		ensure.False(t, v.PartitionRecovered(0))
+		ensure.True(t, v.Recovered())
+
+		cancel()
+		<-final
+	})
+	ensure.Nil(t, err)
+}
+
+func TestView_LazyTimeout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var (
+		consumer    = mock.NewMockConsumer(ctrl)
+		tm          = mock.NewMockTopicManager(ctrl)
+		v           = createTestView(t, consumer, storage.MemoryBuilder(), tm)
+		events      = make(chan kafka.Event)
+		final       = make(chan bool)
+		added       = make(chan bool)
+		ctx, cancel = context.WithCancel(context.Background())
+	)
+	v.opts.hasher = func() hash.Hash32 { return NewConstHasher(0) }
+	v.opts.lazyTimeout = 10 * time.Millisecond
+	v.lazy = new(lazyPartitions)
+
+	tm.EXPECT().Partitions(tableName(group)).Return([]int32{0}, nil)
+	tm.EXPECT().Close()
+	ensure.Nil(t, v.createPartitions(nil))
+	ensure.Nil(t, v.partitions[0].st.Set("key", []byte("old")))
+
+	// the partition never catches up
+	consumer.EXPECT().Events().Return(events).AnyTimes()
+	consumer.EXPECT().AddPartition(tableName(group), int32(0), int64(-2)).Do(func(string, int32, int64) {
+		close(added)
+	})
+	consumer.EXPECT().RemovePartition(tableName(group), int32(0))
+	consumer.EXPECT().Close()
+
+	go func() {
+		ensure.Nil(t, v.Run(ctx))
+		close(final)
+	}()
+
+	err := doTimed(t, func() {
+		var (
+			val   interface{}
+			stale bool
+			err   error
+		)
+		// retry until the view is running, stale lookups do not wait for the
+		// recovery
+		for val, stale, err = v.GetWithStaleness("key"); err != nil; val, stale, err = v.GetWithStaleness("key") {
+			time.Sleep(time.Millisecond)
+		}
+		ensure.True(t, stale)
+		ensure.DeepEqual(t, val, "old")
+		<-added
+
+		// lookups wait for the recovery at most the timeout
+		_, err = v.Get("key")
+		ensure.StringContains(t, err.Error(), "did not recover within")
+
+		cancel()
+		<-final
+	})
+	ensure.Nil(t, err)
+}
+
+func TestView_Backup(t *testing.T) {
+	var (
+		st0 = storage.NewMemory()
+		st1 = storage.NewMemory()
+		v   = &View{
+			topic: "table",
+			partitions: []*partition{
+				{st: &storageProxy{partition: 0, Storage: st0}},
+				{st: &storageProxy{partition: 1, Storage: st1}},
+			},
+			opts: &voptions{tableCodec: new(codec.String)},
+		}
+		buf bytes.Buffer
+	)
+	ensure.Nil(t, st0.Set("key-0", []byte("value-0")))
+	ensure.Nil(t, st0.SetOffset(10))
+	ensure.Nil(t, st1.Set("key-1", []byte("value-1")))
+
+	ensure.Nil(t, v.Backup(&buf))
+	ensure.True(t, strings.HasPrefix(buf.String(), backupMagic))
+	ensure.StringContains(t, buf.String(), "key-0")
+	ensure.StringContains(t, buf.String(), "value-1")
+	// the backup ends with an end record
+	ensure.DeepEqual(t, buf.Bytes()[buf.Len()-1], backupRecordEnd)
+
+	// restore into empty storages
+	var (
+		rst0 = storage.NewMemory()
+		rst1 = storage.NewMemory()
+		rv   = &View{
+			topic: "table",
+			partitions: []*partition{
+				{st: &storageProxy{partition: 0, Storage: rst0}},
+				{st: &storageProxy{partition: 1, Storage: rst1}},
+			},
+			opts: &voptions{tableCodec: new(codec.String)},
+		}
+		backup = buf.Bytes()
+	)
+	ensure.Nil(t, rv.Restore(bytes.NewReader(backup)))
+	value, err := rst0.Get("key-0")
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, value, []byte("value-0"))
+	value, err = rst1.Get("key-1")
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, value, []byte("value-1"))
+	offset, err := rst0.GetOffset(0)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, offset, int64(10))
+	offset, err = rst1.GetOffset(0)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, offset, int64(kafka.OffsetOldest))
+
+	// storages must be empty
+	err = rv.Restore(bytes.NewReader(backup))
+	ensure.NotNil(t, err)
+
+	// backups of other topics are rejected
+	rv.topic = "other"
+	err = rv.Restore(bytes.NewReader(backup))
+	ensure.StringContains(t, err.Error(), "cannot be restored")
+
+	// truncated backups fail
+	rv = &View{topic: "table", partitions: []*partition{{st: &storageProxy{Storage: storage.NewMemory()}}, nil}}
+	err = rv.Restore(bytes.NewReader(backup[:len(backup)-3]))
+	ensure.NotNil(t, err)
+}
+
+func TestView_BackupWrapped(t *testing.T) {
+	wrapped := func() storage.Storage {
+		encrypted := storage.NewEncrypted(storage.NewTTL(storage.NewMemory(), time.Hour), storage.StaticKey(make([]byte, 32)))
+		return storage.NewCached(encrypted, storage.CacheOptions{MaxDirty: 10})
+	}
+	newView := func(st storage.Storage) *View {
+		return &View{
+			topic:      "table",
+			partitions: []*partition{{st: &storageProxy{Storage: st}}},
+			opts:       &voptions{tableCodec: new(codec.String)},
+		}
+	}
+
+	// the values are read and restored through the wrappers, so the backup
+	// holds the plain values, including the writes not flushed by the cache
+	st := wrapped()
+	ensure.Nil(t, st.Set("key", []byte("value")))
+	ensure.Nil(t, st.SetOffset(10))
+	var buf bytes.Buffer
+	ensure.Nil(t, newView(st).Backup(&buf))
+	ensure.StringContains(t, buf.String(), "value")
+
+	restored := wrapped()
+	ensure.Nil(t, newView(restored).Restore(&buf))
+	value, err := restored.Get("key")
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, value, []byte("value"))
+	offset, err := restored.GetOffset(0)
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, offset, int64(10))
+}
+
+func TestView_Filter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var (
+		consumer = mock.NewMockConsumer(ctrl)
+		tm       = mock.NewMockTopicManager(ctrl)
+		v        = createTestView(t, consumer, storage.MemoryBuilder(), tm)
+	)
+	WithViewFilter(func(key string, value interface{}) bool {
+		return value.(string) == "active"
+	})(v.opts)
+
+	tm.EXPECT().Partitions(tableName(group)).Return([]int32{0}, nil)
+	tm.EXPECT().Close()
+	err := v.createPartitions(nil)
+	ensure.Nil(t, err)
+
+	st := v.partitions[0].st
+	ensure.Nil(t, st.Update("user:1", []byte("active")))
+	ensure.Nil(t, st.Update("user:2", []byte("inactive")))
+
+	val, err := v.Get("user:1")
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, val, "active")
+	val, err = v.Get("user:2")
+	ensure.Nil(t, err)
+	ensure.Nil(t, val)
+
+	// entries not matching anymore are removed
+	ensure.Nil(t, st.Update("user:1", []byte("inactive")))
+	val, err = v.Get("user:1")
+	ensure.Nil(t, err)
+	ensure.Nil(t, val)
+}
+
+func TestView_Projection(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var (
+		consumer = mock.NewMockConsumer(ctrl)
+		tm       = mock.NewMockTopicManager(ctrl)
+		v        = createTestView(t, consumer, storage.MemoryBuilder(), tm)
+	)
+	// store the length of the values only
+	v.opts.projection = func(key string, value interface{}) (interface{}, error) {
+		if value.(string) == "" {
+			return nil, nil
+		}
+		return int64(len(value.(string))), nil
+	}
+	v.opts.topicCodec = v.opts.tableCodec
+	v.opts.tableCodec = new(codec.Int64)
+
+	tm.EXPECT().Partitions(tableName(group)).Return([]int32{0}, nil)
+	tm.EXPECT().Close()
+	err := v.createPartitions(nil)
+	ensure.Nil(t, err)
+
+	st := v.partitions[0].st
+	ensure.Nil(t, st.Update("key", []byte("value")))
+	val, err := v.Get("key")
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, val, int64(5))
+
+	// nil projections delete the key
+	ensure.Nil(t, st.Update("key", []byte("")))
+	ok, err := v.Has("key")
+	ensure.Nil(t, err)
+	ensure.False(t, ok)
+
+	// projections require a codec
+	err = new(voptions).applyOptions("table",
+		WithViewStorageBuilder(storage.MemoryBuilder()),
+		WithViewProjection(v.opts.projection, nil),
+	)
+	ensure.NotNil(t, err)
+}
+
+func TestView_WaitRecovered(t *testing.T) {
+	v := &View{
+		partitions: []*partition{
+			{st: &storageProxy{partition: 0, Storage: storage.NewMemory()}},
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	ensure.DeepEqual(t, v.WaitRecovered(ctx), context.DeadlineExceeded)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		atomic.StoreInt32(&v.partitions[0].recoveredFlag, 1)
+	}()
+	err := doTimed(t, func() {
+		ensure.Nil(t, v.WaitRecovered(context.Background()))
+	})
+	ensure.Nil(t, err)
+}
+
+func TestView_Observer(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var (
+		consumer = mock.NewMockConsumer(ctrl)
+		tm       = mock.NewMockTopicManager(ctrl)
+		v        = createTestView(t, consumer, storage.MemoryBuilder(), tm)
+		infos    []*ViewUpdateInfo
+	)
+	WithViewObserver(ViewObserverFunc(func(info *ViewUpdateInfo) {
+		infos = append(infos, info)
+	}))(v.opts)
+
+	tm.EXPECT().Partitions(tableName(group)).Return([]int32{0}, nil)
+	tm.EXPECT().Close()
+	err := v.createPartitions(nil)
+	ensure.Nil(t, err)
+
+	err = v.partitions[0].storeEvent(&kafka.Message{
+		Topic:     tableName(group),
+		Partition: 0,
+		Key:       "key",
+		Value:     []byte("value"),
+		Offset:    3,
+		Timestamp: time.Now().Add(-time.Second),
+	})
+	ensure.Nil(t, err)
+
+	ensure.DeepEqual(t, len(infos), 1)
+	ensure.DeepEqual(t, infos[0].Key, "key")
+	ensure.DeepEqual(t, infos[0].Offset, int64(3))
+	ensure.True(t, infos[0].Latency >= time.Second)
+}
@@ -0,0 +1,88 @@
+package goka
+
+import (
+	"fmt"
+)
+
+// TypedView is a view whose values have type T. It saves the type assertions
+// of the values returned by Get and by the iterators of the view.
+type TypedView[T any] struct {
+	*View
+}
+
+// NewTypedView creates a view of table whose values are decoded by codec into
+// values of type T.
+func NewTypedView[T any](brokers []string, table Table, codec Codec, options ...ViewOption) (*TypedView[T], error) {
+	v, err := NewView(brokers, table, codec, options...)
+	if err != nil {
+		return nil, err
+	}
+	return &TypedView[T]{View: v}, nil
+}
+
+// Get returns the value of key. If the key does not exist, the zero value of T
+// is returned. An error is returned if the value has another type than T.
+func (v *TypedView[T]) Get(key string) (T, error) {
+	value, err := v.View.Get(key)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return castValue[T](key, value)
+}
+
+// Iterator returns an iterator over the state of the view.
+func (v *TypedView[T]) Iterator() (*TypedIterator[T], error) {
+	iter, err := v.View.Iterator()
+	if err != nil {
+		return nil, err
+	}
+	return &TypedIterator[T]{Iterator: iter}, nil
+}
+
+// IteratePrefix returns an iterator over all keys starting with prefix in
+// ascending order.
+func (v *TypedView[T]) IteratePrefix(prefix string) (*TypedIterator[T], error) {
+	iter, err := v.View.IteratePrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+	return &TypedIterator[T]{Iterator: iter}, nil
+}
+
+// IterateRange returns an iterator over all keys in the range [from, to) in
+// ascending order.
+func (v *TypedView[T]) IterateRange(from, to string) (*TypedIterator[T], error) {
+	iter, err := v.View.IterateRange(from, to)
+	if err != nil {
+		return nil, err
+	}
+	return &TypedIterator[T]{Iterator: iter}, nil
+}
+
+// TypedIterator iterates over the keys of a typed view.
+type TypedIterator[T any] struct {
+	Iterator
+}
+
+// Value returns the value of the current key.
+func (i *TypedIterator[T]) Value() (T, error) {
+	value, err := i.Iterator.Value()
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return castValue[T](i.Key(), value)
+}
+
+func castValue[T any](key string, value interface{}) (T, error) {
+	var zero T
+	if value == nil {
+		return zero, nil
+	}
+	v, ok := value.(T)
+	if !ok {
+		return zero, fmt.Errorf("value of key %s has type %T instead of %T", key, value, zero)
+	}
+	return v, nil
+}
@@ -0,0 +1,55 @@
+package goka
+
+import (
+	"hash"
+	"testing"
+
+	"github.com/lovoo/goka/codec"
+	"github.com/lovoo/goka/storage"
+
+	"github.com/facebookgo/ensure"
+)
+
+func TestTypedView(t *testing.T) {
+	var (
+		st = storage.NewMemory()
+		v  = &View{
+			partitions: []*partition{
+				{st: &storageProxy{partition: 0, Storage: st}},
+			},
+			opts: &voptions{
+				hasher: func() hash.Hash32 {
+					return NewConstHasher(0)
+				},
+				tableCodec: new(codec.Int64),
+			},
+		}
+	)
+	ensure.Nil(t, st.Set("a", []byte("1")))
+	ensure.Nil(t, st.Set("b", []byte("2")))
+
+	tv := &TypedView[int64]{View: v}
+	val, err := tv.Get("a")
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, val, int64(1))
+
+	// missing keys return the zero value
+	val, err = tv.Get("c")
+	ensure.Nil(t, err)
+	ensure.DeepEqual(t, val, int64(0))
+
+	it, err := tv.IteratePrefix("")
+	ensure.Nil(t, err)
+	var sum int64
+	for it.Next() {
+		val, err := it.Value()
+		ensure.Nil(t, err)
+		sum += val
+	}
+	it.Release()
+	ensure.DeepEqual(t, sum, int64(3))
+
+	// values of another type fail
+	_, err = (&TypedView[string]{View: v}).Get("a")
+	ensure.NotNil(t, err)
+}
@@ -0,0 +1,182 @@
+package goka
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/lovoo/goka/storage"
+)
+
+const defaultWatchBufferSize = 64
+
+// ViewUpdate is an update of a key of a view as delivered to watchers. Value is
+// nil if the key was deleted.
+type ViewUpdate struct {
+	Key   string
+	Value interface{}
+}
+
+type watcher struct {
+	key    string
+	prefix bool
+	ch     chan *ViewUpdate
+	done   <-chan struct{}
+	cancel context.CancelFunc
+}
+
+func (w *watcher) matches(key string) bool {
+	if w.prefix {
+		return strings.HasPrefix(key, w.key)
+	}
+	return key == w.key
+}
+
+// watchers keeps the watchers of a view.
+type watchers struct {
+	m  sync.RWMutex
+	ws map[*watcher]struct{}
+}
+
+func (ws *watchers) add(ctx context.Context, key string, prefix bool) <-chan *ViewUpdate {
+	ctx, cancel := context.WithCancel(ctx)
+	w := &watcher{
+		key:    key,
+		prefix: prefix,
+		ch:     make(chan *ViewUpdate, defaultWatchBufferSize),
+		done:   ctx.Done(),
+		cancel: cancel,
+	}
+
+	ws.m.Lock()
+	if ws.ws == nil {
+		ws.ws = make(map[*watcher]struct{})
+	}
+	ws.ws[w] = struct{}{}
+	ws.m.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		// notify holds the read lock while sending, so the channel is closed
+		// only once no update is sent anymore
+		ws.m.Lock()
+		delete(ws.ws, w)
+		ws.m.Unlock()
+		close(w.ch)
+	}()
+	return w.ch
+}
+
+// notify sends the update of key to all matching watchers. The value is
+// decoded only if some watcher matches. Watchers whose buffer is full are
+// disconnected instead of blocking the partition.
+func (ws *watchers) notify(key string, decode func() (interface{}, error)) error {
+	ws.m.RLock()
+	defer ws.m.RUnlock()
+
+	var update *ViewUpdate
+	for w := range ws.ws {
+		if !w.matches(key) {
+			continue
+		}
+		if update == nil {
+			value, err := decode()
+			if err != nil {
+				return err
+			}
+			update = &ViewUpdate{Key: key, Value: value}
+		}
+		select {
+		case <-w.done:
+			// disconnected, the channel is closed shortly
+			continue
+		default:
+		}
+		select {
+		case w.ch <- update:
+		default:
+			w.cancel()
+		}
+	}
+	return nil
+}
+
+// Watch returns a channel that receives the updates of key as the view
+// consumes them from the table topic. The channel is closed when ctx is done.
+// The channel is buffered. If the buffer is full, the watcher is disconnected
+// and the channel is closed after the buffered updates, so watchers have to
+// read the channel continuously and watch again to resume.
+func (v *View) Watch(ctx context.Context, key string) <-chan *ViewUpdate {
+	return v.watchers.add(ctx, key, false)
+}
+
+// WatchPrefix returns a channel that receives the updates of all keys starting
+// with prefix. Like Watch, the channel is closed when ctx is done.
+func (v *View) WatchPrefix(ctx context.Context, prefix string) <-chan *ViewUpdate {
+	return v.watchers.add(ctx, prefix, true)
+}
+
+// update calls the update callback of the view and notifies the watchers of the
+// key. Values are filtered and projected before they are stored.
+func (v *View) update(s storage.Storage, partition int32, key string, value []byte) error {
+	if (v.opts.filter != nil || v.opts.projection != nil) && value != nil {
+		var err error
+		if value, err = v.transform(key, value); err != nil {
+			return err
+		}
+	}
+
+	v.snapshotMu.RLock()
+	err := v.opts.updateCallback(s, partition, key, value)
+	if v.cache != nil {
+		v.cache.invalidate(key)
+	}
+	v.snapshotMu.RUnlock()
+	if err != nil {
+		return err
+	}
+	err = v.watchers.notify(key, func() (interface{}, error) {
+		if value == nil {
+			return nil, nil
+		}
+		return v.opts.tableCodec.Decode(value)
+	})
+	if err != nil {
+		v.opts.log.Printf("view: error decoding value of %s for watchers: %v", key, err)
+	}
+	return nil
+}
+
+// transform applies the filter and the projection of the view to the value of
+// a message of the table topic. It returns nil if the key has to be deleted.
+func (v *View) transform(key string, value []byte) ([]byte, error) {
+	codec := v.opts.topicCodec
+	if codec == nil {
+		codec = v.opts.tableCodec
+	}
+	decoded, err := codec.Decode(value)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding value of key %s: %v", key, err)
+	}
+
+	if v.opts.filter != nil && !v.opts.filter(key, decoded) {
+		// delete entries that do not match (anymore)
+		return nil, nil
+	}
+	if v.opts.projection == nil {
+		return value, nil
+	}
+
+	projected, err := v.opts.projection(key, decoded)
+	if err != nil {
+		return nil, fmt.Errorf("error projecting value of key %s: %v", key, err)
+	} else if projected == nil {
+		return nil, nil
+	}
+	data, err := v.opts.tableCodec.Encode(projected)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding projected value of key %s: %v", key, err)
+	}
+	return data, nil
+}
@@ -9,7 +9,7 @@ import (
 	"github.com/lovoo/goka/web/templates"
 )
 
-var baseTemplates = append(templates.BaseTemplates) // "web/templates/monitor/menu.go.html"
+var baseTemplates = templates.BaseTemplates // "web/templates/monitor/menu.go.html"
 
 type component struct {
 	Name     string
@@ -0,0 +1,186 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/lovoo/goka"
+	"github.com/lovoo/goka/logger"
+
+	"github.com/gorilla/mux"
+)
+
+const defaultPrefixLimit = 1000
+
+// Table is a table that can be queried by key and by key prefix. *goka.View
+// implements Table.
+type Table interface {
+	Get(key string) (interface{}, error)
+	IteratePrefix(prefix string) (goka.Iterator, error)
+}
+
+// TableOption is a function that applies a configuration to the table server.
+type TableOption func(s *TableServer)
+
+// WithTableLogger sets the logger to use. By default, it logs to the standard
+// library logger.
+func WithTableLogger(l logger.Logger) TableOption {
+	return func(s *TableServer) {
+		s.log = l
+	}
+}
+
+// WithPrefixLimit sets the maximum number of entries returned by a prefix
+// query. Defaults to 1000.
+func WithPrefixLimit(limit int) TableOption {
+	return func(s *TableServer) {
+		s.prefixLimit = limit
+	}
+}
+
+// TableServer provides a JSON API for querying tables. The values are decoded
+// with the codec of the table and returned as JSON:
+//
+//	GET <basePath>/table/{name}/{key}        returns the value of key
+//	GET <basePath>/table/{name}?prefix={p}   returns all entries with prefix p
+//
+// A prefix query accepts an optional limit parameter, which is capped by the
+// prefix limit of the server.
+type TableServer struct {
+	log logger.Logger
+	m   sync.RWMutex
+
+	basePath    string
+	prefixLimit int
+	tables      map[string]Table
+}
+
+// TableEntry is an entry of the result of a prefix query.
+type TableEntry struct {
+	Key   string      `json:"key"`
+	Value interface{} `json:"value"`
+}
+
+// NewTableServer creates a table server with the given options.
+func NewTableServer(basePath string, router *mux.Router, opts ...TableOption) *TableServer {
+	srv := &TableServer{
+		log:         logger.Default(),
+		basePath:    basePath,
+		prefixLimit: defaultPrefixLimit,
+		tables:      make(map[string]Table),
+	}
+
+	for _, opt := range opts {
+		opt(srv)
+	}
+
+	sub := router.PathPrefix(basePath).Subrouter()
+	sub.HandleFunc("/table/{name}", srv.prefix).Methods(http.MethodGet)
+	sub.HandleFunc("/table/{name}/{key:.*}", srv.key).Methods(http.MethodGet)
+
+	return srv
+}
+
+// BasePath returns the base path of the server.
+func (s *TableServer) BasePath() string {
+	return s.basePath
+}
+
+// AttachTable attaches a new table, eg, a view, to the table server.
+func (s *TableServer) AttachTable(name string, table Table) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if _, exists := s.tables[name]; exists {
+		return fmt.Errorf("table with name '%s' is already attached", name)
+	}
+	s.tables[name] = table
+	return nil
+}
+
+func (s *TableServer) table(name string) Table {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	return s.tables[name]
+}
+
+func (s *TableServer) key(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	table := s.table(vars["name"])
+	if table == nil {
+		s.error(w, http.StatusNotFound, fmt.Errorf("table '%s' not found", vars["name"]))
+		return
+	}
+
+	key := vars["key"]
+	value, err := table.Get(key)
+	if err != nil {
+		s.error(w, http.StatusInternalServerError, fmt.Errorf("error getting key: %v", err))
+		return
+	}
+	if value == nil {
+		s.error(w, http.StatusNotFound, fmt.Errorf("key '%s' not found", key))
+		return
+	}
+
+	s.write(w, http.StatusOK, &TableEntry{Key: key, Value: value})
+}
+
+func (s *TableServer) prefix(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	table := s.table(name)
+	if table == nil {
+		s.error(w, http.StatusNotFound, fmt.Errorf("table '%s' not found", name))
+		return
+	}
+
+	limit := s.prefixLimit
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 {
+			s.error(w, http.StatusBadRequest, fmt.Errorf("invalid limit '%s'", l))
+			return
+		}
+		if n < limit {
+			limit = n
+		}
+	}
+
+	iter, err := table.IteratePrefix(r.URL.Query().Get("prefix"))
+	if err != nil {
+		s.error(w, http.StatusInternalServerError, fmt.Errorf("error iterating table: %v", err))
+		return
+	}
+	defer iter.Release()
+
+	entries := []*TableEntry{}
+	for len(entries) < limit && iter.Next() {
+		value, err := iter.Value()
+		if err != nil {
+			s.error(w, http.StatusInternalServerError, fmt.Errorf("error getting value of key %s: %v", iter.Key(), err))
+			return
+		}
+		entries = append(entries, &TableEntry{Key: iter.Key(), Value: value})
+	}
+
+	s.write(w, http.StatusOK, entries)
+}
+
+func (s *TableServer) error(w http.ResponseWriter, status int, err error) {
+	s.write(w, status, map[string]string{"error": err.Error()})
+}
+
+func (s *TableServer) write(w http.ResponseWriter, status int, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error marshaling response: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, err := w.Write(data); err != nil {
+		s.log.Printf("error writing response: %v", err)
+	}
+}
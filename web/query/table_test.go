@@ -0,0 +1,108 @@
+package query
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lovoo/goka"
+	"github.com/lovoo/goka/codec"
+	"github.com/lovoo/goka/storage"
+
+	"github.com/facebookgo/ensure"
+	"github.com/gorilla/mux"
+)
+
+// table is a Table backed by a memory storage.
+type table struct {
+	st storage.Storage
+}
+
+func (t *table) Get(key string) (interface{}, error) {
+	if key == "failing" {
+		return nil, errors.New("some error")
+	}
+	data, err := t.st.Get(key)
+	if err != nil || data == nil {
+		return nil, err
+	}
+	return new(codec.String).Decode(data)
+}
+
+func (t *table) IteratePrefix(prefix string) (goka.Iterator, error) {
+	iter, err := t.st.IteratorWithRange([]byte(prefix), nil)
+	if err != nil {
+		return nil, err
+	}
+	return goka.NewIterator(iter, new(codec.String)), nil
+}
+
+func newTableServer(t *testing.T) *httptest.Server {
+	st := storage.NewMemory()
+	for _, key := range []string{"user:1", "user:2", "user:3", "group:1"} {
+		ensure.Nil(t, st.Set(key, []byte("value-"+key)))
+	}
+
+	router := mux.NewRouter()
+	srv := NewTableServer("/api", router, WithPrefixLimit(2))
+	ensure.Nil(t, srv.AttachTable("users", &table{st: st}))
+	ensure.NotNil(t, srv.AttachTable("users", &table{st: st}))
+	return httptest.NewServer(router)
+}
+
+func get(t *testing.T, url string, v interface{}) int {
+	resp, err := http.Get(url)
+	ensure.Nil(t, err)
+	defer resp.Body.Close()
+	ensure.DeepEqual(t, resp.Header.Get("Content-Type"), "application/json")
+	ensure.Nil(t, json.NewDecoder(resp.Body).Decode(v))
+	return resp.StatusCode
+}
+
+func TestTableServer_key(t *testing.T) {
+	ts := newTableServer(t)
+	defer ts.Close()
+
+	var entry TableEntry
+	ensure.DeepEqual(t, get(t, ts.URL+"/api/table/users/user:1", &entry), http.StatusOK)
+	ensure.DeepEqual(t, entry, TableEntry{Key: "user:1", Value: "value-user:1"})
+
+	var errResp map[string]string
+	ensure.DeepEqual(t, get(t, ts.URL+"/api/table/users/user:4", &errResp), http.StatusNotFound)
+	ensure.StringContains(t, errResp["error"], "key 'user:4' not found")
+
+	ensure.DeepEqual(t, get(t, ts.URL+"/api/table/groups/group:1", &errResp), http.StatusNotFound)
+	ensure.StringContains(t, errResp["error"], "table 'groups' not found")
+
+	ensure.DeepEqual(t, get(t, ts.URL+"/api/table/users/failing", &errResp), http.StatusInternalServerError)
+	ensure.StringContains(t, errResp["error"], "some error")
+}
+
+func TestTableServer_prefix(t *testing.T) {
+	ts := newTableServer(t)
+	defer ts.Close()
+
+	// the number of entries is capped by the prefix limit of the server
+	var entries []TableEntry
+	ensure.DeepEqual(t, get(t, ts.URL+"/api/table/users?prefix=user:", &entries), http.StatusOK)
+	ensure.DeepEqual(t, entries, []TableEntry{
+		{Key: "user:1", Value: "value-user:1"},
+		{Key: "user:2", Value: "value-user:2"},
+	})
+
+	entries = nil
+	ensure.DeepEqual(t, get(t, ts.URL+"/api/table/users?prefix=user:&limit=1", &entries), http.StatusOK)
+	ensure.DeepEqual(t, entries, []TableEntry{{Key: "user:1", Value: "value-user:1"}})
+
+	entries = nil
+	ensure.DeepEqual(t, get(t, ts.URL+"/api/table/users?prefix=unknown:", &entries), http.StatusOK)
+	ensure.DeepEqual(t, entries, []TableEntry{})
+
+	var errResp map[string]string
+	for _, limit := range []string{"abc", "0", "-1"} {
+		ensure.DeepEqual(t, get(t, ts.URL+"/api/table/users?prefix=user:&limit="+limit, &errResp), http.StatusBadRequest)
+		ensure.StringContains(t, errResp["error"], "invalid limit")
+	}
+}